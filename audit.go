@@ -0,0 +1,380 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type auditSource string
+
+const (
+	AuditSourceAPI          auditSource = "api"
+	AuditSourceImport       auditSource = "import"
+	AuditSourceMassTransfer auditSource = "mass_transfer"
+	AuditSourceGeminiTool   auditSource = "gemini_tool"
+	AuditSourceCLI          auditSource = "cli"
+	AuditSourcePurge        auditSource = "purge"
+)
+
+type AuditEvent struct {
+	ID         int64                  `json:"id"`
+	OccurredAt time.Time              `json:"occurred_at"`
+	Actor      *string                `json:"actor"`
+	Source     string                 `json:"source"`
+	Entity     string                 `json:"entity"`
+	EntityID   string                 `json:"entity_id"`
+	PanelNoPp  *string                `json:"panel_no_pp"`
+	Action     string                 `json:"action"`
+	Changes    map[string]auditChange `json:"changes"`
+}
+
+type auditChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+type auditEntity struct {
+	Table     string
+	IDExpr    string
+	PanelExpr string
+}
+
+// auditEntities mendaftarkan tabel yang dicatat di audit_events. Alias "t"
+// dipakai di IDExpr, PanelExpr dan klausa where milik pemanggil.
+var auditEntities = map[string]auditEntity{
+	"panel":     {"panels", "t.no_pp", "t.no_pp"},
+	"busbar":    {"busbars", "t.panel_no_pp || '/' || t.vendor", "t.panel_no_pp"},
+	"component": {"components", "t.panel_no_pp || '/' || t.vendor", "t.panel_no_pp"},
+	"palet":     {"palet", "t.panel_no_pp || '/' || t.vendor", "t.panel_no_pp"},
+	"corepart":  {"corepart", "t.panel_no_pp || '/' || t.vendor", "t.panel_no_pp"},
+	"g3_vendor": {"g3_vendors", "t.panel_no_pp || '/' || t.vendor", "t.panel_no_pp"},
+	"wiring":    {"wirings", "t.id::text", "t.panel_no_pp"},
+	"project":   {"projects", "t.id::text", "NULL::text"},
+	"wbs":       {"wbs_elements", "t.id::text", "NULL::text"},
+}
+
+// Kolom yang berubah sebagai efek samping dan tidak perlu masuk diff.
+var auditIgnoredFields = map[string]bool{
+	"history_stack": true,
+	"updated_at":    true,
+	"version":       true,
+}
+
+type auditRow struct {
+	PanelNoPp sql.NullString
+	Data      map[string]interface{}
+}
+
+type auditScope struct {
+	entity string
+	where  string
+	args   []interface{}
+	before map[string]auditRow
+	failed bool
+}
+
+func auditSnapshot(db DBTX, entity, where string, args ...interface{}) (map[string]auditRow, error) {
+	e, ok := auditEntities[entity]
+	if !ok {
+		return nil, fmt.Errorf("entity audit tidak dikenal: %s", entity)
+	}
+	rows, err := db.Query(fmt.Sprintf("SELECT %s, %s, row_to_json(t) FROM %s t WHERE %s", e.IDExpr, e.PanelExpr, e.Table, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshot := map[string]auditRow{}
+	for rows.Next() {
+		var id string
+		var row auditRow
+		var raw []byte
+		if err := rows.Scan(&id, &row.PanelNoPp, &raw); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &row.Data); err != nil {
+			return nil, err
+		}
+		snapshot[id] = row
+	}
+	return snapshot, rows.Err()
+}
+
+// withAuditSavepoint menjalankan fn di dalam SAVEPOINT bila db adalah
+// transaksi. Statement yang gagal di Postgres membatalkan seluruh transaksi,
+// jadi tanpa savepoint kegagalan audit ikut menggagalkan Commit data bisnis.
+func withAuditSavepoint(db DBTX, fn func() error) error {
+	tx, ok := db.(*sql.Tx)
+	if !ok {
+		return fn()
+	}
+	if _, err := tx.Exec("SAVEPOINT audit"); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		if _, rbErr := tx.Exec("ROLLBACK TO SAVEPOINT audit"); rbErr != nil {
+			return fmt.Errorf("%v (rollback savepoint: %w)", err, rbErr)
+		}
+		return err
+	}
+	_, err := tx.Exec("RELEASE SAVEPOINT audit")
+	return err
+}
+
+// beginAudit mengambil snapshot baris sebelum diubah. Panggil record setelah
+// perubahan selesai (di transaksi yang sama bila ada) untuk menyimpan diff.
+// Kegagalan audit hanya di-log dan tidak menggagalkan perubahan data; di
+// dalam transaksi statement audit dibungkus savepoint (withAuditSavepoint).
+func beginAudit(db DBTX, entity, where string, args ...interface{}) *auditScope {
+	s := &auditScope{entity: entity, where: where, args: args}
+	var before map[string]auditRow
+	err := withAuditSavepoint(db, func() (err error) {
+		before, err = auditSnapshot(db, entity, where, args...)
+		return err
+	})
+	if err != nil {
+		log.Printf("Audit: gagal mengambil snapshot %s: %v", entity, err)
+		s.failed = true
+	}
+	s.before = before
+	return s
+}
+
+func (s *auditScope) record(db DBTX, actor string, source auditSource) {
+	s.recordWhere(db, actor, source, false, s.where, s.args...)
+}
+
+// recordRenamed dipakai saat primary key berubah (misalnya ganti No PP),
+// sehingga baris sesudah perubahan dicari dengan klausa where yang baru.
+// Perubahan satu baris ke satu baris dicatat sebagai update, bukan hapus+buat.
+func (s *auditScope) recordRenamed(db DBTX, actor string, source auditSource, where string, args ...interface{}) {
+	s.recordWhere(db, actor, source, true, where, args...)
+}
+
+func (s *auditScope) recordWhere(db DBTX, actor string, source auditSource, renamed bool, where string, args ...interface{}) {
+	if s.failed {
+		return
+	}
+	err := withAuditSavepoint(db, func() error {
+		return s.writeEvents(db, actor, source, renamed, where, args...)
+	})
+	if err != nil {
+		log.Printf("Audit: gagal mencatat %s: %v", s.entity, err)
+	}
+}
+
+func (s *auditScope) writeEvents(db DBTX, actor string, source auditSource, renamed bool, where string, args ...interface{}) error {
+	after, err := auditSnapshot(db, s.entity, where, args...)
+	if err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+
+	before := s.before
+	if renamed && len(before) == 1 && len(after) == 1 {
+		var oldID, newID string
+		for id := range before {
+			oldID = id
+		}
+		for id := range after {
+			newID = id
+		}
+		before = map[string]auditRow{newID: before[oldID]}
+	}
+
+	for id, a := range after {
+		b, existed := before[id]
+		action, changes := "update", diffAuditRows(b.Data, a.Data)
+		if !existed {
+			action = "create"
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		if err := s.insert(db, actor, source, id, a.PanelNoPp, action, changes); err != nil {
+			return err
+		}
+	}
+	for id, b := range before {
+		if _, ok := after[id]; ok {
+			continue
+		}
+		if err := s.insert(db, actor, source, id, b.PanelNoPp, "delete", diffAuditRows(b.Data, nil)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *auditScope) insert(db DBTX, actor string, source auditSource, entityID string, panelNoPp sql.NullString, action string, changes map[string]auditChange) error {
+	payload, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Errorf("encode perubahan %s: %w", entityID, err)
+	}
+	var actorArg interface{}
+	if actor != "" {
+		actorArg = actor
+	}
+	_, err = db.Exec(`
+		INSERT INTO audit_events (actor, source, entity, entity_id, panel_no_pp, action, changes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		actorArg, string(source), s.entity, entityID, panelNoPp, action, payload)
+	if err != nil {
+		return fmt.Errorf("simpan event %s: %w", entityID, err)
+	}
+	return nil
+}
+
+func diffAuditRows(before, after map[string]interface{}) map[string]auditChange {
+	changes := map[string]auditChange{}
+	for k, v := range after {
+		if auditIgnoredFields[k] {
+			continue
+		}
+		if old := before[k]; !reflect.DeepEqual(old, v) {
+			changes[k] = auditChange{From: old, To: v}
+		}
+	}
+	for k, v := range before {
+		if auditIgnoredFields[k] {
+			continue
+		}
+		if _, ok := after[k]; !ok && v != nil {
+			changes[k] = auditChange{From: v, To: nil}
+		}
+	}
+	return changes
+}
+
+// renameAuditPanel memindahkan jejak audit ke No PP yang baru supaya riwayat
+// panel tetap utuh setelah ganti No PP.
+func renameAuditPanel(db DBTX, oldNoPp, newNoPp string) {
+	if oldNoPp == newNoPp {
+		return
+	}
+	if _, err := db.Exec("UPDATE audit_events SET panel_no_pp = $1 WHERE panel_no_pp = $2", newNoPp, oldNoPp); err != nil {
+		log.Printf("Audit: gagal memindahkan riwayat %s ke %s: %v", oldNoPp, newNoPp, err)
+	}
+	if _, err := db.Exec("UPDATE wiring_progress_events SET panel_no_pp = $1 WHERE panel_no_pp = $2", newNoPp, oldNoPp); err != nil {
+		log.Printf("Audit: gagal memindahkan riwayat wiring %s ke %s: %v", oldNoPp, newNoPp, err)
+	}
+}
+
+func (a *App) queryAuditEvents(w http.ResponseWriter, r *http.Request, panelNoPp string) {
+	q := r.URL.Query()
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if panelNoPp != "" {
+		where = append(where, "panel_no_pp = "+arg(panelNoPp))
+	} else if v := q.Get("panel_no_pp"); v != "" {
+		where = append(where, "panel_no_pp = "+arg(v))
+	}
+	for _, key := range []string{"entity", "entity_id", "actor", "source", "action"} {
+		if v := q.Get(key); v != "" {
+			where = append(where, key+" = "+arg(v))
+		}
+	}
+	if v := q.Get("field"); v != "" {
+		where = append(where, "changes ? "+arg(v))
+	}
+	from, err := parseDateParam(q.Get("from"), false)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Format tanggal 'from' tidak valid")
+		return
+	}
+	if from != nil {
+		where = append(where, "occurred_at >= "+arg(*from))
+	}
+	to, err := parseDateParam(q.Get("to"), true)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Format tanggal 'to' tidak valid")
+		return
+	}
+	if to != nil {
+		where = append(where, "occurred_at < "+arg(*to))
+	}
+
+	limit, offset := 100, 0
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			respondWithError(w, http.StatusBadRequest, "limit harus berupa angka positif")
+			return
+		}
+		if limit > 1000 {
+			limit = 1000
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			respondWithError(w, http.StatusBadRequest, "offset tidak valid")
+			return
+		}
+	}
+
+	whereSQL := ""
+	if len(where) > 0 {
+		whereSQL = "WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := a.DB.QueryRow("SELECT COUNT(*) FROM audit_events "+whereSQL, args...).Scan(&total); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menghitung audit: "+err.Error())
+		return
+	}
+
+	rows, err := a.DB.Query(`
+		SELECT id, occurred_at, actor, source, entity, entity_id, panel_no_pp, action, changes
+		FROM audit_events `+whereSQL+`
+		ORDER BY occurred_at DESC, id DESC
+		LIMIT `+arg(limit)+` OFFSET `+arg(offset), args...)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil audit: "+err.Error())
+		return
+	}
+	defer rows.Close()
+
+	events := []AuditEvent{}
+	for rows.Next() {
+		var ev AuditEvent
+		var changes []byte
+		if err := rows.Scan(&ev.ID, &ev.OccurredAt, &ev.Actor, &ev.Source, &ev.Entity, &ev.EntityID, &ev.PanelNoPp, &ev.Action, &changes); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal membaca audit: "+err.Error())
+			return
+		}
+		json.Unmarshal(changes, &ev.Changes)
+		events = append(events, ev)
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	respondWithJSON(w, http.StatusOK, events)
+}
+
+func (a *App) getPanelAuditHandler(w http.ResponseWriter, r *http.Request) {
+	a.queryAuditEvents(w, r, mux.Vars(r)["no_pp"])
+}
+
+func (a *App) getAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	a.queryAuditEvents(w, r, "")
+}
+
+func auditEntityForTable(table string) (string, bool) {
+	for name, e := range auditEntities {
+		if e.Table == table {
+			return name, true
+		}
+	}
+	return "", false
+}
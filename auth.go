@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type contextKey string
+
+const identityContextKey contextKey = "identity"
+
+// Identity adalah user yang sedang login, diambil dari session token
+// oleh authMiddleware. Handler tidak boleh lagi membaca role/username
+// dari query string atau body.
+type Identity struct {
+	Username    string `json:"username"`
+	CompanyID   string `json:"company_id"`
+	CompanyName string `json:"company_name"`
+	Role        string `json:"role"`
+	SessionID   string `json:"-"`
+}
+
+type sessionTokens struct {
+	AccessToken      string    `json:"access_token"`
+	RefreshToken     string    `json:"refresh_token"`
+	TokenType        string    `json:"token_type"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+type loginResponse struct {
+	Company
+	Username string `json:"username"`
+	sessionTokens
+}
+
+// Route yang boleh diakses tanpa token.
+var publicPaths = map[string]bool{
+	"/login":         true,
+	"/token/refresh": true,
+}
+
+func identityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityContextKey).(Identity)
+	return id, ok
+}
+
+func requestIdentity(r *http.Request) Identity {
+	id, _ := identityFromContext(r.Context())
+	return id
+}
+
+func tokenTTL(envKey string, fallback time.Duration) time.Duration {
+	if raw := os.Getenv(envKey); raw != "" {
+		if d, err := time.ParseDuration(raw); err == nil && d > 0 {
+			return d
+		}
+		log.Printf("Nilai %s tidak valid (%q), memakai default %s", envKey, raw, fallback)
+	}
+	return fallback
+}
+
+func newOpaqueToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newSessionTokens() (sessionTokens, error) {
+	access, err := newOpaqueToken()
+	if err != nil {
+		return sessionTokens{}, err
+	}
+	refresh, err := newOpaqueToken()
+	if err != nil {
+		return sessionTokens{}, err
+	}
+	now := time.Now()
+	return sessionTokens{
+		AccessToken:      access,
+		RefreshToken:     refresh,
+		TokenType:        "Bearer",
+		ExpiresAt:        now.Add(tokenTTL("ACCESS_TOKEN_TTL", time.Hour)),
+		RefreshExpiresAt: now.Add(tokenTTL("REFRESH_TOKEN_TTL", 30*24*time.Hour)),
+	}, nil
+}
+
+func (a *App) createSession(username, userAgent string) (sessionTokens, error) {
+	tokens, err := newSessionTokens()
+	if err != nil {
+		return sessionTokens{}, err
+	}
+	_, err = a.DB.Exec(`
+		INSERT INTO sessions (id, username, access_token_hash, refresh_token_hash, access_expires_at, refresh_expires_at, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		uuid.New().String(), username, hashToken(tokens.AccessToken), hashToken(tokens.RefreshToken),
+		tokens.ExpiresAt, tokens.RefreshExpiresAt, userAgent)
+	if err != nil {
+		return sessionTokens{}, err
+	}
+	return tokens, nil
+}
+
+func (a *App) revokeSessionsForUser(db DBTX, username, exceptSessionID string) error {
+	_, err := db.Exec(
+		"UPDATE sessions SET revoked_at = NOW() WHERE username = $1 AND id <> $2 AND revoked_at IS NULL",
+		username, exceptSessionID)
+	return err
+}
+
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+func (a *App) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Gambar di /uploads dimuat langsung oleh widget image di aplikasi
+		// sehingga tetap publik; nama file-nya berupa UUID acak. Feed /ics
+		// diambil oleh aplikasi kalender dan diotorisasi oleh token di URL.
+		if r.Method == http.MethodOptions || publicPaths[r.URL.Path] || strings.HasPrefix(r.URL.Path, "/uploads/") || strings.HasPrefix(r.URL.Path, "/ics/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := bearerToken(r)
+		if token == "" {
+			respondWithError(w, http.StatusUnauthorized, "Token tidak ditemukan")
+			return
+		}
+
+		var id Identity
+		err := a.DB.QueryRow(`
+			SELECT s.id, s.username, c.id, c.name, c.role
+			FROM sessions s
+			JOIN company_accounts ca ON ca.username = s.username
+			JOIN companies c ON c.id = ca.company_id
+			WHERE s.access_token_hash = $1
+			  AND s.revoked_at IS NULL
+			  AND s.access_expires_at > NOW()`, hashToken(token)).
+			Scan(&id.SessionID, &id.Username, &id.CompanyID, &id.CompanyName, &id.Role)
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusUnauthorized, "Token tidak valid atau sudah kedaluwarsa")
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal memvalidasi token: "+err.Error())
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityContextKey, id)))
+	})
+}
+
+func (a *App) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	id := requestIdentity(r)
+	var payload struct {
+		AllDevices bool `json:"all_devices"`
+	}
+	// Body opsional; logout tanpa body hanya mencabut session saat ini.
+	json.NewDecoder(r.Body).Decode(&payload)
+
+	var err error
+	if payload.AllDevices {
+		err = a.revokeSessionsForUser(a.DB, id.Username, "")
+	} else {
+		_, err = a.DB.Exec("UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL", id.SessionID)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal logout: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+func (a *App) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.RefreshToken == "" {
+		respondWithError(w, http.StatusBadRequest, "refresh_token wajib diisi")
+		return
+	}
+
+	tokens, err := newSessionTokens()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal membuat token: "+err.Error())
+		return
+	}
+
+	// Refresh token di-rotate: token lama langsung tidak berlaku lagi.
+	res, err := a.DB.Exec(`
+		UPDATE sessions SET
+			access_token_hash = $1, refresh_token_hash = $2,
+			access_expires_at = $3, refresh_expires_at = $4,
+			last_used_at = NOW()
+		WHERE refresh_token_hash = $5
+		  AND revoked_at IS NULL
+		  AND refresh_expires_at > NOW()`,
+		hashToken(tokens.AccessToken), hashToken(tokens.RefreshToken),
+		tokens.ExpiresAt, tokens.RefreshExpiresAt, hashToken(payload.RefreshToken))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memperbarui session: "+err.Error())
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusUnauthorized, "Refresh token tidak valid atau sudah kedaluwarsa")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, tokens)
+}
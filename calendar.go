@@ -0,0 +1,676 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // zona waktu tetap tersedia di image tanpa tzdata
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Kalender hari kerja (lihat migrasi 0012_calendars). Semua kalender dimuat
+// ke memori saat start dan setiap kali diubah, sehingga today(), lead time
+// produksi dan perhitungan keterlambatan tidak perlu query. Replika lain
+// mendapat kabar perubahan lewat NOTIFY calendar_changed (migrasi 0020).
+
+const defaultCalendarTimeZone = "Asia/Jakarta"
+
+// Kondisi SQL untuk panel (alias p) berdasarkan tanggal lokal kalender
+// default, bukan jam server.
+const (
+	panelLocalTargetDate  = `calendar_date(NULL, p.target_delivery)`
+	panelLocalToday       = `calendar_date(NULL, NOW())`
+	panelOverdueCondition = `COALESCE(p.is_closed, false) = false AND ` + panelLocalTargetDate + ` < ` + panelLocalToday
+	// panelDueSoonCondition: jatuh tempo hari ini sampai 5 hari kerja ke depan.
+	panelDueSoonCondition = `COALESCE(p.is_closed, false) = false AND ` + panelLocalTargetDate + ` BETWEEN ` + panelLocalToday +
+		` AND add_working_days(NULL, ` + panelLocalToday + `, 5)`
+)
+
+var calendarDayKinds = map[string]bool{"holiday": true, "shutdown": true, "working": true}
+
+type workCalendar struct {
+	ID          int
+	Name        string
+	TimeZone    string
+	WorkingDays []int
+	loc         *time.Location
+	workdays    [8]bool           // indeks ISO day of week
+	days        map[string]string // "2006-01-02" -> kind
+}
+
+func newWorkCalendar(id int, name, tz string, workingDays []int) *workCalendar {
+	c := &workCalendar{ID: id, Name: name, TimeZone: tz, WorkingDays: workingDays, days: map[string]string{}}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		log.Printf("Calendar: zona waktu %q tidak dikenal, memakai %s", tz, defaultCalendarTimeZone)
+		loc, _ = time.LoadLocation(defaultCalendarTimeZone)
+	}
+	c.loc = loc
+	for _, d := range workingDays {
+		if d >= 1 && d <= 7 {
+			c.workdays[d] = true
+		}
+	}
+	return c
+}
+
+// builtinCalendar dipakai sebelum kalender dimuat atau bila tabelnya kosong.
+var builtinCalendar = newWorkCalendar(0, "Default", defaultCalendarTimeZone, []int{1, 2, 3, 4, 5})
+
+var calendarRegistry = struct {
+	sync.RWMutex
+	byID      map[int]*workCalendar
+	defaultID int
+	company   map[string]int
+}{byID: map[int]*workCalendar{}, company: map[string]int{}}
+
+// loadCalendars memuat ulang semua kalender, pengecualian tanggal dan
+// pemetaan company ke kalender.
+func loadCalendars(db DBTX) error {
+	byID := map[int]*workCalendar{}
+	defaultID := 0
+	rows, err := db.Query(`SELECT id, name, timezone, working_days, is_default FROM calendars`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int
+		var name, tz string
+		var workingDays []int64
+		var isDefault bool
+		if err := rows.Scan(&id, &name, &tz, pq.Array(&workingDays), &isDefault); err != nil {
+			rows.Close()
+			return err
+		}
+		days := make([]int, len(workingDays))
+		for i, d := range workingDays {
+			days[i] = int(d)
+		}
+		byID[id] = newWorkCalendar(id, name, tz, days)
+		if isDefault {
+			defaultID = id
+		}
+	}
+	rows.Close()
+
+	rows, err = db.Query(`SELECT calendar_id, to_char(day, 'YYYY-MM-DD'), kind FROM calendar_days`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int
+		var day, kind string
+		if err := rows.Scan(&id, &day, &kind); err != nil {
+			rows.Close()
+			return err
+		}
+		if c := byID[id]; c != nil {
+			c.days[day] = kind
+		}
+	}
+	rows.Close()
+
+	company := map[string]int{}
+	rows, err = db.Query(`SELECT id, calendar_id FROM companies WHERE calendar_id IS NOT NULL`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var companyID string
+		var id int
+		if err := rows.Scan(&companyID, &id); err != nil {
+			return err
+		}
+		company[companyID] = id
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	calendarRegistry.Lock()
+	calendarRegistry.byID, calendarRegistry.defaultID, calendarRegistry.company = byID, defaultID, company
+	calendarRegistry.Unlock()
+	return nil
+}
+
+func defaultCalendar() *workCalendar {
+	calendarRegistry.RLock()
+	defer calendarRegistry.RUnlock()
+	if c := calendarRegistry.byID[calendarRegistry.defaultID]; c != nil {
+		return c
+	}
+	return builtinCalendar
+}
+
+// companyCalendar mengembalikan kalender override company, atau default.
+func companyCalendar(companyID string) *workCalendar {
+	calendarRegistry.RLock()
+	c := calendarRegistry.byID[calendarRegistry.company[companyID]]
+	calendarRegistry.RUnlock()
+	if c != nil {
+		return c
+	}
+	return defaultCalendar()
+}
+
+// Date mengembalikan tengah malam tanggal lokal t di zona waktu kalender.
+func (c *workCalendar) Date(t time.Time) time.Time {
+	t = t.In(c.loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, c.loc)
+}
+
+func (c *workCalendar) Today() time.Time {
+	return c.Date(time.Now())
+}
+
+func (c *workCalendar) DayKind(t time.Time) string {
+	return c.days[c.Date(t).Format("2006-01-02")]
+}
+
+func (c *workCalendar) IsWorkingDay(t time.Time) bool {
+	switch c.DayKind(t) {
+	case "working":
+		return true
+	case "holiday", "shutdown":
+		return false
+	}
+	iso := int(c.Date(t).Weekday())
+	if iso == 0 {
+		iso = 7
+	}
+	return c.workdays[iso]
+}
+
+// AddWorkingDays maju (atau mundur bila n negatif) sebanyak n hari kerja dari
+// tanggal t. n = 0 menggeser t ke hari kerja berikutnya bila t hari libur.
+func (c *workCalendar) AddWorkingDays(t time.Time, n int) time.Time {
+	d := c.Date(t)
+	step := 1
+	if n < 0 {
+		step, n = -1, -n
+	}
+	if n == 0 {
+		for i := 0; i < 366 && !c.IsWorkingDay(d); i++ {
+			d = d.AddDate(0, 0, 1)
+		}
+		return d
+	}
+	// Batas iterasi mencegah loop tanpa akhir bila kalender tanpa hari kerja.
+	for i := 0; n > 0 && i < 3660; i++ {
+		d = d.AddDate(0, 0, step)
+		if c.IsWorkingDay(d) {
+			n--
+		}
+	}
+	return d
+}
+
+// AddWorkingDuration menambah durasi pecahan hari kerja, dibulatkan ke atas.
+func (c *workCalendar) AddWorkingDuration(t time.Time, days float64) time.Time {
+	return c.AddWorkingDays(t, int(math.Ceil(days)))
+}
+
+// WorkingDaysBetween menghitung hari kerja di rentang (a, b]; negatif bila b
+// sebelum a. Sama dengan fungsi SQL working_days_between.
+func (c *workCalendar) WorkingDaysBetween(a, b time.Time) int {
+	from, to := c.Date(a), c.Date(b)
+	sign := 1
+	if to.Before(from) {
+		from, to, sign = to, from, -1
+	}
+	count := 0
+	for d := from.AddDate(0, 0, 1); !d.After(to); d = d.AddDate(0, 0, 1) {
+		if c.IsWorkingDay(d) {
+			count++
+		}
+	}
+	return sign * count
+}
+
+// PreviousWorkingDay mengembalikan hari kerja terakhir sebelum t.
+func (c *workCalendar) PreviousWorkingDay(t time.Time) time.Time {
+	return c.AddWorkingDays(t, -1)
+}
+
+type CalendarDay struct {
+	Day  string  `json:"day"`
+	Kind string  `json:"kind"`
+	Name *string `json:"name"`
+}
+
+type Calendar struct {
+	ID          int           `json:"id"`
+	Name        string        `json:"name"`
+	TimeZone    string        `json:"timezone"`
+	WorkingDays []int         `json:"working_days"`
+	IsDefault   bool          `json:"is_default"`
+	Companies   []string      `json:"companies"`
+	Days        []CalendarDay `json:"days,omitempty"`
+}
+
+func scanCalendar(s interface{ Scan(...interface{}) error }) (Calendar, error) {
+	var c Calendar
+	var days []int64
+	var companyIDs []string
+	err := s.Scan(&c.ID, &c.Name, &c.TimeZone, pq.Array(&days), &c.IsDefault, pq.Array(&companyIDs))
+	c.WorkingDays = make([]int, len(days))
+	for i, d := range days {
+		c.WorkingDays[i] = int(d)
+	}
+	c.Companies = companyIDs
+	if c.Companies == nil {
+		c.Companies = []string{}
+	}
+	return c, err
+}
+
+const calendarSelect = `SELECT c.id, c.name, c.timezone, c.working_days, c.is_default,
+	ARRAY(SELECT co.id FROM companies co WHERE co.calendar_id = c.id ORDER BY co.id)
+	FROM calendars c`
+
+// calendarReloadInterval: CALENDAR_RELOAD_INTERVAL (durasi Go), default 5
+// menit. Reload berkala menjadi cadangan bila notifikasi terlewat, misalnya
+// saat koneksi listener terputus.
+func calendarReloadInterval() time.Duration {
+	if v := os.Getenv("CALENDAR_RELOAD_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+		log.Printf("Calendar: CALENDAR_RELOAD_INTERVAL %q tidak valid, memakai 5m", v)
+	}
+	return 5 * time.Minute
+}
+
+// watchCalendarChanges memuat ulang kalender setiap ada NOTIFY
+// calendar_changed dari replika mana pun, dan secara berkala.
+func (a *App) watchCalendarChanges() {
+	listener := pq.NewListener(a.dsn, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Calendar: listener: %v", err)
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen("calendar_changed"); err != nil {
+		log.Printf("Calendar: gagal LISTEN calendar_changed, hanya reload berkala: %v", err)
+	}
+	ticker := time.NewTicker(calendarReloadInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case n := <-listener.Notify:
+			// n nil berarti koneksi baru tersambung ulang; notifikasi selama
+			// terputus mungkin hilang, jadi tetap reload.
+			if n != nil {
+				// Gabungkan notifikasi beruntun dari satu transaksi besar.
+				time.Sleep(200 * time.Millisecond)
+				for len(listener.Notify) > 0 {
+					<-listener.Notify
+				}
+			}
+			a.reloadCalendarsOrLog()
+		case <-ticker.C:
+			a.reloadCalendarsOrLog()
+		}
+	}
+}
+
+func (a *App) reloadCalendarsOrLog() {
+	if err := loadCalendars(a.DB); err != nil {
+		log.Printf("Calendar: gagal memuat ulang kalender: %v", err)
+	}
+	dashboardCache.Lock()
+	dashboardCache.entries = map[string]dashboardCacheEntry{}
+	dashboardCache.Unlock()
+}
+
+func (a *App) getCalendarsHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.DB.Query(calendarSelect + ` ORDER BY c.is_default DESC, c.name`)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil kalender: "+err.Error())
+		return
+	}
+	defer rows.Close()
+	list := []Calendar{}
+	for rows.Next() {
+		c, err := scanCalendar(rows)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		list = append(list, c)
+	}
+	respondWithJSON(w, http.StatusOK, list)
+}
+
+// getCalendarHandler: GET /calendars/{id}?year=2026. Tanpa year, semua
+// pengecualian tanggal dikembalikan.
+func (a *App) getCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ID kalender tidak valid")
+		return
+	}
+	c, err := scanCalendar(a.DB.QueryRow(calendarSelect+` WHERE c.id = $1`, id))
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Kalender tidak ditemukan")
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	year, _ := strconv.Atoi(r.URL.Query().Get("year"))
+	rows, err := a.DB.Query(`
+		SELECT to_char(day, 'YYYY-MM-DD'), kind, name FROM calendar_days
+		WHERE calendar_id = $1 AND ($2 = 0 OR EXTRACT(YEAR FROM day) = $2)
+		ORDER BY day`, id, year)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil hari libur: "+err.Error())
+		return
+	}
+	defer rows.Close()
+	c.Days = []CalendarDay{}
+	for rows.Next() {
+		var d CalendarDay
+		if err := rows.Scan(&d.Day, &d.Kind, &d.Name); err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.Days = append(c.Days, d)
+	}
+	respondWithJSON(w, http.StatusOK, c)
+}
+
+type calendarPayload struct {
+	Name        *string `json:"name"`
+	TimeZone    *string `json:"timezone"`
+	WorkingDays *[]int  `json:"working_days"`
+	IsDefault   *bool   `json:"is_default"`
+}
+
+func (p calendarPayload) validate() error {
+	if p.Name != nil && strings.TrimSpace(*p.Name) == "" {
+		return fmt.Errorf("Nama kalender tidak boleh kosong")
+	}
+	if p.TimeZone != nil {
+		if _, err := time.LoadLocation(*p.TimeZone); err != nil || *p.TimeZone == "" {
+			return fmt.Errorf("Zona waktu tidak dikenal: %s", *p.TimeZone)
+		}
+	}
+	if p.WorkingDays != nil {
+		for _, d := range *p.WorkingDays {
+			if d < 1 || d > 7 {
+				return fmt.Errorf("working_days berisi 1 (Senin) sampai 7 (Minggu)")
+			}
+		}
+	}
+	return nil
+}
+
+// saveCalendar membuat (id = 0) atau mengubah kalender. Menjadikan satu
+// kalender default otomatis melepas default kalender lain.
+func (a *App) saveCalendar(w http.ResponseWriter, r *http.Request, id int) {
+	var payload calendarPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid payload: "+err.Error())
+		return
+	}
+	if err := payload.validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if id == 0 && payload.Name == nil {
+		respondWithError(w, http.StatusBadRequest, "Nama kalender tidak boleh kosong")
+		return
+	}
+	var workingDays interface{}
+	if payload.WorkingDays != nil {
+		workingDays = pq.Array(*payload.WorkingDays)
+	}
+
+	tx, err := a.DB.Begin()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memulai transaksi: "+err.Error())
+		return
+	}
+	defer tx.Rollback()
+	if payload.IsDefault != nil && *payload.IsDefault {
+		if _, err := tx.Exec(`UPDATE calendars SET is_default = false WHERE is_default AND id <> $1`, id); err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if id == 0 {
+		err = tx.QueryRow(`
+			INSERT INTO calendars (name, timezone, working_days, is_default)
+			VALUES (BTRIM($1), COALESCE($2, '`+defaultCalendarTimeZone+`'), COALESCE($3::int[], '{1,2,3,4,5}'), COALESCE($4, false))
+			RETURNING id`, *payload.Name, payload.TimeZone, workingDays, payload.IsDefault).Scan(&id)
+	} else {
+		// Kalender default tidak bisa dilepas tanpa menunjuk default lain.
+		err = tx.QueryRow(`
+			UPDATE calendars SET
+				name = COALESCE(BTRIM($2), name),
+				timezone = COALESCE($3, timezone),
+				working_days = COALESCE($4::int[], working_days),
+				is_default = is_default OR COALESCE($5, false),
+				updated_at = NOW()
+			WHERE id = $1 RETURNING id`, id, payload.Name, payload.TimeZone, workingDays, payload.IsDefault).Scan(&id)
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Kalender tidak ditemukan")
+			return
+		}
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			respondWithError(w, http.StatusConflict, "Nama kalender sudah digunakan")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Gagal menyimpan kalender: "+err.Error())
+		return
+	}
+	c, err := scanCalendar(tx.QueryRow(calendarSelect+` WHERE c.id = $1`, id))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menyimpan kalender: "+err.Error())
+		return
+	}
+	a.reloadCalendarsOrLog()
+	status := http.StatusOK
+	if r.Method == http.MethodPost {
+		status = http.StatusCreated
+	}
+	respondWithJSON(w, status, c)
+}
+
+func (a *App) createCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	a.saveCalendar(w, r, 0)
+}
+
+func (a *App) updateCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		respondWithError(w, http.StatusBadRequest, "ID kalender tidak valid")
+		return
+	}
+	a.saveCalendar(w, r, id)
+}
+
+func (a *App) deleteCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ID kalender tidak valid")
+		return
+	}
+	err = a.DB.QueryRow(`DELETE FROM calendars WHERE id = $1 AND NOT is_default RETURNING id`, id).Scan(&id)
+	if err == sql.ErrNoRows {
+		var isDefault bool
+		if a.DB.QueryRow(`SELECT is_default FROM calendars WHERE id = $1`, id).Scan(&isDefault) == nil && isDefault {
+			respondWithError(w, http.StatusConflict, "Kalender default tidak bisa dihapus")
+			return
+		}
+		respondWithError(w, http.StatusNotFound, "Kalender tidak ditemukan")
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menghapus kalender: "+err.Error())
+		return
+	}
+	a.reloadCalendarsOrLog()
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// upsertCalendarDaysHandler: POST /calendars/{id}/days. Body berupa array
+// {"day": "2026-03-20", "end_day": "2026-03-24", "kind": "holiday", "name": "..."};
+// end_day opsional untuk rentang (misalnya shutdown pabrik).
+func (a *App) upsertCalendarDaysHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ID kalender tidak valid")
+		return
+	}
+	var payload []struct {
+		Day    string  `json:"day"`
+		EndDay string  `json:"end_day"`
+		Kind   string  `json:"kind"`
+		Name   *string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid payload: "+err.Error())
+		return
+	}
+
+	tx, err := a.DB.Begin()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memulai transaksi: "+err.Error())
+		return
+	}
+	defer tx.Rollback()
+	saved := 0
+	for i, item := range payload {
+		if !calendarDayKinds[item.Kind] {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Baris %d: kind harus holiday, shutdown atau working", i+1))
+			return
+		}
+		start, err := time.Parse("2006-01-02", item.Day)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Baris %d: day harus berformat YYYY-MM-DD", i+1))
+			return
+		}
+		end := start
+		if item.EndDay != "" {
+			if end, err = time.Parse("2006-01-02", item.EndDay); err != nil || end.Before(start) || end.Sub(start) > 366*24*time.Hour {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Baris %d: end_day tidak valid", i+1))
+				return
+			}
+		}
+		res, err := tx.Exec(`
+			INSERT INTO calendar_days (calendar_id, day, kind, name)
+			SELECT $1, g::date, $4, $5 FROM generate_series($2::date, $3::date, INTERVAL '1 day') g
+			WHERE EXISTS (SELECT 1 FROM calendars WHERE id = $1)
+			ON CONFLICT (calendar_id, day) DO UPDATE SET kind = EXCLUDED.kind, name = EXCLUDED.name`,
+			id, start.Format("2006-01-02"), end.Format("2006-01-02"), item.Kind, item.Name)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal menyimpan hari libur: "+err.Error())
+			return
+		}
+		n, _ := res.RowsAffected()
+		if n == 0 {
+			respondWithError(w, http.StatusNotFound, "Kalender tidak ditemukan")
+			return
+		}
+		saved += int(n)
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menyimpan hari libur: "+err.Error())
+		return
+	}
+	a.reloadCalendarsOrLog()
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"status": "success", "saved": saved})
+}
+
+func (a *App) deleteCalendarDayHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ID kalender tidak valid")
+		return
+	}
+	res, err := a.DB.Exec(`DELETE FROM calendar_days WHERE calendar_id = $1 AND day = $2::date`, id, vars["day"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Gagal menghapus hari libur: "+err.Error())
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusNotFound, "Tanggal tidak ditemukan di kalender")
+		return
+	}
+	a.reloadCalendarsOrLog()
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// setCompanyCalendarHandler: PUT /company/{id}/calendar {"calendar_id": N}.
+// calendar_id null mengembalikan company ke kalender default.
+func (a *App) setCompanyCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	companyID := mux.Vars(r)["id"]
+	var payload struct {
+		CalendarID *int `json:"calendar_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid payload: "+err.Error())
+		return
+	}
+	res, err := a.DB.Exec(`UPDATE companies SET calendar_id = $2 WHERE id = $1`, companyID, payload.CalendarID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			respondWithError(w, http.StatusBadRequest, "Kalender tidak ditemukan")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengubah kalender company: "+err.Error())
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusNotFound, "Company tidak ditemukan")
+		return
+	}
+	a.reloadCalendarsOrLog()
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"status": "success", "company_id": companyID, "calendar_id": payload.CalendarID})
+}
+
+// getWorkingDaysHandler: GET /calendars/working-days?from=&to=&company_id=.
+// Alat bantu client untuk menghitung hari kerja dengan kalender yang sama
+// dengan server.
+func (a *App) getWorkingDaysHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	cal := companyCalendar(q.Get("company_id"))
+	from, err := parseDateParam(q.Get("from"), false)
+	if err != nil || from == nil {
+		respondWithError(w, http.StatusBadRequest, "Parameter from wajib berformat YYYY-MM-DD")
+		return
+	}
+	to, err := parseDateParam(q.Get("to"), false)
+	if err != nil || to == nil {
+		respondWithError(w, http.StatusBadRequest, "Parameter to wajib berformat YYYY-MM-DD")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"calendar_id":  cal.ID,
+		"calendar":     cal.Name,
+		"timezone":     cal.TimeZone,
+		"from":         cal.Date(*from).Format("2006-01-02"),
+		"to":           cal.Date(*to).Format("2006-01-02"),
+		"working_days": cal.WorkingDaysBetween(*from, *to),
+		"today":        cal.Today().Format("2006-01-02"),
+	})
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const cliUsage = `Pemakaian: secpanel <perintah> [opsi]
+
+Perintah:
+  serve           Menjalankan HTTP server (default bila tanpa perintah)
+  migrate         up|down|status [-steps N]
+  seed            [-password P] Mengisi data dummy, issue title, dan production slot
+                  (tanpa -password setiap akun dummy mendapat password acak)
+  create-admin    -username U -password P [-company ID]
+  reset-password  -username U -password P
+  export          [-out FILE] [-tables a,b] [-filter "k=v&k=v"]
+  import          -in FILE
+  check           Laporan integritas data (exit 1 bila ada masalah)
+  purge-trash     [-days N] Hapus permanen isi trash yang lebih lama dari N hari
+`
+
+// allExportTables adalah daftar tabel yang ikut saat export tanpa -tables.
+var allExportTables = []string{
+	"companies", "company_accounts", "panels", "busbars", "components",
+	"palet", "corepart", "additional_sr", "issues", "issue_comments",
+}
+
+// parseServeFlags mengembalikan alamat listen untuk perintah serve.
+func parseServeFlags(args []string) string {
+	fset := flag.NewFlagSet("serve", flag.ExitOnError)
+	port := fset.String("port", os.Getenv("APP_PORT"), "port HTTP (default APP_PORT atau 8099)")
+	fset.Parse(args)
+	if *port == "" {
+		*port = "8099"
+	}
+	return ":" + *port
+}
+
+// cliCommands: perintah selain serve dan migrate, yang butuh skema terbaru
+// sehingga migrasi dijalankan lebih dulu.
+var cliCommands = map[string]bool{
+	"seed": true, "create-admin": true, "reset-password": true, "export": true,
+	"import": true, "check": true, "purge-trash": true,
+}
+
+// runCommand menjalankan perintah CLI selain serve dan mengembalikan exit code.
+func (a *App) runCommand(command string, args []string) int {
+	if cliCommands[command] {
+		if err := migrateUp(a.DB, 0); err != nil {
+			log.Printf("Migrasi database gagal: %v", err)
+			return 1
+		}
+	}
+	var err error
+	switch command {
+	case "migrate":
+		runMigrateCommand(a.DB, args)
+	case "seed":
+		err = a.seedCommand(args)
+	case "create-admin":
+		err = a.createAdminCommand(args)
+	case "reset-password":
+		err = a.resetPasswordCommand(args)
+	case "export":
+		err = a.exportCommand(args)
+	case "import":
+		err = a.importCommand(args)
+	case "purge-trash":
+		err = a.purgeTrashCommand(args)
+	case "check":
+		var problems int
+		problems, err = a.checkCommand(os.Stdout)
+		if err == nil && problems > 0 {
+			return 1
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Perintah tidak dikenal: %s\n\n%s", command, cliUsage)
+		return 2
+	}
+	if err != nil {
+		log.Printf("%s gagal: %v", command, err)
+		return 1
+	}
+	return 0
+}
+
+func (a *App) seedCommand(args []string) error {
+	fset := flag.NewFlagSet("seed", flag.ExitOnError)
+	password := fset.String("password", "", "password untuk semua akun dummy (default acak per akun)")
+	fset.Parse(args)
+
+	if err := insertDummyData(a.DB, *password); err != nil {
+		return err
+	}
+	seedDefaultData(a.DB)
+	return nil
+}
+
+func (a *App) createAdminCommand(args []string) error {
+	fset := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	username := fset.String("username", "", "username admin baru")
+	password := fset.String("password", "", "password admin baru")
+	companyID := fset.String("company", "admin", "id company dengan role admin")
+	fset.Parse(args)
+
+	if *username == "" || *password == "" {
+		return fmt.Errorf("-username dan -password wajib diisi")
+	}
+	if err := validatePasswordStrength(*username, *password); err != nil {
+		return err
+	}
+	hashed, err := hashPassword(*password)
+	if err != nil {
+		return err
+	}
+
+	tx, err := a.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var role string
+	err = tx.QueryRow("SELECT role FROM companies WHERE id = $1", *companyID).Scan(&role)
+	if err == sql.ErrNoRows {
+		_, err = tx.Exec("INSERT INTO companies (id, name, role) VALUES ($1, $2, $3)", *companyID, "Administrator", AppRoleAdmin)
+		role = AppRoleAdmin
+	}
+	if err != nil {
+		return err
+	}
+	if role != AppRoleAdmin {
+		return fmt.Errorf("company %s memiliki role %s, bukan admin", *companyID, role)
+	}
+
+	if _, err := tx.Exec("INSERT INTO company_accounts (username, password, company_id) VALUES ($1, $2, $3)", *username, hashed, *companyID); err != nil {
+		return fmt.Errorf("gagal membuat akun %s: %w", *username, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Admin %s berhasil dibuat di company %s.", *username, *companyID)
+	return nil
+}
+
+func (a *App) resetPasswordCommand(args []string) error {
+	fset := flag.NewFlagSet("reset-password", flag.ExitOnError)
+	username := fset.String("username", "", "username yang di-reset")
+	password := fset.String("password", "", "password baru")
+	fset.Parse(args)
+
+	if *username == "" || *password == "" {
+		return fmt.Errorf("-username dan -password wajib diisi")
+	}
+	if err := validatePasswordStrength(*username, *password); err != nil {
+		return err
+	}
+	hashed, err := hashPassword(*password)
+	if err != nil {
+		return err
+	}
+
+	tx, err := a.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE company_accounts SET password = $1 WHERE username = $2", hashed, *username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("user %s tidak ditemukan", *username)
+	}
+	if err := a.revokeSessionsForUser(tx, *username, ""); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Password %s berhasil di-reset, semua sesi aktif dicabut.", *username)
+	return nil
+}
+
+func (a *App) exportCommand(args []string) error {
+	fset := flag.NewFlagSet("export", flag.ExitOnError)
+	out := fset.String("out", "", "file tujuan (default stdout)")
+	tables := fset.String("tables", strings.Join(allExportTables, ","), "daftar tabel dipisah koma")
+	filter := fset.String("filter", "", "filter seperti query string /export/database, mis. \"panel_types=MCC&start_date_start=2025-01-01\"")
+	fset.Parse(args)
+
+	queryParams, err := url.ParseQuery(*filter)
+	if err != nil {
+		return fmt.Errorf("format -filter tidak valid: %w", err)
+	}
+	data, err := a.getFilteredDataForExport(queryParams)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(selectExportTables(data, strings.Split(*tables, ",")))
+}
+
+func (a *App) importCommand(args []string) error {
+	fset := flag.NewFlagSet("import", flag.ExitOnError)
+	in := fset.String("in", "", "file JSON hasil export database")
+	fset.Parse(args)
+
+	if *in == "" {
+		return fmt.Errorf("-in wajib diisi")
+	}
+	f, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var data map[string][]map[string]interface{}
+	if err := json.NewDecoder(f).Decode(&data); err != nil {
+		return fmt.Errorf("file JSON tidak valid: %w", err)
+	}
+	if err := importDatabaseData(a.DB, data, "", AuditSourceCLI); err != nil {
+		return err
+	}
+	log.Printf("Import dari %s berhasil.", *in)
+	return nil
+}
+
+func (a *App) purgeTrashCommand(args []string) error {
+	fset := flag.NewFlagSet("purge-trash", flag.ExitOnError)
+	defaultDays := int(trashRetention().Hours() / 24)
+	if defaultDays == 0 {
+		defaultDays = defaultTrashRetentionDays
+	}
+	days := fset.Int("days", defaultDays, "umur minimal item trash (hari); 0 = semua")
+	fset.Parse(args)
+
+	if *days < 0 {
+		return fmt.Errorf("-days tidak boleh negatif")
+	}
+	counts, err := purgeTrash(a.DB, time.Now().AddDate(0, 0, -*days))
+	if err != nil {
+		return err
+	}
+	log.Printf("Purge trash selesai: %d panel, %d issue, %d komentar dihapus permanen.", counts["panel"], counts["issue"], counts["comment"])
+	return nil
+}
+
+type integrityCheck struct {
+	Name  string
+	Query string
+}
+
+// Setiap query mengembalikan satu kolom teks berisi identitas baris yang bermasalah.
+var integrityChecks = []integrityCheck{
+	{"Akun dengan password belum di-hash", `
+		SELECT username FROM company_accounts
+		WHERE password IS NOT NULL AND password <> '' AND password !~ '^\$2[aby]\$'`},
+	{"Akun tanpa password (selain user sistem)", `
+		SELECT username FROM company_accounts
+		WHERE (password IS NULL OR password = '') AND username <> 'gemini_ai'`},
+	{"Panel dengan vendor_id yang tidak ada di companies", `
+		SELECT p.no_pp FROM panels p
+		WHERE p.vendor_id IS NOT NULL AND p.vendor_id <> ''
+		  AND NOT EXISTS (SELECT 1 FROM companies c WHERE c.id = p.vendor_id)`},
+	{"Relasi vendor (busbar/component/palet/corepart) ke company yang tidak ada", `
+		SELECT t.tbl || ':' || t.panel_no_pp || ':' || t.vendor FROM (
+			SELECT 'busbars' AS tbl, panel_no_pp, vendor FROM busbars
+			UNION ALL SELECT 'components', panel_no_pp, vendor FROM components
+			UNION ALL SELECT 'palet', panel_no_pp, vendor FROM palet
+			UNION ALL SELECT 'corepart', panel_no_pp, vendor FROM corepart
+		) t
+		WHERE NOT EXISTS (SELECT 1 FROM companies c WHERE c.id = t.vendor)`},
+	{"Panel dengan progress di luar 0-100", `
+		SELECT no_pp FROM panels WHERE percent_progress < 0 OR percent_progress > 100`},
+	{"Panel closed tanpa closed_date", `
+		SELECT no_pp FROM panels WHERE is_closed = true AND closed_date IS NULL`},
+	{"Slot terisi tanpa panel", `
+		SELECT ps.position_code FROM production_slots ps
+		WHERE ps.is_occupied = true
+		  AND NOT EXISTS (SELECT 1 FROM panels p WHERE p.production_slot = ps.position_code)`},
+	{"Panel menempati slot yang tidak ditandai terisi", `
+		SELECT p.no_pp || ' @ ' || ps.position_code FROM panels p
+		JOIN production_slots ps ON ps.position_code = p.production_slot
+		WHERE ps.is_occupied = false`},
+	{"Slot dipakai lebih dari satu panel", `
+		SELECT production_slot || ' (' || COUNT(*) || ' panel)' FROM panels
+		WHERE production_slot IS NOT NULL
+		GROUP BY production_slot HAVING COUNT(*) > 1`},
+	{"Reservasi slot aktif yang tidak sesuai production_slot panel", `
+		SELECT r.id::text || ':' || r.position_code || ':' || COALESCE(r.panel_no_pp, '-') FROM slot_reservations r
+		LEFT JOIN panels p ON p.no_pp = r.panel_no_pp
+		WHERE r.status = 'active' AND p.production_slot IS DISTINCT FROM r.position_code`},
+	{"Reservasi slot yang saling bertabrakan", `
+		SELECT a.position_code || ' (#' || a.id || ' & #' || b.id || ')' FROM slot_reservations a
+		JOIN slot_reservations b ON b.position_code = a.position_code AND b.id > a.id
+		WHERE a.status IN ('reserved', 'active') AND b.status IN ('reserved', 'active')
+		  AND a.start_date <= b.end_date AND b.start_date <= a.end_date`},
+	{"Issue dengan status tidak dikenal", `
+		SELECT id::text FROM issues WHERE status NOT IN ('unsolved', 'solved')`},
+}
+
+// checkCommand menulis laporan integritas ke w dan mengembalikan jumlah
+// pemeriksaan yang menemukan masalah.
+func (a *App) checkCommand(w io.Writer) (int, error) {
+	const maxSamples = 10
+	problems := 0
+	for _, c := range integrityChecks {
+		rows, err := a.DB.Query(c.Query)
+		if err != nil {
+			return problems, fmt.Errorf("%s: %w", c.Name, err)
+		}
+		var found []string
+		total := 0
+		for rows.Next() {
+			var key sql.NullString
+			if err := rows.Scan(&key); err != nil {
+				rows.Close()
+				return problems, err
+			}
+			total++
+			if len(found) < maxSamples {
+				found = append(found, key.String)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return problems, err
+		}
+
+		if total == 0 {
+			fmt.Fprintf(w, "[OK]    %s\n", c.Name)
+			continue
+		}
+		problems++
+		fmt.Fprintf(w, "[GAGAL] %s: %d baris\n", c.Name, total)
+		for _, key := range found {
+			fmt.Fprintf(w, "        - %s\n", key)
+		}
+		if total > len(found) {
+			fmt.Fprintf(w, "        ... dan %d lainnya\n", total-len(found))
+		}
+	}
+	return problems, nil
+}
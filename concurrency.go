@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type versionedEntity struct {
+	Table  string
+	KeyCol string
+}
+
+// Tabel yang punya kolom version (lihat migrasi 0005_row_versions).
+var versionedEntities = map[string]versionedEntity{
+	"panel":         {"panels", "no_pp"},
+	"wiring":        {"wirings", "id"},
+	"issue":         {"issues", "id"},
+	"additional_sr": {"additional_sr", "id"},
+}
+
+func etagFor(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+func setETag(w http.ResponseWriter, version int64) {
+	if version > 0 {
+		w.Header().Set("ETag", etagFor(version))
+	}
+}
+
+// parseETagVersion menerima `"5"`, `W/"5"` atau `5`.
+func parseETagVersion(tag string) (int64, error) {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+	return strconv.ParseInt(strings.Trim(tag, `"`), 10, 64)
+}
+
+// ifMatchRequired menentukan apakah request yang mengubah data yang sudah ada
+// wajib mengirim If-Match. REQUIRE_IF_MATCH:
+//   - kosong (default): wajib untuk PUT, PATCH dan DELETE
+//   - true: juga wajib untuk endpoint upsert POST
+//   - false: tidak pernah wajib (opt-out untuk client lama)
+//
+// POST /panels selalu mewajibkan If-Match untuk panel yang sudah ada (lihat
+// requireIfMatch) karena upsert tanpa versi menimpa perubahan orang lain.
+func ifMatchRequired(r *http.Request) bool {
+	raw := strings.TrimSpace(os.Getenv("REQUIRE_IF_MATCH"))
+	if raw != "" {
+		if required, err := strconv.ParseBool(raw); err == nil {
+			return required
+		}
+	}
+	switch r.Method {
+	case http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// checkIfMatch membaca header If-Match. Hasil nil berarti tanpa pengecekan
+// versi (header kosong atau "*"). exists=false untuk request yang membuat
+// data baru, sehingga If-Match tidak diwajibkan. Bila ok=false, response
+// error sudah ditulis.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, exists bool) (*int64, bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		if exists && ifMatchRequired(r) {
+			respondWithError(w, http.StatusPreconditionRequired, "Header If-Match wajib diisi dengan ETag terakhir")
+			return nil, false
+		}
+		return nil, true
+	}
+	if header == "*" {
+		return nil, true
+	}
+	// Bila client mengirim beberapa ETag, yang pertama dipakai.
+	version, err := parseETagVersion(strings.Split(header, ",")[0])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Header If-Match tidak valid")
+		return nil, false
+	}
+	return &version, true
+}
+
+// requireIfMatch menulis 428 bila If-Match kosong, tanpa melihat
+// REQUIRE_IF_MATCH. Dipakai endpoint yang menimpa seluruh baris.
+func requireIfMatch(w http.ResponseWriter, r *http.Request) bool {
+	if strings.TrimSpace(r.Header.Get("If-Match")) == "" {
+		respondWithError(w, http.StatusPreconditionRequired, "Header If-Match wajib diisi dengan ETag terakhir")
+		return false
+	}
+	return true
+}
+
+// notModified menulis 304 bila If-None-Match cocok dengan versi saat ini.
+func notModified(w http.ResponseWriter, r *http.Request, version int64) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" || version <= 0 {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimSpace(tag) == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+		if v, err := parseETagVersion(tag); err == nil && v == version {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// respondVersionMiss dipanggil saat UPDATE bersyarat versi tidak mengenai
+// baris mana pun: 404 bila datanya memang tidak ada, selain itu 409 berisi
+// salinan terbaru dari server supaya client bisa menggabungkan perubahan.
+func respondVersionMiss(w http.ResponseWriter, db DBTX, entity string, key interface{}) {
+	e, ok := versionedEntities[entity]
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Entity tidak dikenal: "+entity)
+		return
+	}
+	var version int64
+	var raw []byte
+	err := db.QueryRow(fmt.Sprintf("SELECT t.version, row_to_json(t) FROM %s t WHERE t.%s::text = $1", e.Table, e.KeyCol), fmt.Sprint(key)).Scan(&version, &raw)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Data tidak ditemukan")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil data terbaru: "+err.Error())
+		return
+	}
+	setETag(w, version)
+	respondWithJSON(w, http.StatusConflict, map[string]interface{}{
+		"error":   "Data sudah diubah oleh pengguna lain. Muat ulang lalu gabungkan perubahan Anda.",
+		"version": version,
+		"current": json.RawMessage(raw),
+	})
+}
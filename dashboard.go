@@ -0,0 +1,206 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultDashboardCacheSeconds = 30
+
+// panelBuckets adalah kelompok progres panel yang dipakai filter
+// panel_statuses di export dan counter dashboard. Kondisinya memakai alias p.
+var panelBuckets = []struct {
+	Key       string
+	Condition string
+}{
+	{"progressGrey", "(p.percent_progress = 0 OR p.percent_progress IS NULL)"},
+	{"progressRed", "(p.percent_progress > 0 AND p.percent_progress < 50)"},
+	{"progressOrange", "(p.percent_progress >= 50 AND p.percent_progress < 75)"},
+	{"progressBlue", "(p.percent_progress >= 75 AND p.percent_progress < 100)"},
+	{"readyToDelivery", "(p.percent_progress >= 100 AND p.is_closed = false)"},
+	{"closed", "(p.is_closed = true)"},
+}
+
+func panelBucketCondition(key string) (string, bool) {
+	for _, b := range panelBuckets {
+		if b.Key == key {
+			return b.Condition, true
+		}
+	}
+	return "", false
+}
+
+func dashboardCacheTTL() time.Duration {
+	if s, err := strconv.Atoi(os.Getenv("DASHBOARD_CACHE_SECONDS")); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second
+	}
+	return defaultDashboardCacheSeconds * time.Second
+}
+
+type dashboardCacheEntry struct {
+	expires time.Time
+	summary map[string]interface{}
+}
+
+// dashboardCache menyimpan ringkasan per role+company. Datanya boleh basi
+// beberapa detik; ?refresh=true memaksa hitung ulang.
+var dashboardCache = struct {
+	sync.Mutex
+	entries map[string]dashboardCacheEntry
+}{entries: map[string]dashboardCacheEntry{}}
+
+type projectSummary struct {
+	Project string `json:"project"`
+	Total   int    `json:"total"`
+	Closed  int    `json:"closed"`
+	Overdue int    `json:"overdue"`
+}
+
+// buildDashboardSummary menghitung semua counter dashboard di SQL untuk panel
+// yang terlihat oleh scopeQuery (lihat panelScopeQuery).
+func buildDashboardSummary(db DBTX, scopeQuery string, args []interface{}) (map[string]interface{}, error) {
+	scoped := `FROM public.panels p WHERE p.no_pp IN (` + scopeQuery + `)`
+
+	selects := `COUNT(*),
+		COUNT(*) FILTER (WHERE ` + panelOverdueCondition + `),
+		COUNT(*) FILTER (WHERE ` + panelDueSoonCondition + `)`
+	for _, b := range panelBuckets {
+		selects += `,
+		COUNT(*) FILTER (WHERE ` + b.Condition + `)`
+	}
+	var total, overdue, dueThisWeek int
+	counts := make([]int, len(panelBuckets))
+	dest := []interface{}{&total, &overdue, &dueThisWeek}
+	for i := range counts {
+		dest = append(dest, &counts[i])
+	}
+	if err := db.QueryRow(`SELECT `+selects+` `+scoped, args...).Scan(dest...); err != nil {
+		return nil, err
+	}
+	buckets := map[string]int{}
+	for i, b := range panelBuckets {
+		buckets[b.Key] = counts[i]
+	}
+
+	rows, err := db.Query(`
+		SELECT COALESCE(NULLIF(p.status_penyelesaian, ''), '`+defaultWorkflowState+`'), COUNT(*) `+scoped+`
+		GROUP BY 1 ORDER BY 1`, args...)
+	if err != nil {
+		return nil, err
+	}
+	byStatus := map[string]int{}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		byStatus[status] = n
+	}
+	rows.Close()
+
+	rows, err = db.Query(`
+		SELECT COALESCE(NULLIF(p.project, ''), 'Belum Diatur'), COUNT(*),
+			COUNT(*) FILTER (WHERE p.is_closed = true),
+			COUNT(*) FILTER (WHERE `+panelOverdueCondition+`)
+		`+scoped+`
+		GROUP BY 1 ORDER BY 2 DESC, 1`, args...)
+	if err != nil {
+		return nil, err
+	}
+	byProject := []projectSummary{}
+	for rows.Next() {
+		var s projectSummary
+		if err := rows.Scan(&s.Project, &s.Total, &s.Closed, &s.Overdue); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		byProject = append(byProject, s)
+	}
+	rows.Close()
+
+	var issuesOpen, issuesSolved int
+	err = db.QueryRow(`
+		SELECT COUNT(*) FILTER (WHERE i.status <> 'solved'), COUNT(*) FILTER (WHERE i.status = 'solved')
+		FROM issues i JOIN chats ch ON ch.id = i.chat_id
+		WHERE i.deleted_at IS NULL AND ch.panel_no_pp IN (`+scopeQuery+`)`, args...).Scan(&issuesOpen, &issuesSolved)
+	if err != nil {
+		return nil, err
+	}
+	var solvedRatio *float64
+	if issuesOpen+issuesSolved > 0 {
+		v := float64(issuesSolved) / float64(issuesOpen+issuesSolved)
+		solvedRatio = &v
+	}
+
+	var srOpen, srTotal, srOpenQuantity int
+	err = db.QueryRow(`
+		SELECT COUNT(*) FILTER (WHERE COALESCE(asr.status, 'open') = 'open'), COUNT(*),
+			COALESCE(SUM(asr.quantity) FILTER (WHERE COALESCE(asr.status, 'open') = 'open'), 0)
+		FROM additional_sr asr
+		WHERE asr.panel_no_pp IN (`+scopeQuery+`)`, args...).Scan(&srOpen, &srTotal, &srOpenQuantity)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"total_panels":           total,
+		"buckets":                buckets,
+		"by_status_penyelesaian": byStatus,
+		"by_project":             byProject,
+		"overdue": map[string]int{
+			"overdue":       overdue,
+			"due_this_week": dueThisWeek,
+		},
+		"issues": map[string]interface{}{
+			"open":         issuesOpen,
+			"solved":       issuesSolved,
+			"solved_ratio": solvedRatio,
+		},
+		"additional_sr": map[string]int{
+			"open":          srOpen,
+			"total":         srTotal,
+			"open_quantity": srOpenQuantity,
+		},
+	}, nil
+}
+
+// getDashboardSummaryHandler: GET /dashboard/summary. Counter dihitung sesuai
+// panel yang terlihat oleh role/company user.
+func (a *App) getDashboardSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	id := requestIdentity(r)
+	scopeQuery, args, ok := panelScopeQuery(id.Role, id.CompanyID)
+	if !ok {
+		respondWithError(w, http.StatusForbidden, "Role tidak dikenal")
+		return
+	}
+
+	key := id.Role + "|" + id.CompanyID
+	refresh, _ := strconv.ParseBool(r.URL.Query().Get("refresh"))
+	ttl := dashboardCacheTTL()
+	now := time.Now()
+
+	dashboardCache.Lock()
+	entry, hit := dashboardCache.entries[key]
+	dashboardCache.Unlock()
+	if !hit || refresh || now.After(entry.expires) {
+		summary, err := buildDashboardSummary(a.DB, scopeQuery, args)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal menghitung ringkasan dashboard: "+err.Error())
+			return
+		}
+		summary["role"] = id.Role
+		summary["generated_at"] = now
+		entry = dashboardCacheEntry{expires: now.Add(ttl), summary: summary}
+		dashboardCache.Lock()
+		dashboardCache.entries[key] = entry
+		dashboardCache.Unlock()
+	}
+
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(ttl.Seconds())))
+	respondWithJSON(w, http.StatusOK, entry.summary)
+}
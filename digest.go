@@ -0,0 +1,467 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/xuri/excelize/v2"
+)
+
+// Digest email harian/mingguan per user (lihat notification_preferences).
+// Isinya laporan panel yang terlihat oleh user (panelScopeQuery) ditambah
+// notifikasi email yang ditahan sejak digest sebelumnya.
+
+const digestRowLimit = 1000
+
+type digestPanel struct {
+	NoPp           string
+	NoPanel        string
+	Project        string
+	TargetDelivery *time.Time
+	Progress       float64
+}
+
+type digestIssue struct {
+	ID        int
+	PanelNoPp string
+	NoPanel   string
+	Title     string
+	Status    string
+	By        string
+	At        time.Time
+}
+
+type digestSR struct {
+	ID        int
+	PanelNoPp string
+	NoPanel   string
+	PoNumber  string
+	Item      string
+	Quantity  int
+	Supplier  string
+	Status    string
+	CreatedAt time.Time
+}
+
+type digestWiring struct {
+	PanelNoPp string
+	NoPanel   string
+	Package   string
+	Supplier  string
+	From      *int
+	To        int
+	Status    string
+	At        time.Time
+}
+
+type digestItem struct {
+	ID        int64
+	Event     string
+	Title     string
+	Body      string
+	CreatedAt time.Time
+}
+
+type digestReport struct {
+	Frequency     string
+	From, To      time.Time
+	DueSoon       []digestPanel
+	NewlyOverdue  []digestPanel
+	IssuesOpened  []digestIssue
+	IssuesSolved  []digestIssue
+	PendingSRs    []digestSR
+	WiringChanges []digestWiring
+	Notifications []digestItem
+	HasAttachment bool
+}
+
+func (r *digestReport) Empty() bool {
+	return len(r.DueSoon)+len(r.NewlyOverdue)+len(r.IssuesOpened)+len(r.IssuesSolved)+
+		len(r.PendingSRs)+len(r.WiringChanges)+len(r.Notifications) == 0
+}
+
+type digestRecipient struct {
+	Username  string
+	Address   string
+	Pref      recipientPreference
+	Frequency string
+	Hour      int
+	Weekday   int // ISO, 1 = Senin
+	Xlsx      bool
+	Language  string
+	Last      *time.Time
+}
+
+func (c digestRecipient) period() time.Duration {
+	if c.Frequency == "weekly" {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// slot adalah jadwal digest terakhir yang sudah lewat pada now, di zona
+// waktu user.
+func (c digestRecipient) slot(now time.Time) time.Time {
+	loc := c.Pref.location()
+	local := now.In(loc)
+	slot := time.Date(local.Year(), local.Month(), local.Day(), c.Hour, 0, 0, 0, loc)
+	step := 1
+	if c.Frequency == "weekly" {
+		step = 7
+		iso := int(local.Weekday())
+		if iso == 0 {
+			iso = 7
+		}
+		slot = slot.AddDate(0, 0, -((iso - c.Weekday + 7) % 7))
+	}
+	if slot.After(local) {
+		slot = slot.AddDate(0, 0, -step)
+	}
+	return slot
+}
+
+// sendDueDigests dijalankan scheduler tiap jam dan mengirim digest untuk
+// user yang jadwalnya sudah lewat sejak digest terakhir.
+func (a *App) sendDueDigests() error {
+	rows, err := a.DB.Query(`
+		SELECT username, COALESCE(NULLIF(email, ''), CASE WHEN username LIKE '%@%' THEN username ELSE '' END),
+			COALESCE(timezone, ''), digest, digest_hour, digest_weekday, digest_xlsx, COALESCE(language, ''), last_digest_at
+		FROM notification_preferences
+		WHERE digest IN ('daily', 'weekly')`)
+	if err != nil {
+		return fmt.Errorf("gagal mengambil user digest: %w", err)
+	}
+	var recipients []digestRecipient
+	for rows.Next() {
+		var c digestRecipient
+		if err := rows.Scan(&c.Username, &c.Address, &c.Pref.TimeZone, &c.Frequency, &c.Hour, &c.Weekday,
+			&c.Xlsx, &c.Language, &c.Last); err != nil {
+			rows.Close()
+			return err
+		}
+		recipients = append(recipients, c)
+	}
+	rows.Close()
+
+	now := time.Now()
+	var errs []string
+	for _, c := range recipients {
+		if c.Last != nil && !c.Last.Before(c.slot(now)) {
+			continue
+		}
+		if err := a.sendDigest(c, now); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", c.Username, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("digest gagal untuk %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (a *App) sendDigest(c digestRecipient, now time.Time) error {
+	from := now.Add(-c.period())
+	if c.Last != nil && c.Last.After(from) {
+		from = *c.Last
+	}
+	report, err := a.buildDigestReport(c.Username, from, now)
+	if err != nil {
+		return err
+	}
+	report.Frequency = c.Frequency
+
+	tx, err := a.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var ids []int64
+	rows, err := tx.Query(`
+		SELECT id, event, title, body, created_at FROM notification_digest_items
+		WHERE username = $1 AND sent_at IS NULL
+		ORDER BY created_at
+		FOR UPDATE SKIP LOCKED`, c.Username)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var it digestItem
+		if err := rows.Scan(&it.ID, &it.Event, &it.Title, &it.Body, &it.CreatedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		report.Notifications = append(report.Notifications, it)
+		ids = append(ids, it.ID)
+	}
+	rows.Close()
+
+	// Laporan kosong tidak dikirim, tetapi periodenya tetap dianggap selesai.
+	if !report.Empty() {
+		var attachmentName sql.NullString
+		var attachment []byte
+		if c.Xlsx {
+			attachment, err = buildDigestWorkbook(report, emailLanguage(c.Language))
+			if err != nil {
+				return fmt.Errorf("gagal membuat lampiran xlsx: %w", err)
+			}
+			attachmentName = sql.NullString{String: fmt.Sprintf("digest-%s.xlsx", now.In(c.Pref.location()).Format("2006-01-02")), Valid: true}
+			report.HasAttachment = true
+		}
+		subject, body, err := renderEmail("digest", c.Language, report)
+		if err != nil {
+			return err
+		}
+		// Tanpa alamat email baris outbox tetap dibuat supaya statusnya
+		// terlihat (skipped) di /admin/notifications.
+		address := c.Address
+		if address == "" {
+			address = c.Username
+		}
+		data, _ := json.Marshal(map[string]interface{}{"username": c.Username, "frequency": c.Frequency, "items": len(ids)})
+		_, err = tx.Exec(`
+			INSERT INTO notification_outbox (event, channel, recipients, title, body, data, attachment_name, attachment)
+			VALUES ($1, 'smtp', $2, $3, $4, $5, $6, $7)`,
+			"digest."+c.Frequency, pq.Array([]string{address}), subject, body, data, attachmentName, attachment)
+		if err != nil {
+			return err
+		}
+	}
+	if len(ids) > 0 {
+		if _, err := tx.Exec(`UPDATE notification_digest_items SET sent_at = $2 WHERE id = ANY($1)`, pq.Array(ids), now); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`UPDATE notification_preferences SET last_digest_at = $2 WHERE username = $1`, c.Username, now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// buildDigestReport mengumpulkan data laporan untuk panel yang terlihat oleh
+// user pada rentang [from, to).
+func (a *App) buildDigestReport(username string, from, to time.Time) (*digestReport, error) {
+	report := &digestReport{From: from, To: to}
+	var role, companyID string
+	err := a.DB.QueryRow(`
+		SELECT c.role, ca.company_id FROM company_accounts ca JOIN companies c ON c.id = ca.company_id
+		WHERE ca.username = $1`, username).Scan(&role, &companyID)
+	if err == sql.ErrNoRows {
+		return report, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	scopeQuery, scopeArgs, ok := panelScopeQuery(role, companyID)
+	if !ok {
+		return report, nil
+	}
+	n := len(scopeArgs)
+	scope := fmt.Sprintf("p.deleted_at IS NULL AND p.no_pp IN (%s)", scopeQuery)
+	withRange := func() []interface{} {
+		return append(append([]interface{}{}, scopeArgs...), from, to)
+	}
+	fromArg, toArg := fmt.Sprintf("$%d", n+1), fmt.Sprintf("$%d", n+2)
+
+	panelQuery := func(cond string, args []interface{}) ([]digestPanel, error) {
+		rows, err := a.DB.Query(`
+			SELECT p.no_pp, COALESCE(p.no_panel, ''), COALESCE(p.project, ''), p.target_delivery, COALESCE(p.percent_progress, 0)
+			FROM panels p WHERE `+scope+` AND `+cond+`
+			ORDER BY p.target_delivery, p.no_pp LIMIT `+fmt.Sprint(digestRowLimit), args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var out []digestPanel
+		for rows.Next() {
+			var d digestPanel
+			if err := rows.Scan(&d.NoPp, &d.NoPanel, &d.Project, &d.TargetDelivery, &d.Progress); err != nil {
+				return nil, err
+			}
+			out = append(out, d)
+		}
+		return out, rows.Err()
+	}
+	if report.DueSoon, err = panelQuery(panelDueSoonCondition, scopeArgs); err != nil {
+		return nil, fmt.Errorf("panel jatuh tempo: %w", err)
+	}
+	overdueArgs := append(append([]interface{}{}, scopeArgs...), from)
+	if report.NewlyOverdue, err = panelQuery(panelOverdueCondition+` AND `+panelLocalTargetDate+` >= calendar_date(NULL, `+fromArg+`)`, overdueArgs); err != nil {
+		return nil, fmt.Errorf("panel terlambat: %w", err)
+	}
+
+	issueQuery := func(cond string) ([]digestIssue, error) {
+		rows, err := a.DB.Query(`
+			SELECT i.id, p.no_pp, COALESCE(p.no_panel, ''), i.title, i.status, COALESCE(i.created_by, ''),
+				CASE WHEN i.status = 'solved' THEN i.updated_at ELSE i.created_at END
+			FROM issues i
+			JOIN chats c ON c.id = i.chat_id
+			JOIN panels p ON p.no_pp = c.panel_no_pp
+			WHERE i.deleted_at IS NULL AND `+scope+` AND `+cond+`
+			ORDER BY 7 LIMIT `+fmt.Sprint(digestRowLimit), withRange()...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var out []digestIssue
+		for rows.Next() {
+			var d digestIssue
+			if err := rows.Scan(&d.ID, &d.PanelNoPp, &d.NoPanel, &d.Title, &d.Status, &d.By, &d.At); err != nil {
+				return nil, err
+			}
+			out = append(out, d)
+		}
+		return out, rows.Err()
+	}
+	if report.IssuesOpened, err = issueQuery(`i.created_at >= ` + fromArg + ` AND i.created_at < ` + toArg); err != nil {
+		return nil, fmt.Errorf("isu baru: %w", err)
+	}
+	// issues tidak menyimpan waktu selesai; updated_at dipakai sebagai gantinya.
+	if report.IssuesSolved, err = issueQuery(`i.status = 'solved' AND i.updated_at >= ` + fromArg + ` AND i.updated_at < ` + toArg); err != nil {
+		return nil, fmt.Errorf("isu selesai: %w", err)
+	}
+
+	rows, err := a.DB.Query(`
+		SELECT asr.id, p.no_pp, COALESCE(p.no_panel, ''), COALESCE(asr.po_number, ''), COALESCE(asr.item, ''),
+			COALESCE(asr.quantity, 0), COALESCE(asr.supplier, ''), COALESCE(asr.status, 'open'), asr.created_at
+		FROM additional_sr asr
+		JOIN panels p ON p.no_pp = asr.panel_no_pp
+		WHERE asr.received_date IS NULL AND LOWER(COALESCE(asr.status, 'open')) NOT IN ('close', 'closed', 'received', 'done')
+			AND `+scope+`
+		ORDER BY asr.created_at LIMIT `+fmt.Sprint(digestRowLimit), scopeArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("SR tertunda: %w", err)
+	}
+	for rows.Next() {
+		var d digestSR
+		if err := rows.Scan(&d.ID, &d.PanelNoPp, &d.NoPanel, &d.PoNumber, &d.Item, &d.Quantity, &d.Supplier, &d.Status, &d.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		report.PendingSRs = append(report.PendingSRs, d)
+	}
+	rows.Close()
+
+	rows, err = a.DB.Query(`
+		SELECT w.panel_no_pp, COALESCE(p.no_panel, ''), COALESCE(w.package_name, ''), COALESCE(w.supplier, ''),
+			(array_agg(w.progress_from ORDER BY w.recorded_at, w.id))[1],
+			(array_agg(w.progress ORDER BY w.recorded_at DESC, w.id DESC))[1],
+			COALESCE((array_agg(w.status ORDER BY w.recorded_at DESC, w.id DESC))[1], ''),
+			MAX(w.recorded_at)
+		FROM wiring_progress_events w
+		JOIN panels p ON p.no_pp = w.panel_no_pp
+		WHERE `+scope+` AND w.recorded_at >= `+fromArg+` AND w.recorded_at < `+toArg+`
+		GROUP BY w.wiring_id, w.panel_no_pp, p.no_panel, w.package_name, w.supplier
+		ORDER BY MAX(w.recorded_at) DESC LIMIT `+fmt.Sprint(digestRowLimit), withRange()...)
+	if err != nil {
+		return nil, fmt.Errorf("progress wiring: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d digestWiring
+		if err := rows.Scan(&d.PanelNoPp, &d.NoPanel, &d.Package, &d.Supplier, &d.From, &d.To, &d.Status, &d.At); err != nil {
+			return nil, err
+		}
+		report.WiringChanges = append(report.WiringChanges, d)
+	}
+	return report, rows.Err()
+}
+
+// buildDigestWorkbook membuat lampiran xlsx berisi semua baris laporan,
+// satu sheet per bagian.
+func buildDigestWorkbook(r *digestReport, lang string) ([]byte, error) {
+	en := lang == EmailLangEN
+	label := func(id, english string) string {
+		if en {
+			return english
+		}
+		return id
+	}
+	f := excelize.NewFile()
+	defer f.Close()
+	date := func(t *time.Time) interface{} {
+		if t == nil {
+			return ""
+		}
+		return t.In(defaultCalendar().loc).Format("2006-01-02")
+	}
+	sheet := func(name string, headers []interface{}, rows [][]interface{}) error {
+		if len(rows) == 0 {
+			return nil
+		}
+		if _, err := f.NewSheet(name); err != nil {
+			return err
+		}
+		if err := f.SetSheetRow(name, "A1", &headers); err != nil {
+			return err
+		}
+		for i, row := range rows {
+			if err := f.SetSheetRow(name, fmt.Sprintf("A%d", i+2), &row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	panelRows := func(list []digestPanel) [][]interface{} {
+		var out [][]interface{}
+		for _, d := range list {
+			out = append(out, []interface{}{d.NoPp, d.NoPanel, d.Project, date(d.TargetDelivery), d.Progress})
+		}
+		return out
+	}
+	panelHeaders := []interface{}{"no_pp", "no_panel", "project", "target_delivery", "percent_progress"}
+	issueRows := func(list []digestIssue) [][]interface{} {
+		var out [][]interface{}
+		for _, d := range list {
+			out = append(out, []interface{}{d.ID, d.PanelNoPp, d.NoPanel, d.Title, d.Status, d.By, date(&d.At)})
+		}
+		return out
+	}
+	issueHeaders := []interface{}{"issue_id", "no_pp", "no_panel", "title", "status", "created_by", "date"}
+	var srRows, wiringRows, notifRows [][]interface{}
+	for _, d := range r.PendingSRs {
+		srRows = append(srRows, []interface{}{d.ID, d.PanelNoPp, d.NoPanel, d.PoNumber, d.Item, d.Quantity, d.Supplier, d.Status, date(&d.CreatedAt)})
+	}
+	for _, d := range r.WiringChanges {
+		var from interface{} = ""
+		if d.From != nil {
+			from = *d.From
+		}
+		wiringRows = append(wiringRows, []interface{}{d.PanelNoPp, d.NoPanel, d.Package, d.Supplier, from, d.To, d.Status, date(&d.At)})
+	}
+	for _, d := range r.Notifications {
+		notifRows = append(notifRows, []interface{}{d.Event, d.Title, d.Body, d.CreatedAt.In(defaultCalendar().loc).Format("2006-01-02 15:04")})
+	}
+
+	sheets := []struct {
+		name    string
+		headers []interface{}
+		rows    [][]interface{}
+	}{
+		{label("Jatuh Tempo", "Due Soon"), panelHeaders, panelRows(r.DueSoon)},
+		{label("Baru Terlambat", "Newly Overdue"), panelHeaders, panelRows(r.NewlyOverdue)},
+		{label("Isu Baru", "Issues Opened"), issueHeaders, issueRows(r.IssuesOpened)},
+		{label("Isu Selesai", "Issues Solved"), issueHeaders, issueRows(r.IssuesSolved)},
+		{label("SR Tertunda", "Pending SR"), []interface{}{"sr_id", "no_pp", "no_panel", "po_number", "item", "quantity", "supplier", "status", "created_at"}, srRows},
+		{label("Progress Wiring", "Wiring Progress"), []interface{}{"no_pp", "no_panel", "package", "supplier", "progress_from", "progress", "status", "updated_at"}, wiringRows},
+		{label("Notifikasi", "Notifications"), []interface{}{"event", "title", "body", "created_at"}, notifRows},
+	}
+	for _, s := range sheets {
+		if err := sheet(s.name, s.headers, s.rows); err != nil {
+			return nil, err
+		}
+	}
+	if len(f.GetSheetList()) > 1 {
+		f.DeleteSheet("Sheet1")
+	}
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html"
+	"html/template"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Template email ada di templates/email dan ikut di-embed ke binary. Setiap
+// email punya satu file per bahasa (<nama>.<id|en>.html) yang mendefinisikan
+// "subject" dan "content"; layout.html menambahkan header dan footer brand.
+
+//go:embed templates/email/*.html
+var emailTemplateFS embed.FS
+
+const (
+	EmailLangID = "id"
+	EmailLangEN = "en"
+)
+
+var emailLanguages = map[string]bool{EmailLangID: true, EmailLangEN: true}
+
+var emailTemplateNames = []string{"issue_created", "issue_status_changed", "issue_notify_added", "issue_comment", "digest"}
+
+type emailBrand struct {
+	Name    string
+	Color   string
+	LogoURL string
+	AppURL  string
+}
+
+// emailView adalah data yang diterima setiap template.
+type emailView struct {
+	Lang  string
+	Brand emailBrand
+	Data  interface{}
+}
+
+var emailTemplates = parseEmailTemplates()
+
+var emailTemplateFuncs = template.FuncMap{
+	"date": func(v interface{}) string {
+		switch t := v.(type) {
+		case time.Time:
+			return t.In(defaultCalendar().loc).Format("02 Jan 2006")
+		case *time.Time:
+			if t != nil {
+				return t.In(defaultCalendar().loc).Format("02 Jan 2006")
+			}
+		}
+		return "-"
+	},
+	"datetime": func(t time.Time) string {
+		return t.In(defaultCalendar().loc).Format("02 Jan 2006 15:04")
+	},
+	// limit dan more dipakai untuk memotong tabel panjang di badan email.
+	"limit": func(n int, list interface{}) interface{} {
+		v := reflect.ValueOf(list)
+		if v.Kind() != reflect.Slice || v.Len() <= n {
+			return list
+		}
+		return v.Slice(0, n).Interface()
+	},
+	"more": func(n int, list interface{}) int {
+		v := reflect.ValueOf(list)
+		if v.Kind() != reflect.Slice || v.Len() <= n {
+			return 0
+		}
+		return v.Len() - n
+	},
+}
+
+func parseEmailTemplates() map[string]*template.Template {
+	out := map[string]*template.Template{}
+	for _, name := range emailTemplateNames {
+		for lang := range emailLanguages {
+			file := fmt.Sprintf("templates/email/%s.%s.html", name, lang)
+			out[name+"."+lang] = template.Must(template.New(name).Funcs(emailTemplateFuncs).
+				ParseFS(emailTemplateFS, "templates/email/layout.html", file))
+		}
+	}
+	return out
+}
+
+// defaultEmailLanguage: EMAIL_DEFAULT_LANGUAGE (id atau en), default id.
+func defaultEmailLanguage() string {
+	if lang := strings.ToLower(os.Getenv("EMAIL_DEFAULT_LANGUAGE")); emailLanguages[lang] {
+		return lang
+	}
+	return EmailLangID
+}
+
+func emailLanguage(lang string) string {
+	if emailLanguages[lang] {
+		return lang
+	}
+	return defaultEmailLanguage()
+}
+
+func currentEmailBrand() emailBrand {
+	b := emailBrand{
+		Name:    os.Getenv("EMAIL_BRAND_NAME"),
+		Color:   os.Getenv("EMAIL_BRAND_COLOR"),
+		LogoURL: os.Getenv("EMAIL_BRAND_LOGO_URL"),
+		AppURL:  os.Getenv("PUBLIC_APP_URL"),
+	}
+	if b.Name == "" {
+		b.Name = "TrisutorPRO"
+	}
+	if b.Color == "" {
+		b.Color = "#2c3e50"
+	}
+	return b
+}
+
+// renderEmail mengembalikan subject (teks biasa) dan badan HTML.
+func renderEmail(name, lang string, data interface{}) (string, string, error) {
+	lang = emailLanguage(lang)
+	tmpl, ok := emailTemplates[name+"."+lang]
+	if !ok {
+		return "", "", fmt.Errorf("template email %q tidak ada", name)
+	}
+	view := emailView{Lang: lang, Brand: currentEmailBrand(), Data: data}
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", view); err != nil {
+		return "", "", fmt.Errorf("render subject %s: %w", name, err)
+	}
+	if err := tmpl.ExecuteTemplate(&body, "layout", view); err != nil {
+		return "", "", fmt.Errorf("render email %s: %w", name, err)
+	}
+	return strings.TrimSpace(html.UnescapeString(subject.String())), body.String(), nil
+}
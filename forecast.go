@@ -0,0 +1,432 @@
+package main
+
+import (
+	"database/sql"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Forecast tanggal selesai panel dari durasi tahap historis:
+//   - warehouse:  start_date sampai panel keluar warehouse (history_stack), per panel_type
+//   - production: masuk Production/Subcontractor sampai FAT, per panel_type
+//   - fat:        masuk FAT sampai Done, per panel_type
+//   - busbar:     ao_busbar_pcc sampai close_date_busbar_pcc, per vendor busbar
+//   - wiring:     created_at sampai closed_at, per supplier wiring
+// Busbar dan wiring berjalan paralel dengan tahap warehouse; produksi baru
+// mulai setelah semuanya siap.
+
+const (
+	forecastMinSamples = 3
+	forecastModelTTL   = 10 * time.Minute
+	// forecastSampleHalf adalah jumlah sampel saat faktor ukuran sampel
+	// bernilai 0.5; makin banyak sampel makin mendekati 1.
+	forecastSampleHalf = 5
+)
+
+type stageStats struct {
+	Samples int
+	P10     float64
+	P50     float64
+	P90     float64
+}
+
+func (s stageStats) days(q int) float64 {
+	switch q {
+	case 0:
+		return s.P10
+	case 2:
+		return s.P90
+	}
+	return s.P50
+}
+
+// confidence menggabungkan ukuran sampel dan sebaran relatif (P90-P10)/P50:
+// sedikit sampel atau rentang lebar menurunkan keyakinan.
+func (s stageStats) confidence() float64 {
+	if s.Samples <= 0 {
+		return 0
+	}
+	size := float64(s.Samples) / float64(s.Samples+forecastSampleHalf)
+	spread := 0.0
+	if s.P50 > 0 {
+		spread = (s.P90 - s.P10) / s.P50
+	} else if s.P90 > s.P10 {
+		spread = 1
+	}
+	return math.Round(size/(1+spread)*100) / 100
+}
+
+// forecastModel berisi statistik per tahap; kunci "" adalah statistik
+// gabungan semua panel_type/vendor.
+type forecastModel struct {
+	builtAt time.Time
+	stages  map[string]map[string]stageStats
+}
+
+type ForecastBasis struct {
+	Stage      string  `json:"stage"`
+	Key        string  `json:"key,omitempty"`
+	Source     string  `json:"source"`
+	Samples    int     `json:"samples"`
+	MedianDays float64 `json:"median_days"`
+	Confidence float64 `json:"confidence"`
+}
+
+type PanelForecast struct {
+	NoPp           string          `json:"no_pp"`
+	Stage          string          `json:"stage"`
+	Predicted      time.Time       `json:"predicted_completion"`
+	Earliest       time.Time       `json:"earliest"`
+	Latest         time.Time       `json:"latest"`
+	Confidence     *float64        `json:"confidence"`
+	TargetDelivery *time.Time      `json:"target_delivery"`
+	LikelyLate     bool            `json:"likely_late"`
+	DaysLate       int             `json:"days_late"`
+	Basis          []ForecastBasis `json:"basis"`
+}
+
+var forecastCache struct {
+	sync.Mutex
+	model *forecastModel
+}
+
+// forecastSamplesSQL mengukur durasi tiap tahap dalam hari kerja kalender default.
+const forecastSamplesSQL = `
+	WITH milestones AS (
+		SELECT p.no_pp, LOWER(COALESCE(p.panel_type, '')) AS panel_type, p.start_date,
+			MAX(h.ts) FILTER (WHERE h.status IN ('Vendor K3', 'VendorWarehouse', 'Warehouse')) AS production_at,
+			MAX(h.ts) FILTER (WHERE h.status IN ('Production', 'Subcontractor')) AS fat_at,
+			MAX(h.ts) FILTER (WHERE h.status = 'FAT') AS done_at
+		FROM panels p
+		LEFT JOIN LATERAL (
+			SELECT e->>'snapshot_status' AS status,
+				CASE WHEN e->>'timestamp' ~ '^\d{4}-\d{2}-\d{2}' THEN (e->>'timestamp')::timestamptz END AS ts
+			FROM jsonb_array_elements(CASE WHEN jsonb_typeof(p.history_stack) = 'array' THEN p.history_stack ELSE '[]'::jsonb END) e
+		) h ON true
+		WHERE p.deleted_at IS NULL
+		GROUP BY p.no_pp
+	),
+	samples AS (
+		SELECT 'warehouse' AS stage, panel_type AS key, working_days_between(NULL, calendar_date(NULL, start_date), calendar_date(NULL, production_at)) AS span
+		FROM milestones WHERE production_at > start_date
+		UNION ALL
+		SELECT 'production', panel_type, working_days_between(NULL, calendar_date(NULL, production_at), calendar_date(NULL, fat_at)) FROM milestones WHERE fat_at > production_at
+		UNION ALL
+		SELECT 'fat', panel_type, working_days_between(NULL, calendar_date(NULL, fat_at), calendar_date(NULL, done_at)) FROM milestones WHERE done_at > fat_at
+		UNION ALL
+		SELECT 'busbar', b.vendor, working_days_between(NULL, calendar_date(NULL, p.ao_busbar_pcc), calendar_date(NULL, p.close_date_busbar_pcc))
+		FROM panels p JOIN busbars b ON b.panel_no_pp = p.no_pp
+		WHERE p.deleted_at IS NULL AND p.close_date_busbar_pcc > p.ao_busbar_pcc
+		UNION ALL
+		SELECT 'wiring', w.supplier, working_days_between(NULL, calendar_date(NULL, w.created_at), calendar_date(NULL, w.closed_at))
+		FROM wirings w WHERE COALESCE(w.supplier, '') <> '' AND w.closed_at > w.created_at
+	)
+	SELECT stage, key, GROUPING(key) = 1, COUNT(*),
+		percentile_cont(ARRAY[0.1, 0.5, 0.9]) WITHIN GROUP (ORDER BY span)
+	FROM samples
+	GROUP BY GROUPING SETS ((stage, key), (stage))`
+
+func buildForecastModel(db DBTX) (*forecastModel, error) {
+	rows, err := db.Query(forecastSamplesSQL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	m := &forecastModel{builtAt: time.Now(), stages: map[string]map[string]stageStats{}}
+	for rows.Next() {
+		var stage string
+		var key sql.NullString
+		var total bool
+		var s stageStats
+		var q []float64
+		if err := rows.Scan(&stage, &key, &total, &s.Samples, pq.Array(&q)); err != nil {
+			return nil, err
+		}
+		if !total && key.String == "" {
+			continue
+		}
+		if len(q) == 3 {
+			s.P10, s.P50, s.P90 = q[0], q[1], q[2]
+		}
+		if m.stages[stage] == nil {
+			m.stages[stage] = map[string]stageStats{}
+		}
+		m.stages[stage][key.String] = s
+	}
+	return m, rows.Err()
+}
+
+// currentForecastModel memakai model yang di-cache; model dihitung ulang
+// setiap forecastModelTTL karena data historis berubah lambat.
+func currentForecastModel(db DBTX) (*forecastModel, error) {
+	forecastCache.Lock()
+	defer forecastCache.Unlock()
+	if forecastCache.model != nil && time.Since(forecastCache.model.builtAt) < forecastModelTTL {
+		return forecastCache.model, nil
+	}
+	m, err := buildForecastModel(db)
+	if err != nil {
+		return nil, err
+	}
+	forecastCache.model = m
+	return m, nil
+}
+
+// lookup mencari statistik tahap untuk key tertentu, turun ke statistik
+// gabungan bila sampel kurang, lalu ke durasi default.
+func (m *forecastModel) lookup(stage, key string) (stageStats, ForecastBasis) {
+	basis := ForecastBasis{Stage: stage, Key: key}
+	if s, ok := m.stages[stage][key]; ok && key != "" && s.Samples >= forecastMinSamples {
+		basis.Source, basis.Samples, basis.MedianDays = "history", s.Samples, s.P50
+		basis.Confidence = s.confidence()
+		return s, basis
+	}
+	if s, ok := m.stages[stage][""]; ok && s.Samples >= forecastMinSamples {
+		basis.Source, basis.Samples, basis.MedianDays = "history_all", s.Samples, s.P50
+		basis.Confidence = s.confidence()
+		return s, basis
+	}
+	days := float64(productionLeadDays())
+	if stage == "fat" {
+		days = defaultFatDays
+	}
+	basis.Source, basis.MedianDays = "default", days
+	return stageStats{P10: days, P50: days, P90: days}, basis
+}
+
+type forecastInput struct {
+	NoPp           string
+	PanelType      string
+	State          string
+	StartDate      *time.Time
+	TargetDelivery *time.Time
+	History        []byte
+	AoBusbar       *time.Time
+	BusbarClosed   bool
+	BusbarVendors  []string
+	OpenWirings    []forecastWiring
+}
+
+type forecastWiring struct {
+	Supplier  string
+	CreatedAt time.Time
+}
+
+// addDays menambah durasi dalam hari kerja kalender default.
+func addDays(t time.Time, days float64) time.Time {
+	return defaultCalendar().AddWorkingDuration(t, days)
+}
+
+// predict menghitung perkiraan selesai untuk kuantil q (0 = P10, 1 = P50,
+// 2 = P90). ok bernilai false untuk panel yang sudah Done.
+func (m *forecastModel) predict(in forecastInput, q int) (time.Time, []ForecastBasis, bool) {
+	now := time.Now()
+	production, fat, _ := workflowMilestones(in.History)
+	var basis []ForecastBasis
+	use := func(stage, key string) float64 {
+		s, b := m.lookup(stage, key)
+		basis = append(basis, b)
+		return s.days(q)
+	}
+
+	switch normalizeWorkflowState(in.State) {
+	case "Done":
+		return time.Time{}, nil, false
+	case "FAT":
+		base := now
+		if fat != nil {
+			base = *fat
+		}
+		return laterOf(addDays(base, use("fat", in.PanelType)), now), basis, true
+	case "Production", "Subcontractor":
+		base := now
+		if production != nil {
+			base = *production
+		}
+		t := laterOf(addDays(base, use("production", in.PanelType)), now)
+		return addDays(t, use("fat", in.PanelType)), basis, true
+	}
+
+	ready := now
+	if in.StartDate != nil {
+		ready = laterOf(ready, addDays(*in.StartDate, use("warehouse", in.PanelType)))
+	}
+	if !in.BusbarClosed {
+		base := now
+		if in.AoBusbar != nil {
+			base = *in.AoBusbar
+		}
+		vendors := in.BusbarVendors
+		if len(vendors) == 0 {
+			vendors = []string{""}
+		}
+		for _, v := range vendors {
+			ready = laterOf(ready, addDays(base, use("busbar", v)))
+		}
+	}
+	for _, w := range in.OpenWirings {
+		ready = laterOf(ready, addDays(w.CreatedAt, use("wiring", w.Supplier)))
+	}
+	t := addDays(ready, use("production", in.PanelType))
+	return addDays(t, use("fat", in.PanelType)), basis, true
+}
+
+func (m *forecastModel) forecast(in forecastInput) (PanelForecast, bool) {
+	predicted, basis, ok := m.predict(in, 1)
+	if !ok {
+		return PanelForecast{}, false
+	}
+	earliest, _, _ := m.predict(in, 0)
+	latest, _, _ := m.predict(in, 2)
+	f := PanelForecast{
+		NoPp:           in.NoPp,
+		Stage:          normalizeWorkflowState(in.State),
+		Predicted:      dayStart(predicted),
+		Earliest:       dayStart(earliest),
+		Latest:         dayStart(latest),
+		Confidence:     forecastConfidence(basis),
+		TargetDelivery: in.TargetDelivery,
+		Basis:          basis,
+	}
+	if in.TargetDelivery != nil {
+		target := dayStart(*in.TargetDelivery)
+		if f.Predicted.After(target) {
+			f.LikelyLate = true
+			f.DaysLate = defaultCalendar().WorkingDaysBetween(target, f.Predicted)
+		}
+	}
+	return f, true
+}
+
+// forecastConfidence adalah keyakinan terendah dari tahap-tahap yang dipakai.
+// Bila ada tahap yang jatuh ke durasi default (tanpa data historis), rentang
+// P10-P90 tidak bermakna sehingga keyakinan dikosongkan (null).
+func forecastConfidence(basis []ForecastBasis) *float64 {
+	if len(basis) == 0 {
+		return nil
+	}
+	c := 1.0
+	for _, b := range basis {
+		if b.Source == "default" {
+			return nil
+		}
+		c = math.Min(c, b.Confidence)
+	}
+	return &c
+}
+
+// loadForecastInputs mengambil data panel yang belum Done sesuai where
+// (alias p, parameter mulai $1).
+func loadForecastInputs(db DBTX, where string, args ...interface{}) ([]forecastInput, error) {
+	rows, err := db.Query(`
+		SELECT p.no_pp, LOWER(COALESCE(p.panel_type, '')), COALESCE(p.status_penyelesaian, ''),
+			p.start_date, p.target_delivery, p.history_stack, p.ao_busbar_pcc,
+			p.close_date_busbar_pcc IS NOT NULL OR COALESCE(p.status_busbar_pcc, '') = 'Close',
+			ARRAY(SELECT b.vendor FROM busbars b WHERE b.panel_no_pp = p.no_pp ORDER BY b.vendor)
+		FROM panels p
+		WHERE p.deleted_at IS NULL AND COALESCE(p.status_penyelesaian, '') <> 'Done' AND `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	var list []forecastInput
+	index := map[string]int{}
+	for rows.Next() {
+		var in forecastInput
+		if err := rows.Scan(&in.NoPp, &in.PanelType, &in.State, &in.StartDate, &in.TargetDelivery, &in.History,
+			&in.AoBusbar, &in.BusbarClosed, pq.Array(&in.BusbarVendors)); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[in.NoPp] = len(list)
+		list = append(list, in)
+	}
+	rows.Close()
+	if len(list) == 0 {
+		return list, nil
+	}
+
+	noPps := make([]string, 0, len(list))
+	for _, in := range list {
+		noPps = append(noPps, in.NoPp)
+	}
+	rows, err = db.Query(`
+		SELECT panel_no_pp, COALESCE(supplier, ''), COALESCE(created_at, NOW())
+		FROM wirings
+		WHERE archived_at IS NULL AND closed_at IS NULL AND panel_no_pp = ANY($1)`, pq.Array(noPps))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var noPp string
+		var w forecastWiring
+		if err := rows.Scan(&noPp, &w.Supplier, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		i := index[noPp]
+		list[i].OpenWirings = append(list[i].OpenWirings, w)
+	}
+	return list, rows.Err()
+}
+
+// likelyLatePanels mengembalikan no_pp panel dalam scope yang perkiraan
+// selesainya melewati target_delivery.
+func likelyLatePanels(db DBTX, scopeQuery string, scopeArgs []interface{}) ([]string, error) {
+	model, err := currentForecastModel(db)
+	if err != nil {
+		return nil, err
+	}
+	inputs, err := loadForecastInputs(db, "p.target_delivery IS NOT NULL AND p.no_pp IN ("+scopeQuery+")", scopeArgs...)
+	if err != nil {
+		return nil, err
+	}
+	late := []string{}
+	for _, in := range inputs {
+		if f, ok := model.forecast(in); ok && f.LikelyLate {
+			late = append(late, in.NoPp)
+		}
+	}
+	return late, nil
+}
+
+func (a *App) panelForecast(noPp string) (*PanelForecast, error) {
+	model, err := currentForecastModel(a.DB)
+	if err != nil {
+		return nil, err
+	}
+	inputs, err := loadForecastInputs(a.DB, "p.no_pp = $1", noPp)
+	if err != nil || len(inputs) == 0 {
+		return nil, err
+	}
+	f, ok := model.forecast(inputs[0])
+	if !ok {
+		return nil, nil
+	}
+	return &f, nil
+}
+
+// getPanelForecastHandler: GET /panels/{no_pp}/forecast. Panel yang sudah
+// Done mengembalikan forecast null.
+func (a *App) getPanelForecastHandler(w http.ResponseWriter, r *http.Request) {
+	noPp := mux.Vars(r)["no_pp"]
+	var exists bool
+	if err := a.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM panels WHERE no_pp = $1 AND deleted_at IS NULL)`, noPp).Scan(&exists); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !exists {
+		respondWithError(w, http.StatusNotFound, "Panel tidak ditemukan")
+		return
+	}
+	f, err := a.panelForecast(noPp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menghitung forecast: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"no_pp": noPp, "forecast": f})
+}
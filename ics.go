@@ -0,0 +1,482 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Feed ICS (lihat migrasi 0013_calendar_feeds). Isinya dibangun ulang setiap
+// kali client kalender melakukan polling, jadi perubahan target_delivery,
+// tanggal AO busbar, transfer panel dan tanggal SR langsung ikut terbawa.
+// UID event stabil per panel/baris sehingga client memperbarui event yang
+// sama, bukan menambah duplikat.
+
+var icsEventKinds = []string{"delivery", "wiring_delivery", "ao_busbar", "production", "fat", "sr_close"}
+
+// Panel yang sudah closed lebih lama dari ini tidak lagi dipublikasikan.
+const icsClosedRetention = "90 days"
+
+type CalendarFeed struct {
+	ID             int        `json:"id"`
+	Name           string     `json:"name"`
+	Owner          string     `json:"owner"`
+	Username       *string    `json:"username"`
+	CompanyID      *string    `json:"company_id"`
+	Events         []string   `json:"events"`
+	ProjectID      *int       `json:"project_id"`
+	CreatedBy      *string    `json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastAccessedAt *time.Time `json:"last_accessed_at"`
+	Token          string     `json:"token,omitempty"`
+	URL            string     `json:"url,omitempty"`
+}
+
+const calendarFeedColumns = `f.id, f.name, f.username, f.company_id, f.events, f.project_id, f.created_by, f.created_at, f.last_accessed_at`
+
+func scanCalendarFeed(s interface{ Scan(...interface{}) error }) (CalendarFeed, error) {
+	var f CalendarFeed
+	err := s.Scan(&f.ID, &f.Name, &f.Username, &f.CompanyID, pq.Array(&f.Events), &f.ProjectID, &f.CreatedBy, &f.CreatedAt, &f.LastAccessedAt)
+	f.Owner = "user"
+	if f.CompanyID != nil {
+		f.Owner = "company"
+	}
+	if len(f.Events) == 0 {
+		f.Events = icsEventKinds
+	}
+	return f, err
+}
+
+// calendarFeedURL memakai PUBLIC_BASE_URL bila diset; di belakang reverse
+// proxy, host dan skema diambil dari request.
+func calendarFeedURL(r *http.Request, token string) string {
+	base := strings.TrimRight(os.Getenv("PUBLIC_BASE_URL"), "/")
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+			scheme = proto
+		}
+		base = scheme + "://" + r.Host
+	}
+	return base + "/ics/" + token + ".ics"
+}
+
+// calendarFeedOwnerFilter membatasi feed yang boleh dikelola user: miliknya
+// sendiri atau milik company-nya. Admin boleh semua.
+func calendarFeedOwnerFilter(id Identity, argOffset int) (string, []interface{}) {
+	if id.Role == AppRoleAdmin {
+		return "true", nil
+	}
+	return fmt.Sprintf("(f.username = $%d OR f.company_id = $%d)", argOffset+1, argOffset+2), []interface{}{id.Username, id.CompanyID}
+}
+
+func (a *App) getCalendarFeedsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, args := calendarFeedOwnerFilter(requestIdentity(r), 0)
+	rows, err := a.DB.Query(`SELECT `+calendarFeedColumns+` FROM calendar_feeds f
+		WHERE f.revoked_at IS NULL AND `+filter+` ORDER BY f.created_at DESC`, args...)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil feed kalender: "+err.Error())
+		return
+	}
+	defer rows.Close()
+	feeds := []CalendarFeed{}
+	for rows.Next() {
+		f, err := scanCalendarFeed(rows)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		feeds = append(feeds, f)
+	}
+	respondWithJSON(w, http.StatusOK, feeds)
+}
+
+// createCalendarFeedHandler: POST /calendar-feeds
+// {"owner": "user"|"company", "name": "...", "events": [...], "project_id": 1}.
+// Token hanya dikembalikan di respons ini (dan saat rotate).
+func (a *App) createCalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	id := requestIdentity(r)
+	var payload struct {
+		Owner     string   `json:"owner"`
+		CompanyID string   `json:"company_id"`
+		Name      string   `json:"name"`
+		Events    []string `json:"events"`
+		ProjectID *int     `json:"project_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid payload: "+err.Error())
+		return
+	}
+	events, err := normalizeIcsEvents(payload.Events)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var username, companyID interface{}
+	switch payload.Owner {
+	case "", "user":
+		username = id.Username
+	case "company":
+		companyID = id.CompanyID
+		if payload.CompanyID != "" && payload.CompanyID != id.CompanyID {
+			if id.Role != AppRoleAdmin {
+				respondWithError(w, http.StatusForbidden, "Hanya admin yang dapat membuat feed untuk company lain")
+				return
+			}
+			companyID = payload.CompanyID
+		}
+	default:
+		respondWithError(w, http.StatusBadRequest, "owner harus user atau company")
+		return
+	}
+
+	token, err := newOpaqueToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal membuat token: "+err.Error())
+		return
+	}
+	f, err := scanCalendarFeed(a.DB.QueryRow(`
+		INSERT INTO calendar_feeds AS f (token_hash, username, company_id, name, events, project_id, created_by)
+		VALUES ($1, $2, $3, BTRIM($4), $5, $6, $7)
+		RETURNING `+calendarFeedColumns,
+		hashToken(token), username, companyID, payload.Name, pq.Array(events), payload.ProjectID, id.Username))
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			respondWithError(w, http.StatusBadRequest, "Company atau project tidak ditemukan")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Gagal membuat feed kalender: "+err.Error())
+		return
+	}
+	f.Token, f.URL = token, calendarFeedURL(r, token)
+	respondWithJSON(w, http.StatusCreated, f)
+}
+
+func normalizeIcsEvents(events []string) ([]string, error) {
+	valid := map[string]bool{}
+	for _, k := range icsEventKinds {
+		valid[k] = true
+	}
+	seen := map[string]bool{}
+	out := []string{}
+	for _, e := range events {
+		e = strings.TrimSpace(e)
+		if !valid[e] {
+			return nil, fmt.Errorf("Jenis event tidak dikenal: %s (pilihan: %s)", e, strings.Join(icsEventKinds, ", "))
+		}
+		if !seen[e] {
+			seen[e] = true
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// rotateCalendarFeedHandler mengganti token; URL lama langsung tidak berlaku.
+func (a *App) rotateCalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	feedID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ID feed tidak valid")
+		return
+	}
+	token, err := newOpaqueToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal membuat token: "+err.Error())
+		return
+	}
+	filter, args := calendarFeedOwnerFilter(requestIdentity(r), 2)
+	f, err := scanCalendarFeed(a.DB.QueryRow(`
+		UPDATE calendar_feeds f SET token_hash = $2
+		WHERE f.id = $1 AND f.revoked_at IS NULL AND `+filter+`
+		RETURNING `+calendarFeedColumns, append([]interface{}{feedID, hashToken(token)}, args...)...))
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Feed kalender tidak ditemukan")
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengganti token feed: "+err.Error())
+		return
+	}
+	f.Token, f.URL = token, calendarFeedURL(r, token)
+	respondWithJSON(w, http.StatusOK, f)
+}
+
+func (a *App) deleteCalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	feedID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ID feed tidak valid")
+		return
+	}
+	filter, args := calendarFeedOwnerFilter(requestIdentity(r), 1)
+	res, err := a.DB.Exec(`UPDATE calendar_feeds f SET revoked_at = NOW()
+		WHERE f.id = $1 AND f.revoked_at IS NULL AND `+filter, append([]interface{}{feedID}, args...)...)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mencabut feed kalender: "+err.Error())
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusNotFound, "Feed kalender tidak ditemukan")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+type icsEvent struct {
+	UID         string
+	Kind        string
+	Date        time.Time
+	Summary     string
+	Description string
+	Sequence    int64
+	Modified    *time.Time
+}
+
+// buildIcsEvents mengumpulkan event untuk panel yang terlihat oleh
+// scopeQuery. events kosong berarti semua jenis event.
+func buildIcsEvents(db DBTX, scopeQuery string, args []interface{}, events []string, projectID *int) ([]icsEvent, error) {
+	want := map[string]bool{}
+	for _, e := range events {
+		want[e] = true
+	}
+	if len(want) == 0 {
+		for _, e := range icsEventKinds {
+			want[e] = true
+		}
+	}
+	args = append(append([]interface{}{}, args...), projectID)
+	panelFilter := fmt.Sprintf(`p.no_pp IN (%s) AND ($%d::int IS NULL OR p.project_id = $%d)
+		AND (COALESCE(p.is_closed, false) = false OR p.closed_date > NOW() - INTERVAL '%s')`,
+		scopeQuery, len(args), len(args), icsClosedRetention)
+
+	var list []icsEvent
+	add := func(kind, key string, date *time.Time, summary, description string, seq int64, modified *time.Time) {
+		if date == nil || !want[kind] {
+			return
+		}
+		list = append(list, icsEvent{
+			UID:         kind + "-" + url.PathEscape(key) + "@secpanel",
+			Kind:        kind,
+			Date:        dayStart(*date),
+			Summary:     summary,
+			Description: description,
+			Sequence:    seq,
+			Modified:    modified,
+		})
+	}
+
+	if want["delivery"] || want["ao_busbar"] || want["production"] || want["fat"] {
+		rows, err := db.Query(`
+			SELECT p.no_pp, COALESCE(p.no_panel, ''), COALESCE(p.project, ''), COALESCE(p.no_wbs, ''),
+				p.target_delivery, p.ao_busbar_pcc, p.ao_busbar_mcc, p.history_stack, p.version
+			FROM panels p WHERE `+panelFilter, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var noPp, noPanel, project, wbs string
+			var target, aoPcc, aoMcc *time.Time
+			var history []byte
+			var version int64
+			if err := rows.Scan(&noPp, &noPanel, &project, &wbs, &target, &aoPcc, &aoMcc, &history, &version); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			label := noPp
+			if noPanel != "" {
+				label = noPanel + " (" + noPp + ")"
+			}
+			desc := fmt.Sprintf("Project: %s\nWBS: %s\nNo. PP: %s", project, wbs, noPp)
+			production, fat, _ := workflowMilestones(history)
+			add("delivery", noPp, target, "Target delivery panel "+label, desc, version, nil)
+			add("ao_busbar", noPp+"-pcc", aoPcc, "AO busbar PCC "+label, desc, version, nil)
+			add("ao_busbar", noPp+"-mcc", aoMcc, "AO busbar MCC "+label, desc, version, nil)
+			add("production", noPp, production, "Masuk produksi "+label, desc, version, nil)
+			add("fat", noPp, fat, "FAT "+label, desc, version, nil)
+		}
+		rows.Close()
+	}
+
+	if want["wiring_delivery"] {
+		rows, err := db.Query(`
+			SELECT w.id, w.panel_no_pp, w.package_name, COALESCE(w.supplier, ''), w.target_delivery_wiring,
+				w.version, w.updated_at
+			FROM wirings w JOIN panels p ON p.no_pp = w.panel_no_pp
+			WHERE w.archived_at IS NULL AND w.target_delivery_wiring IS NOT NULL AND `+panelFilter, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var wiringID int
+			var noPp, pkg, supplier string
+			var target, updated *time.Time
+			var version int64
+			if err := rows.Scan(&wiringID, &noPp, &pkg, &supplier, &target, &version, &updated); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			add("wiring_delivery", strconv.Itoa(wiringID), target,
+				fmt.Sprintf("Target wiring %s - %s", noPp, pkg),
+				fmt.Sprintf("No. PP: %s\nPaket: %s\nSupplier: %s", noPp, pkg, supplier), version, updated)
+		}
+		rows.Close()
+	}
+
+	if want["sr_close"] {
+		rows, err := db.Query(`
+			SELECT sr.id, sr.panel_no_pp, COALESCE(sr.item, ''), COALESCE(sr.po_number, ''), COALESCE(sr.supplier, ''),
+				sr.close_date, sr.version
+			FROM additional_sr sr JOIN panels p ON p.no_pp = sr.panel_no_pp
+			WHERE sr.close_date IS NOT NULL AND `+panelFilter, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var srID int
+			var noPp, item, po, supplier string
+			var closeDate *time.Time
+			var version int64
+			if err := rows.Scan(&srID, &noPp, &item, &po, &supplier, &closeDate, &version); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			add("sr_close", strconv.Itoa(srID), closeDate,
+				fmt.Sprintf("Close SR %s - %s", noPp, item),
+				fmt.Sprintf("No. PP: %s\nPO: %s\nSupplier: %s", noPp, po, supplier), version, nil)
+		}
+		rows.Close()
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Date.Equal(list[j].Date) {
+			return list[i].Date.Before(list[j].Date)
+		}
+		return list[i].UID < list[j].UID
+	})
+	return list, nil
+}
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// writeIcsLine menulis satu content line dengan folding 75 oktet (RFC 5545
+// 3.1) tanpa memotong karakter UTF-8.
+func writeIcsLine(b *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = 74
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+func renderIcs(name string, events []icsEvent, generatedAt time.Time) string {
+	var b strings.Builder
+	stamp := generatedAt.UTC().Format("20060102T150405Z")
+	writeIcsLine(&b, "BEGIN:VCALENDAR")
+	writeIcsLine(&b, "VERSION:2.0")
+	writeIcsLine(&b, "PRODID:-//SEC Panel//Jadwal Panel//ID")
+	writeIcsLine(&b, "CALSCALE:GREGORIAN")
+	writeIcsLine(&b, "METHOD:PUBLISH")
+	writeIcsLine(&b, "X-WR-CALNAME:"+icsEscaper.Replace(name))
+	writeIcsLine(&b, "X-WR-TIMEZONE:"+defaultCalendar().TimeZone)
+	writeIcsLine(&b, "REFRESH-INTERVAL;VALUE=DURATION:PT1H")
+	writeIcsLine(&b, "X-PUBLISHED-TTL:PT1H")
+	for _, e := range events {
+		writeIcsLine(&b, "BEGIN:VEVENT")
+		writeIcsLine(&b, "UID:"+e.UID)
+		writeIcsLine(&b, "DTSTAMP:"+stamp)
+		writeIcsLine(&b, "DTSTART;VALUE=DATE:"+e.Date.Format("20060102"))
+		writeIcsLine(&b, "DTEND;VALUE=DATE:"+e.Date.AddDate(0, 0, 1).Format("20060102"))
+		writeIcsLine(&b, "SUMMARY:"+icsEscaper.Replace(e.Summary))
+		writeIcsLine(&b, "DESCRIPTION:"+icsEscaper.Replace(e.Description))
+		writeIcsLine(&b, "CATEGORIES:"+strings.ToUpper(e.Kind))
+		writeIcsLine(&b, "SEQUENCE:"+strconv.FormatInt(e.Sequence, 10))
+		if e.Modified != nil {
+			writeIcsLine(&b, "LAST-MODIFIED:"+e.Modified.UTC().Format("20060102T150405Z"))
+		}
+		writeIcsLine(&b, "TRANSP:TRANSPARENT")
+		writeIcsLine(&b, "END:VEVENT")
+	}
+	writeIcsLine(&b, "END:VCALENDAR")
+	return b.String()
+}
+
+// serveIcsFeedHandler: GET /ics/{token}.ics. Route publik; token feed menjadi
+// satu-satunya otorisasi, dan cakupan panel mengikuti role company pemilik
+// feed seperti di aplikasi.
+func (a *App) serveIcsFeedHandler(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimSuffix(mux.Vars(r)["token"], ".ics")
+	var feedID int
+	var name, companyID, companyName, role string
+	var events []string
+	var projectID *int
+	err := a.DB.QueryRow(`
+		SELECT f.id, f.name, f.events, f.project_id, co.id, co.name, co.role
+		FROM calendar_feeds f
+		LEFT JOIN company_accounts ca ON ca.username = f.username
+		JOIN companies co ON co.id = COALESCE(f.company_id, ca.company_id)
+		WHERE f.token_hash = $1 AND f.revoked_at IS NULL`, hashToken(token)).
+		Scan(&feedID, &name, pq.Array(&events), &projectID, &companyID, &companyName, &role)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Feed tidak ditemukan", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Gagal memuat feed", http.StatusInternalServerError)
+		return
+	}
+
+	scopeQuery, scopeArgs, ok := panelScopeQuery(role, companyID)
+	if !ok {
+		http.Error(w, "Feed tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	list, err := buildIcsEvents(a.DB, scopeQuery, scopeArgs, events, projectID)
+	if err != nil {
+		log.Printf("ICS: gagal membangun feed %d: %v", feedID, err)
+		http.Error(w, "Gagal memuat feed", http.StatusInternalServerError)
+		return
+	}
+	if name == "" {
+		name = "Jadwal Panel " + companyName
+	}
+	if _, err := a.DB.Exec(`UPDATE calendar_feeds SET last_accessed_at = NOW() WHERE id = $1`, feedID); err != nil {
+		log.Printf("ICS: gagal mencatat akses feed %d: %v", feedID, err)
+	}
+
+	// ETag dihitung dari isi dengan DTSTAMP tetap supaya polling tanpa
+	// perubahan mendapat 304.
+	sum := sha256.Sum256([]byte(renderIcs(name, list, time.Time{})))
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="secpanel.ics"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(renderIcs(name, list, time.Now())))
+}
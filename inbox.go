@@ -0,0 +1,149 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Inbox notifikasi in-app (lihat migrasi 0016_notifications). Setiap pesan
+// outbox juga dicatat per username supaya user bisa melihat notifikasi yang
+// terlewat, termasuk bila token device sudah kedaluwarsa.
+
+type InboxNotification struct {
+	ID        int64           `json:"id"`
+	Event     string          `json:"event"`
+	Title     string          `json:"title"`
+	Body      string          `json:"body"`
+	PanelNoPp *string         `json:"panel_no_pp"`
+	IssueID   *int            `json:"issue_id"`
+	CommentID *string         `json:"comment_id"`
+	Data      json.RawMessage `json:"data"`
+	ReadAt    *time.Time      `json:"read_at"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// recordInboxNotification menulis satu baris inbox untuk setiap username
+// yang mengaktifkan channel in-app (lihat planNotificationDelivery).
+func recordInboxNotification(db DBTX, m outboxMessage, usernames []string, data []byte) error {
+	if len(usernames) == 0 {
+		return nil
+	}
+	title := m.Title
+	if title == "" {
+		title = m.Subject
+	}
+	_, err := db.Exec(`
+		INSERT INTO notifications (username, event, title, body, panel_no_pp, issue_id, comment_id, data)
+		SELECT u, $2, $3, $4, NULLIF($5, ''), NULLIF($6, '')::int, NULLIF($7, ''), $8
+		FROM unnest($1::text[]) u`,
+		pq.Array(usernames), m.Event, title, m.Body,
+		m.Data["panel_no_pp"], m.Data["issue_id"], m.Data["comment_id"], data)
+	return err
+}
+
+func (a *App) getMyNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	username := requestIdentity(r).Username
+	q := r.URL.Query()
+	limit, offset := 50, 0
+	var err error
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			respondWithError(w, http.StatusBadRequest, "limit harus berupa angka positif")
+			return
+		}
+		if limit > 200 {
+			limit = 200
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			respondWithError(w, http.StatusBadRequest, "offset tidak valid")
+			return
+		}
+	}
+	where := "username = $1"
+	if unread, _ := strconv.ParseBool(q.Get("unread")); unread {
+		where += " AND read_at IS NULL"
+	}
+
+	var total int
+	if err := a.DB.QueryRow("SELECT COUNT(*) FROM notifications WHERE "+where, username).Scan(&total); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menghitung notifikasi: "+err.Error())
+		return
+	}
+	rows, err := a.DB.Query(`
+		SELECT id, event, title, body, panel_no_pp, issue_id, comment_id, data, read_at, created_at
+		FROM notifications WHERE `+where+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3`, username, limit, offset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil notifikasi: "+err.Error())
+		return
+	}
+	defer rows.Close()
+
+	items := []InboxNotification{}
+	for rows.Next() {
+		var n InboxNotification
+		var data []byte
+		if err := rows.Scan(&n.ID, &n.Event, &n.Title, &n.Body, &n.PanelNoPp, &n.IssueID, &n.CommentID, &data, &n.ReadAt, &n.CreatedAt); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal membaca notifikasi: "+err.Error())
+			return
+		}
+		n.Data = json.RawMessage(data)
+		items = append(items, n)
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	respondWithJSON(w, http.StatusOK, items)
+}
+
+func (a *App) getMyUnreadCountHandler(w http.ResponseWriter, r *http.Request) {
+	var unread int
+	err := a.DB.QueryRow("SELECT COUNT(*) FROM notifications WHERE username = $1 AND read_at IS NULL",
+		requestIdentity(r).Username).Scan(&unread)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menghitung notifikasi: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]int{"unread": unread})
+}
+
+func (a *App) markNotificationReadHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ID notifikasi tidak valid")
+		return
+	}
+	var readAt time.Time
+	err = a.DB.QueryRow(`
+		UPDATE notifications SET read_at = COALESCE(read_at, NOW())
+		WHERE id = $1 AND username = $2
+		RETURNING read_at`, id, requestIdentity(r).Username).Scan(&readAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Notifikasi tidak ditemukan")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Gagal menandai notifikasi: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"id": id, "read_at": readAt})
+}
+
+func (a *App) markAllNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	res, err := a.DB.Exec("UPDATE notifications SET read_at = NOW() WHERE username = $1 AND read_at IS NULL",
+		requestIdentity(r).Username)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menandai notifikasi: "+err.Error())
+		return
+	}
+	n, _ := res.RowsAffected()
+	respondWithJSON(w, http.StatusOK, map[string]int64{"updated": n})
+}
@@ -18,7 +18,7 @@ import (
 	"strings"
 	"time"
 	//    "bytes"
-	// firebase "firebase.google.com/go/v4"
+	firebase "firebase.google.com/go/v4"
 	"firebase.google.com/go/v4/messaging"
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
@@ -38,6 +38,7 @@ const (
 	AppRoleWarehouse = "warehouse"
 	AppRoleK3        = "k3"
 	AppRoleK5        = "k5"
+	AppRoleG3        = "g3"
 )
 
 type CustomImportRequest struct {
@@ -173,6 +174,7 @@ type Issue struct {
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	NotifyEmail *string   `json:"notify_email,omitempty"`
+	Version     int64     `json:"version,omitempty"`
 }
 
 type Photo struct {
@@ -203,14 +205,17 @@ type Wiring struct {
 	NoWBS                string     `json:"no_wbs"`
 	NoPanel              string     `json:"no_panel"`
 	PanelType            string     `json:"panel_type"`
+	PackageName          string     `json:"package_name,omitempty"`
 	Supplier             string     `json:"supplier"`
 	Progress             int        `json:"progress"`
 	Status               string     `json:"status"`
 	TargetDeliveryWiring *time.Time `json:"target_delivery_wiring"`
 	ActualDeliveryWiring *time.Time `json:"actual_delivery_wiring"`
 	ClosedAt             *time.Time `json:"closed_at,omitempty"`
+	ArchivedAt           *time.Time `json:"archived_at,omitempty"`
 	CreatedAt            time.Time  `json:"created_at,omitempty"`
 	UpdatedAt            time.Time  `json:"updated_at,omitempty"`
+	Version              int64      `json:"version,omitempty"`
 }
 
 type MassReplaceWiringRequest struct {
@@ -239,6 +244,18 @@ func (a *App) MassReplaceWiringHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
+	var auditNoPps []string
+	for _, item := range input.Data {
+		auditNoPps = append(auditNoPps, item.PanelNoPP)
+	}
+	wiringAudit := beginAudit(tx, "wiring", "t.panel_no_pp = ANY($1)", pq.Array(auditNoPps))
+	panelAudit := beginAudit(tx, "panel", "t.no_pp = ANY($1)", pq.Array(auditNoPps))
+	g3Audit := beginAudit(tx, "g3_vendor", "t.panel_no_pp = ANY($1)", pq.Array(auditNoPps))
+	if err := setWiringActor(tx, requestIdentity(r).Username, AuditSourceImport); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	for _, item := range input.Data {
 		if item.PanelNoPP == "" || item.NoWBS == "" {
 			continue
@@ -247,8 +264,8 @@ func (a *App) MassReplaceWiringHandler(w http.ResponseWriter, r *http.Request) {
 		
 		var existingClosedAt *time.Time
 
-		err := tx.QueryRow(`SELECT closed_at FROM wirings WHERE panel_no_pp = $1 AND no_wbs = $2`,
-			item.PanelNoPP, item.NoWBS).Scan(&existingClosedAt)
+		err := tx.QueryRow(`SELECT closed_at FROM wirings WHERE panel_no_pp = $1 AND no_wbs = $2 AND archived_at IS NULL AND package_name = `+wiringPackageExpr("$3"),
+			item.PanelNoPP, item.NoWBS, item.PackageName).Scan(&existingClosedAt)
 
 		status := "Open"
 		var closedAt *time.Time
@@ -281,9 +298,11 @@ func (a *App) MassReplaceWiringHandler(w http.ResponseWriter, r *http.Request) {
 				closed_at = $8,           
 				updated_at = NOW()
 			WHERE panel_no_pp = $1 
-			AND no_wbs = $2;
+			AND no_wbs = $2
+			AND archived_at IS NULL
+			AND package_name = `+wiringPackageExpr("$9")+`;
 		`
-		res, err := tx.Exec(queryWiring, item.PanelNoPP, item.NoWBS, item.NoPanel, item.Progress, item.Supplier, item.TargetDeliveryWiring, status, closedAt)
+		res, err := tx.Exec(queryWiring, item.PanelNoPP, item.NoWBS, item.NoPanel, item.Progress, item.Supplier, item.TargetDeliveryWiring, status, closedAt, item.PackageName)
 		if err != nil {
 			tx.Rollback()
 			http.Error(w, "Gagal update wiring", http.StatusInternalServerError)
@@ -306,6 +325,11 @@ func (a *App) MassReplaceWiringHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	actor := requestIdentity(r).Username
+	wiringAudit.record(tx, actor, AuditSourceImport)
+	panelAudit.record(tx, actor, AuditSourceImport)
+	g3Audit.record(tx, actor, AuditSourceImport)
+
 	if err := tx.Commit(); err != nil {
 		http.Error(w, "Commit Error", http.StatusInternalServerError)
 		return
@@ -334,6 +358,16 @@ func (a *App) createWiringHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "panel_no_pp is required", http.StatusBadRequest)
 		return
 	}
+	input.PackageName = strings.TrimSpace(input.PackageName)
+	if input.PackageName == "" {
+		input.PackageName = defaultWiringPackage
+	}
+	var wiringExists bool
+	a.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM wirings WHERE panel_no_pp = $1 AND package_name = $2 AND archived_at IS NULL)", input.PanelNoPP, input.PackageName).Scan(&wiringExists)
+	expectedVersion, ok := checkIfMatch(w, r, wiringExists)
+	if !ok {
+		return
+	}
 
 	status := "Open"
 	var closedAt *time.Time
@@ -357,28 +391,44 @@ func (a *App) createWiringHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 
-	var g3Supplier string
-	_ = a.DB.QueryRow(`
+	// Paket tambahan boleh membawa supplier sendiri; default-nya vendor G3 panel.
+	g3Supplier := strings.TrimSpace(input.Supplier)
+	if g3Supplier == "" {
+		_ = a.DB.QueryRow(`
         SELECT vendor FROM g3_vendors WHERE panel_no_pp = $1 LIMIT 1
     `, input.PanelNoPP).Scan(&g3Supplier)
+	}
 
 
 	query := `
         INSERT INTO wirings 
         (panel_no_pp, no_wbs, no_panel, panel_type, supplier, 
-         progress, status, closed_at, target_delivery_wiring, updated_at, created_at)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW(), NOW())
-        ON CONFLICT (panel_no_pp) 
+         progress, status, closed_at, target_delivery_wiring, package_name, updated_at, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $11, NOW(), NOW())
+        ON CONFLICT (panel_no_pp, package_name) WHERE archived_at IS NULL
         DO UPDATE SET
             progress = EXCLUDED.progress,
             status = EXCLUDED.status,
             closed_at = EXCLUDED.closed_at,
             target_delivery_wiring = COALESCE(EXCLUDED.target_delivery_wiring, wirings.target_delivery_wiring),
             updated_at = NOW()
-        RETURNING id, created_at, updated_at;
+        WHERE $10::bigint IS NULL OR wirings.version = $10
+        RETURNING id, created_at, updated_at, version;
     `
 
-	err = a.DB.QueryRow(
+	tx, err := a.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	actor := requestIdentity(r).Username
+	if err := setWiringActor(tx, actor, AuditSourceAPI); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audit := beginAudit(tx, "wiring", "t.panel_no_pp = $1 AND t.package_name = $2", input.PanelNoPP, input.PackageName)
+	err = tx.QueryRow(
 		query,
 		input.PanelNoPP,
 		noWbs,
@@ -389,12 +439,29 @@ func (a *App) createWiringHandler(w http.ResponseWriter, r *http.Request) {
 		status,
 		closedAt,
 		input.TargetDeliveryWiring,
-	).Scan(&input.ID, &input.CreatedAt, &input.UpdatedAt)
+		expectedVersion,
+		input.PackageName,
+	).Scan(&input.ID, &input.CreatedAt, &input.UpdatedAt, &input.Version)
 
+	if err == sql.ErrNoRows {
+		// Tanpa baris berarti versi tidak cocok; wiring dicari lewat panel_no_pp.
+		var id string
+		if tx.QueryRow("SELECT id::text FROM wirings WHERE panel_no_pp = $1 AND package_name = $2 AND archived_at IS NULL", input.PanelNoPP, input.PackageName).Scan(&id) == nil {
+			respondVersionMiss(w, tx, "wiring", id)
+		} else {
+			http.Error(w, "Wiring tidak ditemukan", http.StatusNotFound)
+		}
+		return
+	}
 	if err != nil {
 		http.Error(w, "Gagal simpan/update wiring: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	audit.record(tx, actor, AuditSourceAPI)
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit", http.StatusInternalServerError)
+		return
+	}
 
 	// Update struct untuk response
 	input.Status = status
@@ -403,6 +470,7 @@ func (a *App) createWiringHandler(w http.ResponseWriter, r *http.Request) {
 	input.Supplier = g3Supplier
 	input.ClosedAt = closedAt
 
+	setETag(w, input.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(input)
 }
@@ -410,19 +478,21 @@ func (a *App) createWiringHandler(w http.ResponseWriter, r *http.Request) {
 func (a *App) getWiringsByPanelHandler(w http.ResponseWriter, r *http.Request) {
 
 	panelNoPP := mux.Vars(r)["panel_no_pp"]
+	// Paket yang diarsipkan saat transfer ulang hanya ikut bila diminta.
+	includeArchived, _ := strconv.ParseBool(r.URL.Query().Get("include_archived"))
 
 	rows, err := a.DB.Query(`
         SELECT id, panel_no_pp, no_wbs, no_panel,
-               panel_type, supplier,
+               panel_type, package_name, supplier,
                progress, status,
                target_delivery_wiring,
                actual_delivery_wiring,
-               closed_at,
-               created_at, updated_at
+               closed_at, archived_at,
+               created_at, updated_at, version
         FROM wirings
-        WHERE panel_no_pp = $1
-        ORDER BY created_at DESC
-    `, panelNoPP)
+        WHERE panel_no_pp = $1 AND ($2 OR archived_at IS NULL)
+        ORDER BY archived_at DESC NULLS FIRST, created_at
+    `, panelNoPP, includeArchived)
 
 	if err != nil {
 		http.Error(w, "Failed to fetch wirings", http.StatusInternalServerError)
@@ -439,14 +509,17 @@ func (a *App) getWiringsByPanelHandler(w http.ResponseWriter, r *http.Request) {
 			&wng.NoWBS,
 			&wng.NoPanel,
 			&wng.PanelType,
+			&wng.PackageName,
 			&wng.Supplier,
 			&wng.Progress,
 			&wng.Status,
 			&wng.TargetDeliveryWiring,
 			&wng.ActualDeliveryWiring,
 			&wng.ClosedAt,
+			&wng.ArchivedAt,
 			&wng.CreatedAt,
 			&wng.UpdatedAt,
+			&wng.Version,
 		); err != nil {
 			continue
 		}
@@ -474,48 +547,85 @@ func (a *App) updateWiringHandler(w http.ResponseWriter, r *http.Request) {
 	} else if input.Progress > 0 {
 		status = "In Progress"
 	}
+	expectedVersion, ok := checkIfMatch(w, r, true)
+	if !ok {
+		return
+	}
 
-	err := a.DB.QueryRow(`
+	tx, err := a.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	actor := requestIdentity(r).Username
+	if err := setWiringActor(tx, actor, AuditSourceAPI); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audit := beginAudit(tx, "wiring", "t.id::text = $1", id)
+	err = tx.QueryRow(`
         UPDATE wirings
         SET progress = $1, status = $2, closed_at = $3,
             target_delivery_wiring = $4, updated_at = NOW()
-        WHERE id = $5
-        RETURNING panel_no_pp, no_wbs, no_panel, supplier, created_at, updated_at
+        WHERE id = $5 AND ($6::bigint IS NULL OR version = $6)
+        RETURNING panel_no_pp, no_wbs, no_panel, package_name, supplier, created_at, updated_at, version
     `,
-		input.Progress, status, closedAt, input.TargetDeliveryWiring, id,
-	).Scan(&input.PanelNoPP, &input.NoWBS, &input.NoPanel, &input.Supplier, &input.CreatedAt, &input.UpdatedAt)
+		input.Progress, status, closedAt, input.TargetDeliveryWiring, id, expectedVersion,
+	).Scan(&input.PanelNoPP, &input.NoWBS, &input.NoPanel, &input.PackageName, &input.Supplier, &input.CreatedAt, &input.UpdatedAt, &input.Version)
 
+	if err == sql.ErrNoRows {
+		respondVersionMiss(w, tx, "wiring", id)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Gagal update wiring: ID tidak ditemukan", http.StatusInternalServerError)
 		return
 	}
+	audit.record(tx, actor, AuditSourceAPI)
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit", http.StatusInternalServerError)
+		return
+	}
 
 	input.ID = id
 	input.Status = status
 	input.ClosedAt = closedAt
 
+	setETag(w, input.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(input)
 }
 
 func (a *App) deleteWiringHandler(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
+	expectedVersion, ok := checkIfMatch(w, r, true)
+	if !ok {
+		return
+	}
 
-	query := `DELETE FROM wirings WHERE id = $1`
-	_, err := a.DB.Exec(query, id)
+	audit := beginAudit(a.DB, "wiring", "t.id::text = $1", id)
+	query := `DELETE FROM wirings WHERE id = $1 AND ($2::bigint IS NULL OR version = $2)`
+	res, err := a.DB.Exec(query, id, expectedVersion)
 	if err != nil {
 		log.Println("Error deleting wiring:", err)
 		http.Error(w, "Failed to delete wiring", http.StatusInternalServerError)
 		return
 	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		respondVersionMiss(w, a.DB, "wiring", id)
+		return
+	}
+	audit.record(a.DB, requestIdentity(r).Username, AuditSourceAPI)
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (a *App) massUploadWiringsHandler(w http.ResponseWriter, r *http.Request) {
 	type MassUploadRequest struct {
-		PanelNoPP string `json:"panel_no_pp"`
-		NoWBS     string `json:"no_wbs"`
+		PanelNoPP   string `json:"panel_no_pp"`
+		NoWBS       string `json:"no_wbs"`
+		PackageName string `json:"package_name"`
 		Data      []struct {
 			Progress int `json:"progress"`
 			// Tambahkan field lain jika ada dari JSON
@@ -555,6 +665,15 @@ func (a *App) massUploadWiringsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Panel belum transfer ke G3 Vendor", http.StatusBadRequest)
 		return
 	}
+	audit := beginAudit(tx, "wiring", "t.panel_no_pp = $1", input.PanelNoPP)
+	if err := setWiringActor(tx, requestIdentity(r).Username, AuditSourceImport); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	packageName := strings.TrimSpace(input.PackageName)
+	if packageName == "" {
+		packageName = defaultWiringPackage
+	}
 
 	// 3. Proses Loop Data
 	for _, item := range input.Data {
@@ -572,10 +691,11 @@ func (a *App) massUploadWiringsHandler(w http.ResponseWriter, r *http.Request) {
 		// Jalankan Upsert
 		res, err := tx.Exec(`
             INSERT INTO wirings
-            (panel_no_pp, no_wbs, no_panel, supplier, progress, status, closed_at, updated_at)
-            VALUES ($1,$2,$3,$4,$5,$6,$7, NOW())
-            ON CONFLICT (panel_no_pp, no_wbs)
+            (panel_no_pp, no_wbs, no_panel, supplier, progress, status, closed_at, package_name, updated_at)
+            VALUES ($1,$2,$3,$4,$5,$6,$7,$8, NOW())
+            ON CONFLICT (panel_no_pp, package_name) WHERE archived_at IS NULL
             DO UPDATE SET
+                no_wbs = EXCLUDED.no_wbs,
                 no_panel = EXCLUDED.no_panel,
                 supplier = EXCLUDED.supplier,
                 progress = EXCLUDED.progress,
@@ -590,6 +710,7 @@ func (a *App) massUploadWiringsHandler(w http.ResponseWriter, r *http.Request) {
 			item.Progress,
 			status,
 			closedAt,
+			packageName,
 		)
 
 		if err != nil {
@@ -605,6 +726,8 @@ func (a *App) massUploadWiringsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	audit.record(tx, requestIdentity(r).Username, AuditSourceImport)
+
 	if err := tx.Commit(); err != nil {
 		http.Error(w, "Failed to commit", http.StatusInternalServerError)
 		return
@@ -676,7 +799,7 @@ type Company struct {
 }
 type CompanyAccount struct {
 	Username  string `json:"username"`
-	Password  string `json:"password"`
+	Password  string `json:"password,omitempty"`
 	CompanyID string `json:"company_id"`
 }
 type Panel struct {
@@ -706,6 +829,10 @@ type Panel struct {
 	CloseDateBusbarMcc *customTime `json:"close_date_busbar_mcc,omitempty"`
 	StatusPenyelesaian *string     `json:"status_penyelesaian,omitempty"`
 	ProductionSlot     *string     `json:"production_slot,omitempty"`
+	ProjectID          *int           `json:"project_id,omitempty"`
+	WbsID              *int           `json:"wbs_id,omitempty"`
+	Forecast           *PanelForecast `json:"forecast,omitempty"`
+	Version            int64          `json:"version,omitempty"`
 }
 
 type ProductionSlot struct {
@@ -749,6 +876,7 @@ type AdditionalSR struct {
 	CreatedAt    time.Time   `json:"created_at"`
 	CloseDate    *customTime `json:"close_date,omitempty" db:"close_date"`
 	ReceivedDate *customTime `json:"received_date,omitempty" db:"received_date"`
+	Version      int64       `json:"version,omitempty"`
 }
 
 type PanelDisplayData struct {
@@ -804,9 +932,80 @@ type App struct {
 	Router    *mux.Router
 	DB        *sql.DB
 	FCMClient *messaging.Client
+	Scheduler *jobScheduler
+	// dsn dipakai koneksi LISTEN/NOTIFY yang tidak bisa lewat pool *sql.DB.
+	dsn string
 }
 
 func (a *App) Initialize(dbUser, dbPassword, dbName, dbHost string) {
+	a.connectDB(dbUser, dbPassword, dbName, dbHost)
+	initDB(a.DB)
+	if err := loadCalendars(a.DB); err != nil {
+		log.Printf("Calendar: gagal memuat kalender, memakai default %s: %v", defaultCalendarTimeZone, err)
+	}
+	fcm, err := newFCMClientFromEnv(context.Background())
+	if err != nil {
+		log.Printf("FCM: gagal inisialisasi, notifikasi push dimatikan: %v", err)
+	} else if fcm == nil {
+		log.Println("FCM: kredensial Firebase tidak di-set, notifikasi push dimatikan.")
+	} else {
+		a.FCMClient = fcm
+		log.Println("FCM: client siap.")
+	}
+	a.Scheduler = newJobScheduler(a)
+	a.Router = mux.NewRouter().StrictSlash(true)
+	a.initializeRoutes()
+	go a.startNotificationDispatcher()
+	go a.startScheduler()
+	go a.watchCalendarChanges()
+}
+
+// fcmCredentials membaca service account dari FIREBASE_CREDENTIALS_JSON
+// (JSON mentah atau base64), FIREBASE_CREDENTIALS_FILE atau
+// GOOGLE_APPLICATION_CREDENTIALS. nil berarti FCM tidak dikonfigurasi.
+func fcmCredentials() ([]byte, error) {
+	if raw := strings.TrimSpace(os.Getenv("FIREBASE_CREDENTIALS_JSON")); raw != "" {
+		if strings.HasPrefix(raw, "{") {
+			return []byte(raw), nil
+		}
+		decoded, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil {
+			return nil, fmt.Errorf("FIREBASE_CREDENTIALS_JSON bukan JSON atau base64: %w", err)
+		}
+		return decoded, nil
+	}
+	for _, key := range []string{"FIREBASE_CREDENTIALS_FILE", "GOOGLE_APPLICATION_CREDENTIALS"} {
+		if path := strings.TrimSpace(os.Getenv(key)); path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("gagal membaca %s: %w", key, err)
+			}
+			return data, nil
+		}
+	}
+	return nil, nil
+}
+
+// newFCMClientFromEnv mengembalikan nil tanpa error bila kredensial tidak
+// di-set sehingga server tetap jalan dan notifikasi push ditandai skipped.
+// FIREBASE_PROJECT_ID opsional, default project_id dari service account.
+func newFCMClientFromEnv(ctx context.Context) (*messaging.Client, error) {
+	data, err := fcmCredentials()
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var config *firebase.Config
+	if projectID := os.Getenv("FIREBASE_PROJECT_ID"); projectID != "" {
+		config = &firebase.Config{ProjectID: projectID}
+	}
+	app, err := firebase.NewApp(ctx, config, option.WithCredentialsJSON(data))
+	if err != nil {
+		return nil, fmt.Errorf("kredensial Firebase tidak valid: %w", err)
+	}
+	return app.Messaging(ctx)
+}
+
+func (a *App) connectDB(dbUser, dbPassword, dbName, dbHost string) {
 	dbPort := os.Getenv("DB_PORT")
 	if dbPort == "" {
 		dbPort = "5432"
@@ -826,6 +1025,7 @@ func (a *App) Initialize(dbUser, dbPassword, dbName, dbHost string) {
 		dbSslMode,
 	)
 
+	a.dsn = connectionString
 	var err error
 	a.DB, err = sql.Open("postgres", connectionString)
 	if err != nil {
@@ -841,10 +1041,6 @@ func (a *App) Initialize(dbUser, dbPassword, dbName, dbHost string) {
 		log.Fatalf("Tidak dapat terhubung ke database: %v", err)
 	}
 	log.Println("Berhasil terhubung ke database!")
-
-	initDB(a.DB)
-	a.Router = mux.NewRouter().StrictSlash(true)
-	a.initializeRoutes()
 }
 
 func (a *App) Run(addr string) {
@@ -853,13 +1049,24 @@ func (a *App) Run(addr string) {
 
 	allowedMethods := handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"})
 
-	allowedHeaders := handlers.AllowedHeaders([]string{"Content-Type", "Authorization"})
+	allowedHeaders := handlers.AllowedHeaders([]string{"Content-Type", "Authorization", "If-Match", "If-None-Match"})
+
+	exposedHeaders := handlers.ExposedHeaders([]string{"X-Total-Count", "X-Next-Cursor", "ETag"})
 
 	log.Printf("Server berjalan di %s", addr)
 
-	log.Fatal(http.ListenAndServe(addr, handlers.CORS(allowedOrigins, allowedMethods, allowedHeaders)(a.Router)))
+	log.Fatal(http.ListenAndServe(addr, handlers.CORS(allowedOrigins, allowedMethods, allowedHeaders, exposedHeaders)(a.Router)))
 }
 func main() {
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	if command == "help" {
+		fmt.Print(cliUsage)
+		return
+	}
+
 	godotenv.Load()
 	dbUser := os.Getenv("DB_USER")
 	dbPassword := os.Getenv("DB_PASSWORD")
@@ -871,19 +1078,34 @@ func main() {
 	}
 
 	app := App{}
-	app.Initialize(dbUser, dbPassword, dbName, dbHost)
+	if command != "serve" {
+		app.connectDB(dbUser, dbPassword, dbName, dbHost)
+		os.Exit(app.runCommand(command, args))
+	}
 
-	port := os.Getenv("APP_PORT")
-		if port == "" {
-			port = "8099"
-		}
+	addr := parseServeFlags(args)
+	app.Initialize(dbUser, dbPassword, dbName, dbHost)
+	app.Run(addr)
+}
 
-		app.Run(":" + port)
-	}
 func (a *App) initializeRoutes() {
 
+	a.Router.Use(a.authMiddleware, a.authorizeMiddleware)
+
 	// Auth & User Management
 	a.Router.HandleFunc("/login", a.loginHandler).Methods("POST", "OPTIONS")
+	a.Router.HandleFunc("/logout", a.logoutHandler).Methods("POST", "OPTIONS")
+	a.Router.HandleFunc("/token/refresh", a.refreshTokenHandler).Methods("POST", "OPTIONS")
+	a.Router.HandleFunc("/me/permissions", a.getMyPermissionsHandler).Methods("GET")
+	a.Router.HandleFunc("/me/notifications", a.getMyNotificationsHandler).Methods("GET", "OPTIONS")
+	a.Router.HandleFunc("/me/notifications/unread-count", a.getMyUnreadCountHandler).Methods("GET", "OPTIONS")
+	a.Router.HandleFunc("/me/notifications/read-all", a.markAllNotificationsReadHandler).Methods("POST", "OPTIONS")
+	a.Router.HandleFunc("/me/notifications/{id}/read", a.markNotificationReadHandler).Methods("POST", "OPTIONS")
+	a.Router.HandleFunc("/me/notification-preferences", a.getMyNotificationPreferencesHandler).Methods("GET", "OPTIONS")
+	a.Router.HandleFunc("/me/notification-preferences", a.updateMyNotificationPreferencesHandler).Methods("PUT", "OPTIONS")
+	a.Router.HandleFunc("/me/notification-subscriptions", a.getMyNotificationSubscriptionsHandler).Methods("GET", "OPTIONS")
+	a.Router.HandleFunc("/me/notification-subscriptions", a.putMyNotificationSubscriptionHandler).Methods("PUT", "OPTIONS")
+	a.Router.HandleFunc("/me/notification-subscriptions/{scope}/{id}", a.deleteMyNotificationSubscriptionHandler).Methods("DELETE", "OPTIONS")
 	a.Router.HandleFunc("/user/register-device", a.registerDeviceHandler).Methods("POST", "OPTIONS")
 	a.Router.HandleFunc("/company-by-username/{username}", a.getCompanyByUsernameHandler).Methods("GET")
 	a.Router.HandleFunc("/user/{username}/password", a.updatePasswordHandler).Methods("PUT", "OPTIONS")
@@ -922,6 +1144,54 @@ func (a *App) initializeRoutes() {
 	a.Router.HandleFunc("/panel/exists/no-pp/{no_pp}", a.isNoPpTakenHandler).Methods("GET")
 	a.Router.HandleFunc("/panels/{old_no_pp}/change-pp", a.changePanelNoPpHandler).Methods("PUT", "OPTIONS")
 	a.Router.HandleFunc("/panel/remark-vendor", a.upsertPanelRemarkHandler).Methods("POST", "OPTIONS")
+	a.Router.HandleFunc("/panels/{no_pp}/audit", a.getPanelAuditHandler).Methods("GET")
+	a.Router.HandleFunc("/panels/{no_pp}/forecast", a.getPanelForecastHandler).Methods("GET")
+	a.Router.HandleFunc("/audit", a.getAuditEventsHandler).Methods("GET")
+
+	// Trash
+	a.Router.HandleFunc("/trash", a.getTrashHandler).Methods("GET")
+	a.Router.HandleFunc("/trash/{type}/{id}/restore", a.restoreTrashHandler).Methods("POST", "OPTIONS")
+	a.Router.HandleFunc("/trash/{type}/{id}", a.purgeTrashItemHandler).Methods("DELETE", "OPTIONS")
+
+	// Kalender hari kerja
+	a.Router.HandleFunc("/calendars", a.getCalendarsHandler).Methods("GET")
+	a.Router.HandleFunc("/calendars", a.createCalendarHandler).Methods("POST", "OPTIONS")
+	a.Router.HandleFunc("/calendars/working-days", a.getWorkingDaysHandler).Methods("GET")
+	a.Router.HandleFunc("/calendars/{id}", a.getCalendarHandler).Methods("GET")
+	a.Router.HandleFunc("/calendars/{id}", a.updateCalendarHandler).Methods("PUT", "OPTIONS")
+	a.Router.HandleFunc("/calendars/{id}", a.deleteCalendarHandler).Methods("DELETE", "OPTIONS")
+	a.Router.HandleFunc("/calendars/{id}/days", a.upsertCalendarDaysHandler).Methods("POST", "OPTIONS")
+	a.Router.HandleFunc("/calendars/{id}/days/{day}", a.deleteCalendarDayHandler).Methods("DELETE", "OPTIONS")
+	a.Router.HandleFunc("/company/{id}/calendar", a.setCompanyCalendarHandler).Methods("PUT", "OPTIONS")
+
+	// Outbox notifikasi (admin)
+	a.Router.HandleFunc("/admin/notifications", a.getNotificationOutboxHandler).Methods("GET")
+	a.Router.HandleFunc("/admin/notifications/replay", a.replayNotificationsHandler).Methods("POST", "OPTIONS")
+	a.Router.HandleFunc("/admin/notifications/{id}", a.getNotificationOutboxItemHandler).Methods("GET")
+	a.Router.HandleFunc("/admin/notifications/{id}/replay", a.replayNotificationsHandler).Methods("POST", "OPTIONS")
+	a.Router.HandleFunc("/admin/jobs", a.getJobsHandler).Methods("GET", "OPTIONS")
+
+	// Feed iCalendar
+	a.Router.HandleFunc("/calendar-feeds", a.getCalendarFeedsHandler).Methods("GET")
+	a.Router.HandleFunc("/calendar-feeds", a.createCalendarFeedHandler).Methods("POST", "OPTIONS")
+	a.Router.HandleFunc("/calendar-feeds/{id}/rotate", a.rotateCalendarFeedHandler).Methods("POST", "OPTIONS")
+	a.Router.HandleFunc("/calendar-feeds/{id}", a.deleteCalendarFeedHandler).Methods("DELETE", "OPTIONS")
+	a.Router.HandleFunc("/ics/{token}", a.serveIcsFeedHandler).Methods("GET")
+
+	// Project & WBS
+	a.Router.HandleFunc("/projects", a.getProjectsHandler).Methods("GET")
+	a.Router.HandleFunc("/projects", a.createProjectHandler).Methods("POST", "OPTIONS")
+	a.Router.HandleFunc("/projects/{id}", a.getProjectHandler).Methods("GET")
+	a.Router.HandleFunc("/projects/{id}", a.updateProjectHandler).Methods("PUT", "OPTIONS")
+	a.Router.HandleFunc("/projects/{id}", a.deleteProjectHandler).Methods("DELETE", "OPTIONS")
+	a.Router.HandleFunc("/projects/{id}/merge", a.mergeProjectHandler).Methods("POST", "OPTIONS")
+	a.Router.HandleFunc("/project-name-reviews", a.getProjectNameReviewsHandler).Methods("GET")
+	a.Router.HandleFunc("/project-name-reviews/resolve", a.resolveProjectNameReviewHandler).Methods("POST", "OPTIONS")
+	a.Router.HandleFunc("/projects/{id}/timeline", a.getProjectTimelineHandler).Methods("GET")
+	a.Router.HandleFunc("/projects/{id}/wbs", a.getProjectWbsHandler).Methods("GET")
+	a.Router.HandleFunc("/projects/{id}/wbs", a.createWbsHandler).Methods("POST", "OPTIONS")
+	a.Router.HandleFunc("/wbs/{id}", a.updateWbsHandler).Methods("PUT", "OPTIONS")
+	a.Router.HandleFunc("/wbs/{id}", a.deleteWbsHandler).Methods("DELETE", "OPTIONS")
 
 	// Sub-Panel Parts Management
 	a.Router.HandleFunc("/busbar", a.upsertGenericHandler("busbars", &Busbar{})).Methods("POST", "OPTIONS")
@@ -985,11 +1255,25 @@ func (a *App) initializeRoutes() {
 	a.Router.HandleFunc("/additional-sr/{id}", a.updateAdditionalSRHandler).Methods("PUT", "OPTIONS")
 	a.Router.HandleFunc("/additional-sr/{id}", a.deleteAdditionalSRHandler).Methods("DELETE", "OPTIONS")
 	a.Router.HandleFunc("/suppliers", a.getSuppliersHandler).Methods("GET")
+	a.Router.HandleFunc("/suppliers/scorecards", a.getSupplierScorecardsHandler).Methods("GET")
+	a.Router.HandleFunc("/dashboard/summary", a.getDashboardSummaryHandler).Methods("GET")
 
 	// Workflow Transfer
 	a.Router.HandleFunc("/production-slots", a.getProductionSlotsHandler).Methods("GET")
+	a.Router.HandleFunc("/production-slots/reservations", a.getSlotReservationsHandler).Methods("GET")
+	a.Router.HandleFunc("/production-slots/reservations", a.createSlotReservationHandler).Methods("POST", "OPTIONS")
+	a.Router.HandleFunc("/production-slots/reservations/{id}", a.updateSlotReservationHandler).Methods("PUT", "OPTIONS")
+	a.Router.HandleFunc("/production-slots/reservations/{id}", a.cancelSlotReservationHandler).Methods("DELETE", "OPTIONS")
+	a.Router.HandleFunc("/production-slots/timeline", a.getSlotTimelineHandler).Methods("GET")
+	a.Router.HandleFunc("/production-slots/forecast", a.getSlotForecastHandler).Methods("GET")
+	a.Router.HandleFunc("/production-slots/suggest", a.suggestSlotsHandler).Methods("POST", "OPTIONS")
+	a.Router.HandleFunc("/production-slots/assignments", a.getSlotAssignmentsHandler).Methods("GET")
+	a.Router.HandleFunc("/production-slots/utilization", a.getSlotUtilizationHandler).Methods("GET")
+	a.Router.HandleFunc("/production-slots/dwell-time", a.getSlotDwellTimeHandler).Methods("GET")
 	a.Router.HandleFunc("/panels/{no_pp}/transfer", a.transferPanelHandler).Methods("POST", "OPTIONS")
 	a.Router.HandleFunc("/mass-transfer-panel", a.MassTransferPanelHandler).Methods("POST")
+	a.Router.HandleFunc("/workflow", a.getWorkflowHandler).Methods("GET")
+	a.Router.HandleFunc("/panels/{no_pp}/workflow", a.getPanelWorkflowHandler).Methods("GET")
 
 	// router wiring
 	// Wiring - akhir edit
@@ -999,6 +1283,7 @@ func (a *App) initializeRoutes() {
 	a.Router.HandleFunc("/wirings/{id}", a.deleteWiringHandler).Methods("DELETE", "OPTIONS")
 	a.Router.HandleFunc("/wirings/mass-upload", a.massUploadWiringsHandler).Methods("POST", "OPTIONS")
 	a.Router.HandleFunc("/wirings/mass-replace", a.MassReplaceWiringHandler).Methods("POST", "OPTIONS")
+	a.Router.HandleFunc("/panels/{no_pp}/wiring-progress", a.getWiringProgressHandler).Methods("GET")
 }
 
 func (a *App) insertCompanyHandler(w http.ResponseWriter, r *http.Request) {
@@ -1035,10 +1320,29 @@ func (a *App) upsertPanelHandler(w http.ResponseWriter, r *http.Request) {
 	if p.NoPp == "" {
 		p.NoPp = fmt.Sprintf("TEMP-%d", time.Now().Unix())
 	}
+	actorUsername := requestIdentity(r).Username
+	p.CreatedBy = &actorUsername
 	var isNewPanel bool
-	var exists bool
-	err := a.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM panels WHERE no_pp = $1)", p.NoPp).Scan(&exists)
-	isNewPanel = (err == nil && !exists)
+	var trashed bool
+	err := a.DB.QueryRow("SELECT deleted_at IS NOT NULL FROM panels WHERE no_pp = $1", p.NoPp).Scan(&trashed)
+	exists := err == nil
+	isNewPanel = err == sql.ErrNoRows
+	if trashed {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("No. PP '%s' ada di trash. Pulihkan atau hapus permanen terlebih dahulu.", p.NoPp))
+		return
+	}
+	if exists && !requireIfMatch(w, r) {
+		return
+	}
+	expectedVersion, ok := checkIfMatch(w, r, exists)
+	if !ok {
+		return
+	}
+	if expectedVersion != nil && !exists {
+		respondWithError(w, http.StatusNotFound, "Panel tidak ditemukan")
+		return
+	}
+	audit := beginAudit(a.DB, "panel", "t.no_pp = $1", p.NoPp)
 
 	query := `
 		INSERT INTO panels (
@@ -1051,9 +1355,10 @@ func (a *App) upsertPanelHandler(w http.ResponseWriter, r *http.Request) {
 			vendor_id,
 			percent_progress,
 			status_busbar_pcc,
-			ao_busbar_pcc
+			ao_busbar_pcc,
+			created_by
 		)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
 
 		ON CONFLICT (no_pp)
 		DO UPDATE SET
@@ -1065,10 +1370,18 @@ func (a *App) upsertPanelHandler(w http.ResponseWriter, r *http.Request) {
 			vendor_id = EXCLUDED.vendor_id,
 			percent_progress = EXCLUDED.percent_progress,
 			status_busbar_pcc = EXCLUDED.status_busbar_pcc,
-			ao_busbar_pcc = EXCLUDED.ao_busbar_pcc;
+			ao_busbar_pcc = EXCLUDED.ao_busbar_pcc
+		WHERE ($12::bigint IS NULL AND $13) OR panels.version = $12
+		RETURNING version;
 		`
 
-	_, err = a.DB.Exec(query,
+	tx, err := a.DB.Begin()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memulai transaksi: "+err.Error())
+		return
+	}
+	defer tx.Rollback()
+	err = tx.QueryRow(query,
 		p.NoPp,
 		p.NoPanel,
 		p.NoWbs,
@@ -1079,7 +1392,14 @@ func (a *App) upsertPanelHandler(w http.ResponseWriter, r *http.Request) {
 		p.PercentProgress,
 		p.StatusBusbarPcc,
 		p.AoBusbarPcc,
-	)
+		p.CreatedBy,
+		expectedVersion,
+		exists,
+	).Scan(&p.Version)
+	if err == sql.ErrNoRows {
+		respondVersionMiss(w, a.DB, "panel", p.NoPp)
+		return
+	}
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
 			respondWithError(w, http.StatusConflict, "Gagal menyimpan: Terdapat duplikasi pada No Panel.")
@@ -1088,44 +1408,28 @@ func (a *App) upsertPanelHandler(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	audit.record(tx, actorUsername, AuditSourceAPI)
 
-	go func() {
-		stakeholders, err := a.getPanelStakeholders(p.NoPp)
-		if err != nil {
-			log.Printf("Error getting stakeholders for panel %s: %v", p.NoPp, err)
-			return
-		}
-
-		actor := "seseorang"
-		if p.CreatedBy != nil {
-			actor = *p.CreatedBy
-		}
-
-		finalRecipients := []string{}
-		for _, user := range stakeholders {
-
-			if user != actor {
-				finalRecipients = append(finalRecipients, user)
-			}
-		}
-
-		if len(finalRecipients) > 0 {
-			if isNewPanel {
-				title := "Panel Baru Ditambahkan"
-				body := fmt.Sprintf("%s menambahkan panel baru: %s", actor, p.NoPp)
-
-				if p.VendorID == nil || *p.VendorID == "" {
-					body = fmt.Sprintf("%s menambahkan panel baru TANPA VENDOR: %s", actor, p.NoPp)
-				}
-				a.sendNotificationToUsers(finalRecipients, title, body)
-			} else {
-				title := fmt.Sprintf("Panel Diedit: %s", p.NoPp)
-				body := fmt.Sprintf("Detail untuk panel %s baru saja diperbarui oleh %s.", p.NoPp, actor)
-				a.sendNotificationToUsers(finalRecipients, title, body)
-			}
+	actor := actorUsername
+	event, title := "panel.updated", fmt.Sprintf("Panel Diedit: %s", p.NoPp)
+	body := fmt.Sprintf("Detail untuk panel %s baru saja diperbarui oleh %s.", p.NoPp, actor)
+	if isNewPanel {
+		event, title = "panel.created", "Panel Baru Ditambahkan"
+		body = fmt.Sprintf("%s menambahkan panel baru: %s", actor, p.NoPp)
+		if p.VendorID == nil || *p.VendorID == "" {
+			body = fmt.Sprintf("%s menambahkan panel baru TANPA VENDOR: %s", actor, p.NoPp)
 		}
-	}()
+	}
+	if err := enqueuePanelNotification(tx, event, p.NoPp, actor, title, body); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menyimpan notifikasi: "+err.Error())
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menyimpan panel: "+err.Error())
+		return
+	}
 
+	setETag(w, p.Version)
 	respondWithJSON(w, http.StatusCreated, p)
 }
 
@@ -1167,6 +1471,7 @@ func (a *App) massImportPanelsHandler(w http.ResponseWriter, r *http.Request) {
         return
     }
     defer tx.Rollback()
+    actor := requestIdentity(r).Username
 
     for i, item := range payload.Panels {
         p := item.Panel
@@ -1236,6 +1541,7 @@ func (a *App) massImportPanelsHandler(w http.ResponseWriter, r *http.Request) {
             countSkipped++
             continue
         }
+        panelAudit := beginAudit(tx, "panel", "t.no_panel = $1 AND t.no_wbs = $2", *p.NoPanel, *p.NoWbs)
 
         // =========================
         // UPDATE
@@ -1296,8 +1602,8 @@ func (a *App) massImportPanelsHandler(w http.ResponseWriter, r *http.Request) {
                         ELSE status_penyelesaian
                     END,
                     is_closed = CASE WHEN $11 THEN true ELSE is_closed END,
-                    status_corepart = CASE WHEN $11 THEN 'Closed' ELSE status_corepart END,
-                    status_palet = CASE WHEN $11 THEN 'Closed' ELSE status_palet END
+                    status_corepart = CASE WHEN $11 THEN 'Close' ELSE status_corepart END,
+                    status_palet = CASE WHEN $11 THEN 'Close' ELSE status_palet END
                 WHERE no_panel = $12 AND no_wbs = $13
             `,
                 canUpdatePP, newNoPp, p.Project, p.PanelType, p.VendorID, progress,
@@ -1333,9 +1639,9 @@ func (a *App) massImportPanelsHandler(w http.ResponseWriter, r *http.Request) {
                 finalNoPp, *p.NoPanel, *p.NoWbs, p.Project, p.PanelType,
                 p.TargetDelivery, p.VendorID, progress, p.StatusBusbarPcc,
                 p.AoBusbarPcc, p.ClosedDate, isTransfer,
-                func() string { if isTransfer { return "Closed" }; return "" }(),
-                func() string { if isTransfer { return "Closed" }; return "" }(),
-                func() string { if isTransfer { return "Closed" }; return "" }(),
+                func() string { if isTransfer { return "Close" }; return "" }(),
+                func() string { if isTransfer { return "Done" }; return "" }(),
+                func() string { if isTransfer { return "Close" }; return "" }(),
                 statusPenyelesaian,
             )
 
@@ -1347,11 +1653,13 @@ func (a *App) massImportPanelsHandler(w http.ResponseWriter, r *http.Request) {
             countSkipped++
             continue
         }
+        panelAudit.recordRenamed(tx, actor, AuditSourceImport, "t.no_panel = $1 AND t.no_wbs = $2", *p.NoPanel, *p.NoWbs)
 
         // =========================
         // BUSBAR
         // =========================
         if p.BusbarVendorID != nil && *p.BusbarVendorID != "" {
+            busbarAudit := beginAudit(tx, "busbar", "t.panel_no_pp = $1 AND t.vendor = $2", actualNoPp, *p.BusbarVendorID)
             _, err = tx.Exec(`
                 INSERT INTO busbars (panel_no_pp, vendor)
                 VALUES ($1, $2)
@@ -1360,6 +1668,8 @@ func (a *App) massImportPanelsHandler(w http.ResponseWriter, r *http.Request) {
 
             if err != nil {
                 errorDetails = append(errorDetails, fmt.Sprintf("Baris %d (busbar): %v", i+2, err))
+            } else {
+                busbarAudit.record(tx, actor, AuditSourceImport)
             }
         }
         countSuccess++
@@ -1501,15 +1811,30 @@ func (a *App) loginHandler(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusUnauthorized, "Username atau password salah")
 		return
 	}
-	if account.Password == payload.Password {
+	passwordOK, needsRehash := verifyPassword(account.Password, payload.Password)
+	if passwordOK {
 		var company Company
 
+		if needsRehash {
+			if hashed, err := hashPassword(payload.Password); err == nil {
+				_, err = a.DB.Exec("UPDATE company_accounts SET password = $1 WHERE username = $2 AND password = $3", hashed, payload.Username, account.Password)
+				if err != nil {
+					log.Printf("Gagal rehash password untuk %s: %v", payload.Username, err)
+				}
+			}
+		}
+
 		err := a.DB.QueryRow("SELECT id, name, role FROM public.companies WHERE id = $1", account.CompanyID).Scan(&company.ID, &company.Name, &company.Role)
 		if err != nil {
 			respondWithError(w, http.StatusInternalServerError, "Company not found for user")
 			return
 		}
-		respondWithJSON(w, http.StatusOK, company)
+		tokens, err := a.createSession(payload.Username, r.UserAgent())
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal membuat session: "+err.Error())
+			return
+		}
+		respondWithJSON(w, http.StatusOK, loginResponse{Company: company, Username: payload.Username, sessionTokens: tokens})
 	} else {
 		respondWithError(w, http.StatusUnauthorized, "Username atau password salah")
 	}
@@ -1523,7 +1848,16 @@ func (a *App) updatePasswordHandler(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, "Invalid payload")
 		return
 	}
-	res, err := a.DB.Exec("UPDATE company_accounts SET password = $1 WHERE username = $2", payload.Password, username)
+	if err := validatePasswordStrength(username, payload.Password); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	hashed, err := hashPassword(payload.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memproses password")
+		return
+	}
+	res, err := a.DB.Exec("UPDATE company_accounts SET password = $1 WHERE username = $2", hashed, username)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -1533,6 +1867,10 @@ func (a *App) updatePasswordHandler(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusNotFound, "User not found")
 		return
 	}
+	// Session lain milik user ini dicabut setelah password diganti.
+	if err := a.revokeSessionsForUser(a.DB, username, requestIdentity(r).SessionID); err != nil {
+		log.Printf("Gagal mencabut session %s: %v", username, err)
+	}
 	respondWithJSON(w, http.StatusOK, map[string]string{"status": "success"})
 }
 func (a *App) insertCompanyWithAccountHandler(w http.ResponseWriter, r *http.Request) {
@@ -1552,6 +1890,15 @@ func (a *App) insertCompanyWithAccountHandler(w http.ResponseWriter, r *http.Req
 		respondWithError(w, http.StatusBadRequest, "Password tidak boleh kosong.")
 		return
 	}
+	if err := validatePasswordStrength(payload.Account.Username, payload.Account.Password); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	hashedPassword, err := hashPassword(payload.Account.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memproses password")
+		return
+	}
 
 	tx, err := a.DB.Begin()
 	if err != nil {
@@ -1564,7 +1911,7 @@ func (a *App) insertCompanyWithAccountHandler(w http.ResponseWriter, r *http.Req
 		respondWithError(w, http.StatusInternalServerError, "Failed to insert company: "+err.Error())
 		return
 	}
-	_, err = tx.Exec("INSERT INTO company_accounts (username, password, company_id) VALUES ($1, $2, $3) ON CONFLICT (username) DO UPDATE SET password = EXCLUDED.password, company_id = EXCLUDED.company_id", payload.Account.Username, payload.Account.Password, payload.Account.CompanyID)
+	_, err = tx.Exec("INSERT INTO company_accounts (username, password, company_id) VALUES ($1, $2, $3) ON CONFLICT (username) DO UPDATE SET password = EXCLUDED.password, company_id = EXCLUDED.company_id", payload.Account.Username, hashedPassword, payload.Account.CompanyID)
 	if err != nil {
 		tx.Rollback()
 		respondWithError(w, http.StatusInternalServerError, "Failed to insert account: "+err.Error())
@@ -1574,6 +1921,7 @@ func (a *App) insertCompanyWithAccountHandler(w http.ResponseWriter, r *http.Req
 		respondWithError(w, http.StatusInternalServerError, "Transaction commit failed: "+err.Error())
 		return
 	}
+	payload.Account.Password = ""
 	respondWithJSON(w, http.StatusCreated, payload)
 }
 func (a *App) updateCompanyAndAccountHandler(w http.ResponseWriter, r *http.Request) {
@@ -1586,6 +1934,18 @@ func (a *App) updateCompanyAndAccountHandler(w http.ResponseWriter, r *http.Requ
 		respondWithError(w, http.StatusBadRequest, "Invalid payload: "+err.Error())
 		return
 	}
+	var hashedPassword string
+	if payload.NewPassword != nil && *payload.NewPassword != "" {
+		if err := validatePasswordStrength(username, *payload.NewPassword); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		var err error
+		if hashedPassword, err = hashPassword(*payload.NewPassword); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal memproses password")
+			return
+		}
+	}
 
 	tx, err := a.DB.Begin()
 	if err != nil {
@@ -1608,8 +1968,8 @@ func (a *App) updateCompanyAndAccountHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	if payload.NewPassword != nil && *payload.NewPassword != "" {
-		_, err = tx.Exec("UPDATE company_accounts SET company_id = $1, password = $2 WHERE username = $3", targetCompanyId, *payload.NewPassword, username)
+	if hashedPassword != "" {
+		_, err = tx.Exec("UPDATE company_accounts SET company_id = $1, password = $2 WHERE username = $3", targetCompanyId, hashedPassword, username)
 	} else {
 		_, err = tx.Exec("UPDATE company_accounts SET company_id = $1 WHERE username = $2", targetCompanyId, username)
 	}
@@ -1641,7 +2001,7 @@ func (a *App) deleteCompanyAccountHandler(w http.ResponseWriter, r *http.Request
 	respondWithJSON(w, http.StatusOK, map[string]string{"status": "success"})
 }
 func (a *App) getAllCompanyAccountsHandler(w http.ResponseWriter, r *http.Request) {
-	rows, err := a.DB.Query("SELECT username, COALESCE(password, ''), company_id FROM public.company_accounts")
+	rows, err := a.DB.Query("SELECT username, company_id FROM public.company_accounts")
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -1650,7 +2010,7 @@ func (a *App) getAllCompanyAccountsHandler(w http.ResponseWriter, r *http.Reques
 	var accounts []CompanyAccount
 	for rows.Next() {
 		var acc CompanyAccount
-		if err := rows.Scan(&acc.Username, &acc.Password, &acc.CompanyID); err != nil {
+		if err := rows.Scan(&acc.Username, &acc.CompanyID); err != nil {
 			respondWithError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
@@ -1700,8 +2060,9 @@ func (a *App) getAllUserAccountsForDisplayHandler(w http.ResponseWriter, r *http
 	respondWithJSON(w, http.StatusOK, results)
 }
 func (a *App) getColleagueAccountsForDisplayHandler(w http.ResponseWriter, r *http.Request) {
-	companyName := r.URL.Query().Get("company_name")
-	currentUsername := r.URL.Query().Get("current_username")
+	id := requestIdentity(r)
+	companyName := id.CompanyName
+	currentUsername := id.Username
 
 	query := `
 		SELECT ca.username, ca.company_id, c.name AS company_name, c.role
@@ -1882,7 +2243,7 @@ func (a *App) extractPanelDataHandler(w http.ResponseWriter, r *http.Request) {
 	err := a.DB.QueryRow(`
 		SELECT row_to_json(p)
 		FROM panels p
-		WHERE no_pp = $1
+		WHERE no_pp = $1 AND deleted_at IS NULL
 	`, panelNoPP).Scan(&result.Panel)
 	if err != nil {
 		http.Error(w, "Panel not found", http.StatusNotFound)
@@ -1902,7 +2263,8 @@ func (a *App) extractPanelDataHandler(w http.ResponseWriter, r *http.Request) {
 			created_at, 
 			updated_at
 		FROM wirings
-		WHERE panel_no_pp = $1
+		WHERE panel_no_pp = $1 AND archived_at IS NULL
+		ORDER BY created_at
 	`, panelNoPP)
 	if err != nil {
 		http.Error(w, "Failed to fetch wiring", http.StatusInternalServerError)
@@ -1937,62 +2299,84 @@ func (a *App) extractPanelDataHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(result)
 }
 
-func (a *App) getAllPanelsForDisplayHandler(w http.ResponseWriter, r *http.Request) {
-	userRole := r.URL.Query().Get("role")
-	companyId := r.URL.Query().Get("company_id")
-	if userRole == "" {
-		userRole = "admin"
-	}
-
-	var relevantPanelIds []string
-	var panelIdQuery string
-	var args []interface{}
-
+// panelScopeQuery mengembalikan query no_pp yang boleh dilihat oleh sebuah
+// role/company. ok bernilai false untuk role yang tidak dikenal.
+func panelScopeQuery(userRole, companyId string) (query string, args []interface{}, ok bool) {
 	switch userRole {
-	case "admin", "viewer":
-		panelIdQuery = "SELECT no_pp FROM public.panels"
-	case "k3":
+	case AppRoleAdmin, AppRoleViewer:
+		query = "SELECT no_pp FROM public.panels"
+	case AppRoleK3:
 		args = append(args, companyId, companyId, companyId)
-		panelIdQuery = `
+		query = `
 			SELECT no_pp FROM public.panels WHERE vendor_id = $1 OR vendor_id IS NULL
 			UNION SELECT panel_no_pp FROM public.palet WHERE vendor = $2
 			UNION SELECT panel_no_pp FROM public.corepart WHERE vendor = $3`
-	case "k5":
+	case AppRoleK5:
 		args = append(args, companyId)
-		panelIdQuery = `
+		query = `
 			SELECT panel_no_pp FROM public.busbars WHERE vendor = $1
 			UNION
 			SELECT no_pp FROM public.panels WHERE no_pp NOT IN (SELECT DISTINCT panel_no_pp FROM public.busbars)`
-	case "g3":
+	case AppRoleG3:
 		args = append(args, companyId)
-		panelIdQuery = `
+		query = `
 			SELECT panel_no_pp FROM public.g3_vendors WHERE vendor = $1
 			UNION
 			SELECT no_pp FROM public.panels WHERE no_pp NOT IN (SELECT DISTINCT panel_no_pp FROM public.g3_vendors)`
-	case "warehouse":
+	case AppRoleWarehouse:
 		args = append(args, companyId)
-		panelIdQuery = `
+		query = `
 			SELECT panel_no_pp FROM public.components WHERE vendor = $1
 			UNION
 			SELECT no_pp FROM public.panels WHERE no_pp NOT IN (SELECT DISTINCT panel_no_pp FROM public.components)`
 	default:
+		return "", nil, false
+	}
+	// Panel di trash tidak terlihat oleh siapa pun kecuali lewat /trash.
+	if userRole == AppRoleAdmin || userRole == AppRoleViewer {
+		query += " WHERE deleted_at IS NULL"
+	} else {
+		query = "SELECT no_pp FROM public.panels WHERE deleted_at IS NULL AND no_pp IN (" + query + ")"
+	}
+	return query, args, true
+}
+
+func (a *App) getAllPanelsForDisplayHandler(w http.ResponseWriter, r *http.Request) {
+	id := requestIdentity(r)
+	userRole := id.Role
+	companyId := id.CompanyID
+
+	listQuery, err := parsePanelListQuery(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	panelIdQuery, args, ok := panelScopeQuery(userRole, companyId)
+	if !ok {
+		w.Header().Set("X-Total-Count", "0")
 		respondWithJSON(w, http.StatusOK, []PanelDisplayDataWithTimeline{})
 		return
 	}
 
-	rows, err := a.DB.QueryContext(r.Context(), panelIdQuery, args...)
+	if listQuery.LikelyLate {
+		listQuery.OnlyNoPps, err = likelyLatePanels(a.DB, panelIdQuery, args)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal menghitung forecast: "+err.Error())
+			return
+		}
+	}
+
+	relevantPanelIds, totalCount, nextCursor, err := a.listPanelIDs(r.Context(), panelIdQuery, args, listQuery)
 	if err != nil {
 		log.Printf("SQL ERROR (getPanelIds): %v", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to get panel IDs: "+err.Error())
 		return
 	}
-	for rows.Next() {
-		var id string
-		if err := rows.Scan(&id); err == nil {
-			relevantPanelIds = append(relevantPanelIds, id)
-		}
+	w.Header().Set("X-Total-Count", strconv.Itoa(totalCount))
+	if nextCursor != "" {
+		w.Header().Set("X-Next-Cursor", nextCursor)
 	}
-	rows.Close()
 
 	if len(relevantPanelIds) == 0 {
 		respondWithJSON(w, http.StatusOK, []PanelDisplayDataWithTimeline{})
@@ -2005,7 +2389,7 @@ func (a *App) getAllPanelsForDisplayHandler(w http.ResponseWriter, r *http.Reque
 		SELECT p.no_pp, COUNT(DISTINCT i.id) as issue_count, COUNT(DISTINCT asr.id) as sr_count
 		FROM public.panels p
 		LEFT JOIN public.chats ch ON p.no_pp = ch.panel_no_pp
-		LEFT JOIN public.issues i ON ch.id = i.chat_id
+		LEFT JOIN public.issues i ON ch.id = i.chat_id AND i.deleted_at IS NULL
 		LEFT JOIN public.additional_sr asr ON p.no_pp = asr.panel_no_pp
 		WHERE p.no_pp = ANY($1) GROUP BY p.no_pp`
 
@@ -2037,47 +2421,23 @@ func (a *App) getAllPanelsForDisplayHandler(w http.ResponseWriter, r *http.Reque
         pu.name as panel_vendor_name, -- [Kolom 26]
 		pt.product_type,
 
-        -- TAMBAHAN WIRING (Urutan 27, 28, 29)
-        COALESCE((
-			SELECT progress 
-			FROM public.wirings 
-			WHERE panel_no_pp = p.no_pp 
-			ORDER BY created_at DESC 
-			LIMIT 1
-		), 0) as wiring_progress,
-
-		COALESCE((
-			SELECT status 
-			FROM public.wirings 
-			WHERE panel_no_pp = p.no_pp 
-			ORDER BY created_at DESC 
-			LIMIT 1
-		), 'Open') as wiring_status,
-
-		COALESCE((
-			SELECT supplier 
-			FROM public.wirings 
-			WHERE panel_no_pp = p.no_pp 
-			ORDER BY created_at DESC 
-			LIMIT 1
-		), '') as wiring_vendor_names,
-
-		(
-			SELECT target_delivery_wiring 
-			FROM public.wirings 
-			WHERE panel_no_pp = p.no_pp 
-			ORDER BY created_at DESC 
-			LIMIT 1
-		) as wiring_target_delivery,
+        -- TAMBAHAN WIRING (Urutan 27, 28, 29), gabungan semua paket aktif
+        COALESCE(ws.progress, 0) as wiring_progress,
+		COALESCE(ws.status, 'Open') as wiring_status,
+		COALESCE(ws.suppliers, '') as wiring_vendor_names,
+		ws.target_delivery_wiring as wiring_target_delivery,
 
         -- [Kolom 30] G3 harus di akhir sesuai urutan variabel scan nanti
         (SELECT STRING_AGG(c.name, ', ') 
          FROM public.companies c 
          JOIN public.g3_vendors g3 ON c.id = g3.vendor 
-         WHERE g3.panel_no_pp = p.no_pp) as g3_vendor_names
+         WHERE g3.panel_no_pp = p.no_pp) as g3_vendor_names,
+
+        p.version
     FROM public.panels p
     LEFT JOIN public.companies pu ON p.vendor_id = pu.id
 	LEFT JOIN public.product_types pt ON p.panel_type = pt.panel_type
+	LEFT JOIN public.panel_wiring_summary ws ON ws.panel_no_pp = p.no_pp
     WHERE p.no_pp = ANY($1)`
 
 	panelRows, err := a.DB.QueryContext(r.Context(), panelQuery, pq.Array(relevantPanelIds))
@@ -2134,6 +2494,7 @@ func (a *App) getAllPanelsForDisplayHandler(w http.ResponseWriter, r *http.Reque
 			&wiringVendorNames,
 			&wiringTargetDelivery,
 			&g3VendorNames,
+			&panel.Version,
 		)
 		if err != nil {
 			log.Printf("Error scanning panel row: %v", err)
@@ -2173,9 +2534,11 @@ func (a *App) getAllPanelsForDisplayHandler(w http.ResponseWriter, r *http.Reque
 			panel_type,
 			target_delivery_wiring,
 			created_at, 
-			updated_at
+			updated_at,
+			package_name
 		FROM wirings
-		WHERE LOWER(panel_no_pp) = LOWER($1)
+		WHERE LOWER(panel_no_pp) = LOWER($1) AND archived_at IS NULL
+		ORDER BY created_at
 	`, panel.NoPp)
 
 		if err == nil {
@@ -2198,6 +2561,7 @@ func (a *App) getAllPanelsForDisplayHandler(w http.ResponseWriter, r *http.Reque
 					&w.TargetDeliveryWiring, // WAJIB ADA
 					&w.CreatedAt,
 					&w.UpdatedAt,
+					&w.PackageName,
 				)
 				if err == nil {
 					wirings = append(wirings, w)
@@ -2212,36 +2576,7 @@ func (a *App) getAllPanelsForDisplayHandler(w http.ResponseWriter, r *http.Reque
 			pdd.G3VendorNames = &g3VendorNames.String
 		}
 
-		var historyStackData []map[string]interface{}
-		if historyStackJSON != nil {
-			json.Unmarshal(historyStackJSON, &historyStackData)
-
-			for _, item := range historyStackData {
-				if status, ok := item["snapshot_status"].(string); ok {
-					if timestampStr, ok := item["timestamp"].(string); ok {
-						ts, err := time.Parse(time.RFC3339, timestampStr)
-						if err != nil {
-							continue
-						}
-
-						// Cek status "Warehouse" atau "VendorWarehouse"
-						if status == "VendorWarehouse" || status == "Warehouse" {
-							pdd.ProductionDate = &ts
-						}
-
-						// Cek status "Production" atau "Subcontractor"
-						if status == "Production" || status == "Subcontractor" {
-							pdd.FatDate = &ts
-						}
-
-						// Cek status "FAT"
-						if status == "FAT" {
-							pdd.AllDoneDate = &ts
-						}
-					}
-				}
-			}
-		}
+		pdd.ProductionDate, pdd.FatDate, pdd.AllDoneDate = workflowMilestones(historyStackJSON)
 
 		panelMap[panel.NoPp] = &pdd
 	}
@@ -2370,8 +2705,15 @@ func (a *App) getAllPanelsForDisplayHandler(w http.ResponseWriter, r *http.Reque
 	respondWithJSON(w, http.StatusOK, finalResults)
 }
 func (a *App) getPanelKeysHandler(w http.ResponseWriter, r *http.Request) {
-	query := `SELECT no_pp, COALESCE(no_panel, ''), COALESCE(project, ''), COALESCE(no_wbs, '') FROM public.panels`
-	rows, err := a.DB.Query(query)
+	id := requestIdentity(r)
+	scopeQuery, args, ok := panelScopeQuery(id.Role, id.CompanyID)
+	if !ok {
+		respondWithJSON(w, http.StatusOK, []PanelKeyInfo{})
+		return
+	}
+	query := `SELECT no_pp, COALESCE(no_panel, ''), COALESCE(project, ''), COALESCE(no_wbs, '') FROM public.panels
+		WHERE no_pp IN (` + scopeQuery + `)`
+	rows, err := a.DB.Query(query, args...)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -2401,6 +2743,12 @@ func (a *App) deletePanelsHandler(w http.ResponseWriter, r *http.Request) {
 		respondWithJSON(w, http.StatusOK, map[string]string{"status": "success", "message": "Tidak ada panel yang dipilih untuk dihapus"})
 		return
 	}
+	// Versi dari If-Match berlaku untuk semua panel; gunakan "*" untuk
+	// menghapus panel dengan versi berbeda-beda.
+	expectedVersion, ok := checkIfMatch(w, r, true)
+	if !ok {
+		return
+	}
 
 	tx, err := a.DB.Begin()
 	if err != nil {
@@ -2409,7 +2757,14 @@ func (a *App) deletePanelsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
-	querySlots := "SELECT production_slot FROM panels WHERE no_pp = ANY($1) AND production_slot IS NOT NULL"
+	var targetCount int64
+	err = tx.QueryRow("SELECT COUNT(*) FROM (SELECT 1 FROM panels WHERE no_pp = ANY($1) AND deleted_at IS NULL FOR UPDATE) t", pq.Array(payload.NoPps)).Scan(&targetCount)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mencari data panel: "+err.Error())
+		return
+	}
+
+	querySlots := "SELECT production_slot FROM panels WHERE no_pp = ANY($1) AND production_slot IS NOT NULL AND deleted_at IS NULL"
 	rows, err := tx.Query(querySlots, pq.Array(payload.NoPps))
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Gagal mencari slot yang ditempati: "+err.Error())
@@ -2425,12 +2780,22 @@ func (a *App) deletePanelsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	rows.Close()
 
-	queryDelete := "DELETE FROM public.panels WHERE no_pp = ANY($1)"
-	result, err := tx.Exec(queryDelete, pq.Array(payload.NoPps))
+	actor := requestIdentity(r).Username
+	audit := beginAudit(tx, "panel", "t.no_pp = ANY($1)", pq.Array(payload.NoPps))
+	result, err := tx.Exec(softDeletePanelsQuery, pq.Array(payload.NoPps), actor, expectedVersion)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Gagal menghapus panel: "+err.Error())
 		return
 	}
+	if deleted, _ := result.RowsAffected(); deleted < targetCount {
+		respondWithError(w, http.StatusConflict, "Sebagian panel sudah diubah oleh pengguna lain. Muat ulang lalu coba lagi.")
+		return
+	}
+	audit.record(tx, actor, AuditSourceAPI)
+	if err := cancelPanelReservations(tx, payload.NoPps, actor); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal membatalkan reservasi slot: "+err.Error())
+		return
+	}
 
 	if len(slotsToFree) > 0 {
 		queryFreeSlots := "UPDATE production_slots SET is_occupied = false WHERE position_code = ANY($1)"
@@ -2447,11 +2812,15 @@ func (a *App) deletePanelsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rowsAffected, _ := result.RowsAffected()
-	message := fmt.Sprintf("%d panel berhasil dihapus dan slot terkait telah dikosongkan.", rowsAffected)
+	message := fmt.Sprintf("%d panel dipindahkan ke trash dan slot terkait telah dikosongkan.", rowsAffected)
 	respondWithJSON(w, http.StatusOK, map[string]string{"status": "success", "message": message})
 }
 func (a *App) deletePanelHandler(w http.ResponseWriter, r *http.Request) {
 	noPp := mux.Vars(r)["no_pp"]
+	expectedVersion, ok := checkIfMatch(w, r, true)
+	if !ok {
+		return
+	}
 
 	tx, err := a.DB.Begin()
 	if err != nil {
@@ -2461,7 +2830,7 @@ func (a *App) deletePanelHandler(w http.ResponseWriter, r *http.Request) {
 	defer tx.Rollback()
 
 	var occupiedSlot sql.NullString
-	err = tx.QueryRow("SELECT production_slot FROM panels WHERE no_pp = $1", noPp).Scan(&occupiedSlot)
+	err = tx.QueryRow("SELECT production_slot FROM panels WHERE no_pp = $1 AND deleted_at IS NULL", noPp).Scan(&occupiedSlot)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			respondWithError(w, http.StatusNotFound, "Panel tidak ditemukan")
@@ -2471,17 +2840,27 @@ func (a *App) deletePanelHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := tx.Exec("DELETE FROM public.panels WHERE no_pp = $1", noPp)
+	actor := requestIdentity(r).Username
+	audit := beginAudit(tx, "panel", "t.no_pp = $1", noPp)
+	result, err := tx.Exec(softDeletePanelsQuery, pq.Array([]string{noPp}), actor, expectedVersion)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Gagal menghapus panel: "+err.Error())
 		return
 	}
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
-
+		if expectedVersion != nil {
+			respondVersionMiss(w, tx, "panel", noPp)
+			return
+		}
 		respondWithError(w, http.StatusNotFound, "Panel tidak ditemukan saat proses hapus")
 		return
 	}
+	audit.record(tx, actor, AuditSourceAPI)
+	if err := cancelPanelReservations(tx, []string{noPp}, actor); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal membatalkan reservasi slot: "+err.Error())
+		return
+	}
 
 	if occupiedSlot.Valid && occupiedSlot.String != "" {
 		_, err = tx.Exec("UPDATE production_slots SET is_occupied = false WHERE position_code = $1", occupiedSlot.String)
@@ -2496,10 +2875,16 @@ func (a *App) deletePanelHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]string{"status": "success", "message": "Panel berhasil dihapus dan slot produksi telah dikosongkan."})
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": "success", "message": "Panel dipindahkan ke trash dan slot produksi telah dikosongkan."})
 }
 
 func (a *App) getAllPanelsHandler(w http.ResponseWriter, r *http.Request) {
+	id := requestIdentity(r)
+	scopeQuery, args, ok := panelScopeQuery(id.Role, id.CompanyID)
+	if !ok {
+		respondWithJSON(w, http.StatusOK, []Panel{})
+		return
+	}
 	query := `
 		SELECT
 			CASE WHEN no_pp LIKE 'TEMP_PP_%' THEN '' ELSE no_pp END AS no_pp,
@@ -2507,9 +2892,10 @@ func (a *App) getAllPanelsHandler(w http.ResponseWriter, r *http.Request) {
 			status_busbar_pcc, status_busbar_mcc, status_component, status_palet,
 			status_corepart, ao_busbar_pcc, ao_busbar_mcc, created_by, vendor_id,
 			is_closed, closed_date, panel_type
-		FROM public.panels`
+		FROM public.panels
+		WHERE no_pp IN (` + scopeQuery + `)`
 
-	rows, err := a.DB.Query(query)
+	rows, err := a.DB.Query(query, args...)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -2540,15 +2926,28 @@ func (a *App) getPanelByNoPpHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
-
+	// Forecast berubah seiring waktu, jadi respons dengan forecast tidak
+	// memakai ETag versi.
+	if r.URL.Query().Get("include") == "forecast" {
+		panel.Forecast, err = a.panelForecast(noPP)
+		if err != nil {
+			http.Error(w, "Gagal menghitung forecast panel", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		if notModified(w, r, panel.Version) {
+			return
+		}
+		setETag(w, panel.Version)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(panel)
 }
 
 func (a *App) getPanelByNoPP(noPP string) (*Panel, error) {
 	var p Panel
-	query := `SELECT no_pp, no_panel, no_wbs, project, panel_type FROM panels WHERE no_pp = $1`
-	err := a.DB.QueryRow(query, noPP).Scan(&p.NoPp, &p.NoPanel, &p.NoWbs, &p.Project, &p.PanelType)
+	query := `SELECT no_pp, no_panel, no_wbs, project, panel_type, project_id, wbs_id, version FROM panels WHERE no_pp = $1 AND deleted_at IS NULL`
+	err := a.DB.QueryRow(query, noPP).Scan(&p.NoPp, &p.NoPanel, &p.NoWbs, &p.Project, &p.PanelType, &p.ProjectID, &p.WbsID, &p.Version)
 	if err != nil {
 		return nil, err
 	}
@@ -2584,6 +2983,10 @@ func (a *App) changePanelNoPpHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	expectedVersion, ok := checkIfMatch(w, r, true)
+	if !ok {
+		return
+	}
 
 	tx, err := a.DB.Begin()
 	if err != nil {
@@ -2597,8 +3000,8 @@ func (a *App) changePanelNoPpHandler(w http.ResponseWriter, r *http.Request) {
 		SELECT no_pp, no_panel, no_wbs, project, percent_progress, start_date, target_delivery,
 		status_busbar_pcc, status_busbar_mcc, status_component, status_palet, status_corepart,
 		ao_busbar_pcc, ao_busbar_mcc, created_by, vendor_id, is_closed, closed_date, panel_type, remarks,
-		close_date_busbar_pcc, close_date_busbar_mcc
-		FROM public.panels WHERE no_pp = $1`
+		close_date_busbar_pcc, close_date_busbar_mcc, version
+		FROM public.panels WHERE no_pp = $1 AND deleted_at IS NULL FOR UPDATE`
 	err = tx.QueryRow(querySelect, oldNoPp).Scan(
 		&existingPanel.NoPp, &existingPanel.NoPanel, &existingPanel.NoWbs, &existingPanel.Project,
 		&existingPanel.PercentProgress, &existingPanel.StartDate, &existingPanel.TargetDelivery,
@@ -2606,7 +3009,7 @@ func (a *App) changePanelNoPpHandler(w http.ResponseWriter, r *http.Request) {
 		&existingPanel.StatusPalet, &existingPanel.StatusCorepart, &existingPanel.AoBusbarPcc,
 		&existingPanel.AoBusbarMcc, &existingPanel.CreatedBy, &existingPanel.VendorID,
 		&existingPanel.IsClosed, &existingPanel.ClosedDate, &existingPanel.PanelType, &existingPanel.Remarks,
-		&existingPanel.CloseDateBusbarPcc, &existingPanel.CloseDateBusbarMcc,
+		&existingPanel.CloseDateBusbarPcc, &existingPanel.CloseDateBusbarMcc, &existingPanel.Version,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -2616,6 +3019,12 @@ func (a *App) changePanelNoPpHandler(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil data panel: "+err.Error())
 		return
 	}
+	if expectedVersion != nil && *expectedVersion != existingPanel.Version {
+		tx.Rollback()
+		respondVersionMiss(w, a.DB, "panel", oldNoPp)
+		return
+	}
+	audit := beginAudit(tx, "panel", "t.no_pp = $1", oldNoPp)
 
 	if payloadData.NoPanel != nil {
 		existingPanel.NoPanel = payloadData.NoPanel
@@ -2707,9 +3116,10 @@ func (a *App) changePanelNoPpHandler(w http.ResponseWriter, r *http.Request) {
 			status_corepart = $11, ao_busbar_pcc = $12, ao_busbar_mcc = $13,
 			vendor_id = $14, is_closed = $15, closed_date = $16, panel_type = $17, remarks = $18,
 			close_date_busbar_pcc = $19, close_date_busbar_mcc = $20
-		WHERE no_pp = $21`
+		WHERE no_pp = $21
+		RETURNING version`
 
-	_, err = tx.Exec(updateQuery,
+	err = tx.QueryRow(updateQuery,
 		existingPanel.NoPanel, existingPanel.NoWbs, existingPanel.Project, existingPanel.PercentProgress,
 		existingPanel.StartDate, existingPanel.TargetDelivery, existingPanel.StatusBusbarPcc,
 		existingPanel.StatusBusbarMcc, existingPanel.StatusComponent, existingPanel.StatusPalet,
@@ -2718,11 +3128,13 @@ func (a *App) changePanelNoPpHandler(w http.ResponseWriter, r *http.Request) {
 		existingPanel.Remarks,
 		existingPanel.CloseDateBusbarPcc, existingPanel.CloseDateBusbarMcc,
 		pkToUpdateWith,
-	)
+	).Scan(&existingPanel.Version)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Gagal update detail panel: "+err.Error())
 		return
 	}
+	renameAuditPanel(tx, oldNoPp, pkToUpdateWith)
+	audit.recordRenamed(tx, requestIdentity(r).Username, AuditSourceAPI, "t.no_pp = $1", pkToUpdateWith)
 
 	if err := tx.Commit(); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Gagal commit transaksi: "+err.Error())
@@ -2730,6 +3142,7 @@ func (a *App) changePanelNoPpHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	existingPanel.NoPp = pkToUpdateWith
+	setETag(w, existingPanel.Version)
 	respondWithJSON(w, http.StatusOK, existingPanel)
 }
 
@@ -2742,12 +3155,24 @@ func (a *App) upsertPanelRemarkHandler(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, "Invalid payload")
 		return
 	}
-	query := `UPDATE panels SET remarks = $1 WHERE no_pp = $2`
-	_, err := a.DB.Exec(query, payload.Remarks, payload.PanelNoPp)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+	expectedVersion, ok := checkIfMatch(w, r, true)
+	if !ok {
 		return
 	}
+	audit := beginAudit(a.DB, "panel", "t.no_pp = $1", payload.PanelNoPp)
+	query := `UPDATE panels SET remarks = $1 WHERE no_pp = $2 AND ($3::bigint IS NULL OR version = $3) RETURNING version`
+	var version int64
+	err := a.DB.QueryRow(query, payload.Remarks, payload.PanelNoPp, expectedVersion).Scan(&version)
+	if err == sql.ErrNoRows {
+		respondVersionMiss(w, a.DB, "panel", payload.PanelNoPp)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	audit.record(a.DB, requestIdentity(r).Username, AuditSourceAPI)
+	setETag(w, version)
 	respondWithJSON(w, http.StatusCreated, payload)
 }
 
@@ -2777,6 +3202,7 @@ func (a *App) isPanelNumberUniqueHandler(w http.ResponseWriter, r *http.Request)
 }
 
 func (a *App) deleteGenericRelationHandler(tableName string) http.HandlerFunc {
+	auditEntity, _ := auditEntityForTable(tableName)
 	return func(w http.ResponseWriter, r *http.Request) {
 		var payload struct {
 			PanelNoPp string `json:"panel_no_pp"`
@@ -2792,12 +3218,14 @@ func (a *App) deleteGenericRelationHandler(tableName string) http.HandlerFunc {
 			return
 		}
 
+		audit := beginAudit(a.DB, auditEntity, "t.panel_no_pp = $1 AND t.vendor = $2", payload.PanelNoPp, payload.Vendor)
 		query := fmt.Sprintf("DELETE FROM %s WHERE panel_no_pp = $1 AND vendor = $2", tableName)
 		result, err := a.DB.Exec(query, payload.PanelNoPp, payload.Vendor)
 		if err != nil {
 			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Gagal menghapus relasi %s: %v", tableName, err))
 			return
 		}
+		audit.record(a.DB, requestIdentity(r).Username, AuditSourceAPI)
 
 		rowsAffected, _ := result.RowsAffected()
 		if rowsAffected == 0 {
@@ -2810,6 +3238,7 @@ func (a *App) deleteGenericRelationHandler(tableName string) http.HandlerFunc {
 }
 
 func (a *App) upsertGenericHandler(tableName string, model interface{}) http.HandlerFunc {
+	auditEntity, _ := auditEntityForTable(tableName)
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := json.NewDecoder(r.Body).Decode(model); err != nil {
 			respondWithError(w, http.StatusBadRequest, "Invalid payload")
@@ -2833,12 +3262,14 @@ func (a *App) upsertGenericHandler(tableName string, model interface{}) http.Han
 			respondWithError(w, http.StatusInternalServerError, "Unsupported model type")
 			return
 		}
+		audit := beginAudit(a.DB, auditEntity, "t.panel_no_pp = $1 AND t.vendor = $2", panelNoPp, vendor)
 		query := "INSERT INTO " + tableName + " (panel_no_pp, vendor) VALUES ($1, $2) ON CONFLICT (panel_no_pp, vendor) DO NOTHING"
 		_, err := a.DB.Exec(query, panelNoPp, vendor)
 		if err != nil {
 			respondWithError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
+		audit.record(a.DB, requestIdentity(r).Username, AuditSourceAPI)
 		respondWithJSON(w, http.StatusCreated, model)
 	}
 }
@@ -2887,11 +3318,13 @@ func (a *App) upsertBusbarRemarkandVendorHandler(w http.ResponseWriter, r *http.
 	query := `
 		INSERT INTO busbars (panel_no_pp, vendor, remarks) VALUES ($1, $2, $3)
 		ON CONFLICT (panel_no_pp, vendor) DO UPDATE SET remarks = EXCLUDED.remarks`
+	audit := beginAudit(a.DB, "busbar", "t.panel_no_pp = $1 AND t.vendor = $2", payload.PanelNoPp, payload.Vendor)
 	_, err := a.DB.Exec(query, payload.PanelNoPp, payload.Vendor, payload.Remarks)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	audit.record(a.DB, requestIdentity(r).Username, AuditSourceAPI)
 	respondWithJSON(w, http.StatusCreated, payload)
 }
 func (a *App) upsertStatusAOK5(w http.ResponseWriter, r *http.Request) {
@@ -2957,17 +3390,30 @@ func (a *App) upsertStatusAOK5(w http.ResponseWriter, r *http.Request) {
 		respondWithJSON(w, http.StatusOK, map[string]string{"message": "No fields to update."})
 		return
 	}
+	expectedVersion, ok := checkIfMatch(w, r, true)
+	if !ok {
+		return
+	}
 
 	// Eksekusi Update
-	query := fmt.Sprintf("UPDATE panels SET %s WHERE no_pp = $%d", strings.Join(updates, ", "), argCounter)
-	args = append(args, payload.PanelNoPp)
+	query := fmt.Sprintf("UPDATE panels SET %s WHERE no_pp = $%d AND ($%d::bigint IS NULL OR version = $%d) RETURNING version",
+		strings.Join(updates, ", "), argCounter, argCounter+1, argCounter+1)
+	args = append(args, payload.PanelNoPp, expectedVersion)
 
-	_, err := a.DB.Exec(query, args...)
+	audit := beginAudit(a.DB, "panel", "t.no_pp = $1", payload.PanelNoPp)
+	var version int64
+	err := a.DB.QueryRow(query, args...).Scan(&version)
+	if err == sql.ErrNoRows {
+		respondVersionMiss(w, a.DB, "panel", payload.PanelNoPp)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to update panel status: "+err.Error())
 		return
 	}
+	audit.record(a.DB, requestIdentity(r).Username, AuditSourceAPI)
 
+	setETag(w, version)
 	respondWithJSON(w, http.StatusOK, map[string]string{"status": "success"})
 }
 
@@ -2993,20 +3439,27 @@ func (a *App) upsertStatusWHS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := `UPDATE panels SET status_component = $1 WHERE no_pp = $2`
-
-	result, err := a.DB.Exec(query, *payload.StatusComponent, payload.PanelNoPp)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to update panel component status: "+err.Error())
+	expectedVersion, ok := checkIfMatch(w, r, true)
+	if !ok {
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		respondWithError(w, http.StatusNotFound, "Panel with the given no_pp not found.")
+	query := `UPDATE panels SET status_component = $1 WHERE no_pp = $2 AND ($3::bigint IS NULL OR version = $3) RETURNING version`
+
+	audit := beginAudit(a.DB, "panel", "t.no_pp = $1", payload.PanelNoPp)
+	var version int64
+	err := a.DB.QueryRow(query, *payload.StatusComponent, payload.PanelNoPp, expectedVersion).Scan(&version)
+	if err == sql.ErrNoRows {
+		respondVersionMiss(w, a.DB, "panel", payload.PanelNoPp)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update panel component status: "+err.Error())
 		return
 	}
+	audit.record(a.DB, requestIdentity(r).Username, AuditSourceAPI)
 
+	setETag(w, version)
 	respondWithJSON(w, http.StatusOK, map[string]string{"status": "success"})
 }
 func (a *App) getAllGenericHandler(tableName string, modelFactory func() interface{}) http.HandlerFunc {
@@ -3086,8 +3539,7 @@ func (a *App) updateCompanyHandler(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusOK, map[string]string{"status": "success"})
 }
 
-func (a *App) getFilteredDataForExport(r *http.Request) (map[string]interface{}, error) {
-	queryParams := r.URL.Query()
+func (a *App) getFilteredDataForExport(queryParams url.Values) (map[string]interface{}, error) {
 	result := make(map[string]interface{})
 
 	tx, err := a.DB.Begin()
@@ -3109,10 +3561,8 @@ func (a *App) getFilteredDataForExport(r *http.Request) (map[string]interface{},
 			p.status_penyelesaian, p.production_slot,
 			COALESCE((
 				SELECT progress 
-				FROM public.wirings 
-				WHERE panel_no_pp = p.no_pp 
-				ORDER BY created_at DESC 
-				LIMIT 1
+				FROM public.panel_wiring_summary 
+				WHERE panel_no_pp = p.no_pp
 			), 0) as wiring_progress
 		FROM public.panels p
 		LEFT JOIN public.product_types pt 
@@ -3121,7 +3571,7 @@ func (a *App) getFilteredDataForExport(r *http.Request) (map[string]interface{},
 		LEFT JOIN public.components c ON p.no_pp = c.panel_no_pp
 		LEFT JOIN public.palet pa ON p.no_pp = pa.panel_no_pp
 		LEFT JOIN public.corepart cp ON p.no_pp = cp.panel_no_pp
-		WHERE 1=1
+		WHERE p.deleted_at IS NULL
 	`
 	args := []interface{}{}
 	argCounter := 1
@@ -3251,19 +3701,8 @@ func (a *App) getFilteredDataForExport(r *http.Request) (map[string]interface{},
 		statusList := strings.Split(statuses, ",")
 		var statusConditions []string
 		for _, status := range statusList {
-			switch status {
-			case "progressRed":
-				statusConditions = append(statusConditions, "(p.percent_progress > 0 AND p.percent_progress < 50)")
-			case "progressOrange":
-				statusConditions = append(statusConditions, "(p.percent_progress >= 50 AND p.percent_progress < 75)")
-			case "progressBlue":
-				statusConditions = append(statusConditions, "(p.percent_progress >= 75 AND p.percent_progress < 100)")
-			case "readyToDelivery":
-				statusConditions = append(statusConditions, "(p.percent_progress >= 100 AND p.is_closed = false)")
-			case "closed":
-				statusConditions = append(statusConditions, "(p.is_closed = true)")
-			case "progressGrey":
-				statusConditions = append(statusConditions, "(p.percent_progress = 0 OR p.percent_progress IS NULL)")
+			if condition, ok := panelBucketCondition(status); ok {
+				statusConditions = append(statusConditions, condition)
 			}
 		}
 		if len(statusConditions) > 0 {
@@ -3307,6 +3746,10 @@ func (a *App) getFilteredDataForExport(r *http.Request) (map[string]interface{},
 		result["components"], _ = fetchInAs(tx, "components", "panel_no_pp", relevantPanelIds, func() interface{} { return &Component{} })
 		result["palet"], _ = fetchInAs(tx, "palet", "panel_no_pp", relevantPanelIds, func() interface{} { return &Palet{} })
 		result["corepart"], _ = fetchInAs(tx, "corepart", "panel_no_pp", relevantPanelIds, func() interface{} { return &Corepart{} })
+		result["wirings"], err = fetchWiringSummaries(tx, relevantPanelIds)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch wirings: %w", err)
+		}
 
 		issueQuery := `
 			SELECT 
@@ -3316,7 +3759,7 @@ func (a *App) getFilteredDataForExport(r *http.Request) (map[string]interface{},
 			FROM issues i
 			JOIN chats ch ON i.chat_id = ch.id
 			JOIN panels p ON ch.panel_no_pp = p.no_pp
-			WHERE p.no_pp = ANY($1)
+			WHERE p.no_pp = ANY($1) AND i.deleted_at IS NULL
 			ORDER BY p.no_pp, i.created_at`
 		issueRows, err := tx.Query(issueQuery, pq.Array(relevantPanelIds))
 		if err != nil {
@@ -3342,7 +3785,7 @@ func (a *App) getFilteredDataForExport(r *http.Request) (map[string]interface{},
             FROM issue_comments ic
             JOIN issues i ON ic.issue_id = i.id
             JOIN chats ch ON i.chat_id = ch.id
-            WHERE ch.panel_no_pp = ANY($1)
+            WHERE ch.panel_no_pp = ANY($1) AND i.deleted_at IS NULL AND ic.deleted_at IS NULL
             ORDER BY ic.issue_id, ic.timestamp`
 		commentRows, err := tx.Query(commentQuery, pq.Array(relevantPanelIds))
 		if err != nil {
@@ -3407,6 +3850,7 @@ func (a *App) getFilteredDataForExport(r *http.Request) (map[string]interface{},
 		result["components"] = []Component{}
 		result["palet"] = []Palet{}
 		result["corepart"] = []Corepart{}
+		result["wirings"] = []interface{}{}
 		result["issues"] = []IssueForExport{}
 		result["comments"] = []CommentForExport{}
 		result["additional_srs"] = []AdditionalSRForExport{}
@@ -3418,7 +3862,7 @@ func (a *App) getFilteredDataForExport(r *http.Request) (map[string]interface{},
 }
 
 func (a *App) getFilteredDataForExportHandler(w http.ResponseWriter, r *http.Request) {
-	data, err := a.getFilteredDataForExport(r)
+	data, err := a.getFilteredDataForExport(r.URL.Query())
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -3431,7 +3875,7 @@ func (a *App) generateCustomExportJsonHandler(w http.ResponseWriter, r *http.Req
 	includeIssues, _ := strconv.ParseBool(r.URL.Query().Get("issues"))
 	includeSrs, _ := strconv.ParseBool(r.URL.Query().Get("srs"))
 
-	data, err := a.getFilteredDataForExport(r)
+	data, err := a.getFilteredDataForExport(r.URL.Query())
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -3558,7 +4002,6 @@ func (a *App) generateCustomExportJsonHandler(w http.ResponseWriter, r *http.Req
 			}
 			userData = append(userData, map[string]interface{}{
 				"Username":     account.Username,
-				"Password":     account.Password,
 				"Company":      companyName,
 				"Company Role": companyRole,
 			})
@@ -3580,14 +4023,19 @@ func (a *App) generateCustomExportJsonHandler(w http.ResponseWriter, r *http.Req
 
 func (a *App) generateFilteredDatabaseJsonHandler(w http.ResponseWriter, r *http.Request) {
 	tablesParam := r.URL.Query().Get("tables")
-	tablesToInclude := strings.Split(tablesParam, ",")
 
-	data, err := a.getFilteredDataForExport(r)
+	data, err := a.getFilteredDataForExport(r.URL.Query())
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	respondWithJSON(w, http.StatusOK, selectExportTables(data, strings.Split(tablesParam, ",")))
+}
+
+// selectExportTables memetakan hasil getFilteredDataForExport ke nama tabel
+// database, dengan format yang sama dengan yang diterima importDatabaseData.
+func selectExportTables(data map[string]interface{}, tablesToInclude []string) map[string]interface{} {
 	jsonData := make(map[string]interface{})
 
 	for _, table := range tablesToInclude {
@@ -3615,8 +4063,7 @@ func (a *App) generateFilteredDatabaseJsonHandler(w http.ResponseWriter, r *http
 			jsonData["issue_comments"] = data["comments"]
 		}
 	}
-
-	respondWithJSON(w, http.StatusOK, jsonData)
+	return jsonData
 }
 
 func (a *App) importDataHandler(w http.ResponseWriter, r *http.Request) {
@@ -3626,31 +4073,57 @@ func (a *App) importDataHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tx, err := a.DB.Begin()
-	if err != nil {
+	if err := importDatabaseData(a.DB, data, requestIdentity(r).Username, AuditSourceImport); err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	respondWithJSON(w, http.StatusCreated, map[string]string{"status": "success", "message": "Data imported successfully"})
+}
+
+// importDatabaseData memasukkan data hasil export database dalam satu transaksi.
+func importDatabaseData(db *sql.DB, data map[string][]map[string]interface{}, actor string, source auditSource) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
 	defer tx.Rollback()
 
 	tableOrder := []string{"companies", "company_accounts", "panels", "busbars", "components", "palet", "corepart"}
 	for _, tableName := range tableOrder {
 		if items, ok := data[tableName]; ok {
+			var audit *auditScope
+			if entity, ok := auditEntityForTable(tableName); ok {
+				keyCol, where := "panel_no_pp", "t.panel_no_pp = ANY($1)"
+				if tableName == "panels" {
+					keyCol, where = "no_pp", "t.no_pp = ANY($1)"
+				}
+				var keys []string
+				for _, itemData := range items {
+					keys = append(keys, fmt.Sprintf("%v", itemData[keyCol]))
+				}
+				audit = beginAudit(tx, entity, where, pq.Array(keys))
+			}
 			for _, itemData := range items {
 				cleanMapData(itemData)
+				if tableName == "company_accounts" {
+					if err := hashImportedPassword(itemData); err != nil {
+						return fmt.Errorf("Gagal memproses password: %w", err)
+					}
+				}
 				if err := insertMap(tx, tableName, itemData); err != nil {
-					respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to import to %s: %v", tableName, err))
-					return
+					return fmt.Errorf("Failed to import to %s: %w", tableName, err)
 				}
 			}
+			if audit != nil {
+				audit.record(tx, actor, source)
+			}
 		}
 	}
 
 	if err := tx.Commit(); err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Transaction commit failed: "+err.Error())
-		return
+		return fmt.Errorf("Transaction commit failed: %w", err)
 	}
-	respondWithJSON(w, http.StatusCreated, map[string]string{"status": "success", "message": "Data imported successfully"})
+	return nil
 }
 func (a *App) generateImportTemplateHandler(w http.ResponseWriter, r *http.Request) {
 	dataType := r.URL.Query().Get("dataType")
@@ -3737,9 +4210,8 @@ func generateAcronym(name string) string {
 
 func (a *App) importFromCustomTemplateHandler(w http.ResponseWriter, r *http.Request) {
 	var payload struct {
-		Mode             string                              `json:"mode"`
-		Data             map[string][]map[string]interface{} `json:"data"`
-		LoggedInUsername *string                             `json:"imported_by"`
+		Mode string                              `json:"mode"`
+		Data map[string][]map[string]interface{} `json:"data"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
@@ -3811,11 +4283,9 @@ func (a *App) importFromCustomTemplateHandler(w http.ResponseWriter, r *http.Req
 					panel_type = EXCLUDED.panel_type,
 					target_delivery = EXCLUDED.target_delivery;`
 
-			var creator string
-			if payload.LoggedInUsername != nil {
-				creator = *payload.LoggedInUsername
-			}
+			creator := requestIdentity(r).Username
 
+			audit := beginAudit(tx, "panel", "t.no_pp = $1", pPp)
 			_, err := tx.Exec(query,
 				pPp, pPanel, pWbs, pProj,
 				pType, parseDate(pTarget), 0.0, creator,
@@ -3825,6 +4295,7 @@ func (a *App) importFromCustomTemplateHandler(w http.ResponseWriter, r *http.Req
 			if err != nil {
 				errors = append(errors, fmt.Sprintf("Baris %d: %v", rowNum, err))
 			} else {
+				audit.record(tx, creator, AuditSourceImport)
 				dataProcessed = true
 			}
 		}
@@ -3887,6 +4358,7 @@ func (a *App) createIssueForPanelHandler(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusBadRequest, "Root cause tidak boleh kosong")
 		return
 	}
+	payload.CreatedBy = requestIdentity(r).Username
 
 	tx, err := a.DB.Begin()
 	if err != nil {
@@ -3962,43 +4434,30 @@ func (a *App) createIssueForPanelHandler(w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		wbs, noPanel = "N/A", "N/A"
 	}
+
+	if payload.NotifyEmail != "" {
+		err = enqueueNotification(tx, outboxMessage{
+			Event:    "issue.created",
+			Title:    fmt.Sprintf("Isu Baru - %s / %s", wbs, noPanel),
+			Body:     payload.Title,
+			Emails:   excludeRecipient(strings.Split(payload.NotifyEmail, ","), ""),
+			Data:     map[string]string{"panel_no_pp": panelNoPp, "issue_id": strconv.Itoa(issueID)},
+			Template: "issue_created",
+			TemplateData: map[string]interface{}{
+				"WBS": wbs, "NoPanel": noPanel, "Title": payload.Title,
+				"Description": payload.Description, "CreatedBy": payload.CreatedBy,
+			},
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal menyimpan notifikasi: "+err.Error())
+			return
+		}
+	}
 	if err := tx.Commit(); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to commit transaction")
 		return
 	}
 
-	go func() {
-		if payload.NotifyEmail == "" {
-			return
-		}
-		finalRecipients := strings.Split(payload.NotifyEmail, ",")
-
-		// JUDUL: WBS + No Panel
-		subject := fmt.Sprintf("[NO REPLY] TrisutorPRO: Isu Baru - %s / %s", wbs, noPanel)
-
-		htmlBody := fmt.Sprintf(`
-            <div style="font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif; color: #333; line-height: 1.6; max-width: 600px; border: 1px solid #eee; padding: 20px;">
-                <h2 style="color: #27ae60; border-bottom: 2px solid #27ae60; padding-bottom: 10px;">Laporan Isu Baru</h2>
-                <p>Telah ditambahkan isu baru untuk panel berikut:</p>
-                
-                <p><strong>WBS:</strong> %s<br>
-                   <strong>No. Panel:</strong> %s</p>
-
-                <div style="background: #f9f9f9; padding: 15px; border-radius: 5px; margin: 20px 0;">
-                    <h3 style="margin-top:0; color: #2c3e50;">%s</h3>
-                    <p style="margin-bottom:0;">%s</p>
-                </div>
-                
-                <p style="font-size: 12px; color: #999; border-top: 1px solid #eee; pt: 10px;">
-                    Dibuat oleh: %s<br>
-                    <i>Email ini dikirim secara otomatis oleh sistem TrisutorPRO.</i>
-                </p>
-            </div>`,
-			wbs, noPanel, payload.Title, payload.Description, payload.CreatedBy)
-
-		sendNotificationEmail(finalRecipients, subject, htmlBody)
-	}()
-
 	respondWithJSON(w, http.StatusCreated, map[string]int{"issue_id": issueID})
 }
 
@@ -4017,7 +4476,7 @@ func (a *App) getIssuesByPanelHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rows, err := a.DB.Query("SELECT id, chat_id, title, description, status, logs, created_by, created_at, updated_at, notify_email FROM public.issues WHERE chat_id = $1 ORDER BY created_at DESC", chatID)
+	rows, err := a.DB.Query("SELECT id, chat_id, title, description, status, logs, created_by, created_at, updated_at, notify_email, version FROM public.issues WHERE chat_id = $1 AND deleted_at IS NULL ORDER BY created_at DESC", chatID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -4029,7 +4488,7 @@ func (a *App) getIssuesByPanelHandler(w http.ResponseWriter, r *http.Request) {
 
 	for rows.Next() {
 		var issue Issue
-		if err := rows.Scan(&issue.ID, &issue.ChatID, &issue.Title, &issue.Description, &issue.Status, &issue.Logs, &issue.CreatedBy, &issue.CreatedAt, &issue.UpdatedAt, &issue.NotifyEmail); err != nil {
+		if err := rows.Scan(&issue.ID, &issue.ChatID, &issue.Title, &issue.Description, &issue.Status, &issue.Logs, &issue.CreatedBy, &issue.CreatedAt, &issue.UpdatedAt, &issue.NotifyEmail, &issue.Version); err != nil {
 			respondWithError(w, http.StatusInternalServerError, "Failed to scan issue: "+err.Error())
 			return
 		}
@@ -4078,7 +4537,7 @@ func (a *App) getIssueByIDHandler(w http.ResponseWriter, r *http.Request) {
 
 	var issue Issue
 
-	err = a.DB.QueryRow("SELECT id, chat_id, title, description, status, logs, created_by, created_at, updated_at FROM public.issues WHERE id = $1", id).Scan(&issue.ID, &issue.ChatID, &issue.Title, &issue.Description, &issue.Status, &issue.Logs, &issue.CreatedBy, &issue.CreatedAt, &issue.UpdatedAt)
+	err = a.DB.QueryRow("SELECT id, chat_id, title, description, status, logs, created_by, created_at, updated_at, version FROM public.issues WHERE id = $1 AND deleted_at IS NULL", id).Scan(&issue.ID, &issue.ChatID, &issue.Title, &issue.Description, &issue.Status, &issue.Logs, &issue.CreatedBy, &issue.CreatedAt, &issue.UpdatedAt, &issue.Version)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			respondWithError(w, http.StatusNotFound, "Issue not found")
@@ -4087,6 +4546,9 @@ func (a *App) getIssueByIDHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	if notModified(w, r, issue.Version) {
+		return
+	}
 
 	rows, err := a.DB.Query("SELECT id, issue_id, photo_data FROM photos WHERE issue_id = $1", id)
 	if err != nil {
@@ -4106,6 +4568,7 @@ func (a *App) getIssueByIDHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := IssueWithPhotos{Issue: issue, Photos: photos}
+	setETag(w, issue.Version)
 	respondWithJSON(w, http.StatusOK, response)
 }
 func (a *App) updateIssueHandler(w http.ResponseWriter, r *http.Request) {
@@ -4127,10 +4590,15 @@ func (a *App) updateIssueHandler(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, "Invalid payload: "+err.Error())
 		return
 	}
+	payload.UpdatedBy = requestIdentity(r).Username
 	if payload.Title == "" {
 		respondWithError(w, http.StatusBadRequest, "Tipe Masalah tidak boleh kosong")
 		return
 	}
+	expectedVersion, ok := checkIfMatch(w, r, true)
+	if !ok {
+		return
+	}
 
 	tx, err := a.DB.Begin()
 	if err != nil {
@@ -4144,7 +4612,7 @@ func (a *App) updateIssueHandler(w http.ResponseWriter, r *http.Request) {
 	err = tx.QueryRow(`
 		SELECT i.logs, i.status, COALESCE(i.notify_email, ''), c.panel_no_pp
 		FROM public.issues i JOIN public.chats c ON i.chat_id = c.id
-		WHERE i.id = $1`, issueID).Scan(&currentLogs, &currentStatus, &notifyEmail, &panelNoPp)
+		WHERE i.id = $1 AND i.deleted_at IS NULL`, issueID).Scan(&currentLogs, &currentStatus, &notifyEmail, &panelNoPp)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, "Issue not found or failed to get details: "+err.Error())
 		return
@@ -4170,15 +4638,18 @@ func (a *App) updateIssueHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	query := `UPDATE issues SET title = $1, description = $2, status = $3, logs = $4, notify_email = $5 WHERE id = $6`
-	res, err := tx.Exec(query, payload.Title, payload.Description, payload.Status, updatedLogs, finalNotifyEmail, issueID)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to update issue: "+err.Error())
+	query := `UPDATE issues SET title = $1, description = $2, status = $3, logs = $4, notify_email = $5
+		WHERE id = $6 AND ($7::bigint IS NULL OR version = $7)
+		RETURNING version`
+	var newVersion int64
+	err = tx.QueryRow(query, payload.Title, payload.Description, payload.Status, updatedLogs, finalNotifyEmail, issueID, expectedVersion).Scan(&newVersion)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		respondVersionMiss(w, a.DB, "issue", issueID)
 		return
 	}
-	count, _ := res.RowsAffected()
-	if count == 0 {
-		respondWithError(w, http.StatusNotFound, "Issue not found")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update issue: "+err.Error())
 		return
 	}
 
@@ -4198,12 +4669,8 @@ func (a *App) updateIssueHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := tx.Commit(); err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Gagal commit transaksi")
-		return
-	}
-
-	go func() {
+	// Notifikasi ditulis ke outbox di transaksi yang sama dengan perubahan isu.
+	err = func(db DBTX) error {
 		if currentStatus != payload.Status {
 
 			allRecipients := strings.Split(finalNotifyEmail, ",")
@@ -4219,27 +4686,26 @@ func (a *App) updateIssueHandler(w http.ResponseWriter, r *http.Request) {
 
 				notifTitle := fmt.Sprintf("Update Isu di Panel %s", panelNoPp)
 				notifBody := fmt.Sprintf("%s mengubah status isu '%s' menjadi %s.", payload.UpdatedBy, payload.Title, payload.Status)
-				a.sendNotificationToUsers(finalRecipients, notifTitle, notifBody)
-
-				subject := fmt.Sprintf("[NO REPLY] TrisutorPRO: Update Status Isu: %s", payload.Title)
-				htmlBody := fmt.Sprintf(
-					`<h3>Status Isu pada Panel %s Telah Diubah</h3>
-					 <p><strong>Judul Isu:</strong> %s</p>
-					 <p><strong>Aksi:</strong> Status isu ini telah diubah menjadi <strong>%s</strong>.</p>
-					 <p><strong>Oleh:</strong> %s</p>
-					 <hr>
-					 <p><i>Email ini dibuat secara otomatis. Periksa aplikasi TrisutorPRO untuk detail lebih lanjut.</i></p>`,
-					panelNoPp, payload.Title, payload.Status, payload.UpdatedBy,
-				)
-				sendNotificationEmail(finalRecipients, subject, htmlBody)
+				return enqueueNotification(db, outboxMessage{
+					Event:    "issue.status_changed",
+					Users:    finalRecipients,
+					Title:    notifTitle,
+					Body:     notifBody,
+					Emails:   finalRecipients,
+					Data:     map[string]string{"panel_no_pp": panelNoPp, "issue_id": strconv.Itoa(issueID), "status": payload.Status},
+					Template: "issue_status_changed",
+					TemplateData: map[string]interface{}{
+						"PanelNoPp": panelNoPp, "Title": payload.Title, "Status": payload.Status, "UpdatedBy": payload.UpdatedBy,
+					},
+				})
 			}
-			return
+			return nil
 		}
 
 		if payload.NotifyEmail != nil {
 			// 1. Ambil data WBS, No Panel, dan Detail Isu untuk konteks email
 			var wbs, noPanel, issueTitle, issueDesc string
-			err := a.DB.QueryRow(`
+			err := db.QueryRow(`
 				SELECT COALESCE(p.no_wbs, 'N/A'), COALESCE(p.no_panel, 'N/A'), i.title, i.description
 				FROM public.issues i
 				JOIN public.chats c ON i.chat_id = c.id
@@ -4248,7 +4714,7 @@ func (a *App) updateIssueHandler(w http.ResponseWriter, r *http.Request) {
 
 			if err != nil {
 				log.Printf("Gagal ambil info panel untuk notifikasi add: %v", err)
-				return
+				return nil
 			}
 
 			// 2. Identifikasi email baru yang ditambahkan
@@ -4268,36 +4734,33 @@ func (a *App) updateIssueHandler(w http.ResponseWriter, r *http.Request) {
 			}
 
 			if len(addedEmails) > 0 {
-				// JUDUL: [NO REPLY] TrisutorPRO: Akses Notifikasi - WBS / No Panel
-				subject := fmt.Sprintf("[NO REPLY] TrisutorPRO: Akses Notifikasi - %s / %s", wbs, noPanel)
-
-				htmlBody := fmt.Sprintf(`
-					<div style="font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif; color: #333; line-height: 1.6; max-width: 600px; border: 1px solid #eee; padding: 20px;">
-						<h2 style="color: #f39c12; border-bottom: 2px solid #f39c12; padding-bottom: 10px;">Undangan Notifikasi</h2>
-						
-						<p>Halo, Anda telah ditambahkan ke dalam daftar notifikasi untuk isu berikut pada panel <strong>%s / %s</strong>.</p>
-						
-						<div style="background: #fff9eb; padding: 15px; border-radius: 5px; margin: 20px 0; border-left: 4px solid #f39c12;">
-							<p style="margin:0; font-size: 12px; color: #666;">Topik Isu:</p>
-							<h3 style="margin: 5px 0; color: #2c3e50;">%s</h3>
-							<p style="margin:0; font-size: 13px; color: #7f8c8d;">%s</p>
-						</div>
-
-						<p>Mulai sekarang, Anda akan menerima email otomatis setiap kali ada komentar atau perubahan status pada isu ini.</p>
-						
-						<p style="font-size: 12px; color: #999; border-top: 1px solid #eee; margin-top: 20px; padding-top: 10px;">
-							Ditambahkan oleh: %s<br>
-							<i>Email ini dikirim secara otomatis oleh sistem TrisutorPRO.</i>
-						</p>
-					</div>`,
-					wbs, noPanel, issueTitle, issueDesc, payload.UpdatedBy)
-
-				sendNotificationEmail(addedEmails, subject, htmlBody)
+				return enqueueNotification(db, outboxMessage{
+					Event:    "issue.notify_added",
+					Title:    fmt.Sprintf("Ditambahkan ke notifikasi isu - %s / %s", wbs, noPanel),
+					Body:     issueTitle,
+					Emails:   addedEmails,
+					Data:     map[string]string{"panel_no_pp": panelNoPp, "issue_id": strconv.Itoa(issueID)},
+					Template: "issue_notify_added",
+					TemplateData: map[string]interface{}{
+						"WBS": wbs, "NoPanel": noPanel, "Title": issueTitle,
+						"Description": issueDesc, "UpdatedBy": payload.UpdatedBy,
+					},
+				})
 			}
 		}
-	}()
+		return nil
+	}(tx)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menyimpan notifikasi: "+err.Error())
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal commit transaksi")
+		return
+	}
 
-	respondWithJSON(w, http.StatusOK, map[string]string{"status": "success"})
+	setETag(w, newVersion)
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"status": "success", "version": newVersion})
 }
 
 func (a *App) deleteIssueHandler(w http.ResponseWriter, r *http.Request) {
@@ -4307,8 +4770,12 @@ func (a *App) deleteIssueHandler(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, "Invalid issue ID")
 		return
 	}
+	expectedVersion, ok := checkIfMatch(w, r, true)
+	if !ok {
+		return
+	}
 
-	res, err := a.DB.Exec("DELETE FROM public.issues WHERE id = $1", id)
+	res, err := a.DB.Exec("UPDATE public.issues SET deleted_at = NOW(), deleted_by = $2 WHERE id = $1 AND deleted_at IS NULL AND ($3::bigint IS NULL OR version = $3)", id, requestIdentity(r).Username, expectedVersion)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -4316,6 +4783,10 @@ func (a *App) deleteIssueHandler(w http.ResponseWriter, r *http.Request) {
 
 	count, _ := res.RowsAffected()
 	if count == 0 {
+		if expectedVersion != nil {
+			respondVersionMiss(w, a.DB, "issue", id)
+			return
+		}
 		respondWithError(w, http.StatusNotFound, "Issue not found")
 		return
 	}
@@ -4417,146 +4888,15 @@ func toColumnName(n int) string {
 	return result
 }
 func initDB(db *sql.DB) {
-	createTablesSQL := `
-	CREATE TABLE IF NOT EXISTS companies ( id TEXT PRIMARY KEY, name TEXT UNIQUE NOT NULL, role TEXT NOT NULL );
-	CREATE TABLE IF NOT EXISTS company_accounts ( username TEXT PRIMARY KEY, password TEXT, company_id TEXT REFERENCES companies(id) ON DELETE CASCADE );
-	CREATE TABLE IF NOT EXISTS panels (
-		no_pp TEXT PRIMARY KEY, 
-		no_panel TEXT, 
-		no_wbs TEXT, 
-		project TEXT, 
-		percent_progress REAL,
-		start_date TIMESTAMPTZ, 
-		target_delivery TIMESTAMPTZ, 
-		status_busbar_pcc TEXT, 
-		status_busbar_mcc TEXT,
-		status_component TEXT, 
-		status_palet TEXT, 
-		status_corepart TEXT, 
-		ao_busbar_pcc TIMESTAMPTZ, 
-		ao_busbar_mcc TIMESTAMPTZ,
-		created_by TEXT, 
-		vendor_id TEXT, 
-		is_closed BOOLEAN DEFAULT false, 
-		closed_date TIMESTAMPTZ
-	);
-	CREATE TABLE IF NOT EXISTS busbars ( id SERIAL PRIMARY KEY, panel_no_pp TEXT NOT NULL REFERENCES panels(no_pp) ON DELETE CASCADE ON UPDATE CASCADE, vendor TEXT NOT NULL, remarks TEXT, UNIQUE(panel_no_pp, vendor) );
-	CREATE TABLE IF NOT EXISTS components ( id SERIAL PRIMARY KEY, panel_no_pp TEXT NOT NULL REFERENCES panels(no_pp) ON DELETE CASCADE ON UPDATE CASCADE, vendor TEXT NOT NULL, UNIQUE(panel_no_pp, vendor) );
-	CREATE TABLE IF NOT EXISTS palet ( id SERIAL PRIMARY KEY, panel_no_pp TEXT NOT NULL REFERENCES panels(no_pp) ON DELETE CASCADE ON UPDATE CASCADE, vendor TEXT NOT NULL, UNIQUE(panel_no_pp, vendor) );
-	CREATE TABLE IF NOT EXISTS corepart ( id SERIAL PRIMARY KEY, panel_no_pp TEXT NOT NULL REFERENCES panels(no_pp) ON DELETE CASCADE ON UPDATE CASCADE, vendor TEXT NOT NULL, UNIQUE(panel_no_pp, vendor) );
-	CREATE TABLE IF NOT EXISTS g3_vendors ( 
-		id SERIAL PRIMARY KEY, 
-		panel_no_pp TEXT NOT NULL REFERENCES panels(no_pp) ON DELETE CASCADE ON UPDATE CASCADE, 
-		vendor TEXT NOT NULL, 
-		UNIQUE(panel_no_pp, vendor) 
-	);
-	`
-	if _, err := db.Exec(createTablesSQL); err != nil {
-		log.Fatalf("Gagal membuat tabel awal: %v", err)
-	}
-
-	createUserDevicesTableSQL := `
-	CREATE TABLE IF NOT EXISTS user_devices (
-		id SERIAL PRIMARY KEY,
-		username TEXT NOT NULL REFERENCES company_accounts(username) ON DELETE CASCADE,
-		fcm_token TEXT NOT NULL,
-		last_login TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
-		UNIQUE(username, fcm_token)
-	);
-	`
-	if _, err := db.Exec(createUserDevicesTableSQL); err != nil {
-		log.Fatalf("Gagal membuat tabel user_devices: %v", err)
-	}
-
-	createAdditionalSRTableSQL := `
-    CREATE TABLE IF NOT EXISTS additional_sr (
-        id SERIAL PRIMARY KEY,
-        panel_no_pp TEXT NOT NULL REFERENCES panels(no_pp) ON DELETE CASCADE ON UPDATE CASCADE,
-        po_number TEXT,
-        item TEXT,
-        quantity INTEGER,
-        status TEXT DEFAULT 'open',
-        remarks TEXT,
-        created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
-    );`
-	if _, err := db.Exec(createAdditionalSRTableSQL); err != nil {
-		log.Fatalf("Gagal membuat tabel additional_sr: %v", err)
-	}
-
-	alterTableAdditionalSRSQL := `
-	DO $$
-	BEGIN
-		IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'additional_sr' AND column_name = 'received_date')
-		   AND NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'additional_sr' AND column_name = 'close_date')
-		THEN
-			ALTER TABLE additional_sr RENAME COLUMN received_date TO close_date;
-			RAISE NOTICE 'Migrasi: additional_sr.received_date -> additional_sr.close_date';
-		END IF;
-
-		IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'additional_sr' AND column_name = 'close_date')
-		THEN
-			ALTER TABLE additional_sr ADD COLUMN close_date TIMESTAMPTZ NULL;
-		END IF;
-
-		IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'additional_sr' AND column_name = 'received_date')
-		THEN
-			ALTER TABLE additional_sr ADD COLUMN received_date TIMESTAMPTZ NULL;
-		END IF;
-	END;
-	$$;
-	`
-	if _, err := db.Exec(alterTableAdditionalSRSQL); err != nil {
-		log.Fatalf("Gagal mengubah tabel additional_sr: %v", err)
-	}
-
-	createTablesSQLChats := `
-	CREATE TABLE IF NOT EXISTS chats (
-		id SERIAL PRIMARY KEY,
-		panel_no_pp VARCHAR(255) UNIQUE NOT NULL REFERENCES panels(no_pp) ON DELETE CASCADE,
-		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-	);`
-	if _, err := db.Exec(createTablesSQLChats); err != nil {
-		log.Fatalf("Gagal membuat tabel chats: %v", err)
-	}
-
-	createTablesSQLIssues := `
-	CREATE TABLE IF NOT EXISTS issues (
-		id SERIAL PRIMARY KEY,
-		chat_id INT NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
-		title VARCHAR(255) NOT NULL,
-		description TEXT,
-		status VARCHAR(50) NOT NULL DEFAULT 'unsolved',
-		logs JSONB,
-		created_by VARCHAR(255),
-		notify_email TEXT, -- TAMBAHKAN KOLOM INI
-		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-	);`
-	if _, err := db.Exec(createTablesSQLIssues); err != nil {
-		log.Fatalf("Gagal membuat tabel issues: %v", err)
-	}
-	alterIssuesTableSQL := `
-	DO $$
-	BEGIN
-		IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'issues' AND column_name = 'notify_email') THEN
-			ALTER TABLE issues ADD COLUMN notify_email TEXT;
-		END IF;
-	END;
-	$$;
-	`
-	if _, err := db.Exec(alterIssuesTableSQL); err != nil {
-		log.Fatalf("Gagal menjalankan migrasi untuk kolom notify_email: %v", err)
-	}
-
-	createIssueTitlesTableSQL := `
-	CREATE TABLE IF NOT EXISTS issue_titles (
-		id SERIAL PRIMARY KEY,
-		title TEXT UNIQUE NOT NULL
-	);`
-	if _, err := db.Exec(createIssueTitlesTableSQL); err != nil {
-		log.Fatalf("Gagal membuat tabel issue_titles: %v", err)
+	if err := migrateUp(db, 0); err != nil {
+		log.Fatalf("Gagal menjalankan migrasi database: %v", err)
 	}
+	seedDefaultData(db)
+}
 
+// seedDefaultData mengisi data awal yang dibutuhkan aplikasi. Aman dipanggil
+// berulang kali karena setiap bagian hanya jalan saat tabelnya masih kosong.
+func seedDefaultData(db *sql.DB) {
 	var count_titles int
 	if err := db.QueryRow("SELECT COUNT(*) FROM public.issue_titles").Scan(&count_titles); err == nil && count_titles == 0 {
 		log.Println("Tabel issue_titles kosong, menambahkan data awal...")
@@ -4566,161 +4906,15 @@ func initDB(db *sql.DB) {
 		}
 	}
 
-	createIssueCommentsTableSQL := `
-	CREATE TABLE IF NOT EXISTS issue_comments (
-		id TEXT PRIMARY KEY,
-		issue_id INT NOT NULL REFERENCES issues(id) ON DELETE CASCADE,
-		sender_id TEXT NOT NULL REFERENCES company_accounts(username) ON DELETE CASCADE,
-		text TEXT,
-		timestamp TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-		reply_to_comment_id TEXT REFERENCES issue_comments(id) ON DELETE SET NULL,
-		reply_to_user_id TEXT REFERENCES company_accounts(username) ON DELETE SET NULL,
-		is_edited BOOLEAN DEFAULT false,
-		image_urls JSONB
-	);
-	`
-	if _, err := db.Exec(createIssueCommentsTableSQL); err != nil {
-		log.Fatalf("Gagal membuat tabel issue_comments: %v", err)
-	}
-
-	if _, err := os.Stat("uploads"); os.IsNotExist(err) {
-		os.Mkdir("uploads", 0755)
-		log.Println("Folder 'uploads' berhasil dibuat.")
-	}
-	updateCommentConstraintSQL := `
-	DO $$
-	DECLARE
-		constraint_name TEXT;
-	BEGIN
-		-- Cari nama constraint foreign key yang ada saat ini
-		SELECT conname INTO constraint_name
-		FROM pg_constraint
-		WHERE conrelid = 'issue_comments'::regclass
-		AND confrelid = 'issue_comments'::regclass
-		AND contype = 'f';
-
-		-- Jika constraint ditemukan, hapus dan buat yang baru dengan ON DELETE CASCADE
-		IF constraint_name IS NOT NULL THEN
-			EXECUTE 'ALTER TABLE issue_comments DROP CONSTRAINT ' || quote_ident(constraint_name);
-			ALTER TABLE issue_comments
-				ADD CONSTRAINT issue_comments_reply_to_comment_id_fkey
-				FOREIGN KEY (reply_to_comment_id)
-				REFERENCES issue_comments(id)
-				ON DELETE CASCADE; -- <--- INI BAGIAN PENTINGNYA
-		END IF;
-	END;
-	$$;
-	`
-	if _, err := db.Exec(updateCommentConstraintSQL); err != nil {
-		log.Fatalf("Gagal menjalankan migrasi constraint untuk issue_comments: %v", err)
-	}
-	alterCommentsTableSQL := `
-	DO $$
-	BEGIN
-		IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'issue_comments' AND column_name = 'is_system_comment') THEN
-			ALTER TABLE issue_comments ADD COLUMN is_system_comment BOOLEAN DEFAULT false;
-		END IF;
-	END;
-	$$;
-	`
-	if _, err := db.Exec(alterCommentsTableSQL); err != nil {
-		log.Fatalf("Gagal menjalankan migrasi untuk kolom is_system_comment: %v", err)
-	}
-
-	createTablesSQLPhotos := `
-	CREATE TABLE IF NOT EXISTS photos (
-		id SERIAL PRIMARY KEY,
-		issue_id INT NOT NULL REFERENCES issues(id) ON DELETE CASCADE,
-		photo_data TEXT NOT NULL
-	);`
-	if _, err := db.Exec(createTablesSQLPhotos); err != nil {
-		log.Fatalf("Gagal membuat tabel photos: %v", err)
-	}
-
-	updateIssuesTrigger := `
-	CREATE OR REPLACE FUNCTION update_updated_at_column()
-	RETURNS TRIGGER AS $$
-	BEGIN
-		NEW.updated_at = NOW();
-		RETURN NEW;
-	END;
-	$$ language 'plpgsql';
-
-	DROP TRIGGER IF EXISTS update_issues_updated_at ON issues;
-	CREATE TRIGGER update_issues_updated_at
-	BEFORE UPDATE ON issues
-	FOR EACH ROW
-	EXECUTE FUNCTION update_updated_at_column();
-	`
-	if _, err := db.Exec(updateIssuesTrigger); err != nil {
-		log.Fatalf("Gagal membuat trigger updated_at di tabel issues: %v", err)
-	}
-
-	alterTableSQL := `
-	DO $$
-	BEGIN
-		IF EXISTS (
-			SELECT 1 FROM pg_constraint
-			WHERE conname = 'panels_no_panel_key' AND conrelid = 'panels'::regclass
-		) THEN
-			ALTER TABLE panels DROP CONSTRAINT panels_no_panel_key;
-		END IF;
-	END;
-	$$;
-	`
-	if _, err := db.Exec(alterTableSQL); err != nil {
-		log.Fatalf("Gagal mengubah constraint tabel panels: %v", err)
-	}
-
-	alterTableAddPanelTypeSQL := `
-	DO $$
-	BEGIN
-		IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'panels' AND column_name = 'panel_type') THEN
-			ALTER TABLE panels ADD COLUMN panel_type TEXT;
-		END IF;
-	END;
-	$$;
-	`
-	if _, err := db.Exec(alterTableAddPanelTypeSQL); err != nil {
-		log.Fatalf("Gagal menjalankan migrasi untuk kolom panel_type: %v", err)
-	}
-
-	alterTableAddPanelRemarksSQL := `
-	DO $$
-	BEGIN
-		IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'panels' AND column_name = 'remarks') THEN
-			ALTER TABLE panels ADD COLUMN remarks TEXT;
-		END IF;
-	END;
-	$$;
-	`
-	if _, err := db.Exec(alterTableAddPanelRemarksSQL); err != nil {
-		log.Fatalf("Gagal menjalankan migrasi untuk kolom panel.remarks: %v", err)
-	}
-
 	var count int
 	if err := db.QueryRow("SELECT COUNT(*) FROM public.companies").Scan(&count); err != nil {
 		log.Fatalf("Gagal cek data dummy: %v", err)
 	}
 	if count == 0 {
 		log.Println("Database kosong, membuat data dummy...")
-		insertDummyData(db)
-	}
-
-	alterTableAddBusbarCloseDatesSQL := `
-	DO $$
-	BEGIN
-		IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'panels' AND column_name = 'close_date_busbar_pcc') THEN
-			ALTER TABLE panels ADD COLUMN close_date_busbar_pcc TIMESTAMPTZ;
-		END IF;
-		IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'panels' AND column_name = 'close_date_busbar_mcc') THEN
-			ALTER TABLE panels ADD COLUMN close_date_busbar_mcc TIMESTAMPTZ;
-		END IF;
-	END;
-	$$;
-	`
-	if _, err := db.Exec(alterTableAddBusbarCloseDatesSQL); err != nil {
-		log.Fatalf("Gagal menjalankan migrasi untuk kolom close_date_busbar: %v", err)
+		if err := insertDummyData(db, ""); err != nil {
+			log.Fatalf("Gagal membuat data dummy: %v", err)
+		}
 	}
 
 	log.Println("Memastikan user sistem untuk Gemini AI ada...")
@@ -4737,168 +4931,61 @@ func initDB(db *sql.DB) {
 		log.Fatalf("Gagal membuat user sistem untuk Gemini AI: %v", err)
 	}
 
-	var count_companies int
-	if err := db.QueryRow("SELECT COUNT(*) FROM public.companies").Scan(&count); err != nil {
-		log.Fatalf("Gagal cek data dummy: %v", err)
-	}
-	if count_companies == 0 {
-		log.Println("Database kosong, membuat data dummy...")
-		insertDummyData(db)
-	}
-
-	alterPanelsForTransferSQL := `
-	DO $$
-	BEGIN
-		IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'panels' AND column_name = 'status_penyelesaian') THEN
-			ALTER TABLE panels ADD COLUMN status_penyelesaian TEXT DEFAULT 'VendorWarehouse';
-		END IF;
-		IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'panels' AND column_name = 'production_slot') THEN
-			ALTER TABLE panels ADD COLUMN production_slot TEXT;
-		END IF;
-	END;
-	$$;
-	`
-	if _, err := db.Exec(alterPanelsForTransferSQL); err != nil {
-		log.Fatalf("Gagal menjalankan migrasi untuk workflow transfer: %v", err)
-	}
-
-	createProductionSlotsTableSQL := `
-	CREATE TABLE IF NOT EXISTS production_slots (
-		position_code TEXT PRIMARY KEY,
-		is_occupied BOOLEAN DEFAULT false NOT NULL
-	);
-	`
-	if _, err := db.Exec(createProductionSlotsTableSQL); err != nil {
-		log.Fatalf("Gagal membuat tabel production_slots: %v", err)
-	}
-
-	addSnapshotColumnSQL := `
-	DO $$
-	BEGIN
-		IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'panels' AND column_name = 'rollback_snapshot') THEN
-			ALTER TABLE panels ADD COLUMN rollback_snapshot JSONB;
-		END IF;
-	END;
-	$$;
-	`
-	if _, err := db.Exec(addSnapshotColumnSQL); err != nil {
-		log.Fatalf("Gagal menjalankan migrasi untuk kolom rollback_snapshot: %v", err)
-	}
-
-	migrateHistoryStackSQL := `
-	DO $$
-	BEGIN
-		-- Hapus kolom lama jika ada
-		IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'panels' AND column_name = 'rollback_snapshot') THEN
-			ALTER TABLE panels DROP COLUMN rollback_snapshot;
-		END IF;
-
-		-- Tambah kolom baru untuk menyimpan array JSON dari histori
-		IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'panels' AND column_name = 'history_stack') THEN
-			ALTER TABLE panels ADD COLUMN history_stack JSONB DEFAULT '[]'::jsonb;
-		END IF;
-	END;
-	$$;
-	`
-	if _, err := db.Exec(migrateHistoryStackSQL); err != nil {
-		log.Fatalf("Gagal menjalankan migrasi untuk kolom history_stack: %v", err)
+	if _, err := seedProductionSlots(db); err != nil {
+		log.Fatalf("%v", err)
 	}
+}
 
+// seedProductionSlots mengisi production_slots (7 baris x 702 kolom) bila
+// tabelnya masih kosong. Mengembalikan jumlah slot yang ditambahkan.
+func seedProductionSlots(db *sql.DB) (int, error) {
 	var slotCount int
-	if err := db.QueryRow("SELECT COUNT(*) FROM production_slots").Scan(&slotCount); err == nil && slotCount == 0 {
-		log.Println("Tabel production_slots kosong, menambahkan data slot awal...")
-		tx, err := db.Begin()
-		if err != nil {
-			log.Fatalf("Gagal memulai transaksi untuk slot: %v", err)
-		}
-		stmt, err := tx.Prepare("INSERT INTO production_slots (position_code) VALUES ($1)")
-		if err != nil {
-			tx.Rollback()
-			log.Fatalf("Gagal prepare statement untuk slot: %v", err)
-		}
-		defer stmt.Close()
-
-		const slotsPerCell = 702
-		for row := 1; row <= 7; row++ {
-
-			for i := 0; i < slotsPerCell; i++ {
+	if err := db.QueryRow("SELECT COUNT(*) FROM production_slots").Scan(&slotCount); err != nil {
+		return 0, fmt.Errorf("Gagal cek tabel production_slots: %w", err)
+	}
+	if slotCount > 0 {
+		return 0, nil
+	}
 
-				colName := toColumnName(i)
+	log.Println("Tabel production_slots kosong, menambahkan data slot awal...")
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("Gagal memulai transaksi untuk slot: %w", err)
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare("INSERT INTO production_slots (position_code) VALUES ($1)")
+	if err != nil {
+		return 0, fmt.Errorf("Gagal prepare statement untuk slot: %w", err)
+	}
+	defer stmt.Close()
 
-				slotCode := fmt.Sprintf("Cell %d-%s", row, colName)
-				if _, err := stmt.Exec(slotCode); err != nil {
-					tx.Rollback()
-					log.Fatalf("Gagal insert slot %s: %v", slotCode, err)
-				}
+	const slotsPerCell = 702
+	inserted := 0
+	for row := 1; row <= 7; row++ {
+		for i := 0; i < slotsPerCell; i++ {
+			slotCode := fmt.Sprintf("Cell %d-%s", row, toColumnName(i))
+			if _, err := stmt.Exec(slotCode); err != nil {
+				return 0, fmt.Errorf("Gagal insert slot %s: %w", slotCode, err)
 			}
+			inserted++
 		}
-
-		tx.Commit()
-		log.Println("Berhasil menambahkan 28 slot produksi dalam format baris.")
 	}
 
-	addForeignKeyConstraintSQL := `
-	DO $$
-	BEGIN
-		IF NOT EXISTS (
-			SELECT 1 FROM pg_constraint
-			WHERE conname = 'fk_panels_production_slot' AND conrelid = 'panels'::regclass
-		) THEN
-			ALTER TABLE panels
-			ADD CONSTRAINT fk_panels_production_slot
-			FOREIGN KEY (production_slot) REFERENCES production_slots(position_code) ON DELETE SET NULL;
-		END IF;
-	END;
-	$$;
-	`
-	if _, err := db.Exec(addForeignKeyConstraintSQL); err != nil {
-		log.Fatalf("Gagal menambahkan foreign key constraint untuk production_slot: %v", err)
-	}
-
-	alterTableAddSupplierSQL := `
-    DO $$
-    BEGIN
-        IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'additional_sr' AND column_name = 'supplier') THEN
-            ALTER TABLE additional_sr ADD COLUMN supplier TEXT;
-        END IF;
-    END;
-    $$;
-    `
-	if _, err := db.Exec(alterTableAddSupplierSQL); err != nil {
-		log.Fatalf("Gagal menjalankan migrasi untuk kolom additional_sr.supplier: %v", err)
-	}
-
-	fixChatsForeignKeySQL := `
-    DO $$
-    BEGIN
-        -- Cek apakah constraint yang lama ada
-        IF EXISTS (
-            SELECT 1 FROM pg_constraint
-            WHERE conname = 'chats_panel_no_pp_fkey' AND conrelid = 'chats'::regclass
-        ) THEN
-            -- Hapus constraint yang lama
-            ALTER TABLE chats DROP CONSTRAINT chats_panel_no_pp_fkey;
-        END IF;
-
-        -- Tambahkan constraint yang baru dengan ON UPDATE CASCADE
-        ALTER TABLE chats
-            ADD CONSTRAINT chats_panel_no_pp_fkey
-            FOREIGN KEY (panel_no_pp) REFERENCES panels(no_pp)
-            ON DELETE CASCADE ON UPDATE CASCADE; -- <-- INI KUNCINYA
-    END
-    $$;
-    `
-	if _, err := db.Exec(fixChatsForeignKeySQL); err != nil {
-		log.Fatalf("Gagal memperbaiki foreign key untuk tabel chats: %v", err)
+	if err := tx.Commit(); err != nil {
+		return 0, err
 	}
-
+	log.Printf("Berhasil menambahkan %d slot produksi dalam format baris.", inserted)
+	return inserted, nil
 }
 
-func insertDummyData(db *sql.DB) {
+// insertDummyData membuat company dan akun contoh. password kosong berarti
+// setiap akun mendapat password acak yang dicetak ke log sekali ini saja.
+func insertDummyData(db *sql.DB, password string) error {
 	tx, err := db.Begin()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	defer tx.Rollback()
 	companies := []Company{
 		{ID: "admin", Name: "Administrator", Role: AppRoleAdmin}, {ID: "viewer", Name: "Viewer", Role: AppRoleViewer},
 		{ID: "warehouse", Name: "Warehouse", Role: AppRoleWarehouse}, {ID: "abacus", Name: "ABACUS", Role: AppRoleK3},
@@ -4907,40 +4994,57 @@ func insertDummyData(db *sql.DB) {
 	}
 	stmt, err := tx.Prepare("INSERT INTO companies (id, name, role) VALUES ($1, $2, $3) ON CONFLICT (id) DO NOTHING")
 	if err != nil {
-		tx.Rollback()
-		log.Fatal(err)
+		return err
 	}
 	defer stmt.Close()
 	for _, c := range companies {
 		if _, err := stmt.Exec(c.ID, c.Name, c.Role); err != nil {
-			tx.Rollback()
-			log.Fatal(err)
+			return err
 		}
 	}
 	accounts := []CompanyAccount{
-		{Username: "admin", Password: "123", CompanyID: "admin"}, {Username: "viewer", Password: "123", CompanyID: "viewer"},
-		{Username: "whs_user1", Password: "123", CompanyID: "warehouse"}, {Username: "whs_user2", Password: "123", CompanyID: "warehouse"},
-		{Username: "abacus_user1", Password: "123", CompanyID: "abacus"}, {Username: "abacus_user2", Password: "123", CompanyID: "abacus"},
-		{Username: "gaa_user1", Password: "123", CompanyID: "gaa"}, {Username: "gaa_user2", Password: "123", CompanyID: "gaa"},
-		{Username: "gpe_user1", Password: "123", CompanyID: "gpe"}, {Username: "gpe_user2", Password: "123", CompanyID: "gpe"},
-		{Username: "dsm_user1", Password: "123", CompanyID: "dsm"}, {Username: "dsm_user2", Password: "123", CompanyID: "dsm"},
+		{Username: "admin", CompanyID: "admin"}, {Username: "viewer", CompanyID: "viewer"},
+		{Username: "whs_user1", CompanyID: "warehouse"}, {Username: "whs_user2", CompanyID: "warehouse"},
+		{Username: "abacus_user1", CompanyID: "abacus"}, {Username: "abacus_user2", CompanyID: "abacus"},
+		{Username: "gaa_user1", CompanyID: "gaa"}, {Username: "gaa_user2", CompanyID: "gaa"},
+		{Username: "gpe_user1", CompanyID: "gpe"}, {Username: "gpe_user2", CompanyID: "gpe"},
+		{Username: "dsm_user1", CompanyID: "dsm"}, {Username: "dsm_user2", CompanyID: "dsm"},
 	}
 	stmt2, err := tx.Prepare("INSERT INTO company_accounts (username, password, company_id) VALUES ($1, $2, $3) ON CONFLICT (username) DO NOTHING")
 	if err != nil {
-		tx.Rollback()
-		log.Fatal(err)
+		return err
 	}
 	defer stmt2.Close()
+	var created []string
 	for _, a := range accounts {
-		if _, err := stmt2.Exec(a.Username, a.Password, a.CompanyID); err != nil {
-			tx.Rollback()
-			log.Fatal(err)
+		a.Password = password
+		if a.Password == "" {
+			if a.Password, err = generatePassword(a.Username); err != nil {
+				return err
+			}
+		} else if err := validatePasswordStrength(a.Username, a.Password); err != nil {
+			return fmt.Errorf("password untuk %s: %w", a.Username, err)
+		}
+		hashed, err := hashPassword(a.Password)
+		if err != nil {
+			return err
+		}
+		res, err := stmt2.Exec(a.Username, hashed, a.CompanyID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 && password == "" {
+			created = append(created, fmt.Sprintf("%s / %s", a.Username, a.Password))
 		}
 	}
 	if err := tx.Commit(); err != nil {
-		log.Fatal(err)
+		return err
 	}
 	log.Println("Data dummy berhasil dibuat.")
+	if len(created) > 0 {
+		log.Printf("Password akun dummy (simpan sekarang, tidak ditampilkan lagi):\n  %s", strings.Join(created, "\n  "))
+	}
+	return nil
 }
 func fetchAllAs(db DBTX, tableName string, factory func() interface{}) (interface{}, error) {
 	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s", tableName))
@@ -4958,7 +5062,9 @@ func fetchAllAs(db DBTX, tableName string, factory func() interface{}) (interfac
 				return nil, err
 			}
 		case *CompanyAccount:
-			if err := rows.Scan(&m.Username, &m.Password, &m.CompanyID); err != nil {
+			// Hash password tidak pernah ikut diekspor.
+			var passwordHash sql.NullString
+			if err := rows.Scan(&m.Username, &passwordHash, &m.CompanyID); err != nil {
 				return nil, err
 			}
 		case *Panel:
@@ -5081,7 +5187,7 @@ func generateJsonTemplate(dataType string) map[string]interface{} {
 	jsonData := make(map[string]interface{})
 	if dataType == "companies_and_accounts" {
 		jsonData["companies"] = []map[string]string{{"id": "vendor_k3_contoh", "name": "Nama Vendor K3 Contoh", "role": "k3"}}
-		jsonData["company_accounts"] = []map[string]string{{"username": "staff_k3_contoh", "password": "123", "company_id": "vendor_k3_contoh"}}
+		jsonData["company_accounts"] = []map[string]string{{"username": "staff_k3_contoh", "password": "password123", "company_id": "vendor_k3_contoh"}}
 	} else {
 		now := time.Now().Format(time.RFC3339)
 		jsonData["panels"] = []map[string]interface{}{{"no_pp": "PP-CONTOH-01", "no_panel": "PANEL-CONTOH-A", "percent_progress": 80.5, "start_date": now}}
@@ -5223,6 +5329,7 @@ func (a *App) createMessageHandler(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, "Invalid payload: "+err.Error())
 		return
 	}
+	payload.SenderUsername = requestIdentity(r).Username
 
 	if (payload.Text == nil || *payload.Text == "") && (payload.ImageData == nil || *payload.ImageData == "") {
 		respondWithError(w, http.StatusBadRequest, "Message cannot be empty (must have text or image)")
@@ -5271,7 +5378,7 @@ func (a *App) getCommentsByIssueHandler(w http.ResponseWriter, r *http.Request)
 		FROM public.issue_comments ic
 		JOIN public.company_accounts sender ON ic.sender_id = sender.username
 		LEFT JOIN public.company_accounts reply_user ON ic.reply_to_user_id = reply_user.username
-		WHERE ic.issue_id = $1
+		WHERE ic.issue_id = $1 AND ic.deleted_at IS NULL
 		ORDER BY ic.timestamp ASC
 	`
 
@@ -5325,6 +5432,7 @@ func (a *App) createCommentHandler(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, "Invalid payload: "+err.Error())
 		return
 	}
+	payload.SenderID = requestIdentity(r).Username
 
 	var imageUrls []string
 	for _, base64Image := range payload.Images {
@@ -5357,52 +5465,54 @@ func (a *App) createCommentHandler(w http.ResponseWriter, r *http.Request) {
 	query := `
 		INSERT INTO issue_comments (id, issue_id, sender_id, text, reply_to_comment_id, reply_to_user_id, image_urls)
 		VALUES ($1, $2, $3, $4, $5, $6, $7)`
-	_, err = a.DB.Exec(query, newCommentID, issueID, payload.SenderID, payload.Text, payload.ReplyToCommentID, payload.ReplyToUserID, imageUrlsJSON)
+	tx, err := a.DB.Begin()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memulai transaksi: "+err.Error())
+		return
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(query, newCommentID, issueID, payload.SenderID, payload.Text, payload.ReplyToCommentID, payload.ReplyToUserID, imageUrlsJSON)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to create comment: "+err.Error())
 		return
 	}
 
-	go func() {
-		var notifyList, issueTitle, issueDesc, wbs, noPanel string
-		err := a.DB.QueryRow(`
+	err = func(db DBTX) error {
+		var notifyList, issueTitle, issueDesc, wbs, noPanel, panelNoPp string
+		err := db.QueryRow(`
             SELECT COALESCE(i.notify_email, ''), i.title, i.description, 
-                   COALESCE(p.no_wbs, 'N/A'), COALESCE(p.no_panel, 'N/A')
+                   COALESCE(p.no_wbs, 'N/A'), COALESCE(p.no_panel, 'N/A'), p.no_pp
             FROM public.issues i 
             JOIN public.chats c ON i.chat_id = c.id
             JOIN public.panels p ON c.panel_no_pp = p.no_pp
-            WHERE i.id = $1`, issueID).Scan(&notifyList, &issueTitle, &issueDesc, &wbs, &noPanel)
+            WHERE i.id = $1`, issueID).Scan(&notifyList, &issueTitle, &issueDesc, &wbs, &noPanel, &panelNoPp)
 
 		if err != nil || notifyList == "" {
-			return
+			return nil
 		}
 
-		rows, err := a.DB.Query(`
+		rows, err := db.Query(`
 			SELECT sender_id, text, timestamp 
 			FROM public.issue_comments 
 			WHERE issue_id = $1 
 			ORDER BY timestamp ASC`, issueID)
 
-		var commentThreadHTML string
+		type threadComment struct {
+			Sender string
+			Time   time.Time
+			Text   string
+			Own    bool
+		}
+		var thread []threadComment
 		if err == nil {
-			defer rows.Close()
 			for rows.Next() {
-				var sID, txt string
-				var ts time.Time
-				if err := rows.Scan(&sID, &txt, &ts); err == nil {
-					bgColor := "#ffffff"
-					if sID == payload.SenderID {
-						bgColor = "#f0f7ff"
-					}
-
-					commentThreadHTML += fmt.Sprintf(`
-						<div style="padding: 10px; border-bottom: 1px solid #eee; background-color: %s;">
-							<strong style="color: #2c3e50; font-size: 13px;">%s</strong> 
-							<span style="font-size: 11px; color: #999;">• %s</span><br>
-							<p style="margin: 5px 0 0 0; font-size: 14px;">%s</p>
-						</div>`, bgColor, sID, ts.Format("02 Jan 15:04"), txt)
+				var c threadComment
+				if err := rows.Scan(&c.Sender, &c.Text, &c.Time); err == nil {
+					c.Own = c.Sender == payload.SenderID
+					thread = append(thread, c)
 				}
 			}
+			rows.Close()
 		}
 
 		allRecipients := strings.Split(notifyList, ",")
@@ -5415,34 +5525,28 @@ func (a *App) createCommentHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if len(finalRecipients) > 0 {
-			subject := fmt.Sprintf("[NO REPLY] TrisutorPRO: Komentar Baru - %s / %s", wbs, noPanel)
-
-			htmlBody := fmt.Sprintf(`
-				<div style="font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif; color: #333; line-height: 1.6; max-width: 600px; border: 1px solid #eee; padding: 20px;">
-					<h2 style="color: #2980b9; border-bottom: 2px solid #2980b9; padding-bottom: 10px;">Update Komentar</h2>
-					
-					<p>Terdapat komentar baru pada panel <strong>%s / %s</strong></p>
-					
-					<div style="background: #f9f9f9; padding: 15px; border-radius: 5px; margin-bottom: 20px; border-left: 4px solid #ccc;">
-						<p style="margin:0; font-size: 12px; color: #666;">Topik Isu:</p>
-						<h3 style="margin: 5px 0; color: #2c3e50;">%s</h3>
-						<p style="margin:0; font-size: 13px; color: #7f8c8d;">%s</p>
-					</div>
-
-					<h4 style="color: #7f8c8d; margin-bottom: 10px; text-transform: uppercase; font-size: 12px;">Percakapan Isu:</h4>
-					<div style="border: 1px solid #eee; border-radius: 8px; overflow: hidden;">
-						%s
-					</div>
-
-					<p style="font-size: 12px; color: #999; margin-top: 20px; border-top: 1px solid #eee; padding-top: 10px;">
-						<i>Email ini dikirim secara otomatis oleh sistem TrisutorPRO. Silakan balas langsung di aplikasi.</i>
-					</p>
-				</div>`,
-				wbs, noPanel, issueTitle, issueDesc, commentThreadHTML)
-
-			sendNotificationEmail(finalRecipients, subject, htmlBody)
-		}
-	}()
+			return enqueueNotification(db, outboxMessage{
+				Event:    "issue.comment",
+				Title:    fmt.Sprintf("Komentar Baru - %s / %s", wbs, noPanel),
+				Body:     fmt.Sprintf("%s: %s", payload.SenderID, payload.Text),
+				Emails:   finalRecipients,
+				Data:     map[string]string{"panel_no_pp": panelNoPp, "issue_id": strconv.Itoa(issueID), "comment_id": newCommentID},
+				Template: "issue_comment",
+				TemplateData: map[string]interface{}{
+					"WBS": wbs, "NoPanel": noPanel, "Title": issueTitle, "Description": issueDesc, "Comments": thread,
+				},
+			})
+		}
+		return nil
+	}(tx)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menyimpan notifikasi: "+err.Error())
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create comment: "+err.Error())
+		return
+	}
 
 	respondWithJSON(w, http.StatusCreated, map[string]string{"id": newCommentID})
 }
@@ -5468,7 +5572,8 @@ func (a *App) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
 
 	var issueID int
 	var isSystemComment sql.NullBool
-	err = tx.QueryRow("SELECT issue_id, is_system_comment FROM public.issue_comments WHERE id = $1", commentID).Scan(&issueID, &isSystemComment)
+	var senderID string
+	err = tx.QueryRow("SELECT issue_id, is_system_comment, sender_id FROM public.issue_comments WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", commentID).Scan(&issueID, &isSystemComment, &senderID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			respondWithError(w, http.StatusNotFound, "Komentar tidak ditemukan")
@@ -5477,6 +5582,10 @@ func (a *App) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	if !canModifyComment(requestIdentity(r), senderID) {
+		respondWithError(w, http.StatusForbidden, "Hanya penulis komentar yang dapat mengubahnya")
+		return
+	}
 
 	var finalImageUrls []string
 	for _, img := range payload.Images {
@@ -5536,13 +5645,40 @@ func (a *App) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
 
 	respondWithJSON(w, http.StatusOK, map[string]string{"status": "success"})
 }
+
+// canModifyComment: selain admin, komentar hanya boleh diubah atau dihapus
+// oleh penulisnya sendiri.
+func canModifyComment(id Identity, senderID string) bool {
+	return id.Role == AppRoleAdmin || senderID == id.Username
+}
+
 func (a *App) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
 	commentID := mux.Vars(r)["id"]
-	_, err := a.DB.Exec("DELETE FROM public.issue_comments WHERE id = $1", commentID)
+	id := requestIdentity(r)
+	var senderID string
+	err := a.DB.QueryRow("SELECT sender_id FROM public.issue_comments WHERE id = $1 AND deleted_at IS NULL", commentID).Scan(&senderID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Comment not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete comment")
+		return
+	}
+	if !canModifyComment(id, senderID) {
+		respondWithError(w, http.StatusForbidden, "Hanya penulis komentar yang dapat menghapusnya")
+		return
+	}
+	res, err := a.DB.Exec("UPDATE public.issue_comments SET deleted_at = NOW(), deleted_by = $2 WHERE id = $1 AND deleted_at IS NULL AND ($3 OR sender_id = $2)",
+		commentID, id.Username, id.Role == AppRoleAdmin)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to delete comment")
 		return
 	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		respondWithError(w, http.StatusNotFound, "Comment not found")
+		return
+	}
 	respondWithJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 func (a *App) getAllIssueTitlesHandler(w http.ResponseWriter, r *http.Request) {
@@ -5699,6 +5835,7 @@ func (a *App) askGeminiHandler(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, "Invalid payload: "+err.Error())
 		return
 	}
+	payload.SenderID = requestIdentity(r).Username
 
 	var issueTitle, issueDesc string
 	err = a.DB.QueryRow("SELECT title, description FROM public.issues WHERE id = $1", issueID).Scan(&issueTitle, &issueDesc)
@@ -5711,7 +5848,7 @@ func (a *App) askGeminiHandler(w http.ResponseWriter, r *http.Request) {
         SELECT ca.username, ic.text 
         FROM public.issue_comments ic
         JOIN public.company_accounts ca ON ic.sender_id = ca.username
-        WHERE ic.issue_id = $1 ORDER BY ic.timestamp ASC
+        WHERE ic.issue_id = $1 AND ic.deleted_at IS NULL ORDER BY ic.timestamp ASC
     `, issueID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil histori komentar")
@@ -5744,7 +5881,7 @@ func (a *App) askGeminiHandler(w http.ResponseWriter, r *http.Request) {
 	defer client.Close()
 
 	model := client.GenerativeModel("gemini-2.5-flash-lite")
-	model.Tools = tools
+	model.Tools = filterToolsForRole(tools, requestIdentity(r).Role)
 	cs := model.StartChat()
 
 	fullPrompt := fmt.Sprintf(
@@ -5783,7 +5920,7 @@ func (a *App) askGeminiHandler(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			functionResult, err := a.executeDatabaseFunction(fc, panelNoPp)
+			functionResult, err := a.executeDatabaseFunction(fc, panelNoPp, requestIdentity(r))
 			if err != nil {
 				functionResult = fmt.Sprintf("Error saat menjalankan fungsi: %v", err)
 			}
@@ -5973,23 +6110,16 @@ func (a *App) askGeminiAboutPanelHandler(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusBadRequest, "Invalid payload")
 		return
 	}
-
-	var senderRole string
-	err := a.DB.QueryRow(`
-		SELECT c.role FROM public.companies c
-		JOIN public.company_accounts ca ON c.id = ca.company_id
-		WHERE ca.username = $1`, payload.SenderID).Scan(&senderRole)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Gagal mendapatkan role user: "+err.Error())
-		return
-	}
+	sender := requestIdentity(r)
+	payload.SenderID = sender.Username
+	senderRole := sender.Role
 
 	var panel pdd
-	err = a.DB.QueryRow(`
+	err := a.DB.QueryRow(`
 		SELECT p.no_pp, p.no_panel, p.project, p.no_wbs, p.percent_progress, p.status_busbar_pcc, p.status_busbar_mcc, p.status_component, p.status_palet, p.status_corepart, pu.name as panel_vendor_name, (SELECT STRING_AGG(c.name, ', ') FROM public.companies c JOIN public.busbars b ON c.id = b.vendor WHERE b.panel_no_pp = p.no_pp) as busbar_vendor_names
 		FROM public.panels p
 		LEFT JOIN public.companies pu ON p.vendor_id = pu.id
-		WHERE p.no_pp = $1`, panelNoPp).Scan(&panel.NoPp, &panel.NoPanel, &panel.Project, &panel.NoWbs, &panel.PercentProgress, &panel.StatusBusbarPcc, &panel.StatusBusbarMcc, &panel.StatusComponent, &panel.StatusPalet, &panel.StatusCorepart, &panel.PanelVendorName, &panel.BusbarVendorNames)
+		WHERE p.no_pp = $1 AND p.deleted_at IS NULL`, panelNoPp).Scan(&panel.NoPp, &panel.NoPanel, &panel.Project, &panel.NoWbs, &panel.PercentProgress, &panel.StatusBusbarPcc, &panel.StatusBusbarMcc, &panel.StatusComponent, &panel.StatusPalet, &panel.StatusCorepart, &panel.PanelVendorName, &panel.BusbarVendorNames)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, "Panel tidak ditemukan: "+err.Error())
 		return
@@ -6001,8 +6131,8 @@ func (a *App) askGeminiAboutPanelHandler(w http.ResponseWriter, r *http.Request)
 		SELECT i.id, i.title, i.description, i.status, ic.sender_id, ic.text
 		FROM public.issues i
 		JOIN public.chats ch ON i.chat_id = ch.id
-		LEFT JOIN public.issue_comments ic ON i.id = ic.issue_id
-		WHERE ch.panel_no_pp = $1
+		LEFT JOIN public.issue_comments ic ON i.id = ic.issue_id AND ic.deleted_at IS NULL
+		WHERE ch.panel_no_pp = $1 AND i.deleted_at IS NULL
 		ORDER BY i.created_at, ic.timestamp`, panelNoPp)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil histori isu")
@@ -6095,7 +6225,7 @@ func (a *App) askGeminiAboutPanelHandler(w http.ResponseWriter, r *http.Request)
 			actionTaken = true
 			log.Printf("Gemini meminta pemanggilan fungsi: %s dengan argumen: %v", fc.Name, fc.Args)
 
-			functionResult, err := a.executeDatabaseFunction(fc, panelNoPp)
+			functionResult, err := a.executeDatabaseFunction(fc, panelNoPp, requestIdentity(r))
 			if err != nil {
 				functionResult = fmt.Sprintf("Error saat menjalankan fungsi: %v", err)
 			}
@@ -6174,92 +6304,92 @@ func getToolsForRole(role string) []*genai.Tool {
 		},
 	})
 
-	if role == AppRoleAdmin {
-		allTools = append(allTools, &genai.FunctionDeclaration{
-			Name:        "update_panel_progress",
-			Description: "ADMIN ONLY: Mengubah persentase progres dari sebuah panel.",
-			Parameters: &genai.Schema{
-				Type:       genai.TypeObject,
-				Properties: map[string]*genai.Schema{"new_progress": {Type: genai.TypeNumber, Description: "Nilai progres baru antara 0-100."}},
-				Required:   []string{"new_progress"},
-			},
-		})
-		allTools = append(allTools, &genai.FunctionDeclaration{
-			Name:        "update_panel_remark",
-			Description: "ADMIN ONLY: Menambah atau mengubah catatan/remark utama pada panel.",
-			Parameters: &genai.Schema{
-				Type:       genai.TypeObject,
-				Properties: map[string]*genai.Schema{"new_remark": {Type: genai.TypeString, Description: "Teks remark yang baru."}},
-				Required:   []string{"new_remark"},
-			},
-		})
-		allTools = append(allTools, &genai.FunctionDeclaration{
-			Name:        "assign_vendor",
-			Description: "ADMIN ONLY: Menugaskan vendor ke sebuah kategori pekerjaan di panel ini.",
-			Parameters: &genai.Schema{
-				Type: genai.TypeObject,
-				Properties: map[string]*genai.Schema{
-					"vendor_name": {Type: genai.TypeString, Description: "Nama vendor yang akan ditugaskan, contoh: 'GPE', 'DSM', 'ABACUS'."},
-					"category":    {Type: genai.TypeString, Description: "Kategori pekerjaan.", Enum: []string{"busbar", "component", "palet", "corepart"}},
-				},
-				Required: []string{"vendor_name", "category"},
+	allTools = append(allTools, &genai.FunctionDeclaration{
+		Name:        "update_panel_progress",
+		Description: "ADMIN ONLY: Mengubah persentase progres dari sebuah panel.",
+		Parameters: &genai.Schema{
+			Type:       genai.TypeObject,
+			Properties: map[string]*genai.Schema{"new_progress": {Type: genai.TypeNumber, Description: "Nilai progres baru antara 0-100."}},
+			Required:   []string{"new_progress"},
+		},
+	})
+	allTools = append(allTools, &genai.FunctionDeclaration{
+		Name:        "update_panel_remark",
+		Description: "ADMIN ONLY: Menambah atau mengubah catatan/remark utama pada panel.",
+		Parameters: &genai.Schema{
+			Type:       genai.TypeObject,
+			Properties: map[string]*genai.Schema{"new_remark": {Type: genai.TypeString, Description: "Teks remark yang baru."}},
+			Required:   []string{"new_remark"},
+		},
+	})
+	allTools = append(allTools, &genai.FunctionDeclaration{
+		Name:        "assign_vendor",
+		Description: "ADMIN ONLY: Menugaskan vendor ke sebuah kategori pekerjaan di panel ini.",
+		Parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"vendor_name": {Type: genai.TypeString, Description: "Nama vendor yang akan ditugaskan, contoh: 'GPE', 'DSM', 'ABACUS'."},
+				"category":    {Type: genai.TypeString, Description: "Kategori pekerjaan.", Enum: []string{"busbar", "component", "palet", "corepart"}},
 			},
-		})
-	}
+			Required: []string{"vendor_name", "category"},
+		},
+	})
 
-	if role == AppRoleAdmin || role == AppRoleK3 {
-		allTools = append(allTools, &genai.FunctionDeclaration{
-			Name:        "update_palet_status",
-			Description: "K3 & ADMIN ONLY: Mengubah status untuk komponen Palet.",
-			Parameters: &genai.Schema{
-				Type:       genai.TypeObject,
-				Properties: map[string]*genai.Schema{"new_status": {Type: genai.TypeString, Enum: []string{"Open", "Close"}}},
-				Required:   []string{"new_status"},
-			},
-		})
-		allTools = append(allTools, &genai.FunctionDeclaration{
-			Name:        "update_corepart_status",
-			Description: "K3 & ADMIN ONLY: Mengubah status untuk komponen Corepart.",
-			Parameters: &genai.Schema{
-				Type:       genai.TypeObject,
-				Properties: map[string]*genai.Schema{"new_status": {Type: genai.TypeString, Enum: []string{"Open", "Close"}}},
-				Required:   []string{"new_status"},
+	allTools = append(allTools, &genai.FunctionDeclaration{
+		Name:        "update_palet_status",
+		Description: "K3 & ADMIN ONLY: Mengubah status untuk komponen Palet.",
+		Parameters: &genai.Schema{
+			Type:       genai.TypeObject,
+			Properties: map[string]*genai.Schema{"new_status": {Type: genai.TypeString, Enum: []string{"Open", "Close"}}},
+			Required:   []string{"new_status"},
+		},
+	})
+	allTools = append(allTools, &genai.FunctionDeclaration{
+		Name:        "update_corepart_status",
+		Description: "K3 & ADMIN ONLY: Mengubah status untuk komponen Corepart.",
+		Parameters: &genai.Schema{
+			Type:       genai.TypeObject,
+			Properties: map[string]*genai.Schema{"new_status": {Type: genai.TypeString, Enum: []string{"Open", "Close"}}},
+			Required:   []string{"new_status"},
+		},
+	})
+	allTools = append(allTools, &genai.FunctionDeclaration{
+		Name:        "update_busbar_status",
+		Description: "K5 & ADMIN ONLY: Mengubah status untuk komponen Busbar.",
+		Parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"busbar_type": {Type: genai.TypeString, Enum: []string{"pcc", "mcc"}},
+				"new_status":  {Type: genai.TypeString, Enum: []string{"Open", "Punching/Bending", "Plating/Epoxy", "100% Siap Kirim", "Close"}},
 			},
-		})
-	}
-	if role == AppRoleAdmin || role == AppRoleK5 {
-		allTools = append(allTools, &genai.FunctionDeclaration{
-			Name:        "update_busbar_status",
-			Description: "K5 & ADMIN ONLY: Mengubah status untuk komponen Busbar.",
-			Parameters: &genai.Schema{
-				Type: genai.TypeObject,
-				Properties: map[string]*genai.Schema{
-					"busbar_type": {Type: genai.TypeString, Enum: []string{"pcc", "mcc"}},
-					"new_status":  {Type: genai.TypeString, Enum: []string{"Open", "Punching/Bending", "Plating/Epoxy", "100% Siap Kirim", "Close"}},
-				},
-				Required: []string{"busbar_type", "new_status"},
-			},
-		})
-	}
-	if role == AppRoleAdmin || role == AppRoleWarehouse {
-		allTools = append(allTools, &genai.FunctionDeclaration{
-			Name:        "update_component_status",
-			Description: "WAREHOUSE & ADMIN ONLY: Mengubah status untuk komponen utama.",
-			Parameters: &genai.Schema{
-				Type:       genai.TypeObject,
-				Properties: map[string]*genai.Schema{"new_status": {Type: genai.TypeString, Enum: []string{"Open", "On Progress", "Done"}}},
-				Required:   []string{"new_status"},
-			},
-		})
-	}
+			Required: []string{"busbar_type", "new_status"},
+		},
+	})
+	allTools = append(allTools, &genai.FunctionDeclaration{
+		Name:        "update_component_status",
+		Description: "WAREHOUSE & ADMIN ONLY: Mengubah status untuk komponen utama.",
+		Parameters: &genai.Schema{
+			Type:       genai.TypeObject,
+			Properties: map[string]*genai.Schema{"new_status": {Type: genai.TypeString, Enum: []string{"Open", "On Progress", "Done"}}},
+			Required:   []string{"new_status"},
+		},
+	})
 
-	return []*genai.Tool{{FunctionDeclarations: allTools}}
+	return filterToolsForRole([]*genai.Tool{{FunctionDeclarations: allTools}}, role)
 }
 
-func (a *App) executeDatabaseFunction(fc genai.FunctionCall, panelNoPp string) (string, error) {
+func (a *App) executeDatabaseFunction(fc genai.FunctionCall, panelNoPp string, caller Identity) (string, error) {
+	if err := a.authorizeGeminiCall(fc, panelNoPp, caller); err != nil {
+		return "", err
+	}
+
 	executeUpdate := func(column string, value interface{}) error {
+		audit := beginAudit(a.DB, "panel", "t.no_pp = $1", panelNoPp)
 		query := fmt.Sprintf("UPDATE panels SET %s = $1 WHERE no_pp = $2", column)
 		_, err := a.DB.Exec(query, value, panelNoPp)
+		if err == nil {
+			audit.record(a.DB, caller.Username, AuditSourceGeminiTool)
+		}
 		return err
 	}
 
@@ -6397,11 +6527,14 @@ func (a *App) executeDatabaseFunction(fc genai.FunctionCall, panelNoPp string) (
 			return "", fmt.Errorf("kategori '%s' tidak valid", category)
 		}
 
+		auditEntity, _ := auditEntityForTable(tableName)
+		audit := beginAudit(a.DB, auditEntity, "t.panel_no_pp = $1 AND t.vendor = $2", panelNoPp, vendorID)
 		query := fmt.Sprintf("INSERT INTO %s (panel_no_pp, vendor) VALUES ($1, $2) ON CONFLICT (panel_no_pp, vendor) DO NOTHING", tableName)
 		_, err = a.DB.Exec(query, panelNoPp, vendorID)
 		if err != nil {
 			return "", fmt.Errorf("gagal menugaskan vendor: %w", err)
 		}
+		audit.record(a.DB, caller.Username, AuditSourceGeminiTool)
 
 		return fmt.Sprintf("Vendor '%s' berhasil ditugaskan untuk pekerjaan %s.", vendorName, category), nil
 
@@ -6429,9 +6562,19 @@ func getSMTPConfig() (string, int, string, string) {
 	return host, port, email, password
 }
 
-func sendNotificationEmail(recipients []string, subject, htmlBody string) {
+// sendNotificationEmail dipanggil oleh dispatcher outbox; handler memakai
+// enqueueNotification.
+type emailAttachment struct {
+	Name string
+	Data []byte
+}
+
+func sendNotificationEmail(recipients []string, subject, htmlBody string, attachments ...emailAttachment) error {
 
 	host, port, senderEmail, authPassword := getSMTPConfig()
+	if senderEmail == "" {
+		return skipNotification("SMTP_EMAIL belum dikonfigurasi")
+	}
 
 	validRecipients := []string{}
 	for _, r := range recipients {
@@ -6441,8 +6584,7 @@ func sendNotificationEmail(recipients []string, subject, htmlBody string) {
 	}
 
 	if len(validRecipients) == 0 {
-		log.Println("Tidak ada penerima email yang valid, notifikasi dilewati.")
-		return
+		return skipNotification("tidak ada penerima email yang valid")
 	}
 
 	mailer := gomail.NewMessage()
@@ -6450,6 +6592,13 @@ func sendNotificationEmail(recipients []string, subject, htmlBody string) {
 	mailer.SetHeader("To", validRecipients...)
 	mailer.SetHeader("Subject", subject)
 	mailer.SetBody("text/html", htmlBody)
+	for _, file := range attachments {
+		data := file.Data
+		mailer.Attach(file.Name, gomail.SetCopyFunc(func(w io.Writer) error {
+			_, err := w.Write(data)
+			return err
+		}))
+	}
 
 	dialer := gomail.NewDialer(
 		host,
@@ -6460,10 +6609,9 @@ func sendNotificationEmail(recipients []string, subject, htmlBody string) {
 
 	log.Printf("Mengirim email notifikasi ke: %v", validRecipients)
 	if err := dialer.DialAndSend(mailer); err != nil {
-		log.Printf("Gagal mengirim email: %v", err)
-	} else {
-		log.Println("Email notifikasi berhasil dikirim.")
+		return fmt.Errorf("gagal mengirim email: %w", err)
 	}
+	return nil
 }
 
 func (a *App) getEmailRecommendationsHandler(w http.ResponseWriter, r *http.Request) {
@@ -6479,7 +6627,7 @@ func (a *App) getEmailRecommendationsHandler(w http.ResponseWriter, r *http.Requ
         SELECT DISTINCT unnest(string_to_array(i.notify_email, ',')) as email
         FROM public.issues i
         JOIN public.chats c ON i.chat_id = c.id
-        WHERE c.panel_no_pp = $1 AND i.notify_email IS NOT NULL AND i.notify_email != ''
+        WHERE c.panel_no_pp = $1 AND i.deleted_at IS NULL AND i.notify_email IS NOT NULL AND i.notify_email != ''
     `
 
 	rows, err := a.DB.Query(query, panelNoPp)
@@ -6522,7 +6670,7 @@ func (a *App) getAdditionalSRsByPanelHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	query := `
-		SELECT id, panel_no_pp, po_number, item, quantity, supplier, status, remarks, created_at, close_date, received_date
+		SELECT id, panel_no_pp, po_number, item, quantity, supplier, status, remarks, created_at, close_date, received_date, version
 		FROM additional_sr
 		WHERE panel_no_pp = $1
 		ORDER BY created_at DESC`
@@ -6537,7 +6685,7 @@ func (a *App) getAdditionalSRsByPanelHandler(w http.ResponseWriter, r *http.Requ
 	for rows.Next() {
 		var sr AdditionalSR
 
-		if err := rows.Scan(&sr.ID, &sr.PanelNoPp, &sr.PoNumber, &sr.Item, &sr.Quantity, &sr.Supplier, &sr.Status, &sr.Remarks, &sr.CreatedAt, &sr.CloseDate, &sr.ReceivedDate); err != nil {
+		if err := rows.Scan(&sr.ID, &sr.PanelNoPp, &sr.PoNumber, &sr.Item, &sr.Quantity, &sr.Supplier, &sr.Status, &sr.Remarks, &sr.CreatedAt, &sr.CloseDate, &sr.ReceivedDate, &sr.Version); err != nil {
 			respondWithError(w, http.StatusInternalServerError, "Failed to scan Additional SR: "+err.Error())
 			return
 		}
@@ -6562,43 +6710,41 @@ func (a *App) createAdditionalSRHandler(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusBadRequest, "Invalid payload: "+err.Error())
 		return
 	}
+	payload.CreatedBy = requestIdentity(r).Username
 	payload.PanelNoPp = panelNoPp
 
 	query := `
 		INSERT INTO additional_sr (panel_no_pp, po_number, item, quantity, supplier, status, remarks, close_date, received_date)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		RETURNING id, created_at`
-	err := a.DB.QueryRow(
+		RETURNING id, created_at, version`
+	tx, err := a.DB.Begin()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memulai transaksi: "+err.Error())
+		return
+	}
+	defer tx.Rollback()
+	err = tx.QueryRow(
 		query,
 		payload.PanelNoPp, payload.PoNumber, payload.Item, payload.Quantity, payload.Supplier, payload.Status, payload.Remarks, payload.CloseDate, payload.ReceivedDate,
-	).Scan(&payload.ID, &payload.CreatedAt)
+	).Scan(&payload.ID, &payload.CreatedAt, &payload.Version)
 
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to create Additional SR: "+err.Error())
 		return
 	}
 
-	go func() {
-		stakeholders, err := a.getPanelStakeholders(panelNoPp)
-		if err != nil {
-			log.Printf("Error getting stakeholders for panel %s: %v", panelNoPp, err)
-			return
-		}
-
-		finalRecipients := []string{}
-		for _, user := range stakeholders {
-			if user != payload.CreatedBy {
-				finalRecipients = append(finalRecipients, user)
-			}
-		}
-
-		if len(finalRecipients) > 0 {
-			title := fmt.Sprintf("SR Baru di Panel %s", panelNoPp)
-			body := fmt.Sprintf("%s menambahkan SR baru: '%s'", payload.CreatedBy, payload.Item)
-			a.sendNotificationToUsers(finalRecipients, title, body)
-		}
-	}()
+	if err := enqueuePanelNotification(tx, "additional_sr.created", panelNoPp, payload.CreatedBy,
+		fmt.Sprintf("SR Baru di Panel %s", panelNoPp),
+		fmt.Sprintf("%s menambahkan SR baru: '%s'", payload.CreatedBy, payload.Item)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menyimpan notifikasi: "+err.Error())
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create Additional SR: "+err.Error())
+		return
+	}
 
+	setETag(w, payload.Version)
 	respondWithJSON(w, http.StatusCreated, payload.AdditionalSR)
 }
 
@@ -6618,6 +6764,11 @@ func (a *App) updateAdditionalSRHandler(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusBadRequest, "Invalid payload: "+err.Error())
 		return
 	}
+	payload.UpdatedBy = requestIdentity(r).Username
+	expectedVersion, ok := checkIfMatch(w, r, true)
+	if !ok {
+		return
+	}
 
 	var panelNoPp string
 	err = a.DB.QueryRow("SELECT panel_no_pp FROM additional_sr WHERE id = $1", id).Scan(&panelNoPp)
@@ -6634,36 +6785,39 @@ func (a *App) updateAdditionalSRHandler(w http.ResponseWriter, r *http.Request)
 			UPDATE additional_sr SET
 				po_number = $1, item = $2, quantity = $3, supplier = $4,
 				status = $5, remarks = $6, close_date = $7, received_date = $8
-			WHERE id = $9`
-	res, err := a.DB.Exec(query, payload.PoNumber, payload.Item, payload.Quantity, payload.Supplier, payload.Status, payload.Remarks, payload.CloseDate, payload.ReceivedDate, id)
-	count, _ := res.RowsAffected()
-	if count == 0 {
-		respondWithError(w, http.StatusNotFound, "Additional SR not found during update")
+			WHERE id = $9 AND ($10::bigint IS NULL OR version = $10)
+			RETURNING version`
+	tx, err := a.DB.Begin()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memulai transaksi: "+err.Error())
+		return
+	}
+	defer tx.Rollback()
+	var version int64
+	err = tx.QueryRow(query, payload.PoNumber, payload.Item, payload.Quantity, payload.Supplier, payload.Status, payload.Remarks, payload.CloseDate, payload.ReceivedDate, id, expectedVersion).Scan(&version)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		respondVersionMiss(w, a.DB, "additional_sr", id)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update Additional SR: "+err.Error())
 		return
 	}
 
-	go func() {
-		stakeholders, err := a.getPanelStakeholders(panelNoPp)
-		if err != nil {
-			log.Printf("Error getting stakeholders for panel %s: %v", panelNoPp, err)
-			return
-		}
-
-		finalRecipients := []string{}
-		for _, user := range stakeholders {
-			if user != payload.UpdatedBy {
-				finalRecipients = append(finalRecipients, user)
-			}
-		}
-
-		if len(finalRecipients) > 0 {
-			title := fmt.Sprintf("SR Diedit di Panel %s", panelNoPp)
-			body := fmt.Sprintf("%s mengubah SR: '%s'", payload.UpdatedBy, payload.Item)
-			a.sendNotificationToUsers(finalRecipients, title, body)
-		}
-	}()
+	if err := enqueuePanelNotification(tx, "additional_sr.updated", panelNoPp, payload.UpdatedBy,
+		fmt.Sprintf("SR Diedit di Panel %s", panelNoPp),
+		fmt.Sprintf("%s mengubah SR: '%s'", payload.UpdatedBy, payload.Item)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menyimpan notifikasi: "+err.Error())
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update Additional SR: "+err.Error())
+		return
+	}
 
-	respondWithJSON(w, http.StatusOK, map[string]string{"status": "success"})
+	setETag(w, version)
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"status": "success", "version": version})
 }
 
 func (a *App) deleteAdditionalSRHandler(w http.ResponseWriter, r *http.Request) {
@@ -6673,8 +6827,12 @@ func (a *App) deleteAdditionalSRHandler(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusBadRequest, "Invalid Additional SR ID")
 		return
 	}
+	expectedVersion, ok := checkIfMatch(w, r, true)
+	if !ok {
+		return
+	}
 
-	res, err := a.DB.Exec("DELETE FROM additional_sr WHERE id = $1", id)
+	res, err := a.DB.Exec("DELETE FROM additional_sr WHERE id = $1 AND ($2::bigint IS NULL OR version = $2)", id, expectedVersion)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -6682,7 +6840,7 @@ func (a *App) deleteAdditionalSRHandler(w http.ResponseWriter, r *http.Request)
 
 	count, _ := res.RowsAffected()
 	if count == 0 {
-		respondWithError(w, http.StatusNotFound, "Additional SR not found")
+		respondVersionMiss(w, a.DB, "additional_sr", id)
 		return
 	}
 
@@ -6721,6 +6879,7 @@ func (a *App) transferPanelHandler(w http.ResponseWriter, r *http.Request) {
 		Actor          string  `json:"actor"`
 		VendorID       *string `json:"vendorId,omitempty"`
 		NewVendorRole  *string `json:"newVendorRole,omitempty"`
+		TargetWiring   *string `json:"target_delivery_wiring,omitempty"`
 		StartDate      *string `json:"start_date,omitempty"`
 		ProductionDate *string `json:"production_date,omitempty"`
 		FatDate        *string `json:"fat_date,omitempty"`
@@ -6731,6 +6890,26 @@ func (a *App) transferPanelHandler(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, "Invalid payload")
 		return
 	}
+	payload.Actor = requestIdentity(r).Username
+
+	req := transferRequest{
+		Action:       payload.Action,
+		Actor:        payload.Actor,
+		Slot:         payload.Slot,
+		TargetWiring: parseTransferDate(payload.TargetWiring),
+		Dates: map[string]*time.Time{
+			"start_date":      parseTransferDate(payload.StartDate),
+			"production_date": parseTransferDate(payload.ProductionDate),
+			"fat_date":        parseTransferDate(payload.FatDate),
+			"all_done_date":   parseTransferDate(payload.AllDoneDate),
+		},
+	}
+	if payload.VendorID != nil {
+		req.Vendor = *payload.VendorID
+	}
+	if payload.NewVendorRole != nil {
+		req.NewVendorRole = *payload.NewVendorRole
+	}
 
 	tx, err := a.DB.Begin()
 	if err != nil {
@@ -6738,357 +6917,20 @@ func (a *App) transferPanelHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer tx.Rollback()
-
-	// MODIFIKASI: Ambil data tambahan (no_wbs, no_panel, panel_type) untuk keperluan wiring
-	var p struct {
-		StatusPenyelesaian *string
-		ProductionSlot     *string
-		HistoryStack       []byte
-		NoWbs              string
-		NoPanel            string
-		PanelType          string
-	}
-	query := `SELECT status_penyelesaian, production_slot, history_stack, no_wbs, no_panel, panel_type 
-              FROM panels WHERE no_pp = $1 FOR UPDATE`
-	err = tx.QueryRow(query, noPp).Scan(&p.StatusPenyelesaian, &p.ProductionSlot, &p.HistoryStack, &p.NoWbs, &p.NoPanel, &p.PanelType)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			respondWithError(w, http.StatusNotFound, "Panel not found")
-		} else {
-			respondWithError(w, http.StatusInternalServerError, "Failed to fetch panel data")
-		}
+	panelAudit := beginAudit(tx, "panel", "t.no_pp = $1", noPp)
+	wiringAudit := beginAudit(tx, "wiring", "t.panel_no_pp = $1", noPp)
+	if err := setWiringActor(tx, payload.Actor, AuditSourceAPI); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	currentStatus := "VendorWarehouse"
-	if p.StatusPenyelesaian != nil {
-		currentStatus = *p.StatusPenyelesaian
-	}
-
-	createSnapshot := func(status string, customTimestamp *time.Time) (map[string]interface{}, error) {
-		var panelState map[string]interface{}
-		var panelData []byte
-		err := tx.QueryRow("SELECT row_to_json(p) FROM panels p WHERE no_pp = $1", noPp).Scan(&panelData)
-		if err != nil {
-			return nil, err
-		}
-		json.Unmarshal(panelData, &panelState)
-		timestampToUse := time.Now()
-		if customTimestamp != nil && !customTimestamp.IsZero() {
-			timestampToUse = *customTimestamp
-		}
-		return map[string]interface{}{
-			"timestamp":       timestampToUse.UTC().Format(time.RFC3339),
-			"snapshot_status": status,
-			"state":           panelState,
-		}, nil
-	}
-
-	var historyStack []map[string]interface{}
-	if p.HistoryStack != nil {
-		json.Unmarshal(p.HistoryStack, &historyStack)
+	if err := runTransition(tx, noPp, req); err != nil {
+		respondWorkflowError(w, err)
+		return
 	}
 
-	switch payload.Action {
-	case "update_dates":
-		var updates []string
-		var args []interface{}
-		argCounter := 1
-		if payload.StartDate != nil {
-			if parsedDate, err := time.Parse(time.RFC3339, *payload.StartDate); err == nil {
-				updates = append(updates, fmt.Sprintf("start_date = $%d", argCounter))
-				args = append(args, parsedDate)
-				argCounter++
-			}
-		}
-		historyChanged := false
-		for i, item := range historyStack {
-			status, _ := item["snapshot_status"].(string)
-			switch status {
-			case "VendorWarehouse", "Warehouse": // <--- Tambahkan "Warehouse"
-				if payload.ProductionDate != nil && *payload.ProductionDate != "" {
-					if newDate, err := time.Parse(time.RFC3339, *payload.ProductionDate); err == nil {
-						historyStack[i]["timestamp"] = newDate.UTC().Format(time.RFC3339)
-						historyChanged = true
-					}
-				}
-			case "Production", "Subcontractor":
-				if payload.FatDate != nil && *payload.FatDate != "" {
-					if newDate, err := time.Parse(time.RFC3339, *payload.FatDate); err == nil {
-						historyStack[i]["timestamp"] = newDate.UTC().Format(time.RFC3339)
-						historyChanged = true
-					}
-				}
-			case "FAT":
-				if payload.AllDoneDate != nil && *payload.AllDoneDate != "" {
-					newDate, err := time.Parse(time.RFC3339, *payload.AllDoneDate)
-
-					if err == nil {
-						historyStack[i]["timestamp"] = newDate.UTC().Format(time.RFC3339)
-						historyChanged = true
-					} else {
-						log.Printf("Error: Gagal update tanggal FAT untuk %s. Format salah: %v", noPp, err)
-					}
-				}
-			}
-		}
-		if historyChanged {
-			historyJson, _ := json.Marshal(historyStack)
-			updates = append(updates, fmt.Sprintf("history_stack = $%d", argCounter))
-			args = append(args, historyJson)
-			argCounter++
-		}
-		if len(updates) > 0 {
-			query := fmt.Sprintf("UPDATE panels SET %s WHERE no_pp = $%d", strings.Join(updates, ", "), argCounter)
-			args = append(args, noPp)
-			if _, err := tx.Exec(query, args...); err != nil {
-				respondWithError(w, http.StatusInternalServerError, "Failed to update dates: "+err.Error())
-				return
-			}
-		}
-
-	case "rollback":
-		if len(historyStack) == 0 {
-			respondWithError(w, http.StatusBadRequest, "No history to rollback to.")
-			return
-		}
-		lastStateWrapper := historyStack[len(historyStack)-1]
-		historyStack = historyStack[:len(historyStack)-1]
-		historyJson, _ := json.Marshal(historyStack)
-		lastState, _ := lastStateWrapper["state"].(map[string]interface{})
-
-		delete(lastState, "history_stack")
-		delete(lastState, "snapshot_status")
-
-		var columns []string
-		var values []interface{}
-		i := 1
-		for col, val := range lastState {
-			columns = append(columns, fmt.Sprintf("%s = $%d", col, i))
-			values = append(values, val)
-			i++
-		}
-		columns = append(columns, fmt.Sprintf("history_stack = $%d", i))
-		values = append(values, historyJson)
-		i++
-		values = append(values, noPp)
-
-		updateQuery := fmt.Sprintf("UPDATE panels SET %s WHERE no_pp = $%d", strings.Join(columns, ", "), i)
-		_, err = tx.Exec(updateQuery, values...)
-		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Failed to restore panel from history")
-			return
-		}
-
-		if p.ProductionSlot != nil && *p.ProductionSlot != "" {
-			_, err = tx.Exec("UPDATE production_slots SET is_occupied = false WHERE position_code = $1", *p.ProductionSlot)
-			if err != nil {
-				respondWithError(w, http.StatusInternalServerError, "Failed to free up slot on rollback")
-				return
-			}
-		}
-
-	default:
-		var snapshotDate *time.Time
-		var nextStatus string
-
-		switch payload.Action {
-		case "to_production":
-			nextStatus = "Production"
-			if payload.ProductionDate != nil && *payload.ProductionDate != "" {
-				if t, err := time.Parse(time.RFC3339, *payload.ProductionDate); err == nil {
-					snapshotDate = &t
-				}
-			}
-		case "to_subcontractor":
-			nextStatus = "Subcontractor"
-			if payload.ProductionDate != nil && *payload.ProductionDate != "" {
-				if t, err := time.Parse(time.RFC3339, *payload.ProductionDate); err == nil {
-					snapshotDate = &t
-				}
-			}
-		case "to_fat":
-			nextStatus = "FAT"
-			if payload.FatDate != nil && *payload.FatDate != "" {
-				if t, err := time.Parse(time.RFC3339, *payload.FatDate); err == nil {
-					snapshotDate = &t
-				} else {
-					now := time.Now().UTC()
-					snapshotDate = &now
-					log.Printf("Warning: Format FatDate salah, menggunakan waktu sekarang untuk %s", noPp)
-				}
-			} else {
-				now := time.Now().UTC()
-				snapshotDate = &now
-			}
-		case "to_done":
-			nextStatus = "Done"
-			if payload.AllDoneDate != nil && *payload.AllDoneDate != "" {
-				if t, err := time.Parse(time.RFC3339, *payload.AllDoneDate); err == nil {
-					snapshotDate = &t
-				}
-			}
-		default:
-			respondWithError(w, http.StatusBadRequest, "Invalid action specified.")
-			return
-		}
-
-		snapshot, err := createSnapshot(currentStatus, snapshotDate)
-		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Failed to create snapshot")
-			return
-		}
-		historyStack = append(historyStack, snapshot)
-		historyJson, _ := json.Marshal(historyStack)
-
-		switch payload.Action {
-
-		case "to_production":
-			dateToUse := time.Now()
-			if snapshotDate != nil {
-				dateToUse = *snapshotDate
-			}
-			_, _ = tx.Exec(`DELETE FROM wirings WHERE panel_no_pp = $1`, noPp)
-			_, err = tx.Exec(`
-				INSERT INTO wirings (no_wbs, panel_no_pp, no_panel, panel_type, status, progress, updated_at, created_at)
-				VALUES ($1, $2, $3, $4, 'Open', 0, NOW(), NOW())
-			`, p.NoWbs, noPp, p.NoPanel, p.PanelType)
-			if err != nil {
-				respondWithError(w, http.StatusInternalServerError, "Failed to create wiring: "+err.Error())
-				return
-			}
-
-			updateQuery := `UPDATE panels SET status_component = 'Done', status_palet = 'Close', status_corepart = 'Close', percent_progress = 100, is_closed = true, closed_date = COALESCE(closed_date, $1), status_penyelesaian = $2, production_slot = $3, history_stack = $4 WHERE no_pp = $5`
-			_, err = tx.Exec(updateQuery, dateToUse, nextStatus, payload.Slot, historyJson, noPp)
-			if err != nil {
-				respondWithError(w, http.StatusInternalServerError, "Failed to transfer to production: "+err.Error())
-				return
-			}
-			_, err = tx.Exec("UPDATE production_slots SET is_occupied = true WHERE position_code = $1", payload.Slot)
-			if err != nil {
-				respondWithError(w, http.StatusInternalServerError, "Failed to occupy slot")
-				return
-			}
-
-		case "to_subcontractor":
-			if payload.VendorID == nil || *payload.VendorID == "" {
-				respondWithError(w, http.StatusBadRequest, "Vendor ID/Name is required")
-				return
-			}
-			var finalVendorId string
-			var roleToUse string
-			vendorInput := *payload.VendorID
-
-			err := tx.QueryRow("SELECT id, role FROM companies WHERE id = $1", vendorInput).Scan(&finalVendorId, &roleToUse)
-			if err != nil {
-				if err == sql.ErrNoRows {
-					errName := tx.QueryRow("SELECT id, role FROM companies WHERE name = $1", vendorInput).Scan(&finalVendorId, &roleToUse)
-					if errName != nil {
-						if errName == sql.ErrNoRows {
-							newId := strings.ToLower(strings.ReplaceAll(vendorInput, " ", "_"))
-							var existingId string
-							errCheck := tx.QueryRow("SELECT id FROM companies WHERE id = $1", newId).Scan(&existingId)
-							if errCheck == sql.ErrNoRows {
-								if payload.NewVendorRole != nil && *payload.NewVendorRole != "" {
-									roleToUse = *payload.NewVendorRole
-								} else {
-									roleToUse = "g3"
-								}
-								_, errInsert := tx.Exec("INSERT INTO companies (id, name, role) VALUES ($1, $2, $3)", newId, vendorInput, roleToUse)
-								if errInsert != nil {
-									respondWithError(w, http.StatusInternalServerError, "Gagal membuat vendor baru: "+errInsert.Error())
-									return
-								}
-							}
-							finalVendorId = newId
-						} else {
-							respondWithError(w, http.StatusInternalServerError, "Gagal memvalidasi vendor by name: "+errName.Error())
-							return
-						}
-					}
-				} else {
-					respondWithError(w, http.StatusInternalServerError, "Gagal memvalidasi vendor by id: "+err.Error())
-					return
-				}
-			}
-
-			// --- MODIFIKASI: CREATE WIRING ROW ---
-			_, _ = tx.Exec(`DELETE FROM wirings WHERE panel_no_pp = $1`, noPp)
-			_, err = tx.Exec(`
-				INSERT INTO wirings (no_wbs, panel_no_pp, no_panel, panel_type, supplier, status, progress, updated_at, created_at)
-				VALUES ($1, $2, $3, $4, $5, 'Open', 0, NOW(), NOW())
-			`, p.NoWbs, noPp, p.NoPanel, p.PanelType, finalVendorId)
-			if err != nil {
-				respondWithError(w, http.StatusInternalServerError, "Failed to create wiring: "+err.Error())
-				return
-			}
-
-			_, _ = tx.Exec(`DELETE FROM g3_vendors WHERE panel_no_pp = $1`, noPp)
-			queryG3 := `INSERT INTO g3_vendors (panel_no_pp, vendor) VALUES ($1, $2) ON CONFLICT DO NOTHING`
-			_, errG3 := tx.Exec(queryG3, noPp, finalVendorId)
-			if errG3 != nil {
-				respondWithError(w, http.StatusInternalServerError, "Gagal assign G3 vendor: "+errG3.Error())
-				return
-			}
-
-			updateQuery := `UPDATE panels SET 
-                              status_penyelesaian = 'Subcontractor', 
-                              status_component = 'Done', 
-                              status_palet = 'Close', 
-                              status_corepart = 'Close', 
-                              percent_progress = 100, 
-                              is_closed = true, 
-                              closed_date = COALESCE(closed_date, NOW()), 
-                              history_stack = $1 
-                            WHERE no_pp = $2`
-			_, err = tx.Exec(updateQuery, historyJson, noPp)
-			if err != nil {
-				respondWithError(w, http.StatusInternalServerError, "Gagal transfer ke subkontraktor: "+err.Error())
-				return
-			}
-
-		case "to_fat":
-			var wProgress int
-			var wStatus string
-			err := tx.QueryRow(`
-				SELECT progress, status FROM wirings WHERE panel_no_pp = $1
-			`, noPp).Scan(&wProgress, &wStatus)
-
-			if err != nil {
-				respondWithError(w, http.StatusBadRequest, "Data wiring tidak ditemukan. Panel harus melalui tahap Wiring dahulu.")
-				return
-			}
-
-			if wProgress < 100 || wStatus != "Closed" {
-				msg := fmt.Sprintf("Gagal Transfer: Wiring baru %d%% (%s). Harus 100%% & Closed!", wProgress, wStatus)
-				respondWithError(w, http.StatusBadRequest, msg)
-				return
-			}
-			occupiedSlot := p.ProductionSlot
-			_, err = tx.Exec("UPDATE panels SET status_penyelesaian = $1, production_slot = NULL, history_stack = $2 WHERE no_pp = $3", nextStatus, historyJson, noPp)
-
-			if err != nil {
-
-				respondWithError(w, http.StatusInternalServerError, "Failed to transfer to FAT")
-
-				return
-
-			}
-
-			if occupiedSlot != nil {
-
-				_, err = tx.Exec("UPDATE production_slots SET is_occupied = false WHERE position_code = $1", *occupiedSlot)
-
-			}
-
-		case "to_done":
-			_, err = tx.Exec("UPDATE panels SET status_penyelesaian = $1, history_stack = $2 WHERE no_pp = $3", nextStatus, historyJson, noPp)
-			if err != nil {
-				respondWithError(w, http.StatusInternalServerError, "Failed to transfer to Done")
-				return
-			}
-		}
-	}
+	panelAudit.record(tx, payload.Actor, AuditSourceAPI)
+	wiringAudit.record(tx, payload.Actor, AuditSourceAPI)
 
 	if err := tx.Commit(); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Transaction commit failed")
@@ -7135,30 +6977,21 @@ func (a *App) getProductionSlotsHandler(w http.ResponseWriter, r *http.Request)
 	respondWithJSON(w, http.StatusOK, slots)
 }
 
-func (a *App) sendNotificationToUsers(usernames []string, title string, body string) {
-	// Guard checks to prevent nil pointer panic
-	if a == nil {
-		log.Println("sendNotificationToUsers: App is nil")
-		return
-	}
-	if a.DB == nil {
-		log.Println("sendNotificationToUsers: DB is nil")
-		return
-	}
+// sendNotificationToUsers dipanggil oleh dispatcher outbox; handler memakai
+// enqueueNotification.
+func (a *App) sendNotificationToUsers(usernames []string, title string, body string) error {
 	if a.FCMClient == nil {
-		log.Println("sendNotificationToUsers: FCMClient is nil")
-		return
+		return skipNotification("FCM belum dikonfigurasi")
 	}
 
 	if len(usernames) == 0 {
-		return
+		return skipNotification("tidak ada penerima")
 	}
 
 	query := "SELECT DISTINCT fcm_token FROM user_devices WHERE username = ANY($1)"
 	rows, err := a.DB.Query(query, pq.Array(usernames))
 	if err != nil {
-		log.Printf("Error querying tokens for users %v: %v", usernames, err)
-		return
+		return fmt.Errorf("gagal mengambil token device: %w", err)
 	}
 	defer rows.Close()
 
@@ -7175,38 +7008,51 @@ func (a *App) sendNotificationToUsers(usernames []string, title string, body str
 	}
 
 	if len(tokens) == 0 {
-		log.Printf("No devices found for users %v, skipping notification.", usernames)
-		return
-	}
-
-	message := &messaging.MulticastMessage{
-		Notification: &messaging.Notification{
-			Title: title,
-			Body:  body,
-		},
-		Tokens: tokens,
-		Android: &messaging.AndroidConfig{
-			Priority: "high",
-			Notification: &messaging.AndroidNotification{
-				ChannelID: "high_importance_channel",
-				Sound:     "default",
+		return skipNotification("user belum mendaftarkan device")
+	}
+
+	// Token yang sudah tidak terdaftar dihapus supaya tidak dicoba lagi;
+	// kegagalan lain baru dianggap error bila tidak ada device yang terkirim.
+	// Multicast dibatasi 500 token per panggilan.
+	sent := 0
+	var lastErr error
+	for start := 0; start < len(tokens); start += 500 {
+		batch := tokens[start:min(start+500, len(tokens))]
+		message := &messaging.MulticastMessage{
+			Notification: &messaging.Notification{
+				Title: title,
+				Body:  body,
 			},
-		},
+			Tokens: batch,
+			Android: &messaging.AndroidConfig{
+				Priority: "high",
+				Notification: &messaging.AndroidNotification{
+					ChannelID: "high_importance_channel",
+					Sound:     "default",
+				},
+			},
+		}
+		br, err := a.FCMClient.SendEachForMulticast(context.Background(), message)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		sent += br.SuccessCount
+		for i, resp := range br.Responses {
+			switch {
+			case resp.Success:
+			case messaging.IsUnregistered(resp.Error):
+				a.DB.Exec("DELETE FROM user_devices WHERE fcm_token = $1", batch[i])
+			default:
+				lastErr = resp.Error
+			}
+		}
 	}
-
-	br, err := a.FCMClient.SendMulticast(context.Background(), message)
-	if err != nil {
-		log.Printf("Error sending FCM message to users %v: %v", usernames, err)
-		return
+	log.Printf("FCM: %d dari %d device terkirim untuk %v", sent, len(tokens), usernames)
+	if sent == 0 && lastErr != nil {
+		return fmt.Errorf("gagal mengirim FCM: %w", lastErr)
 	}
-
-	log.Printf(
-		"Successfully sent %d notifications to %d devices for users %v. Failures: %d",
-		br.SuccessCount,
-		len(tokens),
-		usernames,
-		br.FailureCount,
-	)
+	return nil
 }
 
 func (a *App) getAdminUsernames() ([]string, error) {
@@ -7232,6 +7078,11 @@ func (a *App) getAdminUsernames() ([]string, error) {
 }
 
 func (a *App) getPanelStakeholders(panelNoPp string) ([]string, error) {
+	return panelStakeholders(a.DB, panelNoPp)
+}
+
+// panelStakeholders: semua admin, pembuat panel dan user vendor utama panel.
+func panelStakeholders(db DBTX, panelNoPp string) ([]string, error) {
 	query := `
 		SELECT DISTINCT ca.username
 		FROM company_accounts ca
@@ -7245,7 +7096,7 @@ func (a *App) getPanelStakeholders(panelNoPp string) ([]string, error) {
 		FROM company_accounts ca
 		WHERE ca.company_id = (SELECT vendor_id FROM panels WHERE no_pp = $1)
 	`
-	rows, err := a.DB.Query(query, panelNoPp)
+	rows, err := db.Query(query, panelNoPp)
 	if err != nil {
 		return nil, err
 	}
@@ -7266,74 +7117,72 @@ func (a *App) getPanelStakeholders(panelNoPp string) ([]string, error) {
 	return stakeholders, nil
 }
 
-func (a *App) startNotificationScheduler() {
-	log.Println("⏰ Starting notification scheduler...")
-
-	ticker := time.NewTicker(1 * time.Hour)
-	defer ticker.Stop()
-
-	a.runScheduledChecks()
-
-	for range ticker.C {
-
-		if time.Now().Hour() == 8 {
-			a.runScheduledChecks()
-		}
+// checkPanelsDueToday hanya berjalan di hari kerja. Target yang jatuh di hari
+// libur sejak hari kerja sebelumnya ikut diingatkan hari ini.
+func (a *App) checkPanelsDueToday() error {
+	cal := defaultCalendar()
+	now := cal.Today()
+	if !cal.IsWorkingDay(now) {
+		return nil
 	}
-}
-
-func (a *App) runScheduledChecks() {
-	log.Println("Running scheduled checks for notifications...")
-	a.checkPanelsDueToday()
-	a.checkOverduePanels()
-}
-
-func (a *App) checkPanelsDueToday() {
-	query := `SELECT no_pp FROM panels WHERE target_delivery::date = CURRENT_DATE AND is_closed = false`
-	rows, err := a.DB.Query(query)
+	query := `SELECT no_pp FROM panels
+		WHERE (target_delivery AT TIME ZONE $1)::date > $2::date AND (target_delivery AT TIME ZONE $1)::date <= $3::date
+		AND is_closed = false AND deleted_at IS NULL`
+	rows, err := a.DB.Query(query, cal.TimeZone, cal.PreviousWorkingDay(now).Format("2006-01-02"), now.Format("2006-01-02"))
 	if err != nil {
-		log.Printf("Error checking due panels: %v", err)
-		return
+		return fmt.Errorf("gagal mengambil panel jatuh tempo: %w", err)
 	}
 	defer rows.Close()
 
+	var panels []string
 	for rows.Next() {
 		var noPp string
 		if err := rows.Scan(&noPp); err == nil {
-			go func(panelId string) {
-				stakeholders, _ := a.getPanelStakeholders(panelId)
-				if len(stakeholders) > 0 {
-					title := "🔔 Pengingat Pengiriman"
-					body := fmt.Sprintf("Panel %s dijadwalkan untuk pengiriman hari ini.", panelId)
-					a.sendNotificationToUsers(stakeholders, title, body)
-				}
-			}(noPp)
+			panels = append(panels, noPp)
 		}
 	}
+	rows.Close()
+
+	var errs []error
+	for _, panelId := range panels {
+		body := fmt.Sprintf("Panel %s dijadwalkan untuk pengiriman hari ini.", panelId)
+		if err := enqueuePanelNotification(a.DB, "panel.due_today", panelId, "", "🔔 Pengingat Pengiriman", body); err != nil {
+			errs = append(errs, fmt.Errorf("gagal menjadwalkan notifikasi panel %s: %w", panelId, err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
-func (a *App) checkOverduePanels() {
-	query := `SELECT no_pp FROM panels WHERE target_delivery::date < CURRENT_DATE AND is_closed = false`
-	rows, err := a.DB.Query(query)
+func (a *App) checkOverduePanels() error {
+	cal := defaultCalendar()
+	now := cal.Today()
+	if !cal.IsWorkingDay(now) {
+		return nil
+	}
+	query := `SELECT no_pp FROM panels WHERE (target_delivery AT TIME ZONE $1)::date < $2::date AND is_closed = false AND deleted_at IS NULL`
+	rows, err := a.DB.Query(query, cal.TimeZone, now.Format("2006-01-02"))
 	if err != nil {
-		log.Printf("Error checking overdue panels: %v", err)
-		return
+		return fmt.Errorf("gagal mengambil panel terlambat: %w", err)
 	}
 	defer rows.Close()
 
+	var panels []string
 	for rows.Next() {
 		var noPp string
 		if err := rows.Scan(&noPp); err == nil {
-			go func(panelId string) {
-				stakeholders, _ := a.getPanelStakeholders(panelId)
-				if len(stakeholders) > 0 {
-					title := "⚠️ Peringatan Keterlambatan"
-					body := fmt.Sprintf("Pengiriman untuk panel %s telah melewati jadwal.", panelId)
-					a.sendNotificationToUsers(stakeholders, title, body)
-				}
-			}(noPp)
+			panels = append(panels, noPp)
 		}
 	}
+	rows.Close()
+
+	var errs []error
+	for _, panelId := range panels {
+		body := fmt.Sprintf("Pengiriman untuk panel %s telah melewati jadwal.", panelId)
+		if err := enqueuePanelNotification(a.DB, "panel.overdue", panelId, "", "⚠️ Peringatan Keterlambatan", body); err != nil {
+			errs = append(errs, fmt.Errorf("gagal menjadwalkan notifikasi panel %s: %w", panelId, err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
 func (a *App) registerDeviceHandler(w http.ResponseWriter, r *http.Request) {
@@ -7345,6 +7194,7 @@ func (a *App) registerDeviceHandler(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, "Invalid payload")
 		return
 	}
+	payload.Username = requestIdentity(r).Username
 
 	if payload.Username == "" || payload.Token == "" {
 		respondWithError(w, http.StatusBadRequest, "Username and token are required")
@@ -7380,6 +7230,7 @@ func (a *App) MassTransferPanelHandler(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, "Invalid payload")
 		return
 	}
+	input.Actor = requestIdentity(r).Username
 
 	tx, err := a.DB.Begin()
 	if err != nil {
@@ -7388,6 +7239,17 @@ func (a *App) MassTransferPanelHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
+	var auditNoPps []string
+	for _, item := range input.Data {
+		auditNoPps = append(auditNoPps, item.NoPP)
+	}
+	panelAudit := beginAudit(tx, "panel", "t.no_pp = ANY($1)", pq.Array(auditNoPps))
+	wiringAudit := beginAudit(tx, "wiring", "t.panel_no_pp = ANY($1)", pq.Array(auditNoPps))
+	if err := setWiringActor(tx, input.Actor, AuditSourceMassTransfer); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	type Skipped struct {
 		NoPP   string `json:"no_pp"`
 		Reason string `json:"reason"`
@@ -7403,133 +7265,43 @@ func (a *App) MassTransferPanelHandler(w http.ResponseWriter, r *http.Request) {
 		if item.NoPP == "" {
 			continue
 		}
-		var status, noWbs, noPanel, pType string
-		var progress int
-		var currentSlot *string
-		var currentHistoryJSON []byte
-
-		err := tx.QueryRow(`
-            SELECT status_penyelesaian, percent_progress, production_slot, no_wbs, no_panel, panel_type, history_stack
-            FROM panels WHERE no_pp = $1 FOR UPDATE
-        `, item.NoPP).Scan(&status, &progress, &currentSlot, &noWbs, &noPanel, &pType, &currentHistoryJSON)
-
-		if err != nil {
-			failLog = append(failLog, Skipped{item.NoPP, "Panel tidak ditemukan"})
-			skipped++
-			continue
+		req := transferRequest{
+			Action:       item.Action,
+			Actor:        input.Actor,
+			TargetWiring: parseTransferDate(item.TargetWiring),
 		}
-		if status == "Vendor K3" || status == "Production" {
-			failLog = append(failLog, Skipped{item.NoPP, fmt.Sprintf("Gagal: Panel masih berstatus %s", status)})
-			skipped++
-			continue
+		if item.Slot != nil {
+			req.Slot = *item.Slot
 		}
-		var historyStack []map[string]interface{}
-		if len(currentHistoryJSON) > 0 && string(currentHistoryJSON) != "null" {
-			json.Unmarshal(currentHistoryJSON, &historyStack)
-		}
-		now := time.Now().UTC()
-		snapshot := map[string]interface{}{
-			"snapshot_status": status,
-			"timestamp":       now.Format(time.RFC3339),
-			"state": map[string]interface{}{
-				"actor":  input.Actor,
-				"action": item.Action,
-				"note":   "Executed via Mass Transfer",
-			},
+		if item.Vendor != nil {
+			req.Vendor = *item.Vendor
 		}
-		historyStack = append(historyStack, snapshot)
-		newHistoryJSON, _ := json.Marshal(historyStack)
-		var parsedTargetWiring *time.Time = nil
-
-		if item.TargetWiring != nil && *item.TargetWiring != "" {
-			cleanDate := strings.TrimSpace(*item.TargetWiring)
 
-			//log.Printf("[DEBUG] TargetWiring RAW: '%s'", cleanDate)
-
-			t, errParse := time.Parse("02/01/2006", cleanDate)
-			if errParse != nil {
-				t, errParse = time.Parse("2006-01-02", cleanDate)
-			}
-
-			if errParse == nil {
-				parsedTargetWiring = &t
-				//log.Printf("[DEBUG] Parsed TargetWiring SUCCESS: %v", t)
-			} //else {
-				log.Printf("[WARN] Gagal parse tanggal: %s", cleanDate)
-			//}
+		// Savepoint per item supaya satu panel yang gagal tidak membatalkan yang lain.
+		if _, err := tx.Exec("SAVEPOINT mass_transfer_item"); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "DB Error: "+err.Error())
+			return
 		}
-		switch item.Action {
-
-		case "to_production":
-			var slotVal string
-			if item.Slot != nil {
-				slotVal = *item.Slot
-			}
-			_, _ = tx.Exec(`DELETE FROM wirings WHERE panel_no_pp = $1`, item.NoPP)
-			_, err = tx.Exec(`
-				INSERT INTO wirings (no_wbs, panel_no_pp, no_panel, panel_type, status, progress, target_delivery_wiring, updated_at, created_at)
-				VALUES ($1, $2, $3, $4, 'Open', 0, $5, NOW(), NOW())
-			`, noWbs, item.NoPP, noPanel, pType, parsedTargetWiring)
-
-			_, err = tx.Exec(`
-                UPDATE panels SET
-                    status_palet = 'Closed', status_corepart = 'Closed',
-                    percent_progress = 100, is_closed = true, closed_date = COALESCE(closed_date, NOW()),
-                    status_penyelesaian = 'Production', 
-                    production_slot = $1,
-                    history_stack = $2 
-                WHERE no_pp = $3
-            `, slotVal, newHistoryJSON, item.NoPP)
-
-			if slotVal != "" {
-				_, _ = tx.Exec(`UPDATE production_slots SET is_occupied = true WHERE position_code = $1`, slotVal)
-			}
-
-		case "to_subcontractor":
-			if item.Vendor == nil || *item.Vendor == "" {
-				failLog = append(failLog, Skipped{item.NoPP, "Vendor wajib diisi"})
-				skipped++
-				continue
+		if err := runTransition(tx, item.NoPP, req); err != nil {
+			if _, errRb := tx.Exec("ROLLBACK TO SAVEPOINT mass_transfer_item"); errRb != nil {
+				respondWithError(w, http.StatusInternalServerError, "DB Error: "+errRb.Error())
+				return
 			}
-			vendor := *item.Vendor
-			_, _ = tx.Exec(`DELETE FROM g3_vendors WHERE panel_no_pp = $1`, item.NoPP)
-			_, err = tx.Exec(`INSERT INTO g3_vendors (panel_no_pp, vendor) VALUES ($1, $2)`, item.NoPP, vendor)
-
-			_, _ = tx.Exec(`DELETE FROM wirings WHERE panel_no_pp = $1`, item.NoPP)
-			_, err = tx.Exec(`
-				INSERT INTO wirings (no_wbs, panel_no_pp, no_panel, panel_type, supplier, status, progress, target_delivery_wiring, updated_at, created_at)
-				VALUES ($1, $2, $3, $4, $5, 'Open', 0, $6, NOW(), NOW())
-			`, noWbs, item.NoPP, noPanel, pType, vendor, parsedTargetWiring)
-
-			if currentSlot != nil && *currentSlot != "" {
-				_, _ = tx.Exec(`UPDATE production_slots SET is_occupied = false WHERE position_code = $1`, *currentSlot)
+			reason := err.Error()
+			if _, ok := err.(*workflowError); !ok {
+				reason = "DB Error: " + reason
 			}
-
-			_, err = tx.Exec(`
-                UPDATE panels SET
-                    status_penyelesaian = 'Subcontractor',
-                    status_palet = 'Closed', status_corepart = 'Closed',
-                    percent_progress = 100, is_closed = true,
-                    closed_date = COALESCE(closed_date, NOW()), 
-                    production_slot = NULL,
-                    history_stack = $1
-                WHERE no_pp = $2
-            `, newHistoryJSON, item.NoPP)
-
-		default:
-			failLog = append(failLog, Skipped{item.NoPP, "Action tidak valid"})
-			skipped++
-			continue
-		}
-
-		if err != nil {
-			failLog = append(failLog, Skipped{item.NoPP, "DB Error: " + err.Error()})
+			failLog = append(failLog, Skipped{item.NoPP, reason})
 			skipped++
 			continue
 		}
+		tx.Exec("RELEASE SAVEPOINT mass_transfer_item")
 		success++
 	}
 
+	panelAudit.record(tx, input.Actor, AuditSourceMassTransfer)
+	wiringAudit.record(tx, input.Actor, AuditSourceMassTransfer)
+
 	if err := tx.Commit(); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Commit failed")
 		return
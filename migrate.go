@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Kunci advisory lock untuk migrasi, supaya dua instance yang boot
+// bersamaan tidak menjalankan migrasi yang sama.
+const migrationLockKey = 7204815301
+
+var migrationFileRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+type migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type migrationState struct {
+	migration
+	AppliedAt *time.Time
+}
+
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*migration{}
+	for _, e := range entries {
+		m := migrationFileRe.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		body, err := migrationFiles.ReadFile("migrations/" + e.Name())
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("versi migrasi %d dipakai oleh dua nama: %s dan %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	var migrations []migration
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migrasi %04d_%s tidak punya file .up.sql", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// withMigrationLock menjalankan fn di satu koneksi yang memegang advisory
+// lock. Instance lain akan menunggu sampai lock dilepas.
+func withMigrationLock(db *sql.DB, fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("gagal mengambil advisory lock migrasi: %w", err)
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockKey)
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`)
+	if err != nil {
+		return fmt.Errorf("gagal membuat tabel schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+func appliedMigrations(conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(context.Background(), "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var v int64
+		var at time.Time
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, err
+		}
+		applied[v] = at
+	}
+	return applied, rows.Err()
+}
+
+func runMigrationStep(conn *sql.Conn, m migration, up bool) error {
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	body := m.Up
+	if !up {
+		body = m.Down
+	}
+	if _, err := tx.ExecContext(ctx, body); err != nil {
+		return err
+	}
+	if up {
+		_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", m.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrateUp menjalankan migrasi yang belum diterapkan. steps <= 0 berarti semua.
+func migrateUp(db *sql.DB, steps int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	return withMigrationLock(db, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+		done := 0
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			if steps > 0 && done >= steps {
+				break
+			}
+			log.Printf("Migrasi up: %04d_%s", m.Version, m.Name)
+			if err := runMigrationStep(conn, m, true); err != nil {
+				return fmt.Errorf("migrasi %04d_%s gagal: %w", m.Version, m.Name, err)
+			}
+			done++
+		}
+		if done == 0 {
+			log.Println("Skema database sudah versi terbaru.")
+		}
+		return nil
+	})
+}
+
+// migrateDown membatalkan migrasi terakhir sebanyak steps (minimal 1).
+func migrateDown(db *sql.DB, steps int) error {
+	if steps <= 0 {
+		steps = 1
+	}
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	return withMigrationLock(db, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+		done := 0
+		for i := len(migrations) - 1; i >= 0 && done < steps; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("migrasi %04d_%s tidak punya file .down.sql", m.Version, m.Name)
+			}
+			log.Printf("Migrasi down: %04d_%s", m.Version, m.Name)
+			if err := runMigrationStep(conn, m, false); err != nil {
+				return fmt.Errorf("rollback %04d_%s gagal: %w", m.Version, m.Name, err)
+			}
+			done++
+		}
+		return nil
+	})
+}
+
+func migrationStatus(db *sql.DB) ([]migrationState, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	var states []migrationState
+	err = withMigrationLock(db, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			st := migrationState{migration: m}
+			if at, ok := applied[m.Version]; ok {
+				st.AppliedAt = &at
+			}
+			states = append(states, st)
+		}
+		return nil
+	})
+	return states, err
+}
+
+// runMigrateCommand menangani `secpanel migrate up|down|status [-steps N]`.
+func runMigrateCommand(db *sql.DB, args []string) {
+	if len(args) == 0 {
+		log.Fatal("Pemakaian: secpanel migrate up|down|status [-steps N]")
+	}
+	fset := flag.NewFlagSet("migrate "+args[0], flag.ExitOnError)
+	steps := fset.Int("steps", 0, "jumlah migrasi yang dijalankan (up: 0 = semua, down: default 1)")
+	fset.Parse(args[1:])
+
+	switch args[0] {
+	case "up":
+		if err := migrateUp(db, *steps); err != nil {
+			log.Fatalf("Migrasi up gagal: %v", err)
+		}
+	case "down":
+		if err := migrateDown(db, *steps); err != nil {
+			log.Fatalf("Migrasi down gagal: %v", err)
+		}
+	case "status":
+		states, err := migrationStatus(db)
+		if err != nil {
+			log.Fatalf("Gagal membaca status migrasi: %v", err)
+		}
+		for _, st := range states {
+			applied := "pending"
+			if st.AppliedAt != nil {
+				applied = st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(os.Stdout, "%04d  %-40s %s\n", st.Version, st.Name, applied)
+		}
+	default:
+		log.Fatalf("Perintah migrate tidak dikenal: %s", args[0])
+	}
+}
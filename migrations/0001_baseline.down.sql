@@ -0,0 +1,17 @@
+DROP TABLE IF EXISTS photos;
+DROP TABLE IF EXISTS issue_comments;
+DROP TABLE IF EXISTS issue_titles;
+DROP TABLE IF EXISTS issues;
+DROP TABLE IF EXISTS chats;
+DROP TABLE IF EXISTS additional_sr;
+DROP TABLE IF EXISTS user_devices;
+DROP TABLE IF EXISTS g3_vendors;
+DROP TABLE IF EXISTS corepart;
+DROP TABLE IF EXISTS palet;
+DROP TABLE IF EXISTS components;
+DROP TABLE IF EXISTS busbars;
+DROP TABLE IF EXISTS panels;
+DROP TABLE IF EXISTS production_slots;
+DROP TABLE IF EXISTS company_accounts;
+DROP TABLE IF EXISTS companies;
+DROP FUNCTION IF EXISTS update_updated_at_column();
@@ -0,0 +1,237 @@
+-- Baseline: seluruh langkah initDB lama. Semua statement idempotent supaya
+-- aman dijalankan di database produksi yang sudah dibuat oleh initDB.
+
+CREATE TABLE IF NOT EXISTS companies ( id TEXT PRIMARY KEY, name TEXT UNIQUE NOT NULL, role TEXT NOT NULL );
+CREATE TABLE IF NOT EXISTS company_accounts ( username TEXT PRIMARY KEY, password TEXT, company_id TEXT REFERENCES companies(id) ON DELETE CASCADE );
+CREATE TABLE IF NOT EXISTS panels (
+	no_pp TEXT PRIMARY KEY,
+	no_panel TEXT,
+	no_wbs TEXT,
+	project TEXT,
+	percent_progress REAL,
+	start_date TIMESTAMPTZ,
+	target_delivery TIMESTAMPTZ,
+	status_busbar_pcc TEXT,
+	status_busbar_mcc TEXT,
+	status_component TEXT,
+	status_palet TEXT,
+	status_corepart TEXT,
+	ao_busbar_pcc TIMESTAMPTZ,
+	ao_busbar_mcc TIMESTAMPTZ,
+	created_by TEXT,
+	vendor_id TEXT,
+	is_closed BOOLEAN DEFAULT false,
+	closed_date TIMESTAMPTZ
+);
+CREATE TABLE IF NOT EXISTS busbars ( id SERIAL PRIMARY KEY, panel_no_pp TEXT NOT NULL REFERENCES panels(no_pp) ON DELETE CASCADE ON UPDATE CASCADE, vendor TEXT NOT NULL, remarks TEXT, UNIQUE(panel_no_pp, vendor) );
+CREATE TABLE IF NOT EXISTS components ( id SERIAL PRIMARY KEY, panel_no_pp TEXT NOT NULL REFERENCES panels(no_pp) ON DELETE CASCADE ON UPDATE CASCADE, vendor TEXT NOT NULL, UNIQUE(panel_no_pp, vendor) );
+CREATE TABLE IF NOT EXISTS palet ( id SERIAL PRIMARY KEY, panel_no_pp TEXT NOT NULL REFERENCES panels(no_pp) ON DELETE CASCADE ON UPDATE CASCADE, vendor TEXT NOT NULL, UNIQUE(panel_no_pp, vendor) );
+CREATE TABLE IF NOT EXISTS corepart ( id SERIAL PRIMARY KEY, panel_no_pp TEXT NOT NULL REFERENCES panels(no_pp) ON DELETE CASCADE ON UPDATE CASCADE, vendor TEXT NOT NULL, UNIQUE(panel_no_pp, vendor) );
+CREATE TABLE IF NOT EXISTS g3_vendors (
+	id SERIAL PRIMARY KEY,
+	panel_no_pp TEXT NOT NULL REFERENCES panels(no_pp) ON DELETE CASCADE ON UPDATE CASCADE,
+	vendor TEXT NOT NULL,
+	UNIQUE(panel_no_pp, vendor)
+);
+
+CREATE TABLE IF NOT EXISTS user_devices (
+	id SERIAL PRIMARY KEY,
+	username TEXT NOT NULL REFERENCES company_accounts(username) ON DELETE CASCADE,
+	fcm_token TEXT NOT NULL,
+	last_login TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(username, fcm_token)
+);
+
+CREATE TABLE IF NOT EXISTS additional_sr (
+	id SERIAL PRIMARY KEY,
+	panel_no_pp TEXT NOT NULL REFERENCES panels(no_pp) ON DELETE CASCADE ON UPDATE CASCADE,
+	po_number TEXT,
+	item TEXT,
+	quantity INTEGER,
+	status TEXT DEFAULT 'open',
+	remarks TEXT,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+DO $$
+BEGIN
+	IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'additional_sr' AND column_name = 'received_date')
+	   AND NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'additional_sr' AND column_name = 'close_date')
+	THEN
+		ALTER TABLE additional_sr RENAME COLUMN received_date TO close_date;
+		RAISE NOTICE 'Migrasi: additional_sr.received_date -> additional_sr.close_date';
+	END IF;
+
+	IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'additional_sr' AND column_name = 'close_date')
+	THEN
+		ALTER TABLE additional_sr ADD COLUMN close_date TIMESTAMPTZ NULL;
+	END IF;
+
+	IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'additional_sr' AND column_name = 'received_date')
+	THEN
+		ALTER TABLE additional_sr ADD COLUMN received_date TIMESTAMPTZ NULL;
+	END IF;
+
+	IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'additional_sr' AND column_name = 'supplier') THEN
+		ALTER TABLE additional_sr ADD COLUMN supplier TEXT;
+	END IF;
+END;
+$$;
+
+CREATE TABLE IF NOT EXISTS chats (
+	id SERIAL PRIMARY KEY,
+	panel_no_pp VARCHAR(255) UNIQUE NOT NULL REFERENCES panels(no_pp) ON DELETE CASCADE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS issues (
+	id SERIAL PRIMARY KEY,
+	chat_id INT NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+	title VARCHAR(255) NOT NULL,
+	description TEXT,
+	status VARCHAR(50) NOT NULL DEFAULT 'unsolved',
+	logs JSONB,
+	created_by VARCHAR(255),
+	notify_email TEXT,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'issues' AND column_name = 'notify_email') THEN
+		ALTER TABLE issues ADD COLUMN notify_email TEXT;
+	END IF;
+END;
+$$;
+
+CREATE TABLE IF NOT EXISTS issue_titles (
+	id SERIAL PRIMARY KEY,
+	title TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS issue_comments (
+	id TEXT PRIMARY KEY,
+	issue_id INT NOT NULL REFERENCES issues(id) ON DELETE CASCADE,
+	sender_id TEXT NOT NULL REFERENCES company_accounts(username) ON DELETE CASCADE,
+	text TEXT,
+	timestamp TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	reply_to_comment_id TEXT REFERENCES issue_comments(id) ON DELETE SET NULL,
+	reply_to_user_id TEXT REFERENCES company_accounts(username) ON DELETE SET NULL,
+	is_edited BOOLEAN DEFAULT false,
+	image_urls JSONB
+);
+
+DO $$
+DECLARE
+	constraint_name TEXT;
+BEGIN
+	-- Balasan komentar ikut terhapus saat komentar induknya dihapus
+	SELECT conname INTO constraint_name
+	FROM pg_constraint
+	WHERE conrelid = 'issue_comments'::regclass
+	AND confrelid = 'issue_comments'::regclass
+	AND contype = 'f';
+
+	IF constraint_name IS NOT NULL THEN
+		EXECUTE 'ALTER TABLE issue_comments DROP CONSTRAINT ' || quote_ident(constraint_name);
+		ALTER TABLE issue_comments
+			ADD CONSTRAINT issue_comments_reply_to_comment_id_fkey
+			FOREIGN KEY (reply_to_comment_id)
+			REFERENCES issue_comments(id)
+			ON DELETE CASCADE;
+	END IF;
+
+	IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'issue_comments' AND column_name = 'is_system_comment') THEN
+		ALTER TABLE issue_comments ADD COLUMN is_system_comment BOOLEAN DEFAULT false;
+	END IF;
+END;
+$$;
+
+CREATE TABLE IF NOT EXISTS photos (
+	id SERIAL PRIMARY KEY,
+	issue_id INT NOT NULL REFERENCES issues(id) ON DELETE CASCADE,
+	photo_data TEXT NOT NULL
+);
+
+CREATE OR REPLACE FUNCTION update_updated_at_column()
+RETURNS TRIGGER AS $$
+BEGIN
+	NEW.updated_at = NOW();
+	RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS update_issues_updated_at ON issues;
+CREATE TRIGGER update_issues_updated_at
+BEFORE UPDATE ON issues
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+DO $$
+BEGIN
+	IF EXISTS (
+		SELECT 1 FROM pg_constraint
+		WHERE conname = 'panels_no_panel_key' AND conrelid = 'panels'::regclass
+	) THEN
+		ALTER TABLE panels DROP CONSTRAINT panels_no_panel_key;
+	END IF;
+
+	IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'panels' AND column_name = 'panel_type') THEN
+		ALTER TABLE panels ADD COLUMN panel_type TEXT;
+	END IF;
+	IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'panels' AND column_name = 'remarks') THEN
+		ALTER TABLE panels ADD COLUMN remarks TEXT;
+	END IF;
+	IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'panels' AND column_name = 'close_date_busbar_pcc') THEN
+		ALTER TABLE panels ADD COLUMN close_date_busbar_pcc TIMESTAMPTZ;
+	END IF;
+	IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'panels' AND column_name = 'close_date_busbar_mcc') THEN
+		ALTER TABLE panels ADD COLUMN close_date_busbar_mcc TIMESTAMPTZ;
+	END IF;
+	IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'panels' AND column_name = 'status_penyelesaian') THEN
+		ALTER TABLE panels ADD COLUMN status_penyelesaian TEXT DEFAULT 'VendorWarehouse';
+	END IF;
+	IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'panels' AND column_name = 'production_slot') THEN
+		ALTER TABLE panels ADD COLUMN production_slot TEXT;
+	END IF;
+
+	-- rollback_snapshot lama digantikan oleh history_stack
+	IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'panels' AND column_name = 'rollback_snapshot') THEN
+		ALTER TABLE panels DROP COLUMN rollback_snapshot;
+	END IF;
+	IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'panels' AND column_name = 'history_stack') THEN
+		ALTER TABLE panels ADD COLUMN history_stack JSONB DEFAULT '[]'::jsonb;
+	END IF;
+END;
+$$;
+
+CREATE TABLE IF NOT EXISTS production_slots (
+	position_code TEXT PRIMARY KEY,
+	is_occupied BOOLEAN DEFAULT false NOT NULL
+);
+
+DO $$
+BEGIN
+	IF NOT EXISTS (
+		SELECT 1 FROM pg_constraint
+		WHERE conname = 'fk_panels_production_slot' AND conrelid = 'panels'::regclass
+	) THEN
+		ALTER TABLE panels
+		ADD CONSTRAINT fk_panels_production_slot
+		FOREIGN KEY (production_slot) REFERENCES production_slots(position_code) ON DELETE SET NULL;
+	END IF;
+
+	IF EXISTS (
+		SELECT 1 FROM pg_constraint
+		WHERE conname = 'chats_panel_no_pp_fkey' AND conrelid = 'chats'::regclass
+	) THEN
+		ALTER TABLE chats DROP CONSTRAINT chats_panel_no_pp_fkey;
+	END IF;
+
+	ALTER TABLE chats
+		ADD CONSTRAINT chats_panel_no_pp_fkey
+		FOREIGN KEY (panel_no_pp) REFERENCES panels(no_pp)
+		ON DELETE CASCADE ON UPDATE CASCADE;
+END;
+$$;
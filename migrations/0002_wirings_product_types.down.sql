@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS chat_messages;
+DROP TABLE IF EXISTS product_types;
+DROP TABLE IF EXISTS wirings;
@@ -0,0 +1,38 @@
+-- Tabel yang sudah dipakai kode tapi tidak pernah dibuat oleh initDB.
+
+CREATE TABLE IF NOT EXISTS wirings (
+	id SERIAL PRIMARY KEY,
+	panel_no_pp TEXT NOT NULL REFERENCES panels(no_pp) ON DELETE CASCADE ON UPDATE CASCADE,
+	no_wbs TEXT DEFAULT '',
+	no_panel TEXT DEFAULT '',
+	panel_type TEXT DEFAULT '',
+	supplier TEXT DEFAULT '',
+	progress INTEGER NOT NULL DEFAULT 0,
+	status TEXT DEFAULT 'Open',
+	target_delivery_wiring TIMESTAMPTZ,
+	actual_delivery_wiring TIMESTAMPTZ,
+	closed_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- createWiringHandler memakai ON CONFLICT (panel_no_pp),
+-- massUploadWiringsHandler memakai ON CONFLICT (panel_no_pp, no_wbs).
+CREATE UNIQUE INDEX IF NOT EXISTS wirings_panel_no_pp_key ON wirings(panel_no_pp);
+CREATE UNIQUE INDEX IF NOT EXISTS wirings_panel_no_pp_no_wbs_key ON wirings(panel_no_pp, no_wbs);
+
+CREATE TABLE IF NOT EXISTS product_types (
+	panel_type TEXT PRIMARY KEY,
+	product_type TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS chat_messages (
+	id SERIAL PRIMARY KEY,
+	chat_id INT NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+	sender_username TEXT NOT NULL REFERENCES company_accounts(username) ON DELETE CASCADE ON UPDATE CASCADE,
+	text TEXT,
+	image_data TEXT,
+	replied_issue_id INT REFERENCES issues(id) ON DELETE SET NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_chat_messages_chat_id ON chat_messages(chat_id);
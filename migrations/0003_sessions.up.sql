@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS sessions (
+	id TEXT PRIMARY KEY,
+	username TEXT NOT NULL REFERENCES company_accounts(username) ON DELETE CASCADE ON UPDATE CASCADE,
+	access_token_hash TEXT UNIQUE NOT NULL,
+	refresh_token_hash TEXT UNIQUE NOT NULL,
+	access_expires_at TIMESTAMPTZ NOT NULL,
+	refresh_expires_at TIMESTAMPTZ NOT NULL,
+	user_agent TEXT,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	last_used_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_username ON sessions(username);
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS audit_events (
+	id BIGSERIAL PRIMARY KEY,
+	occurred_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	actor TEXT,
+	source TEXT NOT NULL,
+	entity TEXT NOT NULL,
+	entity_id TEXT NOT NULL,
+	panel_no_pp TEXT,
+	action TEXT NOT NULL,
+	changes JSONB NOT NULL DEFAULT '{}'::jsonb
+);
+
+-- panel_no_pp sengaja tanpa foreign key supaya jejak audit tetap ada
+-- setelah panel dihapus atau No PP-nya diganti.
+CREATE INDEX IF NOT EXISTS idx_audit_events_panel ON audit_events(panel_no_pp, occurred_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_entity ON audit_events(entity, entity_id, occurred_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events(actor, occurred_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_occurred_at ON audit_events(occurred_at DESC);
@@ -0,0 +1,10 @@
+DROP TRIGGER IF EXISTS bump_additional_sr_version ON additional_sr;
+DROP TRIGGER IF EXISTS bump_issues_version ON issues;
+DROP TRIGGER IF EXISTS bump_wirings_version ON wirings;
+DROP TRIGGER IF EXISTS bump_panels_version ON panels;
+DROP FUNCTION IF EXISTS bump_row_version();
+
+ALTER TABLE additional_sr DROP COLUMN IF EXISTS version;
+ALTER TABLE issues DROP COLUMN IF EXISTS version;
+ALTER TABLE wirings DROP COLUMN IF EXISTS version;
+ALTER TABLE panels DROP COLUMN IF EXISTS version;
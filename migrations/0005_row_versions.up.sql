@@ -0,0 +1,38 @@
+-- Nomor versi per baris untuk optimistic concurrency (ETag / If-Match).
+-- Trigger menaikkan versi di setiap UPDATE, termasuk dari import dan mass transfer.
+ALTER TABLE panels ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE wirings ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE issues ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE additional_sr ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE FUNCTION bump_row_version()
+RETURNS TRIGGER AS $$
+BEGIN
+	NEW.version = OLD.version + 1;
+	RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS bump_panels_version ON panels;
+CREATE TRIGGER bump_panels_version
+BEFORE UPDATE ON panels
+FOR EACH ROW
+EXECUTE FUNCTION bump_row_version();
+
+DROP TRIGGER IF EXISTS bump_wirings_version ON wirings;
+CREATE TRIGGER bump_wirings_version
+BEFORE UPDATE ON wirings
+FOR EACH ROW
+EXECUTE FUNCTION bump_row_version();
+
+DROP TRIGGER IF EXISTS bump_issues_version ON issues;
+CREATE TRIGGER bump_issues_version
+BEFORE UPDATE ON issues
+FOR EACH ROW
+EXECUTE FUNCTION bump_row_version();
+
+DROP TRIGGER IF EXISTS bump_additional_sr_version ON additional_sr;
+CREATE TRIGGER bump_additional_sr_version
+BEFORE UPDATE ON additional_sr
+FOR EACH ROW
+EXECUTE FUNCTION bump_row_version();
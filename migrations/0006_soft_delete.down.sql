@@ -0,0 +1,11 @@
+-- Baris yang masih di trash akan muncul kembali sebagai data aktif.
+DROP INDEX IF EXISTS idx_issue_comments_deleted_at;
+DROP INDEX IF EXISTS idx_issues_deleted_at;
+DROP INDEX IF EXISTS idx_panels_deleted_at;
+
+ALTER TABLE issue_comments DROP COLUMN IF EXISTS deleted_by;
+ALTER TABLE issue_comments DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE issues DROP COLUMN IF EXISTS deleted_by;
+ALTER TABLE issues DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE panels DROP COLUMN IF EXISTS deleted_by;
+ALTER TABLE panels DROP COLUMN IF EXISTS deleted_at;
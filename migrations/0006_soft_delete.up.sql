@@ -0,0 +1,14 @@
+-- Soft delete: baris yang dihapus dari aplikasi hanya ditandai dan masuk trash.
+-- Data turunan (chat, issue, busbar, wiring, SR) tetap ada karena baris
+-- induknya tidak benar-benar dihapus, sehingga restore mengembalikan semuanya.
+-- Hapus permanen (ON DELETE CASCADE) baru terjadi saat purge.
+ALTER TABLE panels ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE panels ADD COLUMN IF NOT EXISTS deleted_by TEXT;
+ALTER TABLE issues ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE issues ADD COLUMN IF NOT EXISTS deleted_by TEXT;
+ALTER TABLE issue_comments ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE issue_comments ADD COLUMN IF NOT EXISTS deleted_by TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_panels_deleted_at ON panels(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_issues_deleted_at ON issues(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_issue_comments_deleted_at ON issue_comments(deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,2 @@
+-- Normalisasi data tidak dikembalikan.
+SELECT 1;
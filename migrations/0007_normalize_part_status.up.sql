@@ -0,0 +1,5 @@
+-- Mass transfer dan import dulu menulis 'Closed', sedangkan transfer tunggal
+-- dan form panel memakai 'Close'. Samakan ke 'Close'.
+UPDATE panels SET status_palet = 'Close' WHERE status_palet = 'Closed';
+UPDATE panels SET status_corepart = 'Close' WHERE status_corepart = 'Closed';
+UPDATE panels SET status_component = 'Done' WHERE status_component = 'Closed';
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS slot_reservations (
+	id SERIAL PRIMARY KEY,
+	position_code TEXT NOT NULL REFERENCES production_slots(position_code) ON DELETE CASCADE,
+	panel_no_pp TEXT REFERENCES panels(no_pp) ON DELETE CASCADE ON UPDATE CASCADE,
+	start_date DATE NOT NULL,
+	end_date DATE NOT NULL,
+	-- reserved: rencana, active: panel sedang di slot, released/cancelled: selesai
+	status TEXT NOT NULL DEFAULT 'reserved' CHECK (status IN ('reserved', 'active', 'released', 'cancelled')),
+	note TEXT,
+	created_by TEXT,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	released_at TIMESTAMPTZ,
+	CHECK (end_date >= start_date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_slot_reservations_slot ON slot_reservations (position_code, start_date, end_date)
+	WHERE status IN ('reserved', 'active');
+CREATE INDEX IF NOT EXISTS idx_slot_reservations_panel ON slot_reservations (panel_no_pp);
+
+-- Panel yang sudah menempati slot dijadikan reservasi aktif.
+INSERT INTO slot_reservations (position_code, panel_no_pp, start_date, end_date, status, note, created_by)
+SELECT p.production_slot, p.no_pp, CURRENT_DATE,
+	GREATEST(COALESCE(p.target_delivery::date, CURRENT_DATE), CURRENT_DATE),
+	'active', 'Migrasi dari production_slot', 'system'
+FROM panels p
+WHERE p.production_slot IS NOT NULL AND p.production_slot <> '' AND p.deleted_at IS NULL
+	AND EXISTS (SELECT 1 FROM production_slots ps WHERE ps.position_code = p.production_slot);
@@ -0,0 +1,32 @@
+-- Riwayat panel yang pernah menempati slot produksi. panel_type dan no_panel
+-- disalin supaya riwayat tetap terbaca setelah panel di-purge.
+CREATE TABLE IF NOT EXISTS slot_assignments (
+	id SERIAL PRIMARY KEY,
+	position_code TEXT NOT NULL REFERENCES production_slots(position_code) ON DELETE CASCADE,
+	panel_no_pp TEXT REFERENCES panels(no_pp) ON DELETE SET NULL ON UPDATE CASCADE,
+	no_panel TEXT,
+	panel_type TEXT,
+	assigned_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	assigned_by TEXT,
+	released_at TIMESTAMPTZ,
+	released_by TEXT,
+	release_reason TEXT,
+	CHECK (released_at IS NULL OR released_at >= assigned_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_slot_assignments_slot ON slot_assignments (position_code, assigned_at);
+CREATE INDEX IF NOT EXISTS idx_slot_assignments_panel ON slot_assignments (panel_no_pp);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_slot_assignments_open ON slot_assignments (position_code, panel_no_pp)
+	WHERE released_at IS NULL;
+
+-- Panel yang saat ini menempati slot menjadi assignment terbuka. Waktu
+-- masuknya tidak diketahui, jadi dipakai tanggal mulai reservasi aktif.
+INSERT INTO slot_assignments (position_code, panel_no_pp, no_panel, panel_type, assigned_at, assigned_by)
+SELECT p.production_slot, p.no_pp, p.no_panel, p.panel_type,
+	COALESCE((SELECT MIN(r.start_date)::timestamptz FROM slot_reservations r
+		WHERE r.panel_no_pp = p.no_pp AND r.position_code = p.production_slot AND r.status = 'active'), NOW()),
+	'system'
+FROM panels p
+WHERE p.production_slot IS NOT NULL AND p.production_slot <> '' AND p.deleted_at IS NULL
+	AND EXISTS (SELECT 1 FROM production_slots ps WHERE ps.position_code = p.production_slot)
+ON CONFLICT DO NOTHING;
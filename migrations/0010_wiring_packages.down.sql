@@ -0,0 +1,17 @@
+-- Paket arsip dan paket tambahan dihapus supaya indeks satu-wiring-per-panel
+-- bisa dibuat kembali.
+DROP VIEW IF EXISTS panel_wiring_summary;
+DROP TABLE IF EXISTS wiring_progress_events;
+
+DELETE FROM wirings WHERE archived_at IS NOT NULL;
+DELETE FROM wirings w WHERE EXISTS (
+	SELECT 1 FROM wirings o WHERE o.panel_no_pp = w.panel_no_pp AND o.id < w.id
+);
+
+DROP INDEX IF EXISTS idx_wirings_panel;
+DROP INDEX IF EXISTS wirings_active_package_key;
+CREATE UNIQUE INDEX IF NOT EXISTS wirings_panel_no_pp_key ON wirings(panel_no_pp);
+CREATE UNIQUE INDEX IF NOT EXISTS wirings_panel_no_pp_no_wbs_key ON wirings(panel_no_pp, no_wbs);
+
+ALTER TABLE wirings DROP COLUMN IF EXISTS archived_at;
+ALTER TABLE wirings DROP COLUMN IF EXISTS package_name;
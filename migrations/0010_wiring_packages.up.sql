@@ -0,0 +1,51 @@
+-- Satu panel bisa punya beberapa paket wiring (misalnya internal +
+-- subkontraktor). Paket lama tidak dihapus saat panel ditransfer ulang,
+-- melainkan diarsipkan lewat archived_at.
+ALTER TABLE wirings ADD COLUMN IF NOT EXISTS package_name TEXT NOT NULL DEFAULT 'Utama';
+ALTER TABLE wirings ADD COLUMN IF NOT EXISTS archived_at TIMESTAMPTZ;
+
+DROP INDEX IF EXISTS wirings_panel_no_pp_key;
+DROP INDEX IF EXISTS wirings_panel_no_pp_no_wbs_key;
+CREATE UNIQUE INDEX IF NOT EXISTS wirings_active_package_key ON wirings(panel_no_pp, package_name)
+	WHERE archived_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_wirings_panel ON wirings(panel_no_pp);
+
+-- Riwayat progres wiring, hanya ditambah (tidak pernah di-update/hapus).
+-- Sama seperti audit_events, tanpa foreign key supaya riwayat tetap ada
+-- setelah paket atau panel dihapus.
+CREATE TABLE IF NOT EXISTS wiring_progress_events (
+	id BIGSERIAL PRIMARY KEY,
+	wiring_id INTEGER NOT NULL,
+	panel_no_pp TEXT NOT NULL,
+	package_name TEXT,
+	supplier TEXT,
+	progress_from INTEGER,
+	progress INTEGER NOT NULL,
+	status TEXT,
+	actor TEXT,
+	source TEXT NOT NULL,
+	recorded_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_wiring_progress_events_panel ON wiring_progress_events(panel_no_pp, recorded_at);
+CREATE INDEX IF NOT EXISTS idx_wiring_progress_events_wiring ON wiring_progress_events(wiring_id, recorded_at);
+
+-- Titik awal riwayat: progres terakhir setiap wiring yang sudah ada.
+INSERT INTO wiring_progress_events (wiring_id, panel_no_pp, package_name, supplier, progress, status, source, recorded_at)
+SELECT id, panel_no_pp, package_name, supplier, progress, status, 'migration', COALESCE(updated_at, created_at, NOW())
+FROM wirings;
+
+-- Ringkasan wiring per panel dari paket yang masih aktif.
+CREATE OR REPLACE VIEW panel_wiring_summary AS
+SELECT panel_no_pp,
+	ROUND(AVG(progress))::int AS progress,
+	CASE
+		WHEN bool_and(status = 'Closed') THEN 'Closed'
+		WHEN bool_or(progress > 0) THEN 'In Progress'
+		ELSE 'Open'
+	END AS status,
+	STRING_AGG(DISTINCT NULLIF(supplier, ''), ', ') AS suppliers,
+	MAX(target_delivery_wiring) AS target_delivery_wiring,
+	COUNT(*) AS packages
+FROM wirings
+WHERE archived_at IS NULL
+GROUP BY panel_no_pp;
@@ -0,0 +1,12 @@
+-- Teks project/no_wbs yang sudah dirapikan oleh migrasi naik tidak dikembalikan.
+DROP TRIGGER IF EXISTS sync_panels_project ON panels;
+DROP FUNCTION IF EXISTS sync_panel_project();
+
+ALTER TABLE panels DROP COLUMN IF EXISTS wbs_id;
+ALTER TABLE panels DROP COLUMN IF EXISTS project_id;
+
+DROP TABLE IF EXISTS wbs_elements;
+DROP TABLE IF EXISTS projects;
+
+DROP FUNCTION IF EXISTS ref_name(TEXT);
+DROP FUNCTION IF EXISTS ref_key(TEXT);
@@ -0,0 +1,99 @@
+-- Project dan WBS sebagai entitas. Kolom teks panels.project / panels.no_wbs
+-- tetap ada (dipakai import, export dan client lama) tapi sekarang selalu
+-- diturunkan dari projects / wbs_elements lewat trigger, sehingga penulisan
+-- yang hanya beda huruf besar/spasi tidak lagi membuat project baru.
+
+-- Kunci pembanding: trim, spasi ganda dirapikan, huruf kecil.
+CREATE OR REPLACE FUNCTION ref_key(value TEXT)
+RETURNS TEXT AS $$
+	SELECT LOWER(regexp_replace(BTRIM(value), '\s+', ' ', 'g'));
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION ref_name(value TEXT)
+RETURNS TEXT AS $$
+	SELECT NULLIF(regexp_replace(BTRIM(value), '\s+', ' ', 'g'), '');
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE TABLE IF NOT EXISTS projects (
+	id SERIAL PRIMARY KEY,
+	name TEXT NOT NULL CHECK (ref_name(name) IS NOT NULL),
+	customer TEXT,
+	project_manager TEXT,
+	contract_date DATE,
+	contract_delivery_date DATE,
+	notes TEXT,
+	created_by TEXT,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS projects_name_key ON projects (ref_key(name));
+
+-- WBS tanpa project (panel dengan no_wbs tapi project kosong) memakai project_id NULL.
+CREATE TABLE IF NOT EXISTS wbs_elements (
+	id SERIAL PRIMARY KEY,
+	project_id INT REFERENCES projects(id) ON DELETE CASCADE,
+	code TEXT NOT NULL CHECK (ref_name(code) IS NOT NULL),
+	description TEXT,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS wbs_elements_code_key ON wbs_elements (COALESCE(project_id, 0), ref_key(code));
+
+ALTER TABLE panels ADD COLUMN IF NOT EXISTS project_id INT REFERENCES projects(id) ON DELETE RESTRICT;
+ALTER TABLE panels ADD COLUMN IF NOT EXISTS wbs_id INT REFERENCES wbs_elements(id) ON DELETE RESTRICT;
+CREATE INDEX IF NOT EXISTS idx_panels_project_id ON panels(project_id);
+CREATE INDEX IF NOT EXISTS idx_panels_wbs_id ON panels(wbs_id);
+
+-- Deduplikasi satu kali: ejaan yang paling sering dipakai menjadi nama resmi.
+INSERT INTO projects (name, created_by)
+SELECT DISTINCT ON (ref_key(project)) ref_name(project), 'migration'
+FROM panels
+WHERE ref_name(project) IS NOT NULL
+GROUP BY ref_key(project), ref_name(project)
+ORDER BY ref_key(project), COUNT(*) DESC, ref_name(project)
+ON CONFLICT DO NOTHING;
+
+INSERT INTO wbs_elements (project_id, code)
+SELECT DISTINCT ON (pr.id, ref_key(p.no_wbs)) pr.id, ref_name(p.no_wbs)
+FROM panels p
+LEFT JOIN projects pr ON ref_key(pr.name) = ref_key(p.project)
+WHERE ref_name(p.no_wbs) IS NOT NULL
+GROUP BY pr.id, ref_key(p.no_wbs), ref_name(p.no_wbs)
+ORDER BY pr.id, ref_key(p.no_wbs), COUNT(*) DESC, ref_name(p.no_wbs)
+ON CONFLICT DO NOTHING;
+
+CREATE OR REPLACE FUNCTION sync_panel_project()
+RETURNS TRIGGER AS $$
+BEGIN
+	IF ref_name(NEW.project) IS NULL THEN
+		NEW.project_id := NULL;
+	ELSE
+		INSERT INTO projects (name, created_by) VALUES (ref_name(NEW.project), NEW.created_by)
+		ON CONFLICT ((ref_key(name))) DO UPDATE SET name = projects.name
+		RETURNING id, name INTO NEW.project_id, NEW.project;
+	END IF;
+
+	IF ref_name(NEW.no_wbs) IS NULL THEN
+		NEW.wbs_id := NULL;
+	ELSE
+		INSERT INTO wbs_elements (project_id, code) VALUES (NEW.project_id, ref_name(NEW.no_wbs))
+		ON CONFLICT ((COALESCE(project_id, 0)), (ref_key(code))) DO UPDATE SET code = wbs_elements.code
+		RETURNING id, code INTO NEW.wbs_id, NEW.no_wbs;
+	END IF;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS sync_panels_project ON panels;
+CREATE TRIGGER sync_panels_project
+BEFORE INSERT OR UPDATE OF project, no_wbs ON panels
+FOR EACH ROW
+EXECUTE FUNCTION sync_panel_project();
+
+-- Isi project_id/wbs_id dan rapikan teks panel lama lewat trigger di atas.
+UPDATE panels SET project = project, no_wbs = no_wbs
+WHERE ref_name(project) IS NOT NULL OR ref_name(no_wbs) IS NOT NULL;
+
+UPDATE wirings w SET no_wbs = p.no_wbs
+FROM panels p
+WHERE p.no_pp = w.panel_no_pp AND p.wbs_id IS NOT NULL AND w.no_wbs IS DISTINCT FROM p.no_wbs;
@@ -0,0 +1,10 @@
+DROP FUNCTION IF EXISTS calendar_date(INT, TIMESTAMPTZ);
+DROP FUNCTION IF EXISTS add_working_days(INT, DATE, INT);
+DROP FUNCTION IF EXISTS working_days_between(INT, DATE, DATE);
+DROP FUNCTION IF EXISTS is_working_day(INT, DATE);
+DROP FUNCTION IF EXISTS default_calendar_id();
+
+ALTER TABLE companies DROP COLUMN IF EXISTS calendar_id;
+
+DROP TABLE IF EXISTS calendar_days;
+DROP TABLE IF EXISTS calendars;
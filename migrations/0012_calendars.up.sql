@@ -0,0 +1,106 @@
+-- Kalender hari kerja untuk perhitungan jatuh tempo, lead time dan SLA.
+-- working_days memakai ISO day of week (1 = Senin ... 7 = Minggu).
+CREATE TABLE IF NOT EXISTS calendars (
+	id SERIAL PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE,
+	timezone TEXT NOT NULL DEFAULT 'Asia/Jakarta',
+	working_days INT[] NOT NULL DEFAULT '{1,2,3,4,5}',
+	is_default BOOLEAN NOT NULL DEFAULT false,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS calendars_single_default ON calendars (is_default) WHERE is_default;
+
+-- Pengecualian per tanggal: holiday (libur nasional), shutdown (libur pabrik)
+-- atau working (hari kerja pengganti di akhir pekan).
+CREATE TABLE IF NOT EXISTS calendar_days (
+	calendar_id INT NOT NULL REFERENCES calendars(id) ON DELETE CASCADE,
+	day DATE NOT NULL,
+	kind TEXT NOT NULL CHECK (kind IN ('holiday', 'shutdown', 'working')),
+	name TEXT,
+	PRIMARY KEY (calendar_id, day)
+);
+
+-- Company tanpa calendar_id memakai kalender default.
+ALTER TABLE companies ADD COLUMN IF NOT EXISTS calendar_id INT REFERENCES calendars(id) ON DELETE SET NULL;
+
+INSERT INTO calendars (name, timezone, working_days, is_default)
+SELECT 'Indonesia', 'Asia/Jakarta', '{1,2,3,4,5}', true
+WHERE NOT EXISTS (SELECT 1 FROM calendars);
+
+-- Hanya libur nasional bertanggal tetap untuk tahun 2024-2030, ditulis
+-- eksplisit supaya hasil migrasi tidak bergantung pada tanggal dijalankan.
+-- Libur keagamaan yang berpindah setiap tahun (Idul Fitri, Nyepi, Waisak,
+-- dst.) dan tahun setelah 2030 diisi admin lewat POST /calendars/{id}/days.
+INSERT INTO calendar_days (calendar_id, day, kind, name)
+SELECT c.id, make_date(y, m, d), 'holiday', n
+FROM calendars c
+CROSS JOIN generate_series(2024, 2030) y
+CROSS JOIN (VALUES
+	(1, 1, 'Tahun Baru Masehi'),
+	(5, 1, 'Hari Buruh Internasional'),
+	(6, 1, 'Hari Lahir Pancasila'),
+	(8, 17, 'Hari Kemerdekaan RI'),
+	(12, 25, 'Hari Raya Natal')
+) AS h(m, d, n)
+WHERE c.is_default
+ON CONFLICT DO NOTHING;
+
+CREATE OR REPLACE FUNCTION default_calendar_id()
+RETURNS INT AS $$
+	SELECT id FROM calendars WHERE is_default LIMIT 1;
+$$ LANGUAGE sql STABLE;
+
+CREATE OR REPLACE FUNCTION is_working_day(cal INT, d DATE)
+RETURNS BOOLEAN AS $$
+	SELECT COALESCE(
+		(SELECT cd.kind = 'working' FROM calendar_days cd WHERE cd.calendar_id = c.id AND cd.day = d),
+		EXTRACT(ISODOW FROM d)::int = ANY(c.working_days))
+	FROM calendars c
+	WHERE c.id = COALESCE(cal, default_calendar_id());
+$$ LANGUAGE sql STABLE;
+
+-- Jumlah hari kerja di rentang (from_date, to_date]; negatif bila to_date
+-- sebelum from_date.
+CREATE OR REPLACE FUNCTION working_days_between(cal INT, from_date DATE, to_date DATE)
+RETURNS INT AS $$
+	SELECT CASE
+		WHEN from_date IS NULL OR to_date IS NULL THEN NULL
+		ELSE SIGN(to_date - from_date)::int * (
+			SELECT COUNT(*)::int
+			FROM generate_series(LEAST(from_date, to_date) + 1, GREATEST(from_date, to_date), INTERVAL '1 day') g(d)
+			WHERE is_working_day(cal, g.d::date))
+	END;
+$$ LANGUAGE sql STABLE;
+
+-- Tanggal setelah maju (atau mundur bila n negatif) n hari kerja dari d.
+CREATE OR REPLACE FUNCTION add_working_days(cal INT, d DATE, n INT)
+RETURNS DATE AS $$
+DECLARE
+	step INT := CASE WHEN n < 0 THEN -1 ELSE 1 END;
+	remaining INT := ABS(n);
+	result DATE := d;
+	guard INT := 0;
+BEGIN
+	IF d IS NULL OR n IS NULL THEN
+		RETURN NULL;
+	END IF;
+	-- guard mencegah loop tanpa akhir bila kalender tidak punya hari kerja.
+	WHILE remaining > 0 AND guard < 3660 LOOP
+		result := result + step;
+		guard := guard + 1;
+		IF COALESCE(is_working_day(cal, result), false) THEN
+			remaining := remaining - 1;
+		END IF;
+	END LOOP;
+	RETURN result;
+END;
+$$ LANGUAGE plpgsql STABLE;
+
+-- Tanggal lokal sebuah timestamp menurut zona waktu kalender.
+CREATE OR REPLACE FUNCTION calendar_date(cal INT, ts TIMESTAMPTZ)
+RETURNS DATE AS $$
+	SELECT (ts AT TIME ZONE c.timezone)::date
+	FROM calendars c
+	WHERE c.id = COALESCE(cal, default_calendar_id());
+$$ LANGUAGE sql STABLE;
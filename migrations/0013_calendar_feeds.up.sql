@@ -0,0 +1,19 @@
+-- Feed iCalendar (ICS) untuk jadwal panel. Token disimpan sebagai hash
+-- sha256 seperti session; token asli hanya ditampilkan sekali saat dibuat.
+-- Feed dimiliki user (username) atau company (company_id), tidak keduanya.
+CREATE TABLE IF NOT EXISTS calendar_feeds (
+	id SERIAL PRIMARY KEY,
+	token_hash TEXT NOT NULL UNIQUE,
+	username TEXT REFERENCES company_accounts(username) ON DELETE CASCADE ON UPDATE CASCADE,
+	company_id TEXT REFERENCES companies(id) ON DELETE CASCADE ON UPDATE CASCADE,
+	name TEXT NOT NULL DEFAULT '',
+	events TEXT[] NOT NULL DEFAULT '{}',
+	project_id INT REFERENCES projects(id) ON DELETE CASCADE,
+	created_by TEXT,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	last_accessed_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ,
+	CHECK ((username IS NULL) <> (company_id IS NULL))
+);
+CREATE INDEX IF NOT EXISTS idx_calendar_feeds_username ON calendar_feeds(username);
+CREATE INDEX IF NOT EXISTS idx_calendar_feeds_company ON calendar_feeds(company_id);
@@ -0,0 +1,25 @@
+-- Outbox notifikasi: baris ditulis di transaksi yang sama dengan perubahan
+-- datanya, lalu dikirim oleh dispatcher di background. Satu baris per
+-- channel (fcm, smtp, webhook) sehingga status pengiriman tercatat per
+-- channel.
+CREATE TABLE IF NOT EXISTS notification_outbox (
+	id BIGSERIAL PRIMARY KEY,
+	event TEXT NOT NULL,
+	channel TEXT NOT NULL CHECK (channel IN ('fcm', 'smtp', 'webhook')),
+	recipients TEXT[] NOT NULL DEFAULT '{}',
+	title TEXT NOT NULL DEFAULT '',
+	body TEXT NOT NULL DEFAULT '',
+	data JSONB NOT NULL DEFAULT '{}'::jsonb,
+	status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sending', 'sent', 'failed', 'dead', 'skipped')),
+	attempts INT NOT NULL DEFAULT 0,
+	max_attempts INT NOT NULL DEFAULT 8,
+	next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	locked_until TIMESTAMPTZ,
+	last_error TEXT,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	sent_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_notification_outbox_due ON notification_outbox(next_attempt_at)
+	WHERE status IN ('pending', 'failed', 'sending');
+CREATE INDEX IF NOT EXISTS idx_notification_outbox_status ON notification_outbox(status, created_at DESC);
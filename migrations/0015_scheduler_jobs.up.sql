@@ -0,0 +1,17 @@
+-- Status terakhir job terjadwal. Hanya replika yang memegang advisory lock
+-- leader yang menjalankan job, tetapi semua replika membaca tabel ini untuk
+-- /admin/jobs.
+CREATE TABLE IF NOT EXISTS scheduler_jobs (
+	name TEXT PRIMARY KEY,
+	schedule TEXT NOT NULL,
+	last_run_at TIMESTAMPTZ,
+	last_finished_at TIMESTAMPTZ,
+	last_status TEXT CHECK (last_status IN ('running', 'ok', 'failed')),
+	last_error TEXT,
+	last_duration_ms BIGINT,
+	next_run_at TIMESTAMPTZ,
+	run_count BIGINT NOT NULL DEFAULT 0,
+	failure_count BIGINT NOT NULL DEFAULT 0,
+	last_instance TEXT,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,19 @@
+-- Inbox notifikasi per user. Diisi oleh enqueueNotification bersamaan dengan
+-- baris outbox sehingga notifikasi tetap terlihat walaupun push atau email
+-- gagal terkirim. panel_no_pp, issue_id dan comment_id dipakai aplikasi
+-- untuk membuka layar terkait.
+CREATE TABLE IF NOT EXISTS notifications (
+	id BIGSERIAL PRIMARY KEY,
+	username TEXT NOT NULL REFERENCES company_accounts(username) ON DELETE CASCADE ON UPDATE CASCADE,
+	event TEXT NOT NULL,
+	title TEXT NOT NULL DEFAULT '',
+	body TEXT NOT NULL DEFAULT '',
+	panel_no_pp TEXT,
+	issue_id INT,
+	comment_id TEXT,
+	data JSONB NOT NULL DEFAULT '{}'::jsonb,
+	read_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_notifications_username ON notifications(username, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications(username) WHERE read_at IS NULL;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS notification_digest_items;
+DROP TABLE IF EXISTS notification_subscriptions;
+DROP TABLE IF EXISTS notification_event_preferences;
+DROP TABLE IF EXISTS notification_preferences;
@@ -0,0 +1,49 @@
+-- Preferensi notifikasi per user. Tanpa baris di sini user menerima semua
+-- notifikasi seperti sebelumnya. email dipakai bila username bukan alamat
+-- email; quiet hours memakai zona waktu user (default kalender default).
+CREATE TABLE IF NOT EXISTS notification_preferences (
+	username TEXT PRIMARY KEY REFERENCES company_accounts(username) ON DELETE CASCADE ON UPDATE CASCADE,
+	email TEXT,
+	timezone TEXT,
+	quiet_start TIME,
+	quiet_end TIME,
+	digest TEXT NOT NULL DEFAULT 'off' CHECK (digest IN ('off', 'daily')),
+	digest_hour INT NOT NULL DEFAULT 7 CHECK (digest_hour BETWEEN 0 AND 23),
+	last_digest_at TIMESTAMPTZ,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- event '*' berlaku untuk semua event yang tidak punya baris sendiri.
+CREATE TABLE IF NOT EXISTS notification_event_preferences (
+	username TEXT NOT NULL REFERENCES company_accounts(username) ON DELETE CASCADE ON UPDATE CASCADE,
+	event TEXT NOT NULL,
+	channel TEXT NOT NULL CHECK (channel IN ('push', 'email', 'inapp')),
+	enabled BOOLEAN NOT NULL,
+	PRIMARY KEY (username, event, channel)
+);
+
+-- subscribe: ikut menerima notifikasi panel/project walaupun bukan
+-- stakeholder. mute: push dan email dimatikan, inbox tetap diisi. Aturan
+-- panel mengalahkan aturan project.
+CREATE TABLE IF NOT EXISTS notification_subscriptions (
+	username TEXT NOT NULL REFERENCES company_accounts(username) ON DELETE CASCADE ON UPDATE CASCADE,
+	scope TEXT NOT NULL CHECK (scope IN ('panel', 'project')),
+	scope_id TEXT NOT NULL,
+	mode TEXT NOT NULL CHECK (mode IN ('subscribe', 'mute')),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (username, scope, scope_id)
+);
+CREATE INDEX IF NOT EXISTS idx_notification_subscriptions_scope ON notification_subscriptions(scope, scope_id);
+
+-- Email yang ditahan untuk digest harian.
+CREATE TABLE IF NOT EXISTS notification_digest_items (
+	id BIGSERIAL PRIMARY KEY,
+	username TEXT NOT NULL REFERENCES company_accounts(username) ON DELETE CASCADE ON UPDATE CASCADE,
+	event TEXT NOT NULL,
+	title TEXT NOT NULL DEFAULT '',
+	body TEXT NOT NULL DEFAULT '',
+	data JSONB NOT NULL DEFAULT '{}'::jsonb,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	sent_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_notification_digest_pending ON notification_digest_items(username, created_at) WHERE sent_at IS NULL;
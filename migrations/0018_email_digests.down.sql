@@ -0,0 +1,9 @@
+ALTER TABLE notification_outbox DROP COLUMN IF EXISTS attachment;
+ALTER TABLE notification_outbox DROP COLUMN IF EXISTS attachment_name;
+
+UPDATE notification_preferences SET digest = 'daily' WHERE digest = 'weekly';
+ALTER TABLE notification_preferences DROP CONSTRAINT IF EXISTS notification_preferences_digest_check;
+ALTER TABLE notification_preferences ADD CONSTRAINT notification_preferences_digest_check CHECK (digest IN ('off', 'daily'));
+ALTER TABLE notification_preferences DROP COLUMN IF EXISTS digest_xlsx;
+ALTER TABLE notification_preferences DROP COLUMN IF EXISTS digest_weekday;
+ALTER TABLE notification_preferences DROP COLUMN IF EXISTS language;
@@ -0,0 +1,11 @@
+-- Bahasa email (template id/en), digest mingguan dan lampiran xlsx.
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS language TEXT CHECK (language IN ('id', 'en'));
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS digest_weekday INT NOT NULL DEFAULT 1 CHECK (digest_weekday BETWEEN 1 AND 7);
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS digest_xlsx BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE notification_preferences DROP CONSTRAINT IF EXISTS notification_preferences_digest_check;
+ALTER TABLE notification_preferences ADD CONSTRAINT notification_preferences_digest_check CHECK (digest IN ('off', 'daily', 'weekly'));
+
+-- Lampiran email (mis. laporan digest xlsx) disimpan bersama baris outbox
+-- supaya retry mengirim file yang sama.
+ALTER TABLE notification_outbox ADD COLUMN IF NOT EXISTS attachment_name TEXT;
+ALTER TABLE notification_outbox ADD COLUMN IF NOT EXISTS attachment BYTEA;
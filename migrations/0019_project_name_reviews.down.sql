@@ -0,0 +1,26 @@
+-- Kembali ke perilaku 0011: nama yang belum dikenal langsung menjadi project.
+CREATE OR REPLACE FUNCTION sync_panel_project()
+RETURNS TRIGGER AS $$
+BEGIN
+	IF ref_name(NEW.project) IS NULL THEN
+		NEW.project_id := NULL;
+	ELSE
+		INSERT INTO projects (name, created_by) VALUES (ref_name(NEW.project), NEW.created_by)
+		ON CONFLICT ((ref_key(name))) DO UPDATE SET name = projects.name
+		RETURNING id, name INTO NEW.project_id, NEW.project;
+	END IF;
+
+	IF ref_name(NEW.no_wbs) IS NULL THEN
+		NEW.wbs_id := NULL;
+	ELSE
+		INSERT INTO wbs_elements (project_id, code) VALUES (NEW.project_id, ref_name(NEW.no_wbs))
+		ON CONFLICT ((COALESCE(project_id, 0)), (ref_key(code))) DO UPDATE SET code = wbs_elements.code
+		RETURNING id, code INTO NEW.wbs_id, NEW.no_wbs;
+	END IF;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION IF EXISTS resolve_project_id(TEXT);
+DROP TABLE IF EXISTS project_name_reviews;
+DROP TABLE IF EXISTS project_aliases;
@@ -0,0 +1,59 @@
+-- Nama project yang belum dikenal tidak lagi membuat project baru secara
+-- otomatis. Panel tetap menyimpan teksnya dengan project_id NULL dan namanya
+-- masuk antrean review; admin memetakannya ke project yang ada (disimpan
+-- sebagai alias) atau membuat project baru.
+
+CREATE TABLE IF NOT EXISTS project_aliases (
+	alias_key TEXT PRIMARY KEY,
+	project_id INT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	created_by TEXT,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_project_aliases_project ON project_aliases(project_id);
+
+CREATE TABLE IF NOT EXISTS project_name_reviews (
+	name_key TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	first_seen_by TEXT,
+	first_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE OR REPLACE FUNCTION resolve_project_id(value TEXT)
+RETURNS INT AS $$
+	SELECT id FROM (
+		SELECT id, 0 AS rank FROM projects WHERE ref_key(name) = ref_key(value)
+		UNION ALL
+		SELECT project_id, 1 FROM project_aliases WHERE alias_key = ref_key(value)
+	) r ORDER BY rank LIMIT 1;
+$$ LANGUAGE sql STABLE;
+
+CREATE OR REPLACE FUNCTION sync_panel_project()
+RETURNS TRIGGER AS $$
+BEGIN
+	NEW.project := ref_name(NEW.project);
+	IF NEW.project IS NULL THEN
+		NEW.project_id := NULL;
+	ELSE
+		NEW.project_id := resolve_project_id(NEW.project);
+		IF NEW.project_id IS NULL THEN
+			INSERT INTO project_name_reviews (name_key, name, first_seen_by)
+			VALUES (ref_key(NEW.project), NEW.project, NEW.created_by)
+			ON CONFLICT (name_key) DO UPDATE SET last_seen_at = NOW();
+		ELSE
+			SELECT name INTO NEW.project FROM projects WHERE id = NEW.project_id;
+		END IF;
+	END IF;
+
+	-- WBS panel yang project-nya masih direview dipetakan setelah review.
+	IF ref_name(NEW.no_wbs) IS NULL OR (NEW.project IS NOT NULL AND NEW.project_id IS NULL) THEN
+		NEW.wbs_id := NULL;
+		NEW.no_wbs := ref_name(NEW.no_wbs);
+	ELSE
+		INSERT INTO wbs_elements (project_id, code) VALUES (NEW.project_id, ref_name(NEW.no_wbs))
+		ON CONFLICT ((COALESCE(project_id, 0)), (ref_key(code))) DO UPDATE SET code = wbs_elements.code
+		RETURNING id, code INTO NEW.wbs_id, NEW.no_wbs;
+	END IF;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
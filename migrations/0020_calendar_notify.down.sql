@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS companies_calendar_notify ON companies;
+DROP TRIGGER IF EXISTS calendar_days_notify ON calendar_days;
+DROP TRIGGER IF EXISTS calendars_notify ON calendars;
+DROP FUNCTION IF EXISTS notify_calendar_changed();
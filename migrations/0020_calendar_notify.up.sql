@@ -0,0 +1,25 @@
+-- Setiap replika menyimpan kalender di memori. Perubahan kalender, tanggal
+-- pengecualian atau pemetaan company diberitahukan lewat NOTIFY supaya semua
+-- replika memuat ulang, termasuk perubahan yang dilakukan langsung lewat SQL.
+CREATE OR REPLACE FUNCTION notify_calendar_changed()
+RETURNS TRIGGER AS $$
+BEGIN
+	PERFORM pg_notify('calendar_changed', TG_TABLE_NAME);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS calendars_notify ON calendars;
+CREATE TRIGGER calendars_notify
+AFTER INSERT OR UPDATE OR DELETE ON calendars
+FOR EACH STATEMENT EXECUTE FUNCTION notify_calendar_changed();
+
+DROP TRIGGER IF EXISTS calendar_days_notify ON calendar_days;
+CREATE TRIGGER calendar_days_notify
+AFTER INSERT OR UPDATE OR DELETE ON calendar_days
+FOR EACH STATEMENT EXECUTE FUNCTION notify_calendar_changed();
+
+DROP TRIGGER IF EXISTS companies_calendar_notify ON companies;
+CREATE TRIGGER companies_calendar_notify
+AFTER INSERT OR UPDATE OF calendar_id OR DELETE ON companies
+FOR EACH STATEMENT EXECUTE FUNCTION notify_calendar_changed();
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_panels_search;
+DROP FUNCTION IF EXISTS panel_search_document(TEXT, TEXT, TEXT, TEXT);
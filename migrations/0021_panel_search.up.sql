@@ -0,0 +1,12 @@
+-- Pencarian panel memakai full-text search. Tanda baca diganti spasi supaya
+-- nomor seperti "PP-123/A" terpecah menjadi kata "pp", "123", "a" yang bisa
+-- dicocokkan per awalan. Fungsi dipakai bersama oleh index dan query.
+CREATE OR REPLACE FUNCTION panel_search_document(no_pp TEXT, no_panel TEXT, project TEXT, no_wbs TEXT)
+RETURNS tsvector AS $$
+	SELECT to_tsvector('simple'::regconfig, regexp_replace(lower(
+		COALESCE(no_pp, '') || ' ' || COALESCE(no_panel, '') || ' ' ||
+		COALESCE(project, '') || ' ' || COALESCE(no_wbs, '')), '[^[:alnum:]]+', ' ', 'g'))
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE INDEX IF NOT EXISTS idx_panels_search ON panels
+	USING GIN (panel_search_document(no_pp, no_panel, project, no_wbs));
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS wirings_progress_events ON wirings;
+DROP FUNCTION IF EXISTS record_wiring_progress();
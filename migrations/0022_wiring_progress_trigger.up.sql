@@ -0,0 +1,28 @@
+-- Riwayat progres wiring dicatat oleh trigger, tidak lagi lewat audit,
+-- sehingga setiap perubahan progress/status tercatat walaupun audit gagal
+-- atau jalurnya tidak memakai audit. Actor dan source diambil dari setting
+-- transaksi secpanel.actor/secpanel.source (lihat setWiringActor); perubahan
+-- langsung lewat SQL tercatat dengan source 'db'.
+CREATE OR REPLACE FUNCTION record_wiring_progress()
+RETURNS TRIGGER AS $$
+DECLARE
+	progress_from INTEGER;
+BEGIN
+	IF TG_OP = 'UPDATE' THEN
+		IF NEW.progress IS NOT DISTINCT FROM OLD.progress AND NEW.status IS NOT DISTINCT FROM OLD.status THEN
+			RETURN NULL;
+		END IF;
+		progress_from := OLD.progress;
+	END IF;
+	INSERT INTO wiring_progress_events (wiring_id, panel_no_pp, package_name, supplier, progress_from, progress, status, actor, source)
+	VALUES (NEW.id, NEW.panel_no_pp, NEW.package_name, NEW.supplier, progress_from, COALESCE(NEW.progress, 0), NEW.status,
+		NULLIF(current_setting('secpanel.actor', true), ''),
+		COALESCE(NULLIF(current_setting('secpanel.source', true), ''), 'db'));
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS wirings_progress_events ON wirings;
+CREATE TRIGGER wirings_progress_events
+AFTER INSERT OR UPDATE OF progress, status ON wirings
+FOR EACH ROW EXECUTE FUNCTION record_wiring_progress();
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Outbox notifikasi (lihat migrasi 0014_notification_outbox). Handler hanya
+// memanggil enqueueNotification di dalam transaksinya; pengiriman FCM, email
+// dan webhook dilakukan oleh dispatcher sehingga notifikasi tidak hilang bila
+// server restart atau SMTP/FCM sedang gangguan.
+
+const (
+	outboxBatchSize      = 20
+	outboxPollInterval   = 5 * time.Second
+	outboxLockDuration   = 5 * time.Minute
+	outboxBaseBackoff    = 30 * time.Second
+	outboxMaxBackoff     = 6 * time.Hour
+	outboxWebhookTimeout = 10 * time.Second
+)
+
+var outboxStatuses = map[string]bool{"pending": true, "sending": true, "sent": true, "failed": true, "dead": true, "skipped": true}
+
+// errNotificationSkipped menandai pengiriman yang tidak perlu diulang,
+// misalnya user tanpa device terdaftar atau SMTP belum dikonfigurasi.
+var errNotificationSkipped = errors.New("notifikasi dilewati")
+
+func skipNotification(reason string) error {
+	return fmt.Errorf("%w: %s", errNotificationSkipped, reason)
+}
+
+// outboxMessage adalah satu notifikasi logis. Setiap channel yang punya
+// penerima menjadi satu baris outbox.
+type outboxMessage struct {
+	Event   string   // misalnya "panel.updated", "issue.comment"
+	Users   []string // penerima push FCM (username)
+	Title   string
+	Body    string
+	Emails  []string // penerima email
+	Subject string
+	HTML    string
+	Data    map[string]string // konteks tambahan, ikut dikirim ke webhook
+
+	// Template (lihat templates/email) menggantikan Subject/HTML dan dirender
+	// per bahasa penerima.
+	Template     string
+	TemplateData interface{}
+}
+
+func notificationWebhookURL() string {
+	return strings.TrimSpace(os.Getenv("NOTIFICATION_WEBHOOK_URL"))
+}
+
+// enqueueNotification menulis notifikasi ke outbox memakai db yang sama
+// dengan perubahan datanya (biasanya *sql.Tx). Preferensi penerima
+// diterapkan di sini (lihat planNotificationDelivery).
+func enqueueNotification(db DBTX, m outboxMessage) error {
+	if m.Data == nil {
+		m.Data = map[string]string{}
+	}
+	data, err := json.Marshal(m.Data)
+	if err != nil {
+		return err
+	}
+	if m.Template != "" {
+		if m.Subject, m.HTML, err = renderEmail(m.Template, defaultEmailLanguage(), m.TemplateData); err != nil {
+			return err
+		}
+	}
+	plan, err := planNotificationDelivery(db, m, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := recordInboxNotification(db, m, plan.Inbox, data); err != nil {
+		return err
+	}
+	for _, batch := range plan.Push {
+		if err := insertOutboxRow(db, m.Event, "fcm", batch.Recipients, m.Title, m.Body, data, batch.At); err != nil {
+			return err
+		}
+	}
+	for _, batch := range plan.Emails {
+		subject, body := m.Subject, m.HTML
+		if m.Template != "" && batch.Lang != defaultEmailLanguage() {
+			if subject, body, err = renderEmail(m.Template, batch.Lang, m.TemplateData); err != nil {
+				return err
+			}
+		}
+		if err := insertOutboxRow(db, m.Event, "smtp", batch.Recipients, subject, body, data, time.Time{}); err != nil {
+			return err
+		}
+	}
+	if err := queueDigestItems(db, m, plan.Digest, data); err != nil {
+		return err
+	}
+	// Webhook untuk integrasi sistem lain, tidak terpengaruh preferensi user.
+	if url := notificationWebhookURL(); url != "" && (len(m.Users) > 0 || len(m.Emails) > 0) {
+		title, body := m.Title, m.Body
+		if title == "" {
+			title = m.Subject
+		}
+		if err := insertOutboxRow(db, m.Event, "webhook", []string{url}, title, body, data, time.Time{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertOutboxRow: at zero berarti kirim segera.
+func insertOutboxRow(db DBTX, event, channel string, recipients []string, title, body string, data []byte, at time.Time) error {
+	var nextAttempt sql.NullTime
+	if !at.IsZero() {
+		nextAttempt = sql.NullTime{Time: at, Valid: true}
+	}
+	_, err := db.Exec(`
+		INSERT INTO notification_outbox (event, channel, recipients, title, body, data, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, $6, COALESCE($7, NOW()))`,
+		event, channel, pq.Array(recipients), title, body, data, nextAttempt)
+	return err
+}
+
+// excludeRecipient membuang actor dan string kosong dari daftar penerima.
+func excludeRecipient(recipients []string, actor string) []string {
+	out := []string{}
+	for _, r := range recipients {
+		r = strings.TrimSpace(r)
+		if r != "" && r != actor {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+type outboxRow struct {
+	ID          int64           `json:"id"`
+	Event       string          `json:"event"`
+	Channel     string          `json:"channel"`
+	Recipients  []string        `json:"recipients"`
+	Title       string          `json:"title"`
+	Body        string          `json:"body"`
+	Attachment  *string         `json:"attachment_name"`
+	Data        json.RawMessage `json:"data"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	NextAttempt time.Time       `json:"next_attempt_at"`
+	LastError   *string         `json:"last_error"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	SentAt      *time.Time      `json:"sent_at"`
+}
+
+const outboxColumns = `o.id, o.event, o.channel, o.recipients, o.title, o.body, o.attachment_name, o.data, o.status, o.attempts,
+	o.max_attempts, o.next_attempt_at, o.last_error, o.created_at, o.updated_at, o.sent_at`
+
+func scanOutboxRow(s interface{ Scan(...interface{}) error }) (outboxRow, error) {
+	var o outboxRow
+	var data []byte
+	err := s.Scan(&o.ID, &o.Event, &o.Channel, pq.Array(&o.Recipients), &o.Title, &o.Body, &o.Attachment, &data, &o.Status,
+		&o.Attempts, &o.MaxAttempts, &o.NextAttempt, &o.LastError, &o.CreatedAt, &o.UpdatedAt, &o.SentAt)
+	o.Data = json.RawMessage(data)
+	return o, err
+}
+
+// outboxBackoff: 30 detik, 1 menit, 2 menit, ... maksimal 6 jam, dengan
+// jitter ±20% supaya retry tidak serentak.
+func outboxBackoff(attempts int) time.Duration {
+	d := outboxBaseBackoff
+	for i := 1; i < attempts && d < outboxMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > outboxMaxBackoff {
+		d = outboxMaxBackoff
+	}
+	jitter := time.Duration((rand.Float64()*0.4 - 0.2) * float64(d))
+	return d + jitter
+}
+
+func (a *App) startNotificationDispatcher() {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		for {
+			n, err := a.dispatchNotifications(outboxBatchSize)
+			if err != nil {
+				log.Printf("Outbox: gagal memproses notifikasi: %v", err)
+				break
+			}
+			if n < outboxBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// dispatchNotifications mengklaim satu batch baris yang jatuh tempo dan
+// mengirimkannya. Baris "sending" yang lock-nya habis (server mati di tengah
+// pengiriman) diklaim ulang. SKIP LOCKED membuat beberapa instance aman
+// berjalan bersamaan.
+func (a *App) dispatchNotifications(limit int) (int, error) {
+	rows, err := a.DB.Query(`
+		UPDATE notification_outbox o SET status = 'sending', attempts = o.attempts + 1,
+			locked_until = NOW() + $2::interval, updated_at = NOW()
+		WHERE o.id IN (
+			SELECT id FROM notification_outbox
+			WHERE (status IN ('pending', 'failed') AND next_attempt_at <= NOW())
+				OR (status = 'sending' AND locked_until < NOW())
+			ORDER BY next_attempt_at, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED)
+		RETURNING `+outboxColumns, limit, fmt.Sprintf("%d seconds", int(outboxLockDuration.Seconds())))
+	if err != nil {
+		return 0, err
+	}
+	var batch []outboxRow
+	for rows.Next() {
+		o, err := scanOutboxRow(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, o)
+	}
+	rows.Close()
+
+	for _, o := range batch {
+		err := a.deliverNotification(o)
+		switch {
+		case err == nil:
+			_, err = a.DB.Exec(`UPDATE notification_outbox SET status = 'sent', sent_at = NOW(), last_error = NULL,
+				locked_until = NULL, updated_at = NOW() WHERE id = $1`, o.ID)
+		case errors.Is(err, errNotificationSkipped):
+			_, err = a.DB.Exec(`UPDATE notification_outbox SET status = 'skipped', last_error = $2,
+				locked_until = NULL, updated_at = NOW() WHERE id = $1`, o.ID, err.Error())
+		case o.Attempts >= o.MaxAttempts:
+			log.Printf("Outbox: notifikasi %d (%s/%s) gagal %d kali, dipindah ke dead letter: %v", o.ID, o.Event, o.Channel, o.Attempts, err)
+			_, err = a.DB.Exec(`UPDATE notification_outbox SET status = 'dead', last_error = $2,
+				locked_until = NULL, updated_at = NOW() WHERE id = $1`, o.ID, err.Error())
+		default:
+			_, err = a.DB.Exec(`UPDATE notification_outbox SET status = 'failed', last_error = $2,
+				next_attempt_at = NOW() + $3::interval, locked_until = NULL, updated_at = NOW() WHERE id = $1`,
+				o.ID, err.Error(), fmt.Sprintf("%d seconds", int(outboxBackoff(o.Attempts).Seconds())))
+		}
+		if err != nil {
+			log.Printf("Outbox: gagal menyimpan status notifikasi %d: %v", o.ID, err)
+		}
+	}
+	return len(batch), nil
+}
+
+func (a *App) deliverNotification(o outboxRow) error {
+	switch o.Channel {
+	case "fcm":
+		return a.sendNotificationToUsers(o.Recipients, o.Title, o.Body)
+	case "smtp":
+		if o.Attachment == nil {
+			return sendNotificationEmail(o.Recipients, o.Title, o.Body)
+		}
+		// Lampiran hanya dibaca saat dikirim supaya listing outbox tetap ringan.
+		file := emailAttachment{Name: *o.Attachment}
+		if err := a.DB.QueryRow(`SELECT attachment FROM notification_outbox WHERE id = $1`, o.ID).Scan(&file.Data); err != nil {
+			return fmt.Errorf("gagal membaca lampiran: %w", err)
+		}
+		return sendNotificationEmail(o.Recipients, o.Title, o.Body, file)
+	case "webhook":
+		return sendNotificationWebhook(o)
+	}
+	return skipNotification("channel tidak dikenal: " + o.Channel)
+}
+
+// sendNotificationWebhook mengirim POST JSON. Bila NOTIFICATION_WEBHOOK_SECRET
+// diset, body ditandatangani HMAC-SHA256 di header X-Secpanel-Signature.
+func sendNotificationWebhook(o outboxRow) error {
+	if len(o.Recipients) == 0 {
+		return skipNotification("URL webhook kosong")
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":         o.ID,
+		"event":      o.Event,
+		"title":      o.Title,
+		"body":       o.Body,
+		"data":       o.Data,
+		"created_at": o.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, o.Recipients[0], bytes.NewReader(payload))
+	if err != nil {
+		return skipNotification("URL webhook tidak valid: " + err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Secpanel-Event", o.Event)
+	req.Header.Set("X-Secpanel-Delivery", strconv.FormatInt(o.ID, 10))
+	if secret := os.Getenv("NOTIFICATION_WEBHOOK_SECRET"); secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(payload)
+		req.Header.Set("X-Secpanel-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := (&http.Client{Timeout: outboxWebhookTimeout}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook membalas HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// getNotificationOutboxHandler: GET /admin/notifications?status=&channel=&event=&limit=&offset=
+func (a *App) getNotificationOutboxHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if s := q.Get("status"); s != "" {
+		statuses := strings.Split(s, ",")
+		for _, st := range statuses {
+			if !outboxStatuses[st] {
+				respondWithError(w, http.StatusBadRequest, "Status tidak dikenal: "+st)
+				return
+			}
+		}
+		where = append(where, "o.status = ANY("+arg(pq.Array(statuses))+")")
+	}
+	if c := q.Get("channel"); c != "" {
+		where = append(where, "o.channel = "+arg(c))
+	}
+	if e := q.Get("event"); e != "" {
+		where = append(where, "o.event = "+arg(e))
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+	cond := ""
+	if len(where) > 0 {
+		cond = "WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := a.DB.QueryRow(`SELECT COUNT(*) FROM notification_outbox o `+cond, args...).Scan(&total); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil outbox: "+err.Error())
+		return
+	}
+	rows, err := a.DB.Query(`SELECT `+outboxColumns+` FROM notification_outbox o `+cond+
+		` ORDER BY o.created_at DESC, o.id DESC LIMIT `+arg(limit)+` OFFSET `+arg(offset), args...)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil outbox: "+err.Error())
+		return
+	}
+	defer rows.Close()
+	items := []outboxRow{}
+	for rows.Next() {
+		o, err := scanOutboxRow(rows)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		items = append(items, o)
+	}
+
+	counts := map[string]int{}
+	crow, err := a.DB.Query(`SELECT status, COUNT(*) FROM notification_outbox GROUP BY status`)
+	if err == nil {
+		defer crow.Close()
+		for crow.Next() {
+			var s string
+			var n int
+			if crow.Scan(&s, &n) == nil {
+				counts[s] = n
+			}
+		}
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"items":  items,
+		"total":  total,
+		"counts": counts,
+	})
+}
+
+func (a *App) getNotificationOutboxItemHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ID notifikasi tidak valid")
+		return
+	}
+	o, err := scanOutboxRow(a.DB.QueryRow(`SELECT `+outboxColumns+` FROM notification_outbox o WHERE o.id = $1`, id))
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Notifikasi tidak ditemukan")
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, o)
+}
+
+// replayNotificationsHandler: POST /admin/notifications/replay
+// {"ids": [1, 2]} atau {"status": "dead"}. Baris dikembalikan ke pending
+// dengan jatah percobaan baru; baris yang sedang dikirim tidak disentuh.
+func (a *App) replayNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		IDs    []int64 `json:"ids"`
+		Status string  `json:"status"`
+	}
+	if id := mux.Vars(r)["id"]; id != "" {
+		n, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "ID notifikasi tidak valid")
+			return
+		}
+		payload.IDs = []int64{n}
+	} else if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid payload: "+err.Error())
+		return
+	}
+	if len(payload.IDs) == 0 && payload.Status == "" {
+		respondWithError(w, http.StatusBadRequest, "Isi ids atau status")
+		return
+	}
+	if payload.Status != "" && (payload.Status == "sending" || !outboxStatuses[payload.Status]) {
+		respondWithError(w, http.StatusBadRequest, "Status tidak bisa di-replay: "+payload.Status)
+		return
+	}
+
+	res, err := a.DB.Exec(`
+		UPDATE notification_outbox SET status = 'pending', attempts = 0, next_attempt_at = NOW(),
+			locked_until = NULL, updated_at = NOW()
+		WHERE status <> 'sending'
+			AND (cardinality($1::bigint[]) = 0 OR id = ANY($1))
+			AND ($2 = '' OR status = $2)`, pq.Array(payload.IDs), payload.Status)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal replay notifikasi: "+err.Error())
+		return
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 && len(payload.IDs) == 1 {
+		respondWithError(w, http.StatusNotFound, "Notifikasi tidak ditemukan atau sedang dikirim")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"status": "success", "replayed": n})
+}
+
+// enqueuePanelNotification mengirim push ke stakeholder panel (lihat
+// panelStakeholders) dan subscriber panel/project-nya, kecuali actor.
+func enqueuePanelNotification(db DBTX, event, panelNoPp, actor, title, body string) error {
+	stakeholders, err := panelStakeholders(db, panelNoPp)
+	if err != nil {
+		return err
+	}
+	subscribers, err := panelSubscribers(db, panelNoPp)
+	if err != nil {
+		return err
+	}
+	return enqueueNotification(db, outboxMessage{
+		Event: event,
+		Users: excludeRecipient(uniqueStrings(stakeholders, subscribers), actor),
+		Title: title,
+		Body:  body,
+		Data:  map[string]string{"panel_no_pp": panelNoPp, "actor": actor},
+	})
+}
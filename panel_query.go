@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+const (
+	defaultPanelPageSize = 50
+	maxPanelPageSize     = 500
+)
+
+// Kolom yang boleh dipakai di parameter sort. Kunci adalah nama yang dikirim
+// client, nilainya ekspresi SQL.
+var panelSortColumns = map[string]string{
+	"no_pp":               "p.no_pp",
+	"no_panel":            "p.no_panel",
+	"no_wbs":              "p.no_wbs",
+	"project":             "p.project",
+	"panel_type":          "p.panel_type",
+	"percent_progress":    "p.percent_progress",
+	"start_date":          "p.start_date",
+	"target_delivery":     "p.target_delivery",
+	"closed_date":         "p.closed_date",
+	"status_penyelesaian": "p.status_penyelesaian",
+	"production_slot":     "p.production_slot",
+	"vendor":              "pu.name",
+}
+
+// panelCursor menandai baris terakhir halaman sebelumnya untuk keyset
+// pagination: nilai kolom sort (teks, nil bila NULL) dan no_pp sebagai
+// penentu urutan bila nilainya sama. Sort ikut disimpan supaya cursor tidak
+// dipakai dengan urutan yang berbeda.
+type panelCursor struct {
+	Sort  string  `json:"s,omitempty"`
+	Value *string `json:"v"`
+	NoPp  string  `json:"id"`
+}
+
+func encodePanelCursor(c panelCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePanelCursor(raw string) (*panelCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, err
+	}
+	var c panelCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if c.NoPp == "" {
+		return nil, fmt.Errorf("cursor kosong")
+	}
+	return &c, nil
+}
+
+// panelListQuery adalah hasil parsing query string untuk GET /panels.
+type panelListQuery struct {
+	Paginate bool
+	Limit    int
+	Offset   int
+	// UseCursor aktif bila parameter cursor dikirim (boleh kosong untuk
+	// halaman pertama); Cursor nil berarti mulai dari awal.
+	UseCursor bool
+	Cursor    *panelCursor
+
+	Projects            []string
+	ProjectIDs          []string
+	NoWbs               []string
+	Vendors             []string
+	PanelTypes          []string
+	StatusPenyelesaian  []string
+	Closed              *bool
+	Overdue             bool
+	LikelyLate          bool
+	OnlyNoPps           []string // diisi handler, misalnya hasil forecast likely_late
+	TargetDeliveryFrom  *time.Time
+	TargetDeliveryUntil *time.Time
+	Search              string
+	Sort                []string
+}
+
+func splitListParam(v url.Values, key string) []string {
+	var out []string
+	for _, raw := range v[key] {
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, item)
+			}
+		}
+	}
+	return out
+}
+
+// parseDateParam menerima tanggal "2006-01-02" atau RFC3339. Untuk batas akhir
+// berupa tanggal saja, seluruh hari tersebut ikut terhitung. Tanggal dibaca
+// di zona waktu kalender default.
+func parseDateParam(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, defaultCalendar().loc)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+func parsePanelListQuery(v url.Values) (panelListQuery, error) {
+	q := panelListQuery{
+		Projects:           splitListParam(v, "project"),
+		ProjectIDs:         splitListParam(v, "project_id"),
+		NoWbs:              splitListParam(v, "no_wbs"),
+		Vendors:            splitListParam(v, "vendor"),
+		PanelTypes:         splitListParam(v, "panel_type"),
+		StatusPenyelesaian: splitListParam(v, "status_penyelesaian"),
+		Search:             strings.TrimSpace(v.Get("q")),
+		Sort:               splitListParam(v, "sort"),
+	}
+
+	q.UseCursor = v.Has("cursor")
+	if q.UseCursor && (v.Get("offset") != "" || v.Get("page") != "") {
+		return q, fmt.Errorf("cursor tidak bisa digabung dengan offset atau page")
+	}
+	if q.UseCursor && len(q.Sort) > 1 {
+		return q, fmt.Errorf("cursor hanya mendukung satu kolom sort")
+	}
+
+	if q.UseCursor || v.Get("limit") != "" || v.Get("offset") != "" || v.Get("page") != "" || v.Get("page_size") != "" {
+		q.Paginate = true
+		q.Limit = defaultPanelPageSize
+		for _, key := range []string{"limit", "page_size"} {
+			if s := v.Get(key); s != "" {
+				n, err := strconv.Atoi(s)
+				if err != nil || n <= 0 {
+					return q, fmt.Errorf("%s harus berupa angka positif", key)
+				}
+				q.Limit = n
+			}
+		}
+		if q.Limit > maxPanelPageSize {
+			q.Limit = maxPanelPageSize
+		}
+		if s := v.Get("offset"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				return q, fmt.Errorf("offset tidak valid")
+			}
+			q.Offset = n
+		} else if s := v.Get("page"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 {
+				return q, fmt.Errorf("page dimulai dari 1")
+			}
+			q.Offset = (n - 1) * q.Limit
+		}
+	}
+
+	if s := v.Get("closed"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return q, fmt.Errorf("closed harus true atau false")
+		}
+		q.Closed = &b
+	}
+	if s := v.Get("likely_late"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return q, fmt.Errorf("likely_late harus true atau false")
+		}
+		q.LikelyLate = b
+	}
+	if s := v.Get("overdue"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return q, fmt.Errorf("overdue harus true atau false")
+		}
+		q.Overdue = b
+	}
+
+	var err error
+	if q.TargetDeliveryFrom, err = parseDateParam(v.Get("target_delivery_from"), false); err != nil {
+		return q, fmt.Errorf("target_delivery_from tidak valid")
+	}
+	if q.TargetDeliveryUntil, err = parseDateParam(v.Get("target_delivery_to"), true); err != nil {
+		return q, fmt.Errorf("target_delivery_to tidak valid")
+	}
+
+	for _, s := range q.Sort {
+		if _, ok := panelSortColumns[strings.TrimPrefix(s, "-")]; !ok {
+			return q, fmt.Errorf("kolom sort tidak dikenal: %s", strings.TrimPrefix(s, "-"))
+		}
+	}
+
+	if raw := v.Get("cursor"); raw != "" {
+		c, err := decodePanelCursor(raw)
+		if err != nil {
+			return q, fmt.Errorf("cursor tidak valid")
+		}
+		if c.Sort != q.cursorSort() {
+			return q, fmt.Errorf("cursor tidak cocok dengan sort")
+		}
+		q.Cursor = c
+	}
+	return q, nil
+}
+
+// cursorSort adalah satu-satunya kolom sort yang dipakai pada mode cursor.
+func (q panelListQuery) cursorSort() string {
+	if len(q.Sort) == 0 {
+		return ""
+	}
+	return q.Sort[0]
+}
+
+// panelSearchQuery mengubah teks pencarian menjadi tsquery yang cocok dengan
+// panel_search_document: setiap kata dicocokkan sebagai awalan dan semua kata
+// wajib ada. Hanya huruf/angka yang dipakai sehingga aman dari sintaks tsquery.
+func panelSearchQuery(search string) string {
+	words := strings.FieldsFunc(strings.ToLower(search), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, w := range words {
+		words[i] = w + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// buildPanelListSQL menyusun query no_pp untuk halaman yang diminta. scopeQuery
+// dan scopeArgs berasal dari panelScopeQuery sehingga aturan visibilitas per
+// role tetap berlaku. Kolom kedua berisi total baris sebelum LIMIT.
+func buildPanelListSQL(scopeQuery string, scopeArgs []interface{}, q panelListQuery) (string, []interface{}) {
+	args := append([]interface{}{}, scopeArgs...)
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	where := []string{"p.no_pp IN (" + scopeQuery + ")"}
+	if len(q.Projects) > 0 {
+		where = append(where, "p.project = ANY("+arg(pq.Array(q.Projects))+")")
+	}
+	if len(q.ProjectIDs) > 0 {
+		where = append(where, "p.project_id::text = ANY("+arg(pq.Array(q.ProjectIDs))+")")
+	}
+	if len(q.NoWbs) > 0 {
+		where = append(where, "p.no_wbs = ANY("+arg(pq.Array(q.NoWbs))+")")
+	}
+	if len(q.PanelTypes) > 0 {
+		where = append(where, "p.panel_type = ANY("+arg(pq.Array(q.PanelTypes))+")")
+	}
+	if len(q.StatusPenyelesaian) > 0 {
+		where = append(where, "p.status_penyelesaian = ANY("+arg(pq.Array(q.StatusPenyelesaian))+")")
+	}
+	if len(q.Vendors) > 0 {
+		v := arg(pq.Array(q.Vendors))
+		where = append(where, fmt.Sprintf(`(p.vendor_id = ANY(%[1]s)
+			OR EXISTS (SELECT 1 FROM public.busbars x WHERE x.panel_no_pp = p.no_pp AND x.vendor = ANY(%[1]s))
+			OR EXISTS (SELECT 1 FROM public.components x WHERE x.panel_no_pp = p.no_pp AND x.vendor = ANY(%[1]s))
+			OR EXISTS (SELECT 1 FROM public.palet x WHERE x.panel_no_pp = p.no_pp AND x.vendor = ANY(%[1]s))
+			OR EXISTS (SELECT 1 FROM public.corepart x WHERE x.panel_no_pp = p.no_pp AND x.vendor = ANY(%[1]s))
+			OR EXISTS (SELECT 1 FROM public.g3_vendors x WHERE x.panel_no_pp = p.no_pp AND x.vendor = ANY(%[1]s)))`, v))
+	}
+	if q.Closed != nil {
+		where = append(where, "COALESCE(p.is_closed, false) = "+arg(*q.Closed))
+	}
+	if q.Overdue {
+		where = append(where, panelOverdueCondition)
+	}
+	if q.LikelyLate {
+		where = append(where, "p.no_pp = ANY("+arg(pq.Array(append([]string{}, q.OnlyNoPps...)))+")")
+	}
+	if q.TargetDeliveryFrom != nil {
+		where = append(where, "p.target_delivery >= "+arg(*q.TargetDeliveryFrom))
+	}
+	if q.TargetDeliveryUntil != nil {
+		where = append(where, "p.target_delivery < "+arg(*q.TargetDeliveryUntil))
+	}
+	// Setiap kata di q harus muncul (sebagai awalan kata) di no_pp, no_panel,
+	// project atau no_wbs; memakai index GIN idx_panels_search.
+	if tsq := panelSearchQuery(q.Search); tsq != "" {
+		where = append(where, "panel_search_document(p.no_pp, p.no_panel, p.project, p.no_wbs) @@ to_tsquery('simple', "+arg(tsq)+")")
+	}
+
+	sortExpr := "NULL"
+	var orderBy []string
+	for _, s := range q.Sort {
+		dir := "ASC"
+		if strings.HasPrefix(s, "-") {
+			dir = "DESC"
+		}
+		orderBy = append(orderBy, panelSortColumns[strings.TrimPrefix(s, "-")]+" "+dir+" NULLS LAST")
+	}
+	orderBy = append(orderBy, "p.no_pp ASC")
+
+	// Keyset: baris setelah cursor menurut (kolom sort NULLS LAST, no_pp).
+	// Nilai cursor dikirim sebagai teks; tipe parameter mengikuti kolomnya.
+	if q.UseCursor {
+		if s := q.cursorSort(); s != "" {
+			sortExpr = panelSortColumns[strings.TrimPrefix(s, "-")]
+		}
+		if c := q.Cursor; c != nil {
+			id := arg(c.NoPp)
+			switch {
+			case sortExpr == "NULL":
+				where = append(where, "p.no_pp > "+id)
+			case c.Value == nil:
+				where = append(where, fmt.Sprintf("(%s IS NULL AND p.no_pp > %s)", sortExpr, id))
+			default:
+				op := ">"
+				if strings.HasPrefix(q.cursorSort(), "-") {
+					op = "<"
+				}
+				v := arg(*c.Value)
+				where = append(where, fmt.Sprintf("(%[1]s %[2]s %[3]s OR (%[1]s = %[3]s AND p.no_pp > %[4]s) OR %[1]s IS NULL)", sortExpr, op, v, id))
+			}
+		}
+	}
+
+	query := `
+		SELECT p.no_pp, COUNT(*) OVER() AS total_count, (` + sortExpr + `)::text AS sort_value
+		FROM public.panels p
+		LEFT JOIN public.companies pu ON p.vendor_id = pu.id
+		WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY ` + strings.Join(orderBy, ", ")
+	if q.UseCursor {
+		// Satu baris tambahan untuk mengetahui apakah masih ada halaman berikutnya.
+		query += " LIMIT " + arg(q.Limit+1)
+	} else if q.Paginate {
+		query += " LIMIT " + arg(q.Limit) + " OFFSET " + arg(q.Offset)
+	}
+	return query, args
+}
+
+// listPanelIDs mengembalikan no_pp sesuai filter/sort/halaman beserta total
+// panel yang cocok dengan filter. Pada mode cursor, next berisi cursor
+// halaman berikutnya atau kosong bila sudah halaman terakhir.
+func (a *App) listPanelIDs(ctx context.Context, scopeQuery string, scopeArgs []interface{}, q panelListQuery) (ids []string, total int, next string, err error) {
+	query, args := buildPanelListSQL(scopeQuery, scopeArgs, q)
+	rows, err := a.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	defer rows.Close()
+
+	var values []*string
+	for rows.Next() {
+		var id string
+		var value *string
+		if err := rows.Scan(&id, &total, &value); err != nil {
+			return nil, 0, "", err
+		}
+		ids = append(ids, id)
+		values = append(values, value)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, "", err
+	}
+
+	if q.UseCursor && len(ids) > q.Limit {
+		ids = ids[:q.Limit]
+		last := len(ids) - 1
+		next = encodePanelCursor(panelCursor{Sort: q.cursorSort(), Value: values[last], NoPp: ids[last]})
+	}
+
+	// Halaman di luar jangkauan tidak mengembalikan baris, dan halaman cursor
+	// hanya menghitung baris setelah cursor, jadi total dihitung ulang.
+	if (len(ids) == 0 && q.Paginate && q.Offset > 0) || q.Cursor != nil {
+		unpaged := q
+		unpaged.Paginate, unpaged.UseCursor, unpaged.Cursor, unpaged.Sort = false, false, nil, nil
+		countQuery, countArgs := buildPanelListSQL(scopeQuery, scopeArgs, unpaged)
+		err = a.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM ("+countQuery+") t", countArgs...).Scan(&total)
+		if err != nil {
+			return nil, 0, "", err
+		}
+	}
+	return ids, total, next, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const minPasswordLength = 8
+
+func hashPassword(plain string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// generatePassword membuat password acak yang lolos validatePasswordStrength,
+// dipakai untuk akun hasil seed.
+func generatePassword(username string) (string, error) {
+	const alphabet = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	buf := make([]byte, 16)
+	for {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for i, b := range buf {
+			buf[i] = alphabet[int(b)%len(alphabet)]
+		}
+		if validatePasswordStrength(username, string(buf)) == nil {
+			return string(buf), nil
+		}
+	}
+}
+
+func isPasswordHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$")
+}
+
+// verifyPassword mencocokkan password dengan nilai di company_accounts.
+// Baris lama yang masih plaintext tetap bisa login, tapi needsRehash akan
+// bernilai true supaya pemanggil langsung menggantinya dengan hash bcrypt.
+func verifyPassword(stored, plain string) (ok bool, needsRehash bool) {
+	if stored == "" || plain == "" {
+		return false, false
+	}
+	if isPasswordHash(stored) {
+		if err := bcrypt.CompareHashAndPassword([]byte(stored), []byte(plain)); err != nil {
+			return false, false
+		}
+		cost, err := bcrypt.Cost([]byte(stored))
+		return true, err == nil && cost < bcrypt.DefaultCost
+	}
+	if subtle.ConstantTimeCompare([]byte(stored), []byte(plain)) == 1 {
+		return true, true
+	}
+	return false, false
+}
+
+func validatePasswordStrength(username, password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("Password minimal %d karakter", minPasswordLength)
+	}
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return errors.New("Password harus mengandung huruf dan angka")
+	}
+	if username != "" && strings.EqualFold(password, username) {
+		return errors.New("Password tidak boleh sama dengan username")
+	}
+	return nil
+}
+
+// hashImportedPassword dipakai saat import database: password plaintext
+// dari file di-hash, sedangkan nilai yang sudah berupa hash dibiarkan.
+func hashImportedPassword(row map[string]interface{}) error {
+	raw, ok := row["password"].(string)
+	if !ok || raw == "" || isPasswordHash(raw) {
+		return nil
+	}
+	hashed, err := hashPassword(raw)
+	if err != nil {
+		return err
+	}
+	row["password"] = hashed
+	return nil
+}
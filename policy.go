@@ -0,0 +1,594 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/gorilla/mux"
+)
+
+type Resource string
+type Action string
+
+const (
+	ResourceAll              Resource = "*"
+	ResourceMe               Resource = "me"
+	ResourceAccount          Resource = "account"
+	ResourcePassword         Resource = "password"
+	ResourceCompany          Resource = "company"
+	ResourcePanel            Resource = "panel"
+	ResourcePanelRemark      Resource = "panel_remark"
+	ResourceVendorAssignment Resource = "vendor_assignment"
+	ResourceBusbar           Resource = "busbar"
+	ResourceComponent        Resource = "component"
+	ResourcePalet            Resource = "palet"
+	ResourceCorepart         Resource = "corepart"
+	ResourceWiring           Resource = "wiring"
+	ResourceIssue            Resource = "issue"
+	ResourceIssueTitle       Resource = "issue_title"
+	ResourceComment          Resource = "comment"
+	ResourcePhoto            Resource = "photo"
+	ResourceChat             Resource = "chat"
+	ResourceAssistant        Resource = "assistant"
+	ResourceAdditionalSR     Resource = "additional_sr"
+	ResourceProductionSlot   Resource = "production_slot"
+	ResourceData             Resource = "data"
+	ResourceAudit            Resource = "audit"
+	ResourceTrash            Resource = "trash"
+	ResourceScorecard        Resource = "supplier_scorecard"
+	ResourceProject          Resource = "project"
+	ResourceCalendar         Resource = "calendar"
+	ResourceCalendarFeed     Resource = "calendar_feed"
+	ResourceNotification     Resource = "notification_outbox"
+	ResourceJobs             Resource = "scheduler_jobs"
+)
+
+const (
+	ActionAll      Action = "*"
+	ActionRead     Action = "read"
+	ActionCreate   Action = "create"
+	ActionUpdate   Action = "update"
+	ActionDelete   Action = "delete"
+	ActionTransfer Action = "transfer"
+	ActionImport   Action = "import"
+	ActionExport   Action = "export"
+)
+
+// Scope menentukan data mana yang boleh disentuh oleh sebuah aturan.
+const (
+	ScopeAll        = "all"
+	ScopeOwnCompany = "own_company" // hanya panel yang terlihat oleh company user (lihat panelScopeQuery)
+	ScopeSelf       = "self"        // hanya akun milik user sendiri
+)
+
+type policyRule struct {
+	Actions []Action `json:"actions"`
+	Scope   string   `json:"scope"`
+}
+
+type rolePolicy map[Resource]policyRule
+
+func allow(scope string, actions ...Action) policyRule {
+	return policyRule{Actions: actions, Scope: scope}
+}
+
+// vendorPolicy adalah hak dasar semua role vendor (k3, k5, g3, warehouse),
+// ditambah hak khusus per role.
+func vendorPolicy(extra rolePolicy) rolePolicy {
+	p := rolePolicy{
+		ResourceMe:               allow(ScopeAll, ActionRead, ActionUpdate),
+		ResourcePassword:         allow(ScopeSelf, ActionUpdate),
+		ResourceAccount:          allow(ScopeAll, ActionRead),
+		ResourceCompany:          allow(ScopeAll, ActionRead),
+		ResourcePanel:            allow(ScopeOwnCompany, ActionRead),
+		ResourcePanelRemark:      allow(ScopeOwnCompany, ActionUpdate),
+		ResourceVendorAssignment: allow(ScopeAll, ActionRead),
+		ResourceWiring:           allow(ScopeOwnCompany, ActionRead),
+		ResourceIssue:            allow(ScopeOwnCompany, ActionRead, ActionCreate, ActionUpdate),
+		ResourceIssueTitle:       allow(ScopeAll, ActionRead),
+		ResourceComment:          allow(ScopeOwnCompany, ActionRead, ActionCreate, ActionUpdate, ActionDelete),
+		ResourcePhoto:            allow(ScopeOwnCompany, ActionCreate, ActionDelete),
+		ResourceChat:             allow(ScopeOwnCompany, ActionRead, ActionCreate),
+		ResourceAssistant:        allow(ScopeOwnCompany, ActionCreate),
+		ResourceAdditionalSR:     allow(ScopeOwnCompany, ActionRead),
+		ResourceProductionSlot:   allow(ScopeAll, ActionRead),
+		ResourceProject:          allow(ScopeAll, ActionRead),
+		ResourceCalendar:         allow(ScopeAll, ActionRead),
+		ResourceCalendarFeed:     allow(ScopeAll, ActionRead, ActionCreate, ActionUpdate, ActionDelete),
+	}
+	for res, rule := range extra {
+		p[res] = rule
+	}
+	return p
+}
+
+var policyTable = map[string]rolePolicy{
+	AppRoleAdmin: {
+		ResourceAll: allow(ScopeAll, ActionAll),
+	},
+	AppRoleViewer: {
+		ResourceMe:               allow(ScopeAll, ActionRead, ActionUpdate),
+		ResourcePassword:         allow(ScopeSelf, ActionUpdate),
+		ResourceAccount:          allow(ScopeAll, ActionRead),
+		ResourceCompany:          allow(ScopeAll, ActionRead),
+		ResourcePanel:            allow(ScopeAll, ActionRead),
+		ResourceVendorAssignment: allow(ScopeAll, ActionRead),
+		ResourceWiring:           allow(ScopeAll, ActionRead),
+		ResourceIssue:            allow(ScopeAll, ActionRead),
+		ResourceIssueTitle:       allow(ScopeAll, ActionRead),
+		ResourceComment:          allow(ScopeAll, ActionRead),
+		ResourceChat:             allow(ScopeAll, ActionRead),
+		ResourceAssistant:        allow(ScopeAll, ActionCreate),
+		ResourceAdditionalSR:     allow(ScopeAll, ActionRead),
+		ResourceProductionSlot:   allow(ScopeAll, ActionRead),
+		ResourceData:             allow(ScopeAll, ActionExport),
+		ResourceAudit:            allow(ScopeAll, ActionRead),
+		ResourceScorecard:        allow(ScopeAll, ActionRead),
+		ResourceProject:          allow(ScopeAll, ActionRead),
+		ResourceCalendar:         allow(ScopeAll, ActionRead),
+		ResourceCalendarFeed:     allow(ScopeAll, ActionRead, ActionCreate, ActionUpdate, ActionDelete),
+	},
+	AppRoleK3: vendorPolicy(rolePolicy{
+		ResourcePalet:        allow(ScopeOwnCompany, ActionUpdate),
+		ResourceCorepart:     allow(ScopeOwnCompany, ActionUpdate),
+		ResourceAdditionalSR: allow(ScopeOwnCompany, ActionRead, ActionCreate, ActionUpdate),
+	}),
+	AppRoleK5: vendorPolicy(rolePolicy{
+		ResourceBusbar: allow(ScopeOwnCompany, ActionUpdate),
+	}),
+	AppRoleG3: vendorPolicy(rolePolicy{
+		ResourceWiring: allow(ScopeOwnCompany, ActionRead, ActionUpdate),
+	}),
+	AppRoleWarehouse: vendorPolicy(rolePolicy{
+		ResourceComponent:    allow(ScopeOwnCompany, ActionUpdate),
+		ResourceAdditionalSR: allow(ScopeOwnCompany, ActionRead, ActionCreate, ActionUpdate),
+	}),
+}
+
+type routePermission struct {
+	Resource Resource
+	Action   Action
+	// Unscoped dipakai untuk route yang memang harus bisa dipanggil
+	// tanpa panel yang terlihat, misalnya cek ketersediaan No PP.
+	Unscoped bool
+}
+
+// routePermissions memetakan "METHOD /template" ke izin yang dibutuhkan.
+// Route yang tidak terdaftar di sini akan ditolak oleh authorizeMiddleware.
+var routePermissions = map[string]routePermission{
+	"POST /logout":                                       {ResourceMe, ActionRead, false},
+	"GET /me/permissions":                                {ResourceMe, ActionRead, false},
+	"POST /user/register-device":                         {ResourceMe, ActionUpdate, false},
+	"GET /me/notifications":                              {ResourceMe, ActionRead, false},
+	"GET /me/notifications/unread-count":                 {ResourceMe, ActionRead, false},
+	"POST /me/notifications/read-all":                    {ResourceMe, ActionUpdate, false},
+	"POST /me/notifications/{id}/read":                   {ResourceMe, ActionUpdate, false},
+	"GET /me/notification-preferences":                   {ResourceMe, ActionRead, false},
+	"PUT /me/notification-preferences":                   {ResourceMe, ActionUpdate, false},
+	"GET /me/notification-subscriptions":                 {ResourceMe, ActionRead, false},
+	"PUT /me/notification-subscriptions":                 {ResourceMe, ActionUpdate, false},
+	"DELETE /me/notification-subscriptions/{scope}/{id}": {ResourceMe, ActionUpdate, false},
+
+	"GET /company-by-username/{username}":  {ResourceCompany, ActionRead, false},
+	"PUT /user/{username}/password":        {ResourcePassword, ActionUpdate, false},
+	"POST /company-with-account":           {ResourceAccount, ActionCreate, false},
+	"PUT /company-with-account/{username}": {ResourceAccount, ActionUpdate, false},
+	"DELETE /account/{username}":           {ResourceAccount, ActionDelete, false},
+	"GET /accounts":                        {ResourceAccount, ActionRead, false},
+	"GET /account/exists/{username}":       {ResourceAccount, ActionRead, false},
+	"GET /users/display":                   {ResourceAccount, ActionRead, false},
+	"GET /users/colleagues/display":        {ResourceAccount, ActionRead, false},
+	"GET /accounts/search":                 {ResourceAccount, ActionRead, false},
+	"GET /extract/panel/{no_pp}":           {ResourcePanel, ActionRead, false},
+
+	"POST /company":               {ResourceCompany, ActionCreate, false},
+	"GET /company/{id}":           {ResourceCompany, ActionRead, false},
+	"PUT /company/{id}":           {ResourceCompany, ActionUpdate, false},
+	"GET /companies":              {ResourceCompany, ActionRead, false},
+	"GET /company-by-name/{name}": {ResourceCompany, ActionRead, false},
+	"GET /vendors":                {ResourceCompany, ActionRead, false},
+	"GET /companies/form-data":    {ResourceCompany, ActionRead, false},
+
+	"GET /panels":                       {ResourcePanel, ActionRead, false},
+	"POST /panels":                      {ResourcePanel, ActionUpdate, false},
+	"POST /panel/status-ao-k5":          {ResourceBusbar, ActionUpdate, false},
+	"POST /panel/status-whs":            {ResourceComponent, ActionUpdate, false},
+	"POST /panels/import-custom":        {ResourcePanel, ActionImport, false},
+	"DELETE /panels/bulk-delete":        {ResourcePanel, ActionDelete, false},
+	"DELETE /panels/{no_pp}":            {ResourcePanel, ActionDelete, false},
+	"GET /panels/all":                   {ResourcePanel, ActionRead, false},
+	"GET /panels/keys":                  {ResourcePanel, ActionRead, false},
+	"GET /panel/{no_pp}":                {ResourcePanel, ActionRead, false},
+	"GET /panel/exists/no-pp/{no_pp}":   {ResourcePanel, ActionRead, true},
+	"PUT /panels/{old_no_pp}/change-pp": {ResourcePanel, ActionUpdate, false},
+	"POST /panel/remark-vendor":         {ResourcePanelRemark, ActionUpdate, false},
+	"GET /panels/{no_pp}/audit":         {ResourcePanel, ActionRead, false},
+	"GET /panels/{no_pp}/forecast":      {ResourcePanel, ActionRead, false},
+	"GET /audit":                        {ResourceAudit, ActionRead, false},
+	"GET /dashboard/summary":            {ResourcePanel, ActionRead, false},
+
+	"GET /trash":                      {ResourceTrash, ActionRead, false},
+	"POST /trash/{type}/{id}/restore": {ResourceTrash, ActionUpdate, false},
+	"DELETE /trash/{type}/{id}":       {ResourceTrash, ActionDelete, false},
+
+	"GET /calendars":                    {ResourceCalendar, ActionRead, false},
+	"POST /calendars":                   {ResourceCalendar, ActionCreate, false},
+	"GET /calendars/working-days":       {ResourceCalendar, ActionRead, false},
+	"GET /calendars/{id}":               {ResourceCalendar, ActionRead, false},
+	"PUT /calendars/{id}":               {ResourceCalendar, ActionUpdate, false},
+	"DELETE /calendars/{id}":            {ResourceCalendar, ActionDelete, false},
+	"POST /calendars/{id}/days":         {ResourceCalendar, ActionUpdate, false},
+	"DELETE /calendars/{id}/days/{day}": {ResourceCalendar, ActionUpdate, false},
+	"PUT /company/{id}/calendar":        {ResourceCalendar, ActionUpdate, false},
+
+	"GET /admin/notifications":              {ResourceNotification, ActionRead, false},
+	"GET /admin/notifications/{id}":         {ResourceNotification, ActionRead, false},
+	"POST /admin/notifications/replay":      {ResourceNotification, ActionUpdate, false},
+	"POST /admin/notifications/{id}/replay": {ResourceNotification, ActionUpdate, false},
+	"GET /admin/jobs":                       {ResourceJobs, ActionRead, false},
+
+	// Kepemilikan feed diperiksa di handler (lihat calendarFeedOwnerFilter).
+	"GET /calendar-feeds":              {ResourceCalendarFeed, ActionRead, false},
+	"POST /calendar-feeds":             {ResourceCalendarFeed, ActionCreate, false},
+	"POST /calendar-feeds/{id}/rotate": {ResourceCalendarFeed, ActionUpdate, false},
+	"DELETE /calendar-feeds/{id}":      {ResourceCalendarFeed, ActionDelete, false},
+
+	"GET /projects":             {ResourceProject, ActionRead, false},
+	"POST /projects":            {ResourceProject, ActionCreate, false},
+	"GET /projects/{id}":        {ResourceProject, ActionRead, false},
+	"PUT /projects/{id}":        {ResourceProject, ActionUpdate, false},
+	"DELETE /projects/{id}":     {ResourceProject, ActionDelete, false},
+	"POST /projects/{id}/merge": {ResourceProject, ActionUpdate, false},
+	// Antrean review berisi nama project dari semua company, jadi hanya untuk
+	// role yang boleh me-resolve-nya.
+	"GET /project-name-reviews":          {ResourceProject, ActionUpdate, false},
+	"POST /project-name-reviews/resolve": {ResourceProject, ActionUpdate, false},
+	"GET /projects/{id}/timeline":        {ResourceProject, ActionRead, false},
+	"GET /projects/{id}/wbs":             {ResourceProject, ActionRead, false},
+	"POST /projects/{id}/wbs":            {ResourceProject, ActionCreate, false},
+	"PUT /wbs/{id}":                      {ResourceProject, ActionUpdate, false},
+	"DELETE /wbs/{id}":                   {ResourceProject, ActionDelete, false},
+
+	"POST /busbar":               {ResourceVendorAssignment, ActionCreate, false},
+	"POST /component":            {ResourceVendorAssignment, ActionCreate, false},
+	"POST /palet":                {ResourceVendorAssignment, ActionCreate, false},
+	"POST /corepart":             {ResourceVendorAssignment, ActionCreate, false},
+	"DELETE /busbar":             {ResourceVendorAssignment, ActionDelete, false},
+	"DELETE /palet":              {ResourceVendorAssignment, ActionDelete, false},
+	"DELETE /corepart":           {ResourceVendorAssignment, ActionDelete, false},
+	"POST /busbar/remark-vendor": {ResourceBusbar, ActionUpdate, false},
+	"GET /busbars":               {ResourceVendorAssignment, ActionRead, false},
+	"GET /components":            {ResourceVendorAssignment, ActionRead, false},
+	"GET /palets":                {ResourceVendorAssignment, ActionRead, false},
+	"GET /coreparts":             {ResourceVendorAssignment, ActionRead, false},
+
+	"GET /export/filtered-data": {ResourceData, ActionExport, false},
+	"GET /export/custom":        {ResourceData, ActionExport, false},
+	"GET /export/database":      {ResourceData, ActionExport, false},
+	"POST /import/database":     {ResourceData, ActionImport, false},
+	"GET /import/template":      {ResourceData, ActionImport, false},
+	"POST /import/panels/mass":  {ResourcePanel, ActionImport, false},
+
+	"GET /issues/email-recommendations": {ResourceIssue, ActionRead, false},
+	"GET /panels/{no_pp}/issues":        {ResourceIssue, ActionRead, false},
+	"POST /panels/{no_pp}/issues":       {ResourceIssue, ActionCreate, false},
+	"GET /issues/{id}":                  {ResourceIssue, ActionRead, false},
+	"PUT /issues/{id}":                  {ResourceIssue, ActionUpdate, false},
+	"DELETE /issues/{id}":               {ResourceIssue, ActionDelete, false},
+	"GET /issue-titles":                 {ResourceIssueTitle, ActionRead, false},
+	"POST /issue-titles":                {ResourceIssueTitle, ActionCreate, false},
+	"PUT /issue-titles/{id}":            {ResourceIssueTitle, ActionUpdate, false},
+	"DELETE /issue-titles/{id}":         {ResourceIssueTitle, ActionDelete, false},
+
+	"POST /issues/{issue_id}/photos": {ResourcePhoto, ActionCreate, false},
+	"DELETE /photos/{id}":            {ResourcePhoto, ActionDelete, false},
+
+	"GET /chats/{chat_id}/messages":  {ResourceChat, ActionRead, false},
+	"POST /chats/{chat_id}/messages": {ResourceChat, ActionCreate, false},
+
+	"GET /issues/{issue_id}/comments":    {ResourceComment, ActionRead, false},
+	"POST /issues/{issue_id}/comments":   {ResourceComment, ActionCreate, false},
+	"POST /issues/{issue_id}/ask-gemini": {ResourceAssistant, ActionCreate, false},
+	"POST /panels/{no_pp}/ask-gemini":    {ResourceAssistant, ActionCreate, false},
+	"PUT /comments/{id}":                 {ResourceComment, ActionUpdate, false},
+	"DELETE /comments/{id}":              {ResourceComment, ActionDelete, false},
+
+	"GET /panel/{no_pp}/additional-sr":  {ResourceAdditionalSR, ActionRead, false},
+	"POST /panel/{no_pp}/additional-sr": {ResourceAdditionalSR, ActionCreate, false},
+	"PUT /additional-sr/{id}":           {ResourceAdditionalSR, ActionUpdate, false},
+	"DELETE /additional-sr/{id}":        {ResourceAdditionalSR, ActionDelete, false},
+	"GET /suppliers":                    {ResourceAdditionalSR, ActionRead, false},
+	"GET /suppliers/scorecards":         {ResourceScorecard, ActionRead, false},
+
+	"GET /production-slots":                      {ResourceProductionSlot, ActionRead, false},
+	"GET /production-slots/reservations":         {ResourceProductionSlot, ActionRead, false},
+	"POST /production-slots/reservations":        {ResourceProductionSlot, ActionCreate, false},
+	"PUT /production-slots/reservations/{id}":    {ResourceProductionSlot, ActionUpdate, false},
+	"DELETE /production-slots/reservations/{id}": {ResourceProductionSlot, ActionDelete, false},
+	"GET /production-slots/timeline":             {ResourceProductionSlot, ActionRead, false},
+	"GET /production-slots/forecast":             {ResourceProductionSlot, ActionRead, false},
+	"POST /production-slots/suggest":             {ResourceProductionSlot, ActionCreate, false},
+	"GET /production-slots/assignments":          {ResourceProductionSlot, ActionRead, false},
+	"GET /production-slots/utilization":          {ResourceProductionSlot, ActionRead, false},
+	"GET /production-slots/dwell-time":           {ResourceProductionSlot, ActionRead, false},
+	"POST /panels/{no_pp}/transfer":              {ResourcePanel, ActionTransfer, false},
+	"POST /mass-transfer-panel":                  {ResourcePanel, ActionTransfer, false},
+	"GET /workflow":                              {ResourcePanel, ActionRead, false},
+	"GET /panels/{no_pp}/workflow":               {ResourcePanel, ActionRead, false},
+
+	"POST /wirings":                       {ResourceWiring, ActionCreate, false},
+	"GET /wirings/{panel_no_pp}":          {ResourceWiring, ActionRead, false},
+	"PUT /wirings/{id}":                   {ResourceWiring, ActionUpdate, false},
+	"DELETE /wirings/{id}":                {ResourceWiring, ActionDelete, false},
+	"POST /wirings/mass-upload":           {ResourceWiring, ActionImport, false},
+	"POST /wirings/mass-replace":          {ResourceWiring, ActionImport, false},
+	"GET /panels/{no_pp}/wiring-progress": {ResourceWiring, ActionRead, false},
+}
+
+// panelByIDQueries dipakai untuk mencari panel dari route yang hanya
+// membawa {id} milik resource turunan panel.
+var panelByIDQueries = map[Resource]string{
+	ResourceIssue:        "SELECT c.panel_no_pp FROM issues i JOIN chats c ON c.id = i.chat_id WHERE i.id::text = $1",
+	ResourceComment:      "SELECT c.panel_no_pp FROM issue_comments ic JOIN issues i ON i.id = ic.issue_id JOIN chats c ON c.id = i.chat_id WHERE ic.id = $1",
+	ResourcePhoto:        "SELECT c.panel_no_pp FROM photos ph JOIN issues i ON i.id = ph.issue_id JOIN chats c ON c.id = i.chat_id WHERE ph.id::text = $1",
+	ResourceAdditionalSR: "SELECT panel_no_pp FROM additional_sr WHERE id::text = $1",
+	ResourceWiring:       "SELECT panel_no_pp FROM wirings WHERE id::text = $1",
+}
+
+var errForbidden = errors.New("Anda tidak memiliki akses untuk aksi ini")
+
+func (p rolePolicy) rule(res Resource, act Action) (policyRule, bool) {
+	for _, key := range []Resource{res, ResourceAll} {
+		rule, ok := p[key]
+		if !ok {
+			continue
+		}
+		for _, a := range rule.Actions {
+			if a == act || a == ActionAll {
+				return rule, true
+			}
+		}
+	}
+	return policyRule{}, false
+}
+
+func roleCan(role string, res Resource, act Action) bool {
+	_, ok := policyTable[role].rule(res, act)
+	return ok
+}
+
+func (a *App) canAccessPanel(id Identity, noPp string) (bool, error) {
+	return panelVisibleTo(a.DB, id.Role, id.CompanyID, noPp)
+}
+
+// panelVisibleTo sama dengan canAccessPanel tetapi memakai db yang diberikan,
+// supaya bisa dipanggil di dalam transaksi (mis. saat enqueue notifikasi).
+func panelVisibleTo(db DBTX, role, companyID, noPp string) (bool, error) {
+	scopeQuery, args, ok := panelScopeQuery(role, companyID)
+	if !ok {
+		return false, nil
+	}
+	args = append(args, noPp)
+	query := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM (%s) AS visible(no_pp) WHERE visible.no_pp = $%d)", scopeQuery, len(args))
+	var visible bool
+	err := db.QueryRow(query, args...).Scan(&visible)
+	return visible, err
+}
+
+// authorize memeriksa policyTable untuk identity tertentu. panelNoPp dan
+// username hanya dipakai bila aturan yang cocok punya scope terbatas;
+// string kosong berarti target tidak diketahui (misalnya endpoint list,
+// yang sudah memfilter datanya sendiri) dan hanya lolos untuk ActionRead.
+func (a *App) authorize(id Identity, res Resource, act Action, panelNoPp, username string) error {
+	rule, ok := policyTable[id.Role].rule(res, act)
+	if !ok {
+		return errForbidden
+	}
+	switch rule.Scope {
+	case ScopeOwnCompany:
+		// Tanpa panel target hanya read yang diizinkan (endpoint list sudah
+		// memfilter datanya sendiri); aksi tulis ditolak supaya tidak fail-open.
+		if panelNoPp == "" {
+			if act == ActionRead {
+				return nil
+			}
+			return errForbidden
+		}
+		visible, err := a.canAccessPanel(id, panelNoPp)
+		if err != nil {
+			return err
+		}
+		if !visible {
+			return errForbidden
+		}
+	case ScopeSelf:
+		if username != "" && username != id.Username {
+			return errForbidden
+		}
+	}
+	return nil
+}
+
+// panelFromRequest mencari No PP yang menjadi target request, dari
+// variabel route atau dari body JSON (panel_no_pp / no_pp).
+func (a *App) panelFromRequest(r *http.Request, res Resource) (string, error) {
+	vars := mux.Vars(r)
+	for _, key := range []string{"no_pp", "old_no_pp", "panel_no_pp"} {
+		if v := vars[key]; v != "" {
+			return v, nil
+		}
+	}
+
+	var lookup, arg string
+	switch {
+	case vars["issue_id"] != "":
+		lookup, arg = panelByIDQueries[ResourceIssue], vars["issue_id"]
+	case vars["chat_id"] != "":
+		lookup, arg = "SELECT panel_no_pp FROM chats WHERE id::text = $1", vars["chat_id"]
+	case vars["id"] != "" && panelByIDQueries[res] != "":
+		lookup, arg = panelByIDQueries[res], vars["id"]
+	}
+	if lookup != "" {
+		var noPp string
+		err := a.DB.QueryRow(lookup, arg).Scan(&noPp)
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return noPp, err
+	}
+
+	if r.Body == nil || (r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodDelete) {
+		return "", nil
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	var target struct {
+		PanelNoPp string `json:"panel_no_pp"`
+		NoPp      string `json:"no_pp"`
+	}
+	if json.Unmarshal(body, &target) == nil {
+		if target.PanelNoPp != "" {
+			return target.PanelNoPp, nil
+		}
+		return target.NoPp, nil
+	}
+	return "", nil
+}
+
+func (a *App) authorizeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, authenticated := identityFromContext(r.Context())
+		route := mux.CurrentRoute(r)
+		if !authenticated || route == nil || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		template, _ := route.GetPathTemplate()
+		perm, ok := routePermissions[r.Method+" "+template]
+		if !ok {
+			log.Printf("Route %s %s belum terdaftar di routePermissions, akses ditolak", r.Method, template)
+			respondWithError(w, http.StatusForbidden, errForbidden.Error())
+			return
+		}
+
+		rule, allowed := policyTable[id.Role].rule(perm.Resource, perm.Action)
+		if !allowed {
+			respondWithError(w, http.StatusForbidden, errForbidden.Error())
+			return
+		}
+
+		var panelNoPp, username string
+		switch {
+		case rule.Scope == ScopeOwnCompany && !perm.Unscoped:
+			var err error
+			panelNoPp, err = a.panelFromRequest(r, perm.Resource)
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Gagal memeriksa akses: "+err.Error())
+				return
+			}
+		case rule.Scope == ScopeSelf:
+			username = mux.Vars(r)["username"]
+		}
+
+		if err := a.authorize(id, perm.Resource, perm.Action, panelNoPp, username); err != nil {
+			if errors.Is(err, errForbidden) {
+				respondWithError(w, http.StatusForbidden, err.Error())
+			} else {
+				respondWithError(w, http.StatusInternalServerError, "Gagal memeriksa akses: "+err.Error())
+			}
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type resourcePermission struct {
+	Resource Resource `json:"resource"`
+	Actions  []Action `json:"actions"`
+	Scope    string   `json:"scope"`
+}
+
+func (a *App) getMyPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	id := requestIdentity(r)
+	policy := policyTable[id.Role]
+
+	var permissions []resourcePermission
+	for res, rule := range policy {
+		permissions = append(permissions, resourcePermission{Resource: res, Actions: rule.Actions, Scope: rule.Scope})
+	}
+	sort.Slice(permissions, func(i, j int) bool { return permissions[i].Resource < permissions[j].Resource })
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"username":     id.Username,
+		"company_id":   id.CompanyID,
+		"company_name": id.CompanyName,
+		"role":         id.Role,
+		"permissions":  permissions,
+	})
+}
+
+// geminiToolPermissions memetakan function calling Gemini ke izin yang sama
+// dengan endpoint REST-nya, supaya AI tidak bisa melakukan lebih dari user.
+var geminiToolPermissions = map[string]routePermission{
+	"get_panel_summary":        {ResourcePanel, ActionRead, false},
+	"get_issue_explanation":    {ResourceIssue, ActionRead, false},
+	"find_related_issues":      {ResourceIssue, ActionRead, false},
+	"find_similar_past_issues": {ResourceIssue, ActionRead, false},
+	"update_issue_status":      {ResourceIssue, ActionUpdate, false},
+	"add_issue_comment":        {ResourceComment, ActionCreate, false},
+	"update_panel_progress":    {ResourcePanel, ActionUpdate, false},
+	"update_panel_remark":      {ResourcePanelRemark, ActionUpdate, false},
+	"assign_vendor":            {ResourceVendorAssignment, ActionCreate, false},
+	"assign_vendor_to_panel":   {ResourceVendorAssignment, ActionCreate, false},
+	"update_busbar_status":     {ResourceBusbar, ActionUpdate, false},
+	"update_component_status":  {ResourceComponent, ActionUpdate, false},
+	"update_palet_status":      {ResourcePalet, ActionUpdate, false},
+	"update_corepart_status":   {ResourceCorepart, ActionUpdate, false},
+}
+
+func filterToolsForRole(tools []*genai.Tool, role string) []*genai.Tool {
+	var filtered []*genai.Tool
+	for _, tool := range tools {
+		var decls []*genai.FunctionDeclaration
+		for _, fd := range tool.FunctionDeclarations {
+			if perm, ok := geminiToolPermissions[fd.Name]; ok && roleCan(role, perm.Resource, perm.Action) {
+				decls = append(decls, fd)
+			}
+		}
+		if len(decls) > 0 {
+			filtered = append(filtered, &genai.Tool{FunctionDeclarations: decls})
+		}
+	}
+	return filtered
+}
+
+func (a *App) authorizeGeminiCall(fc genai.FunctionCall, panelNoPp string, caller Identity) error {
+	perm, ok := geminiToolPermissions[fc.Name]
+	if !ok {
+		return fmt.Errorf("fungsi tidak dikenal: %s", fc.Name)
+	}
+	target := panelNoPp
+	if issueID, ok := fc.Args["issue_id"].(float64); ok {
+		var issuePanel string
+		err := a.DB.QueryRow(panelByIDQueries[ResourceIssue], strconv.Itoa(int(issueID))).Scan(&issuePanel)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if issuePanel != "" {
+			target = issuePanel
+		}
+	}
+	return a.authorize(caller, perm.Resource, perm.Action, target, "")
+}
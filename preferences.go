@@ -0,0 +1,591 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Preferensi notifikasi per user (lihat migrasi 0017_notification_preferences).
+// Semua notifikasi melewati planNotificationDelivery di enqueueNotification,
+// jadi handler tidak perlu tahu preferensi penerimanya.
+
+const (
+	NotifChannelPush  = "push"
+	NotifChannelEmail = "email"
+	NotifChannelInApp = "inapp"
+)
+
+// notificationEvents: event yang bisa diatur user. "*" berarti semua event.
+var notificationEvents = []string{
+	"panel.created", "panel.updated", "panel.due_today", "panel.overdue",
+	"issue.created", "issue.status_changed", "issue.notify_added", "issue.comment",
+	"additional_sr.created", "additional_sr.updated",
+}
+
+var notificationChannels = map[string]bool{NotifChannelPush: true, NotifChannelEmail: true, NotifChannelInApp: true}
+
+func isNotificationEvent(event string) bool {
+	if event == "*" {
+		return true
+	}
+	for _, e := range notificationEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// recipientPreference adalah preferensi efektif satu user untuk satu event.
+type recipientPreference struct {
+	Username   string
+	Address    string // alamat email; kosong bila tidak diketahui
+	TimeZone   string
+	QuietStart string // "HH:MM"
+	QuietEnd   string
+	Digest     string
+	Language   string
+	Push       bool
+	Email      bool
+	InApp      bool
+	Muted      bool
+}
+
+const prefChannelEnabled = `COALESCE((SELECT ep.enabled FROM notification_event_preferences ep
+		WHERE ep.username = ca.username AND ep.channel = '%s' AND ep.event IN ($2, '*')
+		ORDER BY ep.event = '*' LIMIT 1), true)`
+
+// loadRecipientPreferences hanya mengembalikan username yang terdaftar;
+// alamat email biasa tidak punya preferensi.
+func loadRecipientPreferences(db DBTX, usernames []string, event, panelNoPp string) (map[string]recipientPreference, error) {
+	prefs := map[string]recipientPreference{}
+	if len(usernames) == 0 {
+		return prefs, nil
+	}
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT ca.username,
+			COALESCE(NULLIF(np.email, ''), CASE WHEN ca.username LIKE '%%@%%' THEN ca.username ELSE '' END),
+			COALESCE(np.timezone, ''),
+			COALESCE(to_char(np.quiet_start, 'HH24:MI'), ''), COALESCE(to_char(np.quiet_end, 'HH24:MI'), ''),
+			COALESCE(np.digest, 'off'), COALESCE(np.language, ''),
+			%s, %s, %s,
+			COALESCE((SELECT s.mode = 'mute' FROM notification_subscriptions s
+				WHERE s.username = ca.username AND (
+					(s.scope = 'panel' AND s.scope_id = $3) OR
+					(s.scope = 'project' AND s.scope_id = (SELECT p.project_id::text FROM panels p WHERE p.no_pp = $3)))
+				ORDER BY s.scope = 'panel' DESC LIMIT 1), false)
+		FROM company_accounts ca
+		LEFT JOIN notification_preferences np ON np.username = ca.username
+		WHERE ca.username = ANY($1)`,
+		fmt.Sprintf(prefChannelEnabled, NotifChannelPush),
+		fmt.Sprintf(prefChannelEnabled, NotifChannelEmail),
+		fmt.Sprintf(prefChannelEnabled, NotifChannelInApp)),
+		pq.Array(usernames), event, panelNoPp)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p recipientPreference
+		if err := rows.Scan(&p.Username, &p.Address, &p.TimeZone, &p.QuietStart, &p.QuietEnd, &p.Digest,
+			&p.Language, &p.Push, &p.Email, &p.InApp, &p.Muted); err != nil {
+			return nil, err
+		}
+		prefs[p.Username] = p
+	}
+	return prefs, rows.Err()
+}
+
+func (p recipientPreference) location() *time.Location {
+	if p.TimeZone != "" {
+		if loc, err := time.LoadLocation(p.TimeZone); err == nil {
+			return loc
+		}
+	}
+	return defaultCalendar().loc
+}
+
+func parseClock(s string) (int, bool) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// quietUntil mengembalikan akhir quiet hours bila now berada di dalamnya,
+// atau zero time. Rentang boleh melewati tengah malam (22:00-06:00).
+func (p recipientPreference) quietUntil(now time.Time) time.Time {
+	start, okStart := parseClock(p.QuietStart)
+	end, okEnd := parseClock(p.QuietEnd)
+	if !okStart || !okEnd || start == end {
+		return time.Time{}
+	}
+	loc := p.location()
+	local := now.In(loc)
+	cur := local.Hour()*60 + local.Minute()
+	endAt := func(days int) time.Time {
+		return time.Date(local.Year(), local.Month(), local.Day()+days, end/60, end%60, 0, 0, loc)
+	}
+	switch {
+	case start < end && cur >= start && cur < end:
+		return endAt(0)
+	case start > end && cur >= start:
+		return endAt(1)
+	case start > end && cur < end:
+		return endAt(0)
+	}
+	return time.Time{}
+}
+
+type deliveryBatch struct {
+	At         time.Time // zero berarti segera
+	Recipients []string
+}
+
+// emailBatch: penerima email dengan bahasa template yang sama.
+type emailBatch struct {
+	Lang       string
+	Recipients []string
+}
+
+// deliveryPlan adalah hasil penerapan preferensi pada satu outboxMessage.
+type deliveryPlan struct {
+	Push   []deliveryBatch
+	Emails []emailBatch
+	Digest []string // username yang emailnya ditahan untuk digest
+	Inbox  []string
+}
+
+func uniqueStrings(lists ...[]string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, list := range lists {
+		for _, s := range list {
+			if s != "" && !seen[s] {
+				seen[s] = true
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+// planNotificationDelivery menerapkan mute, preferensi event/channel, quiet
+// hours (hanya push, ditunda sampai quiet hours selesai) dan digest (hanya
+// email). Penerima yang bukan akun terdaftar dikirimi seperti biasa.
+func planNotificationDelivery(db DBTX, m outboxMessage, now time.Time) (deliveryPlan, error) {
+	var plan deliveryPlan
+	users := uniqueStrings(m.Users)
+	emails := uniqueStrings(m.Emails)
+	prefs, err := loadRecipientPreferences(db, uniqueStrings(users, emails), m.Event, m.Data["panel_no_pp"])
+	if err != nil {
+		return plan, err
+	}
+
+	batches := map[time.Time][]string{}
+	for _, u := range users {
+		at := time.Time{}
+		if p, ok := prefs[u]; ok {
+			if p.Muted || !p.Push {
+				continue
+			}
+			at = p.quietUntil(now)
+		}
+		batches[at] = append(batches[at], u)
+	}
+	times := make([]time.Time, 0, len(batches))
+	for at := range batches {
+		times = append(times, at)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	for _, at := range times {
+		plan.Push = append(plan.Push, deliveryBatch{At: at, Recipients: batches[at]})
+	}
+
+	byLang := map[string][]string{}
+	for _, e := range emails {
+		p, ok := prefs[e]
+		switch {
+		case !ok:
+			lang := defaultEmailLanguage()
+			byLang[lang] = append(byLang[lang], e)
+		case p.Muted || !p.Email:
+		case p.Digest != "off":
+			plan.Digest = append(plan.Digest, e)
+		case p.Address != "":
+			lang := emailLanguage(p.Language)
+			byLang[lang] = append(byLang[lang], p.Address)
+		}
+	}
+	langs := make([]string, 0, len(byLang))
+	for lang := range byLang {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	for _, lang := range langs {
+		plan.Emails = append(plan.Emails, emailBatch{Lang: lang, Recipients: uniqueStrings(byLang[lang])})
+	}
+
+	for _, u := range uniqueStrings(users, emails) {
+		if p, ok := prefs[u]; ok && p.InApp {
+			plan.Inbox = append(plan.Inbox, u)
+		}
+	}
+	return plan, nil
+}
+
+// panelSubscribers: user yang subscribe ke panel atau project panel tersebut.
+// Subscription project tidak menjamin user boleh melihat setiap panel di
+// dalamnya, jadi visibilitas panel diperiksa ulang per user.
+func panelSubscribers(db DBTX, panelNoPp string) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT s.username, c.role, ca.company_id
+		FROM notification_subscriptions s
+		JOIN company_accounts ca ON ca.username = s.username
+		JOIN companies c ON c.id = ca.company_id
+		WHERE s.mode = 'subscribe' AND (
+			(s.scope = 'panel' AND s.scope_id = $1) OR
+			(s.scope = 'project' AND s.scope_id = (SELECT project_id::text FROM panels WHERE no_pp = $1)))`, panelNoPp)
+	if err != nil {
+		return nil, err
+	}
+	type subscriber struct{ username, role, companyID string }
+	var candidates []subscriber
+	for rows.Next() {
+		var s subscriber
+		if err := rows.Scan(&s.username, &s.role, &s.companyID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var users []string
+	for _, s := range candidates {
+		visible, err := panelVisibleTo(db, s.role, s.companyID, panelNoPp)
+		if err != nil {
+			return nil, err
+		}
+		if visible {
+			users = append(users, s.username)
+		}
+	}
+	return users, nil
+}
+
+func queueDigestItems(db DBTX, m outboxMessage, usernames []string, data []byte) error {
+	if len(usernames) == 0 {
+		return nil
+	}
+	title, body := m.Title, m.Body
+	if title == "" {
+		title = m.Subject
+	}
+	_, err := db.Exec(`
+		INSERT INTO notification_digest_items (username, event, title, body, data)
+		SELECT u, $2, $3, $4, $5 FROM unnest($1::text[]) u`,
+		pq.Array(usernames), m.Event, title, body, data)
+	return err
+}
+
+type NotificationEventPreference struct {
+	Event   string `json:"event"`
+	Channel string `json:"channel"`
+	Enabled bool   `json:"enabled"`
+}
+
+type NotificationPreferences struct {
+	Email      *string `json:"email"`
+	TimeZone   *string `json:"timezone"`
+	QuietStart *string `json:"quiet_start"`
+	QuietEnd   *string `json:"quiet_end"`
+	Language   *string `json:"language"`
+	Digest     string  `json:"digest"`
+	DigestHour int     `json:"digest_hour"`
+	// DigestWeekday hanya dipakai digest mingguan: 1 = Senin ... 7 = Minggu.
+	DigestWeekday int                           `json:"digest_weekday"`
+	DigestXlsx    bool                          `json:"digest_xlsx"`
+	Events        []NotificationEventPreference `json:"events"`
+}
+
+func (a *App) loadNotificationPreferences(username string) (NotificationPreferences, error) {
+	p := NotificationPreferences{Digest: "off", DigestHour: 7, DigestWeekday: 1, Events: []NotificationEventPreference{}}
+	err := a.DB.QueryRow(`
+		SELECT email, timezone, to_char(quiet_start, 'HH24:MI'), to_char(quiet_end, 'HH24:MI'), language,
+			digest, digest_hour, digest_weekday, digest_xlsx
+		FROM notification_preferences WHERE username = $1`, username).
+		Scan(&p.Email, &p.TimeZone, &p.QuietStart, &p.QuietEnd, &p.Language,
+			&p.Digest, &p.DigestHour, &p.DigestWeekday, &p.DigestXlsx)
+	if err != nil && err != sql.ErrNoRows {
+		return p, err
+	}
+	rows, err := a.DB.Query(`SELECT event, channel, enabled FROM notification_event_preferences
+		WHERE username = $1 ORDER BY event, channel`, username)
+	if err != nil {
+		return p, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ep NotificationEventPreference
+		if err := rows.Scan(&ep.Event, &ep.Channel, &ep.Enabled); err != nil {
+			return p, err
+		}
+		p.Events = append(p.Events, ep)
+	}
+	return p, rows.Err()
+}
+
+func (a *App) getMyNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	prefs, err := a.loadNotificationPreferences(requestIdentity(r).Username)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil preferensi notifikasi: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"preferences":      prefs,
+		"available_events": notificationEvents,
+		"channels":         []string{NotifChannelPush, NotifChannelEmail, NotifChannelInApp},
+	})
+}
+
+// updateMyNotificationPreferencesHandler: field yang tidak dikirim tidak
+// diubah; string kosong menghapus nilai (mis. mematikan quiet hours). events
+// di-upsert per (event, channel).
+func (a *App) updateMyNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Email         *string                       `json:"email"`
+		TimeZone      *string                       `json:"timezone"`
+		QuietStart    *string                       `json:"quiet_start"`
+		QuietEnd      *string                       `json:"quiet_end"`
+		Language      *string                       `json:"language"`
+		Digest        *string                       `json:"digest"`
+		DigestHour    *int                          `json:"digest_hour"`
+		DigestWeekday *int                          `json:"digest_weekday"`
+		DigestXlsx    *bool                         `json:"digest_xlsx"`
+		Events        []NotificationEventPreference `json:"events"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid payload: "+err.Error())
+		return
+	}
+	if payload.Email != nil && *payload.Email != "" && !strings.Contains(*payload.Email, "@") {
+		respondWithError(w, http.StatusBadRequest, "Email tidak valid")
+		return
+	}
+	if payload.TimeZone != nil && *payload.TimeZone != "" {
+		if _, err := time.LoadLocation(*payload.TimeZone); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Zona waktu tidak dikenal: "+*payload.TimeZone)
+			return
+		}
+	}
+	for _, t := range []*string{payload.QuietStart, payload.QuietEnd} {
+		if t != nil && *t != "" {
+			if _, ok := parseClock(*t); !ok {
+				respondWithError(w, http.StatusBadRequest, "Quiet hours harus berformat HH:MM")
+				return
+			}
+		}
+	}
+	if payload.Language != nil && *payload.Language != "" && !emailLanguages[*payload.Language] {
+		respondWithError(w, http.StatusBadRequest, "language harus 'id' atau 'en'")
+		return
+	}
+	if payload.Digest != nil && *payload.Digest != "off" && *payload.Digest != "daily" && *payload.Digest != "weekly" {
+		respondWithError(w, http.StatusBadRequest, "digest harus 'off', 'daily' atau 'weekly'")
+		return
+	}
+	if payload.DigestHour != nil && (*payload.DigestHour < 0 || *payload.DigestHour > 23) {
+		respondWithError(w, http.StatusBadRequest, "digest_hour harus 0-23")
+		return
+	}
+	if payload.DigestWeekday != nil && (*payload.DigestWeekday < 1 || *payload.DigestWeekday > 7) {
+		respondWithError(w, http.StatusBadRequest, "digest_weekday harus 1 (Senin) sampai 7 (Minggu)")
+		return
+	}
+	for _, ep := range payload.Events {
+		if !isNotificationEvent(ep.Event) || !notificationChannels[ep.Channel] {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Preferensi tidak dikenal: %s/%s", ep.Event, ep.Channel))
+			return
+		}
+	}
+
+	username := requestIdentity(r).Username
+	tx, err := a.DB.Begin()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memulai transaksi: "+err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	nullable := func(s *string) interface{} {
+		if s == nil || *s == "" {
+			return nil
+		}
+		return *s
+	}
+	// Digest pertama mencakup data sejak digest diaktifkan, bukan sejak
+	// jadwal terdekat sebelumnya.
+	_, err = tx.Exec(`
+		INSERT INTO notification_preferences (username, email, timezone, quiet_start, quiet_end, digest, digest_hour,
+			language, digest_weekday, digest_xlsx, last_digest_at)
+		VALUES ($1, $3, $5, $7::time, $9::time, COALESCE($10, 'off'), COALESCE($11, 7),
+			$13, COALESCE($14, 1), COALESCE($15, false), CASE WHEN COALESCE($10, 'off') <> 'off' THEN NOW() END)
+		ON CONFLICT (username) DO UPDATE SET
+			email = CASE WHEN $2 THEN EXCLUDED.email ELSE notification_preferences.email END,
+			timezone = CASE WHEN $4 THEN EXCLUDED.timezone ELSE notification_preferences.timezone END,
+			quiet_start = CASE WHEN $6 THEN EXCLUDED.quiet_start ELSE notification_preferences.quiet_start END,
+			quiet_end = CASE WHEN $8 THEN EXCLUDED.quiet_end ELSE notification_preferences.quiet_end END,
+			language = CASE WHEN $12 THEN EXCLUDED.language ELSE notification_preferences.language END,
+			digest = COALESCE($10, notification_preferences.digest),
+			digest_hour = COALESCE($11, notification_preferences.digest_hour),
+			digest_weekday = COALESCE($14, notification_preferences.digest_weekday),
+			digest_xlsx = COALESCE($15, notification_preferences.digest_xlsx),
+			last_digest_at = CASE WHEN COALESCE($10, notification_preferences.digest) <> 'off'
+				THEN COALESCE(notification_preferences.last_digest_at, NOW()) END,
+			updated_at = NOW()`,
+		username,
+		payload.Email != nil, nullable(payload.Email),
+		payload.TimeZone != nil, nullable(payload.TimeZone),
+		payload.QuietStart != nil, nullable(payload.QuietStart),
+		payload.QuietEnd != nil, nullable(payload.QuietEnd),
+		payload.Digest, payload.DigestHour,
+		payload.Language != nil, nullable(payload.Language),
+		payload.DigestWeekday, payload.DigestXlsx)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menyimpan preferensi notifikasi: "+err.Error())
+		return
+	}
+	for _, ep := range payload.Events {
+		_, err := tx.Exec(`
+			INSERT INTO notification_event_preferences (username, event, channel, enabled) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (username, event, channel) DO UPDATE SET enabled = EXCLUDED.enabled`,
+			username, ep.Event, ep.Channel, ep.Enabled)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal menyimpan preferensi event: "+err.Error())
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal commit transaksi")
+		return
+	}
+	a.getMyNotificationPreferencesHandler(w, r)
+}
+
+type NotificationSubscription struct {
+	Scope     string    `json:"scope"`
+	ID        string    `json:"id"`
+	Mode      string    `json:"mode"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (a *App) getMyNotificationSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.DB.Query(`SELECT scope, scope_id, mode, created_at FROM notification_subscriptions
+		WHERE username = $1 ORDER BY scope, scope_id`, requestIdentity(r).Username)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil subscription: "+err.Error())
+		return
+	}
+	defer rows.Close()
+	subs := []NotificationSubscription{}
+	for rows.Next() {
+		var s NotificationSubscription
+		if err := rows.Scan(&s.Scope, &s.ID, &s.Mode, &s.CreatedAt); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal membaca subscription: "+err.Error())
+			return
+		}
+		subs = append(subs, s)
+	}
+	respondWithJSON(w, http.StatusOK, subs)
+}
+
+// putMyNotificationSubscriptionHandler: subscribe atau mute satu panel atau
+// project. Panel harus terlihat oleh user (lihat canAccessPanel).
+func (a *App) putMyNotificationSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	var s NotificationSubscription
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid payload: "+err.Error())
+		return
+	}
+	if s.Mode != "subscribe" && s.Mode != "mute" {
+		respondWithError(w, http.StatusBadRequest, "mode harus 'subscribe' atau 'mute'")
+		return
+	}
+	id := requestIdentity(r)
+	switch s.Scope {
+	case "panel":
+		visible, err := a.canAccessPanel(id, s.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal memeriksa panel: "+err.Error())
+			return
+		}
+		if !visible {
+			respondWithError(w, http.StatusNotFound, "Panel tidak ditemukan")
+			return
+		}
+	case "project":
+		// Selain admin/viewer, user hanya boleh subscribe ke project yang
+		// punya minimal satu panel yang terlihat olehnya.
+		query := "SELECT EXISTS (SELECT 1 FROM projects WHERE id::text = $1)"
+		args := []interface{}{s.ID}
+		if id.Role != AppRoleAdmin && id.Role != AppRoleViewer {
+			scopeQuery, scopeArgs, ok := panelScopeQuery(id.Role, id.CompanyID)
+			if !ok {
+				respondWithError(w, http.StatusNotFound, "Project tidak ditemukan")
+				return
+			}
+			args = append(scopeArgs, s.ID)
+			query = fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM panels p
+				WHERE p.project_id::text = $%d AND p.deleted_at IS NULL AND p.no_pp IN (%s))`, len(args), scopeQuery)
+		}
+		var exists bool
+		if err := a.DB.QueryRow(query, args...).Scan(&exists); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal memeriksa project: "+err.Error())
+			return
+		}
+		if !exists {
+			respondWithError(w, http.StatusNotFound, "Project tidak ditemukan")
+			return
+		}
+	default:
+		respondWithError(w, http.StatusBadRequest, "scope harus 'panel' atau 'project'")
+		return
+	}
+	err := a.DB.QueryRow(`
+		INSERT INTO notification_subscriptions (username, scope, scope_id, mode) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (username, scope, scope_id) DO UPDATE SET mode = EXCLUDED.mode
+		RETURNING created_at`, id.Username, s.Scope, s.ID, s.Mode).Scan(&s.CreatedAt)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menyimpan subscription: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, s)
+}
+
+func (a *App) deleteMyNotificationSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	res, err := a.DB.Exec(`DELETE FROM notification_subscriptions WHERE username = $1 AND scope = $2 AND scope_id = $3`,
+		requestIdentity(r).Username, vars["scope"], vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menghapus subscription: "+err.Error())
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusNotFound, "Subscription tidak ditemukan")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
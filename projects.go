@@ -0,0 +1,953 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Project dan WbsElement adalah master data untuk panels.project dan
+// panels.no_wbs (lihat migrasi 0011_projects). Teks di panels disinkronkan
+// trigger sync_panel_project, jadi rename di sini cukup mengubah teks panel.
+// Nama project yang belum dikenal masuk antrean project_name_reviews
+// (migrasi 0019) dan tidak membuat project baru.
+
+type Project struct {
+	ID                   int            `json:"id"`
+	Name                 string         `json:"name"`
+	Customer             *string        `json:"customer"`
+	ProjectManager       *string        `json:"project_manager"`
+	ContractDate         *string        `json:"contract_date"`
+	ContractDeliveryDate *string        `json:"contract_delivery_date"`
+	Notes                *string        `json:"notes"`
+	CreatedBy            *string        `json:"created_by,omitempty"`
+	CreatedAt            time.Time      `json:"created_at"`
+	UpdatedAt            time.Time      `json:"updated_at"`
+	Rollup               *ProjectRollup `json:"rollup,omitempty"`
+}
+
+type WbsElement struct {
+	ID          int            `json:"id"`
+	ProjectID   *int           `json:"project_id"`
+	Code        string         `json:"code"`
+	Description *string        `json:"description"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	Rollup      *ProjectRollup `json:"rollup,omitempty"`
+}
+
+type ProjectRollup struct {
+	PanelCount     int        `json:"panel_count"`
+	ClosedCount    int        `json:"closed_count"`
+	OverdueCount   int        `json:"overdue_count"`
+	AvgProgress    float64    `json:"avg_progress"`
+	NextDelivery   *time.Time `json:"next_delivery"`
+	OpenIssues     int        `json:"open_issues"`
+	UpcomingPanels []string   `json:"upcoming_panels,omitempty"`
+}
+
+const projectColumns = `pr.id, pr.name, pr.customer, pr.project_manager,
+	to_char(pr.contract_date, 'YYYY-MM-DD'), to_char(pr.contract_delivery_date, 'YYYY-MM-DD'),
+	pr.notes, pr.created_by, pr.created_at, pr.updated_at`
+
+func scanProject(s interface{ Scan(...interface{}) error }) (Project, error) {
+	var p Project
+	err := s.Scan(&p.ID, &p.Name, &p.Customer, &p.ProjectManager, &p.ContractDate, &p.ContractDeliveryDate,
+		&p.Notes, &p.CreatedBy, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
+
+const wbsColumns = `w.id, w.project_id, w.code, w.description, w.created_at, w.updated_at`
+
+func scanWbs(s interface{ Scan(...interface{}) error }) (WbsElement, error) {
+	var e WbsElement
+	err := s.Scan(&e.ID, &e.ProjectID, &e.Code, &e.Description, &e.CreatedAt, &e.UpdatedAt)
+	return e, err
+}
+
+// projectRollups menghitung ringkasan per groupCol ("project_id" atau
+// "wbs_id") dari panel yang terlihat oleh scopeQuery. Panel di trash tidak
+// ikut dihitung.
+func projectRollups(db DBTX, groupCol, scopeQuery string, args []interface{}, where string, whereArgs ...interface{}) (map[int]*ProjectRollup, error) {
+	args = append(append([]interface{}{}, args...), whereArgs...)
+	query := fmt.Sprintf(`
+		SELECT p.%[1]s, COUNT(*),
+			COUNT(*) FILTER (WHERE p.is_closed = true),
+			COUNT(*) FILTER (WHERE %[4]s),
+			COALESCE(AVG(p.percent_progress), 0),
+			MIN(p.target_delivery) FILTER (WHERE p.is_closed = false AND %[5]s >= %[6]s),
+			(SELECT COUNT(*) FROM issues i
+				JOIN chats ch ON ch.id = i.chat_id
+				JOIN panels p2 ON p2.no_pp = ch.panel_no_pp
+				WHERE p2.%[1]s = p.%[1]s AND p2.no_pp IN (%[2]s)
+					AND i.deleted_at IS NULL AND i.status <> 'solved'),
+			(ARRAY_AGG(p.no_pp ORDER BY p.target_delivery)
+				FILTER (WHERE p.is_closed = false AND %[5]s >= %[6]s))[1:5]
+		FROM panels p
+		WHERE p.%[1]s IS NOT NULL AND p.no_pp IN (%[2]s) %[3]s
+		GROUP BY p.%[1]s`, groupCol, scopeQuery, where, panelOverdueCondition, panelLocalTargetDate, panelLocalToday)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := map[int]*ProjectRollup{}
+	for rows.Next() {
+		var id int
+		var r ProjectRollup
+		if err := rows.Scan(&id, &r.PanelCount, &r.ClosedCount, &r.OverdueCount, &r.AvgProgress,
+			&r.NextDelivery, &r.OpenIssues, pq.Array(&r.UpcomingPanels)); err != nil {
+			return nil, err
+		}
+		result[id] = &r
+	}
+	return result, rows.Err()
+}
+
+type projectPayload struct {
+	Name                 *string `json:"name"`
+	Customer             *string `json:"customer"`
+	ProjectManager       *string `json:"project_manager"`
+	ContractDate         *string `json:"contract_date"`
+	ContractDeliveryDate *string `json:"contract_delivery_date"`
+	Notes                *string `json:"notes"`
+}
+
+// projectVisibleTo: admin/viewer melihat semua project, role lain hanya
+// project yang punya panel (di luar trash) dalam scope-nya. Aturannya sama
+// dengan getProjectHandler.
+func projectVisibleTo(db DBTX, id Identity, projectID int) (bool, error) {
+	if id.Role == AppRoleAdmin || id.Role == AppRoleViewer {
+		return true, nil
+	}
+	scopeQuery, args, ok := panelScopeQuery(id.Role, id.CompanyID)
+	if !ok {
+		return false, nil
+	}
+	args = append(args, projectID)
+	query := fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM panels p
+		WHERE p.project_id = $%d AND p.deleted_at IS NULL AND p.no_pp IN (%s))`, len(args), scopeQuery)
+	var visible bool
+	err := db.QueryRow(query, args...).Scan(&visible)
+	return visible, err
+}
+
+// nullableDate mengubah "" menjadi NULL dan memvalidasi format tanggal.
+func nullableDate(field string, value *string) (interface{}, error) {
+	if value == nil || strings.TrimSpace(*value) == "" {
+		return nil, nil
+	}
+	t, err := parseDateParam(strings.TrimSpace(*value), false)
+	if err != nil {
+		return nil, fmt.Errorf("%s harus berformat YYYY-MM-DD", field)
+	}
+	return t.Format("2006-01-02"), nil
+}
+
+func nullableText(value *string) interface{} {
+	if value == nil || strings.TrimSpace(*value) == "" {
+		return nil
+	}
+	return strings.TrimSpace(*value)
+}
+
+func respondProjectError(w http.ResponseWriter, err error, what string) {
+	if pqErr, ok := err.(*pq.Error); ok {
+		switch pqErr.Code {
+		case "23505":
+			respondWithError(w, http.StatusConflict, what+" dengan nama tersebut sudah ada")
+			return
+		case "23503":
+			respondWithError(w, http.StatusConflict, what+" masih dipakai oleh panel")
+			return
+		case "23514":
+			respondWithError(w, http.StatusBadRequest, "Nama "+strings.ToLower(what)+" tidak boleh kosong")
+			return
+		}
+	}
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, what+" tidak ditemukan")
+		return
+	}
+	respondWithError(w, http.StatusInternalServerError, err.Error())
+}
+
+func (a *App) getProjectsHandler(w http.ResponseWriter, r *http.Request) {
+	id := requestIdentity(r)
+	scopeQuery, scopeArgs, ok := panelScopeQuery(id.Role, id.CompanyID)
+	if !ok {
+		respondWithJSON(w, http.StatusOK, []Project{})
+		return
+	}
+	search := strings.TrimSpace(r.URL.Query().Get("q"))
+	rows, err := a.DB.Query(`SELECT `+projectColumns+` FROM projects pr
+		WHERE $1 = '' OR pr.name ILIKE '%' || $1 || '%' OR pr.customer ILIKE '%' || $1 || '%'
+		ORDER BY pr.name`, escapeLike(search))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil project: "+err.Error())
+		return
+	}
+	defer rows.Close()
+	projects := []Project{}
+	for rows.Next() {
+		p, err := scanProject(rows)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		projects = append(projects, p)
+	}
+	rows.Close()
+
+	rollups, err := projectRollups(a.DB, "project_id", scopeQuery, scopeArgs, "")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menghitung ringkasan project: "+err.Error())
+		return
+	}
+	// Vendor hanya melihat project yang punya panel di scope-nya.
+	allProjects := id.Role == AppRoleAdmin || id.Role == AppRoleViewer
+	visible := projects[:0]
+	for _, p := range projects {
+		p.Rollup = rollups[p.ID]
+		if p.Rollup == nil {
+			if !allProjects {
+				continue
+			}
+			p.Rollup = &ProjectRollup{}
+		}
+		visible = append(visible, p)
+	}
+	respondWithJSON(w, http.StatusOK, visible)
+}
+
+func (a *App) getProjectHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ID project tidak valid")
+		return
+	}
+	id := requestIdentity(r)
+	scopeQuery, scopeArgs, ok := panelScopeQuery(id.Role, id.CompanyID)
+	if !ok {
+		respondWithError(w, http.StatusForbidden, "Role tidak dikenal")
+		return
+	}
+
+	project, err := scanProject(a.DB.QueryRow(`SELECT `+projectColumns+` FROM projects pr WHERE pr.id = $1`, projectID))
+	if err != nil {
+		respondProjectError(w, err, "Project")
+		return
+	}
+	filter := fmt.Sprintf("AND p.project_id = $%d", len(scopeArgs)+1)
+	rollups, err := projectRollups(a.DB, "project_id", scopeQuery, scopeArgs, filter, projectID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menghitung ringkasan project: "+err.Error())
+		return
+	}
+	project.Rollup = rollups[projectID]
+	if project.Rollup == nil {
+		if id.Role != AppRoleAdmin && id.Role != AppRoleViewer {
+			respondWithError(w, http.StatusNotFound, "Project tidak ditemukan")
+			return
+		}
+		project.Rollup = &ProjectRollup{}
+	}
+
+	wbs, err := a.listWbs(projectID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil WBS: "+err.Error())
+		return
+	}
+	wbsRollups, err := projectRollups(a.DB, "wbs_id", scopeQuery, scopeArgs, filter, projectID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menghitung ringkasan WBS: "+err.Error())
+		return
+	}
+	for i := range wbs {
+		wbs[i].Rollup = wbsRollups[wbs[i].ID]
+		if wbs[i].Rollup == nil {
+			wbs[i].Rollup = &ProjectRollup{}
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"project": project,
+		"wbs":     wbs,
+	})
+}
+
+func (a *App) listWbs(projectID int) ([]WbsElement, error) {
+	rows, err := a.DB.Query(`SELECT `+wbsColumns+` FROM wbs_elements w WHERE w.project_id = $1 ORDER BY w.code`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []WbsElement{}
+	for rows.Next() {
+		e, err := scanWbs(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+func (a *App) createProjectHandler(w http.ResponseWriter, r *http.Request) {
+	var payload projectPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid payload: "+err.Error())
+		return
+	}
+	if payload.Name == nil || strings.TrimSpace(*payload.Name) == "" {
+		respondWithError(w, http.StatusBadRequest, "Nama project tidak boleh kosong")
+		return
+	}
+	contractDate, err := nullableDate("contract_date", payload.ContractDate)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	deliveryDate, err := nullableDate("contract_delivery_date", payload.ContractDeliveryDate)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tx, err := a.DB.Begin()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memulai transaksi: "+err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	actor := requestIdentity(r).Username
+	audit := beginAudit(tx, "project", "ref_key(t.name) = ref_key($1)", *payload.Name)
+	var projectID int
+	err = tx.QueryRow(`
+		INSERT INTO projects (name, customer, project_manager, contract_date, contract_delivery_date, notes, created_by)
+		VALUES (ref_name($1), $2, $3, $4, $5, $6, $7) RETURNING id`,
+		*payload.Name, nullableText(payload.Customer), nullableText(payload.ProjectManager),
+		contractDate, deliveryDate, nullableText(payload.Notes), actor).Scan(&projectID)
+	if err != nil {
+		respondProjectError(w, err, "Project")
+		return
+	}
+	audit.record(tx, actor, AuditSourceAPI)
+	// Panel yang menunggu review dengan nama yang sama langsung terhubung.
+	if _, err := resolveProjectNameReview(tx, actor, *payload.Name); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menghubungkan panel: "+err.Error())
+		return
+	}
+
+	project, err := scanProject(tx.QueryRow(`SELECT `+projectColumns+` FROM projects pr WHERE pr.id = $1`, projectID))
+	if err != nil {
+		respondProjectError(w, err, "Project")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal membuat project: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, project)
+}
+
+// updateProjectHandler mengubah master data project. Field yang tidak dikirim
+// tidak diubah; string kosong mengosongkan field opsional. Rename ikut
+// mengubah teks project di semua panel project tersebut.
+func (a *App) updateProjectHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ID project tidak valid")
+		return
+	}
+	var payload projectPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid payload: "+err.Error())
+		return
+	}
+
+	sets := []string{"updated_at = NOW()"}
+	args := []interface{}{projectID}
+	set := func(col string, v interface{}) {
+		args = append(args, v)
+		sets = append(sets, fmt.Sprintf("%s = $%d", col, len(args)))
+	}
+	if payload.Name != nil {
+		if strings.TrimSpace(*payload.Name) == "" {
+			respondWithError(w, http.StatusBadRequest, "Nama project tidak boleh kosong")
+			return
+		}
+		args = append(args, *payload.Name)
+		sets = append(sets, fmt.Sprintf("name = ref_name($%d)", len(args)))
+	}
+	if payload.Customer != nil {
+		set("customer", nullableText(payload.Customer))
+	}
+	if payload.ProjectManager != nil {
+		set("project_manager", nullableText(payload.ProjectManager))
+	}
+	if payload.Notes != nil {
+		set("notes", nullableText(payload.Notes))
+	}
+	for _, d := range []struct {
+		col   string
+		value *string
+	}{{"contract_date", payload.ContractDate}, {"contract_delivery_date", payload.ContractDeliveryDate}} {
+		if d.value == nil {
+			continue
+		}
+		v, err := nullableDate(d.col, d.value)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		set(d.col, v)
+	}
+
+	tx, err := a.DB.Begin()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memulai transaksi: "+err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	actor := requestIdentity(r).Username
+	projectAudit := beginAudit(tx, "project", "t.id = $1", projectID)
+	panelAudit := beginAudit(tx, "panel", "t.project_id = $1", projectID)
+	var name string
+	err = tx.QueryRow(`UPDATE projects SET `+strings.Join(sets, ", ")+` WHERE id = $1 RETURNING name`, args...).Scan(&name)
+	if err != nil {
+		respondProjectError(w, err, "Project")
+		return
+	}
+	if payload.Name != nil {
+		if _, err := tx.Exec(`UPDATE panels SET project = $2 WHERE project_id = $1 AND project IS DISTINCT FROM $2`, projectID, name); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal memperbarui project di panel: "+err.Error())
+			return
+		}
+	}
+	projectAudit.record(tx, actor, AuditSourceAPI)
+	panelAudit.record(tx, actor, AuditSourceAPI)
+
+	project, err := scanProject(tx.QueryRow(`SELECT `+projectColumns+` FROM projects pr WHERE pr.id = $1`, projectID))
+	if err != nil {
+		respondProjectError(w, err, "Project")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menyimpan project: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, project)
+}
+
+// deleteProjectHandler hanya menghapus project yang tidak lagi dipakai panel
+// (termasuk panel di trash). Gunakan merge untuk menggabungkan project salah ketik.
+func (a *App) deleteProjectHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ID project tidak valid")
+		return
+	}
+	tx, err := a.DB.Begin()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memulai transaksi: "+err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	audit := beginAudit(tx, "project", "t.id = $1", projectID)
+	res, err := tx.Exec(`DELETE FROM projects WHERE id = $1`, projectID)
+	if err != nil {
+		respondProjectError(w, err, "Project")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusNotFound, "Project tidak ditemukan")
+		return
+	}
+	audit.record(tx, requestIdentity(r).Username, AuditSourceAPI)
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menghapus project: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// mergeProjectHandler: POST /projects/{id}/merge {"into_id": N}. Semua panel
+// project {id} dipindah ke project tujuan (WBS dengan kode sama digabung,
+// sisanya dipindah), nama lama dan alias-nya menjadi alias project tujuan,
+// lalu project {id} dihapus.
+func (a *App) mergeProjectHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ID project tidak valid")
+		return
+	}
+	var payload struct {
+		IntoID int `json:"into_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid payload: "+err.Error())
+		return
+	}
+	if payload.IntoID == 0 || payload.IntoID == projectID {
+		respondWithError(w, http.StatusBadRequest, "into_id harus berisi project lain")
+		return
+	}
+
+	tx, err := a.DB.Begin()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memulai transaksi: "+err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	var target string
+	if err := tx.QueryRow(`SELECT name FROM projects WHERE id = $1 FOR UPDATE`, payload.IntoID).Scan(&target); err != nil {
+		respondProjectError(w, err, "Project tujuan")
+		return
+	}
+	actor := requestIdentity(r).Username
+	projectAudit := beginAudit(tx, "project", "t.id = $1", projectID)
+	panelAudit := beginAudit(tx, "panel", "t.project_id = $1", projectID)
+
+	// Trigger memetakan ulang project_id dan wbs_id dari teks baru.
+	res, err := tx.Exec(`UPDATE panels SET project = $2, no_wbs = no_wbs WHERE project_id = $1`, projectID, target)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memindahkan panel: "+err.Error())
+		return
+	}
+	moved, _ := res.RowsAffected()
+	if _, err := tx.Exec(`
+		UPDATE wirings w SET no_wbs = p.no_wbs FROM panels p
+		WHERE p.no_pp = w.panel_no_pp AND p.project_id = $1 AND w.no_wbs IS DISTINCT FROM p.no_wbs`, payload.IntoID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memperbarui WBS wiring: "+err.Error())
+		return
+	}
+	// WBS yang kodenya sudah ada di project tujuan digabung deskripsinya;
+	// sisanya (termasuk yang belum dipakai panel) dipindah sebelum project
+	// sumber dihapus, karena wbs_elements ikut terhapus lewat cascade.
+	if _, err := tx.Exec(`
+		UPDATE wbs_elements t SET description = COALESCE(t.description, s.description), updated_at = NOW()
+		FROM wbs_elements s
+		WHERE s.project_id = $1 AND t.project_id = $2 AND ref_key(t.code) = ref_key(s.code)`, projectID, payload.IntoID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menggabungkan WBS: "+err.Error())
+		return
+	}
+	res, err = tx.Exec(`
+		UPDATE wbs_elements s SET project_id = $2, updated_at = NOW()
+		WHERE s.project_id = $1 AND NOT EXISTS (
+			SELECT 1 FROM wbs_elements t WHERE t.project_id = $2 AND ref_key(t.code) = ref_key(s.code))`, projectID, payload.IntoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memindahkan WBS: "+err.Error())
+		return
+	}
+	movedWbs, _ := res.RowsAffected()
+	// Nama project sumber tetap dikenali supaya import berikutnya tidak
+	// masuk antrean review lagi.
+	if _, err := tx.Exec(`UPDATE project_aliases SET project_id = $2 WHERE project_id = $1`, projectID, payload.IntoID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memindahkan alias project: "+err.Error())
+		return
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO project_aliases (alias_key, project_id, created_by)
+		SELECT ref_key(name), $2, $3 FROM projects WHERE id = $1
+		ON CONFLICT (alias_key) DO UPDATE SET project_id = EXCLUDED.project_id`, projectID, payload.IntoID, actor); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menyimpan alias project: "+err.Error())
+		return
+	}
+	res, err = tx.Exec(`DELETE FROM projects WHERE id = $1`, projectID)
+	if err != nil {
+		respondProjectError(w, err, "Project")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusNotFound, "Project tidak ditemukan")
+		return
+	}
+	projectAudit.record(tx, actor, AuditSourceAPI)
+	panelAudit.recordWhere(tx, actor, AuditSourceAPI, false, "t.no_pp = ANY($1)", pq.Array(auditKeys(panelAudit)))
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menggabungkan project: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"status":       "success",
+		"into_id":      payload.IntoID,
+		"moved_panels": moved,
+		"moved_wbs":    movedWbs,
+	})
+}
+
+// auditKeys mengembalikan ID baris yang ada di snapshot sebelum perubahan.
+func auditKeys(s *auditScope) []string {
+	keys := make([]string, 0, len(s.before))
+	for k := range s.before {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (a *App) getProjectWbsHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ID project tidak valid")
+		return
+	}
+	visible, err := projectVisibleTo(a.DB, requestIdentity(r), projectID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memeriksa project: "+err.Error())
+		return
+	}
+	if !visible {
+		respondWithError(w, http.StatusNotFound, "Project tidak ditemukan")
+		return
+	}
+	list, err := a.listWbs(projectID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil WBS: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, list)
+}
+
+type wbsPayload struct {
+	Code        *string `json:"code"`
+	Description *string `json:"description"`
+}
+
+func (a *App) createWbsHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ID project tidak valid")
+		return
+	}
+	var payload wbsPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid payload: "+err.Error())
+		return
+	}
+	if payload.Code == nil || strings.TrimSpace(*payload.Code) == "" {
+		respondWithError(w, http.StatusBadRequest, "Kode WBS tidak boleh kosong")
+		return
+	}
+	actor := requestIdentity(r).Username
+	audit := beginAudit(a.DB, "wbs", "t.project_id = $1 AND ref_key(t.code) = ref_key($2)", projectID, *payload.Code)
+	var wbsID int
+	err = a.DB.QueryRow(`
+		INSERT INTO wbs_elements (project_id, code, description)
+		SELECT id, ref_name($2), $3 FROM projects WHERE id = $1
+		RETURNING id`, projectID, *payload.Code, nullableText(payload.Description)).Scan(&wbsID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Project tidak ditemukan")
+			return
+		}
+		respondProjectError(w, err, "WBS")
+		return
+	}
+	audit.record(a.DB, actor, AuditSourceAPI)
+
+	e, err := scanWbs(a.DB.QueryRow(`SELECT `+wbsColumns+` FROM wbs_elements w WHERE w.id = $1`, wbsID))
+	if err != nil {
+		respondProjectError(w, err, "WBS")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, e)
+}
+
+// updateWbsHandler mengubah kode/deskripsi WBS. Rename kode ikut mengubah
+// no_wbs di panel dan wiring yang memakai WBS ini.
+func (a *App) updateWbsHandler(w http.ResponseWriter, r *http.Request) {
+	wbsID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ID WBS tidak valid")
+		return
+	}
+	var payload wbsPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid payload: "+err.Error())
+		return
+	}
+	if payload.Code != nil && strings.TrimSpace(*payload.Code) == "" {
+		respondWithError(w, http.StatusBadRequest, "Kode WBS tidak boleh kosong")
+		return
+	}
+
+	tx, err := a.DB.Begin()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memulai transaksi: "+err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	actor := requestIdentity(r).Username
+	wbsAudit := beginAudit(tx, "wbs", "t.id = $1", wbsID)
+	panelAudit := beginAudit(tx, "panel", "t.wbs_id = $1", wbsID)
+	var code string
+	err = tx.QueryRow(`
+		UPDATE wbs_elements SET
+			code = COALESCE(ref_name($2), code),
+			description = CASE WHEN $3 THEN $4 ELSE description END,
+			updated_at = NOW()
+		WHERE id = $1 RETURNING code`,
+		wbsID, nullableText(payload.Code), payload.Description != nil, nullableText(payload.Description)).Scan(&code)
+	if err != nil {
+		respondProjectError(w, err, "WBS")
+		return
+	}
+	if payload.Code != nil {
+		if _, err := tx.Exec(`UPDATE panels SET no_wbs = $2 WHERE wbs_id = $1 AND no_wbs IS DISTINCT FROM $2`, wbsID, code); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal memperbarui WBS di panel: "+err.Error())
+			return
+		}
+		if _, err := tx.Exec(`
+			UPDATE wirings w SET no_wbs = $2 FROM panels p
+			WHERE p.no_pp = w.panel_no_pp AND p.wbs_id = $1 AND w.no_wbs IS DISTINCT FROM $2`, wbsID, code); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal memperbarui WBS wiring: "+err.Error())
+			return
+		}
+	}
+	wbsAudit.record(tx, actor, AuditSourceAPI)
+	panelAudit.record(tx, actor, AuditSourceAPI)
+
+	e, err := scanWbs(tx.QueryRow(`SELECT `+wbsColumns+` FROM wbs_elements w WHERE w.id = $1`, wbsID))
+	if err != nil {
+		respondProjectError(w, err, "WBS")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menyimpan WBS: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, e)
+}
+
+func (a *App) deleteWbsHandler(w http.ResponseWriter, r *http.Request) {
+	wbsID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ID WBS tidak valid")
+		return
+	}
+	audit := beginAudit(a.DB, "wbs", "t.id = $1", wbsID)
+	res, err := a.DB.Exec(`DELETE FROM wbs_elements WHERE id = $1`, wbsID)
+	if err != nil {
+		respondProjectError(w, err, "WBS")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusNotFound, "WBS tidak ditemukan")
+		return
+	}
+	audit.record(a.DB, requestIdentity(r).Username, AuditSourceAPI)
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+type ProjectNameReview struct {
+	Name        string    `json:"name"`
+	PanelCount  int       `json:"panel_count"`
+	FirstSeenBy *string   `json:"first_seen_by"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+	Suggestions []Project `json:"suggestions"`
+}
+
+// resolveProjectNameReview memetakan ulang panel yang menunggu review untuk
+// nama tersebut (trigger mencari project lewat nama atau alias), lalu
+// menghapus nama itu dari antrean.
+func resolveProjectNameReview(db DBTX, actor, name string) (int64, error) {
+	panelAudit := beginAudit(db, "panel", "t.project_id IS NULL AND ref_key(t.project) = ref_key($1)", name)
+	res, err := db.Exec(`
+		UPDATE panels SET project = project, no_wbs = no_wbs
+		WHERE project_id IS NULL AND ref_key(project) = ref_key($1)`, name)
+	if err != nil {
+		return 0, err
+	}
+	resolved, _ := res.RowsAffected()
+	if _, err := db.Exec(`
+		UPDATE wirings w SET no_wbs = p.no_wbs FROM panels p
+		WHERE p.no_pp = w.panel_no_pp AND p.wbs_id IS NOT NULL AND ref_key(p.project) = ref_key($1)
+			AND w.no_wbs IS DISTINCT FROM p.no_wbs`, name); err != nil {
+		return 0, err
+	}
+	if _, err := db.Exec(`DELETE FROM project_name_reviews WHERE name_key = ref_key($1)`, name); err != nil {
+		return 0, err
+	}
+	panelAudit.recordWhere(db, actor, AuditSourceAPI, false, "t.no_pp = ANY($1)", pq.Array(auditKeys(panelAudit)))
+	return resolved, nil
+}
+
+// levenshtein dipakai untuk saran project pada antrean review.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// getProjectNameReviewsHandler: GET /project-name-reviews. Nama project dari
+// panel yang belum cocok dengan project mana pun, beserta saran project yang
+// ejaannya mirip.
+func (a *App) getProjectNameReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.DB.Query(`
+		SELECT r.name, COUNT(p.no_pp), r.first_seen_by, r.first_seen_at, r.last_seen_at
+		FROM project_name_reviews r
+		LEFT JOIN panels p ON p.project_id IS NULL AND ref_key(p.project) = r.name_key
+		GROUP BY r.name_key, r.name, r.first_seen_by, r.first_seen_at, r.last_seen_at
+		ORDER BY r.last_seen_at DESC`)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil antrean review: "+err.Error())
+		return
+	}
+	reviews := []ProjectNameReview{}
+	for rows.Next() {
+		var rv ProjectNameReview
+		if err := rows.Scan(&rv.Name, &rv.PanelCount, &rv.FirstSeenBy, &rv.FirstSeenAt, &rv.LastSeenAt); err != nil {
+			rows.Close()
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		reviews = append(reviews, rv)
+	}
+	rows.Close()
+
+	rows, err = a.DB.Query(`SELECT ` + projectColumns + ` FROM projects pr ORDER BY pr.name`)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil project: "+err.Error())
+		return
+	}
+	defer rows.Close()
+	var projects []Project
+	for rows.Next() {
+		p, err := scanProject(rows)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		projects = append(projects, p)
+	}
+
+	const maxSuggestions = 3
+	for i := range reviews {
+		key := strings.ToLower(reviews[i].Name)
+		// Ambang jarak: sepertiga panjang nama, minimal 2 karakter.
+		limit := max(2, len([]rune(key))/3)
+		type candidate struct {
+			p    Project
+			dist int
+		}
+		var candidates []candidate
+		for _, p := range projects {
+			if d := levenshtein(key, strings.ToLower(p.Name)); d <= limit {
+				candidates = append(candidates, candidate{p, d})
+			}
+		}
+		sort.SliceStable(candidates, func(x, y int) bool { return candidates[x].dist < candidates[y].dist })
+		reviews[i].Suggestions = []Project{}
+		for j := 0; j < len(candidates) && j < maxSuggestions; j++ {
+			reviews[i].Suggestions = append(reviews[i].Suggestions, candidates[j].p)
+		}
+	}
+	respondWithJSON(w, http.StatusOK, reviews)
+}
+
+// resolveProjectNameReviewHandler: POST /project-name-reviews/resolve dengan
+// {"name": "...", "project_id": N} untuk memetakan nama ke project yang ada
+// (disimpan sebagai alias) atau {"name": "...", "create": true} untuk
+// menjadikannya project baru.
+func (a *App) resolveProjectNameReviewHandler(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Name      string `json:"name"`
+		ProjectID *int   `json:"project_id"`
+		Create    bool   `json:"create"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid payload: "+err.Error())
+		return
+	}
+	if (payload.ProjectID == nil) == !payload.Create {
+		respondWithError(w, http.StatusBadRequest, "Isi salah satu: project_id atau create")
+		return
+	}
+
+	tx, err := a.DB.Begin()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memulai transaksi: "+err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	var name string
+	err = tx.QueryRow(`SELECT name FROM project_name_reviews WHERE name_key = ref_key($1) FOR UPDATE`, payload.Name).Scan(&name)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Nama project tidak ada di antrean review")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	actor := requestIdentity(r).Username
+	var projectID int
+	if payload.Create {
+		audit := beginAudit(tx, "project", "ref_key(t.name) = ref_key($1)", name)
+		if err := tx.QueryRow(`INSERT INTO projects (name, created_by) VALUES (ref_name($1), $2) RETURNING id`, name, actor).Scan(&projectID); err != nil {
+			respondProjectError(w, err, "Project")
+			return
+		}
+		audit.record(tx, actor, AuditSourceAPI)
+	} else {
+		projectID = *payload.ProjectID
+		_, err := tx.Exec(`
+			INSERT INTO project_aliases (alias_key, project_id, created_by) VALUES (ref_key($1), $2, $3)
+			ON CONFLICT (alias_key) DO UPDATE SET project_id = EXCLUDED.project_id`, name, projectID, actor)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+				respondWithError(w, http.StatusNotFound, "Project tidak ditemukan")
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, "Gagal menyimpan alias project: "+err.Error())
+			return
+		}
+	}
+	resolved, err := resolveProjectNameReview(tx, actor, name)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menghubungkan panel: "+err.Error())
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menyimpan review: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"status":          "success",
+		"project_id":      projectID,
+		"resolved_panels": resolved,
+	})
+}
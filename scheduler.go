@@ -0,0 +1,498 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scheduler job berkala (pengingat jatuh tempo, panel terlambat, purge
+// trash). Semua replika boleh menjalankan scheduler; hanya yang memegang
+// advisory lock Postgres yang menjalankan job. Lock terikat ke satu koneksi
+// sehingga otomatis lepas bila replika mati. Status run disimpan di tabel
+// scheduler_jobs (migrasi 0015_scheduler_jobs).
+
+const (
+	// schedulerLockKey: kunci advisory lock leader, cukup unik per database.
+	schedulerLockKey      int64 = 0x5ec9a9e1
+	schedulerPollInterval       = 30 * time.Second
+)
+
+// Cron 5 kolom: menit jam tanggal bulan hari (0-6, Minggu = 0 atau 7).
+// Mendukung *, daftar (1,15), rentang (1-5), langkah (*/15, 8-18/2) dan
+// alias @hourly, @daily, @weekly, @monthly, @yearly.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+var cronAliases = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+func parseCron(expr string) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if alias, ok := cronAliases[strings.ToLower(expr)]; ok {
+		expr = alias
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron %q harus 5 kolom (menit jam tanggal bulan hari)", expr)
+	}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	var bits [5]uint64
+	for i, f := range fields {
+		b, err := parseCronField(f, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("cron %q kolom %d: %w", expr, i+1, err)
+		}
+		bits[i] = b
+	}
+	// 7 = Minggu, disamakan dengan 0.
+	if bits[4]&(1<<7) != 0 {
+		bits[4] = bits[4]&^(1<<7) | 1
+	}
+	return &cronSchedule{
+		minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4],
+		domAny: fields[2] == "*", dowAny: fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("langkah %q tidak valid", part)
+			}
+			rangePart, step = part[:i], n
+		}
+		lo, hi := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			a, b, _ := strings.Cut(rangePart, "-")
+			var errA, errB error
+			lo, errA = strconv.Atoi(a)
+			hi, errB = strconv.Atoi(b)
+			if errA != nil || errB != nil || lo > hi {
+				return 0, fmt.Errorf("rentang %q tidak valid", rangePart)
+			}
+		default:
+			n, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("nilai %q tidak valid", rangePart)
+			}
+			lo, hi = n, n
+			if strings.Contains(part, "/") {
+				hi = max
+			}
+		}
+		if lo < min || hi > max {
+			return 0, fmt.Errorf("%q di luar %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (c *cronSchedule) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	// Aturan cron: bila tanggal dan hari sama-sama dibatasi, cukup salah satu.
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+// Next mengembalikan waktu jalan berikutnya setelah t di zona loc, atau
+// zero time bila tidak ada dalam 5 tahun (mis. 30 Februari).
+func (c *cronSchedule) Next(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+type scheduledJob struct {
+	Name        string
+	Description string
+	// DefaultSchedule bisa ditimpa lewat JOB_SCHEDULE_<NAME>; "off" mematikan job.
+	DefaultSchedule string
+	Run             func() error
+	Enabled         func() bool
+
+	schedule string
+	cron     *cronSchedule
+	next     time.Time
+	running  bool
+}
+
+type jobScheduler struct {
+	app      *App
+	instance string
+
+	mu     sync.Mutex
+	jobs   []*scheduledJob
+	leader bool
+	conn   *sql.Conn
+}
+
+// schedulerLocation: SCHEDULER_TIMEZONE, default zona waktu kalender default.
+func schedulerLocation() *time.Location {
+	if tz := os.Getenv("SCHEDULER_TIMEZONE"); tz != "" {
+		if loc, err := time.LoadLocation(tz); err == nil {
+			return loc
+		}
+		log.Printf("Scheduler: SCHEDULER_TIMEZONE %q tidak valid, memakai zona kalender default", tz)
+	}
+	return defaultCalendar().loc
+}
+
+func schedulerInstanceName() string {
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "secpanel"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+func (a *App) scheduledJobs() []*scheduledJob {
+	return []*scheduledJob{
+		{
+			Name:            "panels_due_today",
+			Description:     "Pengingat panel yang dijadwalkan kirim hari ini",
+			DefaultSchedule: "0 8 * * *",
+			Run:             a.checkPanelsDueToday,
+		},
+		{
+			Name:            "panels_overdue",
+			Description:     "Peringatan panel yang melewati target pengiriman",
+			DefaultSchedule: "0 8 * * *",
+			Run:             a.checkOverduePanels,
+		},
+		{
+			Name:            "notification_digest",
+			Description:     "Kirim digest email harian/mingguan sesuai jadwal digest tiap user",
+			DefaultSchedule: "0 * * * *",
+			Run:             a.sendDueDigests,
+		},
+		{
+			Name:            "trash_purge",
+			Description:     "Hapus permanen isi trash yang melewati TRASH_RETENTION_DAYS",
+			DefaultSchedule: "0 */6 * * *",
+			Run:             a.runTrashPurge,
+			Enabled:         func() bool { return trashRetention() > 0 },
+		},
+	}
+}
+
+func newJobScheduler(a *App) *jobScheduler {
+	s := &jobScheduler{app: a, instance: schedulerInstanceName()}
+	for _, job := range a.scheduledJobs() {
+		job.schedule = job.DefaultSchedule
+		envKey := "JOB_SCHEDULE_" + strings.ToUpper(job.Name)
+		if v := strings.TrimSpace(os.Getenv(envKey)); v != "" {
+			job.schedule = v
+		}
+		if job.Enabled != nil && !job.Enabled() {
+			job.schedule = "off"
+		}
+		if job.schedule != "off" {
+			c, err := parseCron(job.schedule)
+			if err != nil {
+				log.Printf("Scheduler: %s tidak valid, job %s dimatikan: %v", envKey, job.Name, err)
+				job.schedule = "off"
+			} else {
+				job.cron = c
+			}
+		}
+		s.jobs = append(s.jobs, job)
+	}
+	return s
+}
+
+// startScheduler berjalan selamanya. SCHEDULER_ENABLED=false membuat replika
+// ini tidak pernah ikut pemilihan leader (mis. replika khusus API).
+func (a *App) startScheduler() {
+	if v := os.Getenv("SCHEDULER_ENABLED"); v != "" {
+		if on, err := strconv.ParseBool(v); err == nil && !on {
+			log.Println("Scheduler dimatikan (SCHEDULER_ENABLED=false).")
+			return
+		}
+	}
+	s := a.Scheduler
+	log.Printf("⏰ Scheduler %s berjalan (zona %s).", s.instance, schedulerLocation())
+	for {
+		wait := schedulerPollInterval
+		if s.ensureLeader() {
+			if next := s.runDue(time.Now()); !next.IsZero() {
+				if d := time.Until(next); d < wait {
+					wait = d
+				}
+			}
+		}
+		if wait < time.Second {
+			wait = time.Second
+		}
+		time.Sleep(wait)
+	}
+}
+
+// ensureLeader memeriksa koneksi lock yang sudah dipegang, atau mencoba
+// mengambil lock bila belum leader.
+func (s *jobScheduler) ensureLeader() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+	if conn != nil {
+		if _, err := conn.ExecContext(ctx, "SELECT 1"); err == nil {
+			return true
+		}
+		log.Printf("Scheduler: koneksi lock leader terputus, %s melepas leader.", s.instance)
+		// Koneksi kembali ke pool saat Close; lepaskan lock dulu bila ternyata
+		// koneksinya masih hidup.
+		conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", schedulerLockKey)
+		conn.Close()
+		s.setLeader(nil)
+		return false
+	}
+
+	conn, err := s.app.DB.Conn(ctx)
+	if err != nil {
+		return false
+	}
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", schedulerLockKey).Scan(&acquired); err != nil || !acquired {
+		conn.Close()
+		return false
+	}
+	log.Printf("Scheduler: %s menjadi leader.", s.instance)
+	s.setLeader(conn)
+	s.planRuns()
+	return true
+}
+
+func (s *jobScheduler) setLeader(conn *sql.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conn = conn
+	s.leader = conn != nil
+	if conn == nil {
+		for _, job := range s.jobs {
+			job.next = time.Time{}
+		}
+	}
+}
+
+// planRuns dipanggil saat menjadi leader. Job yang jadwalnya terlewat sejak
+// run terakhir (mis. semua replika sedang restart jam 08.00) dijalankan
+// segera, sekali saja.
+func (s *jobScheduler) planRuns() {
+	lastRuns := map[string]time.Time{}
+	rows, err := s.app.DB.Query("SELECT name, last_run_at FROM scheduler_jobs WHERE last_run_at IS NOT NULL")
+	if err == nil {
+		for rows.Next() {
+			var name string
+			var at time.Time
+			if rows.Scan(&name, &at) == nil {
+				lastRuns[name] = at
+			}
+		}
+		rows.Close()
+	}
+
+	now := time.Now()
+	loc := schedulerLocation()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		if job.cron == nil {
+			continue
+		}
+		job.next = job.cron.Next(now, loc)
+		if last, ok := lastRuns[job.Name]; ok {
+			if missed := job.cron.Next(last, loc); !missed.IsZero() && missed.Before(now) {
+				job.next = now
+			}
+		}
+		s.app.DB.Exec(`INSERT INTO scheduler_jobs (name, schedule, next_run_at) VALUES ($1, $2, $3)
+			ON CONFLICT (name) DO UPDATE SET schedule = EXCLUDED.schedule, next_run_at = EXCLUDED.next_run_at, updated_at = NOW()`,
+			job.Name, job.schedule, job.next)
+	}
+}
+
+// runDue menjalankan job yang jatuh tempo dan mengembalikan waktu jalan
+// terdekat berikutnya.
+func (s *jobScheduler) runDue(now time.Time) time.Time {
+	loc := schedulerLocation()
+	var soonest time.Time
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		if job.cron == nil || job.next.IsZero() {
+			continue
+		}
+		if !job.next.After(now) && !job.running {
+			job.running = true
+			job.next = job.cron.Next(now, loc)
+			go s.execute(job, job.next)
+		}
+		if soonest.IsZero() || job.next.Before(soonest) {
+			soonest = job.next
+		}
+	}
+	return soonest
+}
+
+func (s *jobScheduler) execute(job *scheduledJob, next time.Time) {
+	defer func() {
+		s.mu.Lock()
+		job.running = false
+		s.mu.Unlock()
+	}()
+
+	started := time.Now()
+	s.app.DB.Exec(`INSERT INTO scheduler_jobs (name, schedule, last_run_at, last_status, next_run_at, last_instance)
+		VALUES ($1, $2, $3, 'running', $4, $5)
+		ON CONFLICT (name) DO UPDATE SET schedule = EXCLUDED.schedule, last_run_at = EXCLUDED.last_run_at,
+			last_status = 'running', next_run_at = EXCLUDED.next_run_at, last_instance = EXCLUDED.last_instance, updated_at = NOW()`,
+		job.Name, job.schedule, started, next, s.instance)
+
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return job.Run()
+	}()
+
+	status, lastError := "ok", sql.NullString{}
+	if err != nil {
+		status, lastError = "failed", sql.NullString{String: err.Error(), Valid: true}
+		log.Printf("Scheduler: job %s gagal: %v", job.Name, err)
+	}
+	_, dbErr := s.app.DB.Exec(`UPDATE scheduler_jobs SET last_finished_at = NOW(), last_status = $2, last_error = $3,
+			last_duration_ms = $4, run_count = run_count + 1,
+			failure_count = failure_count + CASE WHEN $2 = 'failed' THEN 1 ELSE 0 END, updated_at = NOW()
+		WHERE name = $1`,
+		job.Name, status, lastError, time.Since(started).Milliseconds())
+	if dbErr != nil {
+		log.Printf("Scheduler: gagal menyimpan status job %s: %v", job.Name, dbErr)
+	}
+}
+
+type JobStatus struct {
+	Name           string     `json:"name"`
+	Description    string     `json:"description"`
+	Schedule       string     `json:"schedule"`
+	Enabled        bool       `json:"enabled"`
+	Running        bool       `json:"running"`
+	NextRunAt      *time.Time `json:"next_run_at"`
+	LastRunAt      *time.Time `json:"last_run_at"`
+	LastFinishedAt *time.Time `json:"last_finished_at"`
+	LastStatus     *string    `json:"last_status"`
+	LastError      *string    `json:"last_error"`
+	LastDurationMs *int64     `json:"last_duration_ms"`
+	RunCount       int64      `json:"run_count"`
+	FailureCount   int64      `json:"failure_count"`
+	LastInstance   *string    `json:"last_instance"`
+}
+
+// getJobsHandler: GET /admin/jobs. Status run dibaca dari database sehingga
+// replika mana pun yang melayani request menampilkan data yang sama.
+func (a *App) getJobsHandler(w http.ResponseWriter, r *http.Request) {
+	s := a.Scheduler
+	rows, err := a.DB.Query(`SELECT name, last_run_at, last_finished_at, last_status, last_error, last_duration_ms,
+		run_count, failure_count, last_instance
+		FROM scheduler_jobs`)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil status job: "+err.Error())
+		return
+	}
+	defer rows.Close()
+	stored := map[string]*JobStatus{}
+	for rows.Next() {
+		var st JobStatus
+		if err := rows.Scan(&st.Name, &st.LastRunAt, &st.LastFinishedAt, &st.LastStatus, &st.LastError, &st.LastDurationMs,
+			&st.RunCount, &st.FailureCount, &st.LastInstance); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal membaca status job: "+err.Error())
+			return
+		}
+		st.Running = st.LastStatus != nil && *st.LastStatus == "running"
+		stored[st.Name] = &st
+	}
+
+	now := time.Now()
+	loc := schedulerLocation()
+	s.mu.Lock()
+	leader := s.leader
+	jobs := make([]JobStatus, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		st := JobStatus{Name: job.Name}
+		if saved, ok := stored[job.Name]; ok {
+			st = *saved
+		}
+		st.Description = job.Description
+		st.Schedule = job.schedule
+		st.Enabled = job.cron != nil
+		if st.Enabled {
+			next := job.next
+			if next.IsZero() {
+				next = job.cron.Next(now, loc)
+			}
+			st.NextRunAt = &next
+		}
+		jobs = append(jobs, st)
+	}
+	s.mu.Unlock()
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"instance":  s.instance,
+		"leader":    leader,
+		"time_zone": loc.String(),
+		"jobs":      jobs,
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func cronTime(s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	// 2024-01-01 adalah hari Senin.
+	tests := []struct {
+		name string
+		expr string
+		from string
+		want string // kosong berarti zero time
+	}{
+		{"tanggal saja", "0 0 13 * *", "2024-01-01 00:00", "2024-01-13 00:00"},
+		{"hari saja", "0 0 * * 5", "2024-01-01 00:00", "2024-01-05 00:00"},
+		{"tanggal atau hari, hari lebih dulu", "0 0 13 * 5", "2024-01-01 00:00", "2024-01-05 00:00"},
+		{"tanggal atau hari, tanggal lebih dulu", "0 0 13 * 5", "2024-01-12 00:00", "2024-01-13 00:00"},
+		{"tanggal atau hari, berikutnya hari lagi", "0 0 13 * 5", "2024-01-13 00:00", "2024-01-19 00:00"},
+
+		{"langkah dari bintang", "*/15 * * * *", "2024-01-01 00:07", "2024-01-01 00:15"},
+		{"langkah dari nilai tunggal", "5/20 * * * *", "2024-01-01 00:06", "2024-01-01 00:25"},
+		{"langkah dari nilai tunggal lewat jam", "5/20 * * * *", "2024-01-01 00:45", "2024-01-01 01:05"},
+		{"langkah pada rentang", "0 8-18/5 * * *", "2024-01-01 09:00", "2024-01-01 13:00"},
+		{"langkah pada rentang, hari berikutnya", "0 8-18/5 * * *", "2024-01-01 18:30", "2024-01-02 08:00"},
+		{"daftar", "0 9 1,15 * *", "2024-01-02 00:00", "2024-01-15 09:00"},
+
+		{"7 adalah Minggu", "0 0 * * 7", "2024-01-01 00:00", "2024-01-07 00:00"},
+		{"rentang sampai 7", "0 0 * * 6-7", "2024-01-01 00:00", "2024-01-06 00:00"},
+		{"rentang sampai 7 termasuk Minggu", "0 0 * * 6-7", "2024-01-06 00:00", "2024-01-07 00:00"},
+
+		{"@hourly", "@hourly", "2024-01-01 10:30", "2024-01-01 11:00"},
+		{"@daily", "@daily", "2024-01-01 10:00", "2024-01-02 00:00"},
+		{"@midnight", "@midnight", "2024-01-01 10:00", "2024-01-02 00:00"},
+		{"@weekly", "@weekly", "2024-01-01 00:00", "2024-01-07 00:00"},
+		{"@monthly", "@monthly", "2024-01-01 00:00", "2024-02-01 00:00"},
+		{"@yearly", "@yearly", "2024-01-01 00:00", "2025-01-01 00:00"},
+		{"@annually", "@annually", "2024-01-01 00:00", "2025-01-01 00:00"},
+		{"alias huruf besar", "@DAILY", "2024-01-01 10:00", "2024-01-02 00:00"},
+
+		{"29 Februari", "0 0 29 2 *", "2024-03-01 00:00", "2028-02-29 00:00"},
+		{"30 Februari tidak pernah ada", "0 0 30 2 *", "2024-01-01 00:00", ""},
+		{"31 April tidak pernah ada", "0 0 31 4 *", "2024-01-01 00:00", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("parseCron(%q): %v", tt.expr, err)
+			}
+			got := c.Next(cronTime(tt.from), time.UTC)
+			if tt.want == "" {
+				if !got.IsZero() {
+					t.Fatalf("Next(%s) = %s, ingin zero time", tt.from, got)
+				}
+				return
+			}
+			if want := cronTime(tt.want); !got.Equal(want) {
+				t.Fatalf("Next(%s) = %s, ingin %s", tt.from, got, want)
+			}
+		})
+	}
+}
+
+func TestParseCronSundayAlias(t *testing.T) {
+	a, err := parseCron("0 0 * * 7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := parseCron("0 0 * * 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *a != *b {
+		t.Fatalf("7 dan 0 menghasilkan jadwal berbeda: %+v vs %+v", *a, *b)
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@sometimes",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) seharusnya error", expr)
+		}
+	}
+}
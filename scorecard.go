@@ -0,0 +1,361 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/xuri/excelize/v2"
+)
+
+// Scorecard supplier dihitung dari tanggal yang sudah ada di tiap pekerjaan:
+//   - busbar:        mulai ao_busbar_pcc, selesai close_date_busbar_pcc, target panel.target_delivery
+//   - wiring:        mulai created_at, selesai actual_delivery_wiring/closed_at, target target_delivery_wiring
+//   - component:     mulai panel.start_date, selesai panel.closed_date (status_component Done), target panel.target_delivery
+//   - additional_sr: mulai created_at, selesai received_date (tanggal barang
+//     diterima), target close_date (rencana tanggal selesai). Kolom
+//     received_date versi awal di-rename menjadi close_date (migrasi 0001),
+//     jadi pada SR lama yang sudah selesai tanpa received_date, close_date
+//     berisi tanggal terima, bukan target; SR seperti itu tidak ikut dihitung.
+//     Supplier dicocokkan ke company lewat id, baru lewat nama bila tidak ada
+//     id yang cocok.
+//
+// Tepat waktu dibandingkan per tanggal lokal; lead time dan keterlambatan
+// dihitung dalam hari kerja kalender company (atau kalender default).
+const supplierDeliveriesCTE = `
+	deliveries AS (
+		SELECT b.vendor AS company_id, 'busbar' AS category, p.no_pp, p.project,
+			p.ao_busbar_pcc AS started_at, p.close_date_busbar_pcc AS done_at, p.target_delivery AS due_at
+		FROM busbars b JOIN panels p ON p.no_pp = b.panel_no_pp AND p.deleted_at IS NULL
+		UNION ALL
+		SELECT w.supplier, 'wiring', p.no_pp, p.project,
+			w.created_at, COALESCE(w.actual_delivery_wiring, w.closed_at), w.target_delivery_wiring
+		FROM wirings w JOIN panels p ON p.no_pp = w.panel_no_pp AND p.deleted_at IS NULL
+		WHERE COALESCE(w.supplier, '') <> ''
+		UNION ALL
+		SELECT c.vendor, 'component', p.no_pp, p.project,
+			p.start_date, CASE WHEN p.status_component = 'Done' THEN p.closed_date END, p.target_delivery
+		FROM components c JOIN panels p ON p.no_pp = c.panel_no_pp AND p.deleted_at IS NULL
+		UNION ALL
+		SELECT co.id, 'additional_sr', p.no_pp, p.project,
+			sr.created_at, sr.received_date, sr.close_date
+		FROM additional_sr sr
+		JOIN panels p ON p.no_pp = sr.panel_no_pp AND p.deleted_at IS NULL
+		JOIN LATERAL (
+			SELECT co.id FROM companies co
+			WHERE co.id = sr.supplier OR LOWER(co.name) = LOWER(sr.supplier)
+			ORDER BY co.id = sr.supplier DESC, co.id
+			LIMIT 1
+		) co ON true
+		WHERE NOT (sr.received_date IS NULL
+			AND LOWER(COALESCE(sr.status, 'open')) IN ('close', 'closed', 'received', 'done'))
+	),
+	filtered AS (
+		SELECT d.* FROM deliveries d
+		WHERE ($1 = '' OR d.project = $1) AND ($4 = '' OR d.company_id = $4)
+	)`
+
+var scorecardCategories = []string{"busbar", "wiring", "component", "additional_sr"}
+
+type leadTimeStats struct {
+	MinDays *float64       `json:"min_days"`
+	P50Days *float64       `json:"p50_days"`
+	P90Days *float64       `json:"p90_days"`
+	MaxDays *float64       `json:"max_days"`
+	Buckets map[string]int `json:"buckets"`
+}
+
+var leadTimeBuckets = []string{"0-7", "8-14", "15-30", "31-60", ">60"}
+
+type scorecardCategory struct {
+	Category        string        `json:"category"`
+	OpenWorkload    int           `json:"open_workload"`
+	Completed       int           `json:"completed"`
+	WithTarget      int           `json:"with_target"`
+	OnTime          int           `json:"on_time"`
+	OnTimeRate      *float64      `json:"on_time_rate"`
+	Late            int           `json:"late"`
+	AvgLatenessDays *float64      `json:"avg_lateness_days"`
+	LeadTime        leadTimeStats `json:"lead_time"`
+}
+
+type SupplierScorecard struct {
+	CompanyID      string              `json:"company_id"`
+	CompanyName    string              `json:"company_name"`
+	Role           string              `json:"role"`
+	Panels         int                 `json:"panels"`
+	Issues         int                 `json:"issues"`
+	IssuesPerPanel *float64            `json:"issues_per_panel"`
+	OpenWorkload   int                 `json:"open_workload"`
+	Completed      int                 `json:"completed"`
+	OnTimeRate     *float64            `json:"on_time_rate"`
+	Categories     []scorecardCategory `json:"categories"`
+}
+
+type scorecardFilter struct {
+	From, To  time.Time
+	Project   string
+	CompanyID string
+}
+
+func ratio(n, d int) *float64 {
+	if d == 0 {
+		return nil
+	}
+	v := float64(n) / float64(d)
+	return &v
+}
+
+// buildSupplierScorecards menghitung scorecard untuk semua company dengan
+// role vendor. Metrik selesai/tepat waktu/lead time memakai pekerjaan yang
+// selesai di [From, To); open workload dan issue dihitung per saat ini.
+func buildSupplierScorecards(db DBTX, f scorecardFilter) ([]SupplierScorecard, error) {
+	vendorRoles := []string{AppRoleK3, AppRoleK5, AppRoleG3, AppRoleWarehouse}
+	rows, err := db.Query(`SELECT id, name, role FROM companies WHERE role = ANY($1) AND ($2 = '' OR id = $2) ORDER BY name`,
+		pq.Array(vendorRoles), f.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+	cards := []SupplierScorecard{}
+	index := map[string]int{}
+	for rows.Next() {
+		var c SupplierScorecard
+		if err := rows.Scan(&c.CompanyID, &c.CompanyName, &c.Role); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		c.Categories = []scorecardCategory{}
+		index[c.CompanyID] = len(cards)
+		cards = append(cards, c)
+	}
+	rows.Close()
+
+	rows, err = db.Query(`
+		WITH `+supplierDeliveriesCTE+`
+		SELECT f.company_id, f.category,
+			COUNT(*) FILTER (WHERE f.done_at IS NULL),
+			COUNT(*) FILTER (WHERE x.in_period),
+			COUNT(*) FILTER (WHERE x.in_period AND f.due_at IS NOT NULL),
+			COUNT(*) FILTER (WHERE x.in_period AND d.done_day <= d.due_day),
+			COUNT(*) FILTER (WHERE x.in_period AND d.done_day > d.due_day),
+			AVG(x.late_days) FILTER (WHERE x.in_period AND d.done_day > d.due_day),
+			MIN(x.lead_days) FILTER (WHERE x.in_period),
+			percentile_cont(0.5) WITHIN GROUP (ORDER BY x.lead_days) FILTER (WHERE x.in_period),
+			percentile_cont(0.9) WITHIN GROUP (ORDER BY x.lead_days) FILTER (WHERE x.in_period),
+			MAX(x.lead_days) FILTER (WHERE x.in_period),
+			COUNT(*) FILTER (WHERE x.in_period AND x.lead_days <= 7),
+			COUNT(*) FILTER (WHERE x.in_period AND x.lead_days > 7 AND x.lead_days <= 14),
+			COUNT(*) FILTER (WHERE x.in_period AND x.lead_days > 14 AND x.lead_days <= 30),
+			COUNT(*) FILTER (WHERE x.in_period AND x.lead_days > 30 AND x.lead_days <= 60),
+			COUNT(*) FILTER (WHERE x.in_period AND x.lead_days > 60)
+		FROM filtered f
+		CROSS JOIN LATERAL (
+			SELECT calendar_date(k.cal, f.started_at) AS start_day, calendar_date(k.cal, f.done_at) AS done_day,
+				calendar_date(k.cal, f.due_at) AS due_day, k.cal
+			FROM (SELECT (SELECT co.calendar_id FROM companies co WHERE co.id = f.company_id) AS cal) k
+		) d
+		CROSS JOIN LATERAL (
+			SELECT f.done_at >= $2 AND f.done_at < $3 AS in_period,
+				CASE WHEN d.done_day >= d.start_day THEN working_days_between(d.cal, d.start_day, d.done_day) END AS lead_days,
+				CASE WHEN d.done_day > d.due_day THEN working_days_between(d.cal, d.due_day, d.done_day) END AS late_days
+		) x
+		GROUP BY f.company_id, f.category`, f.Project, f.From, f.To, f.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var companyID string
+		var c scorecardCategory
+		var avgLate, minLead, p50, p90, maxLead sql.NullFloat64
+		b := make([]int, len(leadTimeBuckets))
+		if err := rows.Scan(&companyID, &c.Category, &c.OpenWorkload, &c.Completed, &c.WithTarget, &c.OnTime, &c.Late,
+			&avgLate, &minLead, &p50, &p90, &maxLead, &b[0], &b[1], &b[2], &b[3], &b[4]); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		i, ok := index[companyID]
+		if !ok {
+			continue
+		}
+		c.OnTimeRate = ratio(c.OnTime, c.WithTarget)
+		c.AvgLatenessDays = nullFloat(avgLate)
+		c.LeadTime = leadTimeStats{MinDays: nullFloat(minLead), P50Days: nullFloat(p50), P90Days: nullFloat(p90), MaxDays: nullFloat(maxLead), Buckets: map[string]int{}}
+		for j, name := range leadTimeBuckets {
+			c.LeadTime.Buckets[name] = b[j]
+		}
+		cards[i].Categories = append(cards[i].Categories, c)
+	}
+	rows.Close()
+
+	// Issue per panel: issue (yang dibuat di periode) pada panel yang
+	// dikerjakan vendor tersebut.
+	rows, err = db.Query(`
+		WITH `+supplierDeliveriesCTE+`,
+		involved AS (SELECT DISTINCT company_id, no_pp FROM filtered)
+		SELECT inv.company_id, COUNT(DISTINCT inv.no_pp),
+			COUNT(i.id) FILTER (WHERE i.created_at >= $2 AND i.created_at < $3)
+		FROM involved inv
+		LEFT JOIN chats ch ON ch.panel_no_pp = inv.no_pp
+		LEFT JOIN issues i ON i.chat_id = ch.id AND i.deleted_at IS NULL
+		GROUP BY inv.company_id`, f.Project, f.From, f.To, f.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var companyID string
+		var panels, issues int
+		if err := rows.Scan(&companyID, &panels, &issues); err != nil {
+			return nil, err
+		}
+		if i, ok := index[companyID]; ok {
+			cards[i].Panels, cards[i].Issues = panels, issues
+			cards[i].IssuesPerPanel = ratio(issues, panels)
+		}
+	}
+
+	for i := range cards {
+		c := &cards[i]
+		withTarget, onTime := 0, 0
+		sort.Slice(c.Categories, func(x, y int) bool {
+			return categoryOrder(c.Categories[x].Category) < categoryOrder(c.Categories[y].Category)
+		})
+		for _, cat := range c.Categories {
+			c.OpenWorkload += cat.OpenWorkload
+			c.Completed += cat.Completed
+			withTarget += cat.WithTarget
+			onTime += cat.OnTime
+		}
+		c.OnTimeRate = ratio(onTime, withTarget)
+	}
+	return cards, rows.Err()
+}
+
+func categoryOrder(category string) int {
+	for i, c := range scorecardCategories {
+		if c == category {
+			return i
+		}
+	}
+	return len(scorecardCategories)
+}
+
+func nullFloat(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Float64
+}
+
+// getSupplierScorecardsHandler: GET /suppliers/scorecards?from=&to=&project=&company_id=&format=xlsx.
+// Default periode 90 hari terakhir.
+func (a *App) getSupplierScorecardsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := scorecardFilter{Project: q.Get("project"), CompanyID: q.Get("company_id")}
+	f.To = time.Now()
+	f.From = today().AddDate(0, 0, -90)
+	if v, err := parseDateParam(q.Get("from"), false); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Parameter from tidak valid")
+		return
+	} else if v != nil {
+		f.From = *v
+	}
+	if v, err := parseDateParam(q.Get("to"), true); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Parameter to tidak valid")
+		return
+	} else if v != nil {
+		f.To = *v
+	}
+	if !f.To.After(f.From) {
+		respondWithError(w, http.StatusBadRequest, "Rentang tanggal tidak valid")
+		return
+	}
+
+	cards, err := buildSupplierScorecards(a.DB, f)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menghitung scorecard supplier: "+err.Error())
+		return
+	}
+
+	if q.Get("format") == "xlsx" {
+		file, err := scorecardWorkbook(cards, f)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal membuat file excel: "+err.Error())
+			return
+		}
+		buffer, err := file.WriteToBuffer()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal membuat file excel: "+err.Error())
+			return
+		}
+		respondWithJSON(w, http.StatusOK, map[string]string{
+			"bytes":     base64.StdEncoding.EncodeToString(buffer.Bytes()),
+			"extension": "xlsx",
+		})
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"from":       f.From,
+		"to":         f.To,
+		"project":    f.Project,
+		"scorecards": cards,
+	})
+}
+
+func scorecardWorkbook(cards []SupplierScorecard, f scorecardFilter) (*excelize.File, error) {
+	file := excelize.NewFile()
+	period := fmt.Sprintf("%s s.d. %s", f.From.Format("2006-01-02"), f.To.Format("2006-01-02"))
+
+	summaryHeaders := []interface{}{"Company ID", "Vendor", "Role", "Panel", "Issue", "Issue/Panel", "Open Workload", "Selesai", "On-Time Rate (%)"}
+	detailHeaders := []interface{}{"Company ID", "Vendor", "Kategori", "Open Workload", "Selesai", "Dengan Target", "Tepat Waktu",
+		"Terlambat", "On-Time Rate (%)", "Rata-rata Terlambat (hari)", "Lead Min", "Lead P50", "Lead P90", "Lead Max"}
+	for _, b := range leadTimeBuckets {
+		detailHeaders = append(detailHeaders, "Lead "+b+" hari")
+	}
+
+	const summary, detail = "Scorecard", "Detail"
+	file.SetSheetName("Sheet1", summary)
+	if _, err := file.NewSheet(detail); err != nil {
+		return nil, err
+	}
+	file.SetSheetRow(summary, "A1", &[]interface{}{"Periode", period, "Project", f.Project})
+	file.SetSheetRow(summary, "A3", &summaryHeaders)
+	file.SetSheetRow(detail, "A1", &detailHeaders)
+
+	pct := func(v *float64) interface{} {
+		if v == nil {
+			return ""
+		}
+		return *v * 100
+	}
+	num := func(v *float64) interface{} {
+		if v == nil {
+			return ""
+		}
+		return *v
+	}
+	detailRow := 2
+	for i, c := range cards {
+		row := []interface{}{c.CompanyID, c.CompanyName, c.Role, c.Panels, c.Issues, num(c.IssuesPerPanel), c.OpenWorkload, c.Completed, pct(c.OnTimeRate)}
+		cell, _ := excelize.CoordinatesToCellName(1, i+4)
+		file.SetSheetRow(summary, cell, &row)
+
+		for _, cat := range c.Categories {
+			row := []interface{}{c.CompanyID, c.CompanyName, cat.Category, cat.OpenWorkload, cat.Completed, cat.WithTarget, cat.OnTime,
+				cat.Late, pct(cat.OnTimeRate), num(cat.AvgLatenessDays),
+				num(cat.LeadTime.MinDays), num(cat.LeadTime.P50Days), num(cat.LeadTime.P90Days), num(cat.LeadTime.MaxDays)}
+			for _, b := range leadTimeBuckets {
+				row = append(row, cat.LeadTime.Buckets[b])
+			}
+			cell, _ := excelize.CoordinatesToCellName(1, detailRow)
+			file.SetSheetRow(detail, cell, &row)
+			detailRow++
+		}
+	}
+	return file, nil
+}
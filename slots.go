@@ -0,0 +1,947 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Reservasi slot produksi. production_slots.is_occupied tetap dipakai
+// sebagai penanda slot yang sedang terisi, sedangkan rencana pemakaian slot
+// disimpan di slot_reservations (lihat migrasi 0008_slot_reservations).
+
+const defaultProductionLeadDays = 14
+
+// liveReservationEnd adalah tanggal akhir efektif reservasi: reservasi aktif
+// dianggap terus berjalan selama panel belum keluar dari slot.
+const liveReservationEnd = `CASE WHEN r.status = 'active' THEN GREATEST(r.end_date, CURRENT_DATE) ELSE r.end_date END`
+
+type SlotReservation struct {
+	ID           int        `json:"id"`
+	PositionCode string     `json:"position_code"`
+	PanelNoPp    *string    `json:"panel_no_pp,omitempty"`
+	PanelNoPanel *string    `json:"panel_no_panel,omitempty"`
+	StartDate    string     `json:"start_date"`
+	EndDate      string     `json:"end_date"`
+	Status       string     `json:"status"`
+	Note         *string    `json:"note,omitempty"`
+	CreatedBy    *string    `json:"created_by,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ReleasedAt   *time.Time `json:"released_at,omitempty"`
+}
+
+const slotReservationColumns = `r.id, r.position_code, r.panel_no_pp, p.no_panel, r.start_date::text, r.end_date::text,
+	r.status, r.note, r.created_by, r.created_at, r.released_at`
+
+const slotReservationFrom = ` FROM slot_reservations r LEFT JOIN panels p ON p.no_pp = r.panel_no_pp`
+
+func scanSlotReservations(rows *sql.Rows) ([]SlotReservation, error) {
+	defer rows.Close()
+	list := []SlotReservation{}
+	for rows.Next() {
+		var s SlotReservation
+		if err := rows.Scan(&s.ID, &s.PositionCode, &s.PanelNoPp, &s.PanelNoPanel, &s.StartDate, &s.EndDate,
+			&s.Status, &s.Note, &s.CreatedBy, &s.CreatedAt, &s.ReleasedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// productionLeadDays adalah perkiraan lama panel menempati slot sebelum
+// target_delivery dalam hari kerja (env PRODUCTION_LEAD_DAYS).
+func productionLeadDays() int {
+	if days, err := strconv.Atoi(os.Getenv("PRODUCTION_LEAD_DAYS")); err == nil && days > 0 {
+		return days
+	}
+	return defaultProductionLeadDays
+}
+
+// today mengembalikan tanggal hari ini menurut zona waktu kalender default.
+func today() time.Time {
+	return defaultCalendar().Today()
+}
+
+// productionWindow menghitung rentang pemakaian slot untuk panel yang mulai
+// produksi pada start: sampai target_delivery, atau start + lead time (hari
+// kerja) bila target sudah lewat / kosong.
+func productionWindow(start time.Time, target *time.Time) (time.Time, time.Time) {
+	cal := defaultCalendar()
+	end := cal.AddWorkingDays(start, productionLeadDays())
+	if target != nil {
+		t := cal.Date(*target)
+		if !t.Before(start) {
+			end = t
+		}
+	}
+	return start, end
+}
+
+// slotConflicts mengembalikan reservasi hidup di slot yang beririsan dengan
+// [start, end]. Reservasi milik panel exceptPanel dan reservasi exceptID
+// tidak dihitung.
+func slotConflicts(db DBTX, slot string, start, end time.Time, exceptPanel string, exceptID int) ([]SlotReservation, error) {
+	rows, err := db.Query(`SELECT `+slotReservationColumns+slotReservationFrom+`
+		WHERE r.position_code = $1 AND r.status IN ('reserved', 'active')
+			AND r.start_date <= $3::date AND `+liveReservationEnd+` >= $2::date
+			AND r.id <> $5 AND ($4 = '' OR r.panel_no_pp IS DISTINCT FROM $4)
+		ORDER BY r.start_date`, slot, start, end, exceptPanel, exceptID)
+	if err != nil {
+		return nil, err
+	}
+	return scanSlotReservations(rows)
+}
+
+// occupySlot menandai slot terisi oleh panel, mencatat slot_assignments dan
+// mengaktifkan reservasinya. Bila panel belum punya reservasi di slot
+// tersebut, reservasi aktif dibuat.
+func occupySlot(tx *sql.Tx, slot, noPp, actor string, end time.Time) error {
+	if slot == "" {
+		return nil
+	}
+	if _, err := tx.Exec("UPDATE production_slots SET is_occupied = true WHERE position_code = $1", slot); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+		INSERT INTO slot_assignments (position_code, panel_no_pp, no_panel, panel_type, assigned_by)
+		SELECT $1, no_pp, no_panel, panel_type, $3 FROM panels WHERE no_pp = $2
+		ON CONFLICT DO NOTHING`, slot, noPp, actor)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(`
+		UPDATE slot_reservations SET status = 'active', start_date = LEAST(start_date, CURRENT_DATE)
+		WHERE id = (
+			SELECT id FROM slot_reservations
+			WHERE position_code = $1 AND panel_no_pp = $2 AND status IN ('reserved', 'active')
+			ORDER BY (status = 'active') DESC, start_date LIMIT 1
+		)`, slot, noPp)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+	_, err = tx.Exec(`
+		INSERT INTO slot_reservations (position_code, panel_no_pp, start_date, end_date, status, created_by)
+		VALUES ($1, $2, CURRENT_DATE, GREATEST($3::date, CURRENT_DATE), 'active', $4)`, slot, noPp, end, actor)
+	return err
+}
+
+// vacateSlot mengosongkan slot, menutup assignment terbuka dan reservasi
+// aktif panel di slot itu. reason biasanya nama aksi workflow.
+func vacateSlot(tx *sql.Tx, slot, noPp, actor, reason string) error {
+	if slot == "" {
+		return nil
+	}
+	if _, err := tx.Exec("UPDATE production_slots SET is_occupied = false WHERE position_code = $1", slot); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+		UPDATE slot_assignments SET released_at = NOW(), released_by = $3, release_reason = $4
+		WHERE position_code = $1 AND panel_no_pp = $2 AND released_at IS NULL`, slot, noPp, actor, reason)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE slot_reservations
+		SET status = 'released', end_date = GREATEST(start_date, LEAST(end_date, CURRENT_DATE)), released_at = NOW()
+		WHERE position_code = $1 AND panel_no_pp = $2 AND status = 'active'`, slot, noPp)
+	return err
+}
+
+// cancelPanelReservations dipakai saat panel dipindahkan ke trash: reservasi
+// dibatalkan dan assignment yang masih terbuka ditutup.
+func cancelPanelReservations(tx *sql.Tx, noPps []string, actor string) error {
+	_, err := tx.Exec(`
+		UPDATE slot_assignments SET released_at = NOW(), released_by = $2, release_reason = 'trash'
+		WHERE panel_no_pp = ANY($1) AND released_at IS NULL`, pq.Array(noPps), actor)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE slot_reservations
+		SET status = CASE WHEN status = 'active' THEN 'released' ELSE 'cancelled' END,
+			end_date = CASE WHEN status = 'active' THEN GREATEST(start_date, LEAST(end_date, CURRENT_DATE)) ELSE end_date END,
+			released_at = NOW()
+		WHERE panel_no_pp = ANY($1) AND status IN ('reserved', 'active')`, pq.Array(noPps))
+	return err
+}
+
+func respondSlotConflict(w http.ResponseWriter, slot string, conflicts []SlotReservation) {
+	respondWithJSON(w, http.StatusConflict, map[string]interface{}{
+		"error":     fmt.Sprintf("Slot %s sudah dipesan pada rentang tanggal tersebut", slot),
+		"conflicts": conflicts,
+	})
+}
+
+func (a *App) getSlotReservationsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	from, err := parseDateParam(q.Get("from"), false)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Parameter from tidak valid")
+		return
+	}
+	to, err := parseDateParam(q.Get("to"), false)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Parameter to tidak valid")
+		return
+	}
+
+	var where []string
+	var args []interface{}
+	add := func(cond string, v interface{}) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if slot := q.Get("slot"); slot != "" {
+		add("r.position_code = $%d", slot)
+	}
+	if cell := q.Get("cell"); cell != "" {
+		add("split_part(r.position_code, '-', 1) = $%d", cell)
+	}
+	if noPp := q.Get("panel_no_pp"); noPp != "" {
+		add("r.panel_no_pp = $%d", noPp)
+	}
+	if statuses := splitListParam(q, "status"); len(statuses) > 0 {
+		add("r.status = ANY($%d)", pq.Array(statuses))
+	} else {
+		where = append(where, "r.status IN ('reserved', 'active')")
+	}
+	if from != nil {
+		add(liveReservationEnd+" >= $%d::date", *from)
+	}
+	if to != nil {
+		add("r.start_date <= $%d::date", *to)
+	}
+
+	query := `SELECT ` + slotReservationColumns + slotReservationFrom
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	rows, err := a.DB.Query(query+" ORDER BY r.start_date, r.position_code", args...)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil reservasi slot: "+err.Error())
+		return
+	}
+	list, err := scanSlotReservations(rows)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal membaca reservasi slot: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, list)
+}
+
+type slotReservationPayload struct {
+	PositionCode *string `json:"position_code"`
+	PanelNoPp    *string `json:"panel_no_pp"`
+	StartDate    *string `json:"start_date"`
+	EndDate      *string `json:"end_date"`
+	Note         *string `json:"note"`
+}
+
+func getSlotReservation(db DBTX, id int, forUpdate bool) (*SlotReservation, error) {
+	query := `SELECT ` + slotReservationColumns + slotReservationFrom + ` WHERE r.id = $1`
+	if forUpdate {
+		query += " FOR UPDATE OF r"
+	}
+	rows, err := db.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	list, err := scanSlotReservations(rows)
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+	return &list[0], nil
+}
+
+// saveSlotReservation memvalidasi lalu menyimpan reservasi baru (existing
+// nil) atau perubahan reservasi. Response error sudah ditulis bila ok=false.
+func (a *App) saveSlotReservation(w http.ResponseWriter, r *http.Request, existing *SlotReservation, p slotReservationPayload) (int, bool) {
+	slot, noPp, start, end := "", "", "", ""
+	var note *string
+	if existing != nil {
+		slot, start, end, note = existing.PositionCode, existing.StartDate, existing.EndDate, existing.Note
+		if existing.PanelNoPp != nil {
+			noPp = *existing.PanelNoPp
+		}
+	}
+	if p.PositionCode != nil {
+		slot = strings.TrimSpace(*p.PositionCode)
+	}
+	if p.PanelNoPp != nil {
+		noPp = strings.TrimSpace(*p.PanelNoPp)
+	}
+	if p.StartDate != nil {
+		start = *p.StartDate
+	}
+	if p.EndDate != nil {
+		end = *p.EndDate
+	}
+	if p.Note != nil {
+		note = p.Note
+	}
+	if slot == "" || start == "" || end == "" {
+		respondWithError(w, http.StatusBadRequest, "position_code, start_date dan end_date wajib diisi")
+		return 0, false
+	}
+	startDate, errStart := parseDateParam(start, false)
+	endDate, errEnd := parseDateParam(end, false)
+	if errStart != nil || errEnd != nil {
+		respondWithError(w, http.StatusBadRequest, "Format tanggal harus YYYY-MM-DD")
+		return 0, false
+	}
+	if endDate.Before(*startDate) {
+		respondWithError(w, http.StatusBadRequest, "end_date tidak boleh sebelum start_date")
+		return 0, false
+	}
+
+	tx, err := a.DB.Begin()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memulai transaksi: "+err.Error())
+		return 0, false
+	}
+	defer tx.Rollback()
+
+	// Kunci baris slot supaya dua reservasi bersamaan tidak lolos cek konflik.
+	var exists bool
+	err = tx.QueryRow("SELECT true FROM production_slots WHERE position_code = $1 FOR UPDATE", slot).Scan(&exists)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusBadRequest, "Slot "+slot+" tidak terdaftar")
+		return 0, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengunci slot: "+err.Error())
+		return 0, false
+	}
+	var panelNoPp *string
+	if noPp != "" {
+		err = tx.QueryRow("SELECT true FROM panels WHERE no_pp = $1 AND deleted_at IS NULL", noPp).Scan(&exists)
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusBadRequest, "Panel "+noPp+" tidak ditemukan")
+			return 0, false
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal mencari panel: "+err.Error())
+			return 0, false
+		}
+		panelNoPp = &noPp
+	}
+
+	exceptID := 0
+	if existing != nil {
+		exceptID = existing.ID
+	}
+	conflicts, err := slotConflicts(tx, slot, *startDate, *endDate, "", exceptID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memeriksa konflik slot: "+err.Error())
+		return 0, false
+	}
+	if len(conflicts) > 0 {
+		respondSlotConflict(w, slot, conflicts)
+		return 0, false
+	}
+
+	id := exceptID
+	if existing == nil {
+		err = tx.QueryRow(`
+			INSERT INTO slot_reservations (position_code, panel_no_pp, start_date, end_date, note, created_by)
+			VALUES ($1, $2, $3::date, $4::date, $5, $6) RETURNING id`,
+			slot, panelNoPp, *startDate, *endDate, note, requestIdentity(r).Username).Scan(&id)
+	} else {
+		_, err = tx.Exec(`
+			UPDATE slot_reservations SET position_code = $1, panel_no_pp = $2, start_date = $3::date, end_date = $4::date, note = $5
+			WHERE id = $6`, slot, panelNoPp, *startDate, *endDate, note, id)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menyimpan reservasi slot: "+err.Error())
+		return 0, false
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menyelesaikan transaksi: "+err.Error())
+		return 0, false
+	}
+	return id, true
+}
+
+func (a *App) createSlotReservationHandler(w http.ResponseWriter, r *http.Request) {
+	var p slotReservationPayload
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	id, ok := a.saveSlotReservation(w, r, nil, p)
+	if !ok {
+		return
+	}
+	res, err := getSlotReservation(a.DB, id, false)
+	if err != nil || res == nil {
+		respondWithJSON(w, http.StatusCreated, map[string]int{"id": id})
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, res)
+}
+
+func (a *App) updateSlotReservationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ID reservasi tidak valid")
+		return
+	}
+	var p slotReservationPayload
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	existing, err := getSlotReservation(a.DB, id, false)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil reservasi: "+err.Error())
+		return
+	}
+	if existing == nil {
+		respondWithError(w, http.StatusNotFound, "Reservasi tidak ditemukan")
+		return
+	}
+	if existing.Status != "reserved" {
+		respondWithError(w, http.StatusConflict, "Hanya reservasi berstatus reserved yang bisa diubah")
+		return
+	}
+	if _, ok := a.saveSlotReservation(w, r, existing, p); !ok {
+		return
+	}
+	res, _ := getSlotReservation(a.DB, id, false)
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+func (a *App) cancelSlotReservationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ID reservasi tidak valid")
+		return
+	}
+	res, err := a.DB.Exec("UPDATE slot_reservations SET status = 'cancelled', released_at = NOW() WHERE id = $1 AND status = 'reserved'", id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal membatalkan reservasi: "+err.Error())
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		existing, _ := getSlotReservation(a.DB, id, false)
+		if existing == nil {
+			respondWithError(w, http.StatusNotFound, "Reservasi tidak ditemukan")
+			return
+		}
+		respondWithError(w, http.StatusConflict, "Reservasi berstatus "+existing.Status+" tidak bisa dibatalkan")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": "success", "message": "Reservasi dibatalkan"})
+}
+
+// slotWindowParams membaca from/to dengan default hari ini s.d. days hari ke depan.
+func slotWindowParams(r *http.Request, days int) (time.Time, time.Time, error) {
+	from, to := today(), today().AddDate(0, 0, days)
+	if f, err := parseDateParam(r.URL.Query().Get("from"), false); err != nil {
+		return from, to, fmt.Errorf("Parameter from tidak valid")
+	} else if f != nil {
+		from = *f
+	}
+	if t, err := parseDateParam(r.URL.Query().Get("to"), false); err != nil {
+		return from, to, fmt.Errorf("Parameter to tidak valid")
+	} else if t != nil {
+		to = *t
+	}
+	if to.Before(from) {
+		return from, to, fmt.Errorf("Parameter to tidak boleh sebelum from")
+	}
+	return from, to, nil
+}
+
+// getSlotTimelineHandler mengembalikan reservasi per slot dalam satu cell.
+// Slot tanpa reservasi hanya ikut bila include_free=true.
+func (a *App) getSlotTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	cell := r.URL.Query().Get("cell")
+	if cell == "" {
+		respondWithError(w, http.StatusBadRequest, "Parameter cell wajib diisi, contoh: Cell 1")
+		return
+	}
+	from, to, err := slotWindowParams(r, 60)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	includeFree, _ := strconv.ParseBool(r.URL.Query().Get("include_free"))
+
+	type slotTimeline struct {
+		PositionCode string            `json:"position_code"`
+		IsOccupied   bool              `json:"is_occupied"`
+		Reservations []SlotReservation `json:"reservations"`
+	}
+	var slots []*slotTimeline
+	index := map[string]*slotTimeline{}
+
+	rows, err := a.DB.Query(`
+		SELECT position_code, is_occupied FROM production_slots
+		WHERE split_part(position_code, '-', 1) = $1
+		ORDER BY length(position_code), position_code`, cell)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil slot: "+err.Error())
+		return
+	}
+	for rows.Next() {
+		s := &slotTimeline{Reservations: []SlotReservation{}}
+		if err := rows.Scan(&s.PositionCode, &s.IsOccupied); err != nil {
+			rows.Close()
+			respondWithError(w, http.StatusInternalServerError, "Gagal membaca slot: "+err.Error())
+			return
+		}
+		slots = append(slots, s)
+		index[s.PositionCode] = s
+	}
+	rows.Close()
+	if len(slots) == 0 {
+		respondWithError(w, http.StatusNotFound, "Cell "+cell+" tidak ditemukan")
+		return
+	}
+
+	rows, err = a.DB.Query(`SELECT `+slotReservationColumns+slotReservationFrom+`
+		WHERE split_part(r.position_code, '-', 1) = $1 AND r.status IN ('reserved', 'active')
+			AND r.start_date <= $3::date AND `+liveReservationEnd+` >= $2::date
+		ORDER BY r.start_date`, cell, from, to)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil reservasi: "+err.Error())
+		return
+	}
+	reservations, err := scanSlotReservations(rows)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal membaca reservasi: "+err.Error())
+		return
+	}
+	for _, res := range reservations {
+		if s := index[res.PositionCode]; s != nil {
+			s.Reservations = append(s.Reservations, res)
+		}
+	}
+
+	result := []*slotTimeline{}
+	busy := 0
+	for _, s := range slots {
+		if len(s.Reservations) > 0 || s.IsOccupied {
+			busy++
+		} else if !includeFree {
+			continue
+		}
+		result = append(result, s)
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"cell":        cell,
+		"from":        from.Format("2006-01-02"),
+		"to":          to.Format("2006-01-02"),
+		"total_slots": len(slots),
+		"busy_slots":  busy,
+		"slots":       result,
+	})
+}
+
+var forecastBuckets = map[string]string{"day": "1 day", "week": "1 week", "month": "1 month"}
+
+// getSlotForecastHandler memperkirakan kebutuhan slot per periode: slot yang
+// sudah dipesan ditambah panel di warehouse yang belum punya reservasi,
+// dengan asumsi panel menempati slot selama lead_days sebelum target_delivery.
+func (a *App) getSlotForecastHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, err := slotWindowParams(r, 90)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	bucket := r.URL.Query().Get("bucket")
+	if bucket == "" {
+		bucket = "week"
+	}
+	interval, ok := forecastBuckets[bucket]
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Parameter bucket harus day, week atau month")
+		return
+	}
+	leadDays := productionLeadDays()
+	if v := r.URL.Query().Get("lead_days"); v != "" {
+		if leadDays, err = strconv.Atoi(v); err != nil || leadDays < 0 {
+			respondWithError(w, http.StatusBadRequest, "Parameter lead_days tidak valid")
+			return
+		}
+	}
+
+	rows, err := a.DB.Query(`
+		WITH buckets AS (
+			SELECT b::date AS bucket_start, (b + $3::interval - INTERVAL '1 day')::date AS bucket_end
+			FROM generate_series(date_trunc($4, $1::date), $2::date, $3::interval) b
+		)
+		SELECT bk.bucket_start::text, bk.bucket_end::text,
+			(SELECT COUNT(*) FROM production_slots),
+			(SELECT COUNT(DISTINCT r.position_code) FROM slot_reservations r
+				WHERE r.status IN ('reserved', 'active')
+					AND r.start_date <= bk.bucket_end AND `+liveReservationEnd+` >= bk.bucket_start),
+			(SELECT COUNT(*) FROM panels p
+				WHERE p.deleted_at IS NULL AND p.target_delivery IS NOT NULL
+					AND COALESCE(NULLIF(p.status_penyelesaian, ''), 'VendorWarehouse') IN ('Vendor K3', 'VendorWarehouse', 'Warehouse')
+					AND NOT EXISTS (SELECT 1 FROM slot_reservations r WHERE r.panel_no_pp = p.no_pp AND r.status IN ('reserved', 'active'))
+					AND add_working_days(NULL, `+panelLocalTargetDate+`, -$5::int) <= bk.bucket_end AND `+panelLocalTargetDate+` >= bk.bucket_start)
+		FROM buckets bk
+		ORDER BY bk.bucket_start`, from, to, interval, bucket, leadDays)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menghitung forecast: "+err.Error())
+		return
+	}
+	defer rows.Close()
+
+	type forecastBucket struct {
+		Start        string `json:"start"`
+		End          string `json:"end"`
+		Capacity     int    `json:"capacity"`
+		Reserved     int    `json:"reserved"`
+		Unscheduled  int    `json:"unscheduled_demand"`
+		Available    int    `json:"available"`
+		OverCapacity bool   `json:"over_capacity"`
+	}
+	buckets := []forecastBucket{}
+	for rows.Next() {
+		var b forecastBucket
+		if err := rows.Scan(&b.Start, &b.End, &b.Capacity, &b.Reserved, &b.Unscheduled); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal membaca forecast: "+err.Error())
+			return
+		}
+		b.Available = b.Capacity - b.Reserved - b.Unscheduled
+		b.OverCapacity = b.Available < 0
+		buckets = append(buckets, b)
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"bucket":    bucket,
+		"lead_days": leadDays,
+		"buckets":   buckets,
+	})
+}
+
+// suggestSlotsHandler mencarikan slot kosong untuk sekumpulan panel yang akan
+// masuk produksi. Tidak ada reservasi yang dibuat; client memakai hasilnya
+// untuk POST /production-slots/reservations atau transfer.
+func (a *App) suggestSlotsHandler(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		NoPps     []string `json:"no_pps"`
+		StartDate string   `json:"start_date"`
+		Cell      string   `json:"cell"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || len(payload.NoPps) == 0 {
+		respondWithError(w, http.StatusBadRequest, "no_pps wajib diisi")
+		return
+	}
+	if len(payload.NoPps) > 500 {
+		respondWithError(w, http.StatusBadRequest, "Maksimal 500 panel per permintaan")
+		return
+	}
+	start := today()
+	if payload.StartDate != "" {
+		t, err := parseDateParam(payload.StartDate, false)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Format start_date harus YYYY-MM-DD")
+			return
+		}
+		start = *t
+	}
+
+	// Panel dengan target_delivery terdekat didahulukan.
+	rows, err := a.DB.Query(`
+		SELECT no_pp, no_panel, target_delivery FROM panels
+		WHERE no_pp = ANY($1) AND deleted_at IS NULL
+		ORDER BY target_delivery NULLS LAST, no_pp`, pq.Array(payload.NoPps))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil panel: "+err.Error())
+		return
+	}
+	type suggestion struct {
+		NoPp           string     `json:"no_pp"`
+		NoPanel        *string    `json:"no_panel,omitempty"`
+		TargetDelivery *time.Time `json:"target_delivery,omitempty"`
+		StartDate      string     `json:"start_date"`
+		EndDate        string     `json:"end_date"`
+		PositionCode   *string    `json:"position_code"`
+		Reason         string     `json:"reason,omitempty"`
+	}
+	var result []suggestion
+	found := map[string]bool{}
+	for rows.Next() {
+		var s suggestion
+		if err := rows.Scan(&s.NoPp, &s.NoPanel, &s.TargetDelivery); err != nil {
+			rows.Close()
+			respondWithError(w, http.StatusInternalServerError, "Gagal membaca panel: "+err.Error())
+			return
+		}
+		result = append(result, s)
+		found[s.NoPp] = true
+	}
+	rows.Close()
+
+	taken := []string{}
+	for i := range result {
+		s := &result[i]
+		from, until := productionWindow(start, s.TargetDelivery)
+		s.StartDate, s.EndDate = from.Format("2006-01-02"), until.Format("2006-01-02")
+
+		var slot string
+		err := a.DB.QueryRow(`
+			SELECT ps.position_code FROM production_slots ps
+			WHERE ($1 = '' OR split_part(ps.position_code, '-', 1) = $1)
+				AND NOT (ps.position_code = ANY($4))
+				AND NOT ($2::date <= CURRENT_DATE AND ps.is_occupied)
+				AND NOT EXISTS (
+					SELECT 1 FROM slot_reservations r
+					WHERE r.position_code = ps.position_code AND r.status IN ('reserved', 'active')
+						AND r.start_date <= $3::date AND `+liveReservationEnd+` >= $2::date)
+			ORDER BY split_part(ps.position_code, '-', 1), length(ps.position_code), ps.position_code
+			LIMIT 1`, payload.Cell, from, until, pq.Array(taken)).Scan(&slot)
+		if err == sql.ErrNoRows {
+			s.Reason = "Tidak ada slot kosong pada rentang tanggal ini"
+			continue
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal mencari slot kosong: "+err.Error())
+			return
+		}
+		s.PositionCode = &slot
+		taken = append(taken, slot)
+	}
+	for _, noPp := range payload.NoPps {
+		if !found[noPp] {
+			result = append(result, suggestion{NoPp: noPp, Reason: "Panel tidak ditemukan"})
+		}
+	}
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+type SlotAssignment struct {
+	ID            int        `json:"id"`
+	PositionCode  string     `json:"position_code"`
+	PanelNoPp     *string    `json:"panel_no_pp,omitempty"`
+	NoPanel       *string    `json:"no_panel,omitempty"`
+	PanelType     *string    `json:"panel_type,omitempty"`
+	AssignedAt    time.Time  `json:"assigned_at"`
+	AssignedBy    *string    `json:"assigned_by,omitempty"`
+	ReleasedAt    *time.Time `json:"released_at,omitempty"`
+	ReleasedBy    *string    `json:"released_by,omitempty"`
+	ReleaseReason *string    `json:"release_reason,omitempty"`
+	DwellHours    float64    `json:"dwell_hours"`
+}
+
+// analyticsRange membaca from/to untuk laporan slot. Default 30 hari terakhir;
+// batas akhir tidak melewati waktu sekarang.
+func analyticsRange(r *http.Request) (time.Time, time.Time, error) {
+	now := time.Now()
+	from, to := today().AddDate(0, 0, -30), now
+	if f, err := parseDateParam(r.URL.Query().Get("from"), false); err != nil {
+		return from, to, fmt.Errorf("Parameter from tidak valid")
+	} else if f != nil {
+		from = *f
+	}
+	if t, err := parseDateParam(r.URL.Query().Get("to"), true); err != nil {
+		return from, to, fmt.Errorf("Parameter to tidak valid")
+	} else if t != nil && t.Before(now) {
+		to = *t
+	}
+	if !to.After(from) {
+		return from, to, fmt.Errorf("Rentang tanggal tidak valid")
+	}
+	return from, to, nil
+}
+
+func (a *App) getSlotAssignmentsHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, err := analyticsRange(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	q := r.URL.Query()
+	where := []string{"sa.assigned_at < $2", "COALESCE(sa.released_at, NOW()) > $1"}
+	args := []interface{}{from, to}
+	if slot := q.Get("slot"); slot != "" {
+		args = append(args, slot)
+		where = append(where, fmt.Sprintf("sa.position_code = $%d", len(args)))
+	}
+	if row := q.Get("row"); row != "" {
+		args = append(args, row)
+		where = append(where, fmt.Sprintf("split_part(sa.position_code, '-', 1) = $%d", len(args)))
+	}
+	if noPp := q.Get("panel_no_pp"); noPp != "" {
+		args = append(args, noPp)
+		where = append(where, fmt.Sprintf("sa.panel_no_pp = $%d", len(args)))
+	}
+
+	rows, err := a.DB.Query(`
+		SELECT sa.id, sa.position_code, sa.panel_no_pp, sa.no_panel, sa.panel_type, sa.assigned_at, sa.assigned_by,
+			sa.released_at, sa.released_by, sa.release_reason,
+			EXTRACT(EPOCH FROM COALESCE(sa.released_at, NOW()) - sa.assigned_at) / 3600
+		FROM slot_assignments sa
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY sa.assigned_at DESC LIMIT 1000`, args...)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil riwayat slot: "+err.Error())
+		return
+	}
+	defer rows.Close()
+	list := []SlotAssignment{}
+	for rows.Next() {
+		var s SlotAssignment
+		if err := rows.Scan(&s.ID, &s.PositionCode, &s.PanelNoPp, &s.NoPanel, &s.PanelType, &s.AssignedAt, &s.AssignedBy,
+			&s.ReleasedAt, &s.ReleasedBy, &s.ReleaseReason, &s.DwellHours); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal membaca riwayat slot: "+err.Error())
+			return
+		}
+		list = append(list, s)
+	}
+	respondWithJSON(w, http.StatusOK, list)
+}
+
+// getSlotUtilizationHandler menghitung utilisasi slot dalam rentang tanggal,
+// dikelompokkan per baris ("Cell N", group=row) atau per slot (group=slot).
+// Slot idle adalah slot yang sama sekali tidak terisi dalam rentang tersebut.
+func (a *App) getSlotUtilizationHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, err := analyticsRange(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	groupExpr := "split_part(ps.position_code, '-', 1)"
+	orderExpr := "1"
+	switch r.URL.Query().Get("group") {
+	case "", "row":
+	case "slot":
+		groupExpr = "ps.position_code"
+		orderExpr = "split_part(ps.position_code, '-', 1), length(ps.position_code), ps.position_code"
+	default:
+		respondWithError(w, http.StatusBadRequest, "Parameter group harus row atau slot")
+		return
+	}
+	row := r.URL.Query().Get("row")
+
+	rows, err := a.DB.Query(`
+		WITH occ AS (
+			SELECT sa.position_code, COUNT(*) AS assignments,
+				SUM(EXTRACT(EPOCH FROM LEAST(COALESCE(sa.released_at, NOW()), $2) - GREATEST(sa.assigned_at, $1))) AS secs
+			FROM slot_assignments sa
+			WHERE sa.assigned_at < $2 AND COALESCE(sa.released_at, NOW()) > $1
+			GROUP BY sa.position_code
+		)
+		SELECT `+groupExpr+`, COUNT(*), COALESCE(SUM(occ.assignments), 0),
+			COALESCE(SUM(occ.secs), 0) / 3600, COUNT(*) FILTER (WHERE occ.position_code IS NULL)
+		FROM production_slots ps
+		LEFT JOIN occ ON occ.position_code = ps.position_code
+		WHERE ($3 = '' OR split_part(ps.position_code, '-', 1) = $3)
+		GROUP BY `+groupExpr+`
+		ORDER BY `+orderExpr, from, to, row)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menghitung utilisasi slot: "+err.Error())
+		return
+	}
+	defer rows.Close()
+
+	type utilization struct {
+		Group          string  `json:"group"`
+		Slots          int     `json:"slots"`
+		Assignments    int     `json:"assignments"`
+		OccupiedHours  float64 `json:"occupied_hours"`
+		CapacityHours  float64 `json:"capacity_hours"`
+		UtilizationPct float64 `json:"utilization_pct"`
+		IdleSlots      int     `json:"idle_slots"`
+	}
+	rangeHours := to.Sub(from).Hours()
+	result := []utilization{}
+	total := utilization{Group: "total"}
+	for rows.Next() {
+		var u utilization
+		if err := rows.Scan(&u.Group, &u.Slots, &u.Assignments, &u.OccupiedHours, &u.IdleSlots); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal membaca utilisasi slot: "+err.Error())
+			return
+		}
+		u.CapacityHours = float64(u.Slots) * rangeHours
+		if u.CapacityHours > 0 {
+			u.UtilizationPct = u.OccupiedHours / u.CapacityHours * 100
+		}
+		total.Slots += u.Slots
+		total.Assignments += u.Assignments
+		total.OccupiedHours += u.OccupiedHours
+		total.CapacityHours += u.CapacityHours
+		total.IdleSlots += u.IdleSlots
+		result = append(result, u)
+	}
+	if total.CapacityHours > 0 {
+		total.UtilizationPct = total.OccupiedHours / total.CapacityHours * 100
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"from":   from,
+		"to":     to,
+		"total":  total,
+		"groups": result,
+	})
+}
+
+// getSlotDwellTimeHandler menghitung lama panel menempati slot per
+// panel_type untuk assignment yang selesai dalam rentang tanggal.
+// include_open=true ikut menghitung panel yang masih di slot sampai sekarang.
+func (a *App) getSlotDwellTimeHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, err := analyticsRange(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	includeOpen, _ := strconv.ParseBool(r.URL.Query().Get("include_open"))
+
+	rows, err := a.DB.Query(`
+		SELECT COALESCE(NULLIF(sa.panel_type, ''), '-'), COUNT(*),
+			AVG(d.hours), MIN(d.hours), MAX(d.hours),
+			percentile_cont(0.5) WITHIN GROUP (ORDER BY d.hours)
+		FROM slot_assignments sa
+		CROSS JOIN LATERAL (
+			SELECT EXTRACT(EPOCH FROM COALESCE(sa.released_at, NOW()) - sa.assigned_at) / 3600 AS hours
+		) d
+		WHERE (sa.released_at >= $1 AND sa.released_at < $2)
+			OR ($3 AND sa.released_at IS NULL AND sa.assigned_at < $2)
+		GROUP BY 1
+		ORDER BY 1`, from, to, includeOpen)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menghitung dwell time: "+err.Error())
+		return
+	}
+	defer rows.Close()
+
+	type dwell struct {
+		PanelType   string  `json:"panel_type"`
+		Count       int     `json:"count"`
+		AvgHours    float64 `json:"avg_hours"`
+		MinHours    float64 `json:"min_hours"`
+		MaxHours    float64 `json:"max_hours"`
+		MedianHours float64 `json:"median_hours"`
+		AvgDays     float64 `json:"avg_days"`
+	}
+	result := []dwell{}
+	for rows.Next() {
+		var d dwell
+		if err := rows.Scan(&d.PanelType, &d.Count, &d.AvgHours, &d.MinHours, &d.MaxHours, &d.MedianHours); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal membaca dwell time: "+err.Error())
+			return
+		}
+		d.AvgDays = d.AvgHours / 24
+		result = append(result, d)
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"from":         from,
+		"to":           to,
+		"include_open": includeOpen,
+		"panel_types":  result,
+	})
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Perkiraan durasi FAT bila panel belum punya tanggal FAT.
+const defaultFatDays = 3
+
+// Jenis task di timeline. Semua pekerjaan vendor (part) harus selesai
+// sebelum produksi, dan FAT menunggu produksi.
+var timelinePartTasks = []string{"busbar", "component", "palet", "corepart", "wiring"}
+
+type TimelineTask struct {
+	ID           string     `json:"id"`
+	Type         string     `json:"type"`
+	Status       string     `json:"status"`
+	Vendors      []string   `json:"vendors,omitempty"`
+	Progress     *float64   `json:"progress,omitempty"`
+	PlannedStart *time.Time `json:"planned_start"`
+	PlannedEnd   *time.Time `json:"planned_end"`
+	ActualStart  *time.Time `json:"actual_start"`
+	ActualEnd    *time.Time `json:"actual_end"`
+	ForecastEnd  *time.Time `json:"forecast_end"`
+	DependsOn    []string   `json:"depends_on"`
+	Late         bool       `json:"late"`
+	Critical     bool       `json:"critical"`
+}
+
+type PanelTimeline struct {
+	NoPp           string         `json:"no_pp"`
+	NoPanel        *string        `json:"no_panel"`
+	NoWbs          *string        `json:"no_wbs"`
+	PanelType      *string        `json:"panel_type"`
+	State          string         `json:"status_penyelesaian"`
+	StartDate      *time.Time     `json:"start_date"`
+	TargetDelivery *time.Time     `json:"target_delivery"`
+	Deadline       *time.Time     `json:"deadline"`
+	ForecastFinish *time.Time     `json:"forecast_finish"`
+	SlackDays      *int           `json:"slack_days"`
+	Critical       bool           `json:"critical"`
+	Tasks          []TimelineTask `json:"tasks"`
+}
+
+type timelinePanelRow struct {
+	PanelTimeline
+	progress                 float64
+	statusComponent          sql.NullString
+	statusPalet              sql.NullString
+	statusCorepart           sql.NullString
+	statusBusbar             sql.NullString
+	aoBusbar, closeBusbar    *time.Time
+	history                  []byte
+	reservedFrom, reservedTo *time.Time
+	vendors                  map[string][]string
+	wiringCount              int
+	wiringOpen               int
+	wiringStart, wiringEnd   *time.Time
+	wiringTarget             *time.Time
+	wiringProgress           sql.NullFloat64
+	partClosedAt             map[string]*time.Time
+}
+
+func laterOf(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func timePtr(t time.Time) *time.Time { return &t }
+
+// forecast mengisi ForecastEnd dan Late sebuah task. Task yang belum selesai
+// mulai paling cepat saat ready (semua dependensi selesai) dengan durasi
+// sesuai rencana, dan tidak mungkin selesai sebelum hari ini.
+func (t *TimelineTask) forecast(ready time.Time, fallbackDays int) {
+	now := today()
+	if t.ActualEnd != nil {
+		t.ForecastEnd = t.ActualEnd
+		t.Late = t.PlannedEnd != nil && dayStart(*t.ActualEnd).After(*t.PlannedEnd)
+		return
+	}
+	cal := defaultCalendar()
+	days := fallbackDays
+	if t.PlannedStart != nil && t.PlannedEnd != nil && t.PlannedEnd.After(*t.PlannedStart) {
+		days = cal.WorkingDaysBetween(*t.PlannedStart, *t.PlannedEnd)
+	}
+	start := ready
+	if t.ActualStart != nil {
+		start = *t.ActualStart
+	} else if t.PlannedStart != nil {
+		start = laterOf(*t.PlannedStart, ready)
+	}
+	end := laterOf(cal.AddWorkingDays(start, days), now)
+	t.ForecastEnd = &end
+	t.Late = t.PlannedEnd != nil && end.After(*t.PlannedEnd)
+}
+
+func taskStatus(done bool, started bool) string {
+	switch {
+	case done:
+		return "done"
+	case started:
+		return "in_progress"
+	}
+	return "not_started"
+}
+
+// buildPanelTimeline menyusun task Gantt satu panel lalu menghitung perkiraan
+// selesai dan status kritis terhadap deadline (kontrak project atau
+// target_delivery panel).
+func buildPanelTimeline(row *timelinePanelRow, projectDeadline *time.Time) PanelTimeline {
+	p := row.PanelTimeline
+	production, fat, done := workflowMilestones(row.history)
+
+	// Rencana: produksi mengikuti reservasi slot bila ada, selain itu
+	// lead time produksi sebelum FAT; FAT berakhir di target_delivery.
+	var prodStart, prodEnd, fatStart, fatEnd *time.Time
+	if row.reservedFrom != nil {
+		prodStart, prodEnd = row.reservedFrom, row.reservedTo
+	}
+	if p.TargetDelivery != nil {
+		target := dayStart(*p.TargetDelivery)
+		fatEnd = &target
+		fatStart = timePtr(defaultCalendar().AddWorkingDays(target, -defaultFatDays))
+		if prodStart == nil {
+			prodEnd = fatStart
+			prodStart = timePtr(defaultCalendar().AddWorkingDays(*fatStart, -productionLeadDays()))
+		}
+	}
+	var partStart *time.Time
+	if p.StartDate != nil {
+		partStart = timePtr(dayStart(*p.StartDate))
+	}
+
+	parts := map[string]*TimelineTask{
+		"busbar": {
+			Status:      taskStatus(row.statusBusbar.String == "Close", row.aoBusbar != nil),
+			ActualStart: row.aoBusbar,
+			ActualEnd:   row.closeBusbar,
+		},
+		"component": {Status: taskStatus(row.statusComponent.String == "Done", row.statusComponent.String != "" && row.statusComponent.String != "Open")},
+		"palet":     {Status: taskStatus(row.statusPalet.String == "Close", row.statusPalet.String != "" && row.statusPalet.String != "Open")},
+		"corepart":  {Status: taskStatus(row.statusCorepart.String == "Close", row.statusCorepart.String != "" && row.statusCorepart.String != "Open")},
+	}
+	for _, kind := range []string{"component", "palet", "corepart"} {
+		if parts[kind].Status == "done" {
+			parts[kind].ActualEnd = row.partClosedAt[kind]
+		}
+	}
+	if row.wiringCount > 0 {
+		w := &TimelineTask{
+			Status:      taskStatus(row.wiringOpen == 0, row.wiringStart != nil),
+			ActualStart: row.wiringStart,
+			PlannedEnd:  row.wiringTarget,
+		}
+		if row.wiringOpen == 0 {
+			w.ActualEnd = row.wiringEnd
+		}
+		if row.wiringProgress.Valid {
+			w.Progress = &row.wiringProgress.Float64
+		}
+		parts["wiring"] = w
+	}
+
+	now := today()
+	ready := now
+	if partStart != nil {
+		ready = *partStart
+	}
+	partsReady := ready
+	var drivingPart *TimelineTask
+	for _, kind := range timelinePartTasks {
+		t, ok := parts[kind]
+		if !ok {
+			continue
+		}
+		t.ID = p.NoPp + ":" + kind
+		t.Type = kind
+		t.Vendors = row.vendors[kind]
+		t.PlannedStart = partStart
+		if t.PlannedEnd == nil {
+			t.PlannedEnd = prodStart
+		}
+		t.DependsOn = []string{}
+		// Task selesai tanpa tanggal tercatat dianggap tidak menahan produksi.
+		if t.Status == "done" && t.ActualEnd == nil {
+			continue
+		}
+		t.forecast(ready, productionLeadDays())
+		if !t.ForecastEnd.Before(partsReady) {
+			partsReady = *t.ForecastEnd
+			drivingPart = t
+		}
+	}
+
+	// Status produksi/FAT mengikuti status_penyelesaian; tanggalnya dari history.
+	stage := map[string]int{"Production": 1, "Subcontractor": 1, "FAT": 2, "Done": 3}[p.State]
+	prod := &TimelineTask{
+		ID: p.NoPp + ":production", Type: "production",
+		Status:       taskStatus(stage >= 2, stage >= 1),
+		PlannedStart: prodStart, PlannedEnd: prodEnd,
+		ActualStart: production, ActualEnd: fat,
+		Progress: &row.progress,
+	}
+	for _, kind := range timelinePartTasks {
+		if _, ok := parts[kind]; ok {
+			prod.DependsOn = append(prod.DependsOn, p.NoPp+":"+kind)
+		}
+	}
+	fatReady := now
+	if prod.Status != "done" || prod.ActualEnd != nil {
+		prod.forecast(partsReady, productionLeadDays())
+		fatReady = *prod.ForecastEnd
+	}
+
+	fatTask := &TimelineTask{
+		ID: p.NoPp + ":fat", Type: "fat",
+		Status:       taskStatus(stage >= 3, stage >= 2),
+		PlannedStart: fatStart, PlannedEnd: fatEnd,
+		ActualStart: fat, ActualEnd: done,
+		DependsOn: []string{prod.ID},
+	}
+	if fatTask.Status != "done" || fatTask.ActualEnd != nil {
+		fatTask.forecast(fatReady, defaultFatDays)
+	}
+
+	p.ForecastFinish = fatTask.ForecastEnd
+	p.Deadline = projectDeadline
+	if p.Deadline == nil && p.TargetDelivery != nil {
+		p.Deadline = timePtr(dayStart(*p.TargetDelivery))
+	}
+	if p.Deadline != nil && p.ForecastFinish != nil {
+		slack := defaultCalendar().WorkingDaysBetween(*p.ForecastFinish, *p.Deadline)
+		p.SlackDays = &slack
+		p.Critical = slack < 0 && fatTask.Status != "done"
+	}
+	if p.Critical {
+		fatTask.Critical = true
+		if prod.Status != "done" {
+			prod.Critical = true
+			if drivingPart != nil && drivingPart.Status != "done" {
+				drivingPart.Critical = true
+			}
+		}
+	}
+
+	p.Tasks = []TimelineTask{}
+	for _, kind := range timelinePartTasks {
+		if t, ok := parts[kind]; ok {
+			p.Tasks = append(p.Tasks, *t)
+		}
+	}
+	p.Tasks = append(p.Tasks, *prod, *fatTask)
+	return p
+}
+
+// loadTimelineRows mengambil semua bahan timeline untuk panel-panel yang
+// cocok dengan where (alias p), dalam scope role/company.
+func loadTimelineRows(db DBTX, scopeQuery string, scopeArgs []interface{}, where string, whereArgs ...interface{}) ([]*timelinePanelRow, error) {
+	args := append(append([]interface{}{}, scopeArgs...), whereArgs...)
+	rows, err := db.Query(`
+		SELECT p.no_pp, p.no_panel, p.no_wbs, p.panel_type, COALESCE(p.status_penyelesaian, ''),
+			p.start_date, p.target_delivery, COALESCE(p.percent_progress, 0),
+			p.status_busbar_pcc, p.status_component, p.status_palet, p.status_corepart,
+			p.ao_busbar_pcc, p.close_date_busbar_pcc, p.history_stack,
+			r.start_date::timestamptz, r.end_date::timestamptz
+		FROM panels p
+		LEFT JOIN LATERAL (
+			SELECT start_date, end_date FROM slot_reservations r
+			WHERE r.panel_no_pp = p.no_pp AND r.status IN ('reserved', 'active')
+			ORDER BY (r.status = 'active') DESC, r.start_date DESC LIMIT 1
+		) r ON true
+		WHERE p.deleted_at IS NULL AND p.no_pp IN (`+scopeQuery+`) `+where+`
+		ORDER BY p.target_delivery NULLS LAST, p.no_pp`, args...)
+	if err != nil {
+		return nil, err
+	}
+	var list []*timelinePanelRow
+	index := map[string]*timelinePanelRow{}
+	for rows.Next() {
+		row := &timelinePanelRow{vendors: map[string][]string{}, partClosedAt: map[string]*time.Time{}}
+		if err := rows.Scan(&row.NoPp, &row.NoPanel, &row.NoWbs, &row.PanelType, &row.State,
+			&row.StartDate, &row.TargetDelivery, &row.progress,
+			&row.statusBusbar, &row.statusComponent, &row.statusPalet, &row.statusCorepart,
+			&row.aoBusbar, &row.closeBusbar, &row.history, &row.reservedFrom, &row.reservedTo); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		row.State = normalizeWorkflowState(row.State)
+		list = append(list, row)
+		index[row.NoPp] = row
+	}
+	rows.Close()
+	if len(list) == 0 {
+		return list, nil
+	}
+	noPps := make([]string, 0, len(list))
+	for _, row := range list {
+		noPps = append(noPps, row.NoPp)
+	}
+
+	rows, err = db.Query(`
+		SELECT x.kind, x.panel_no_pp, c.name FROM (
+			SELECT 'busbar' AS kind, panel_no_pp, vendor FROM busbars
+			UNION ALL SELECT 'component', panel_no_pp, vendor FROM components
+			UNION ALL SELECT 'palet', panel_no_pp, vendor FROM palet
+			UNION ALL SELECT 'corepart', panel_no_pp, vendor FROM corepart
+			UNION ALL SELECT 'wiring', panel_no_pp, supplier FROM wirings WHERE archived_at IS NULL AND COALESCE(supplier, '') <> ''
+		) x JOIN companies c ON c.id = x.vendor
+		WHERE x.panel_no_pp = ANY($1)
+		ORDER BY c.name`, pq.Array(noPps))
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var kind, noPp, name string
+		if err := rows.Scan(&kind, &noPp, &name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[noPp].vendors[kind] = append(index[noPp].vendors[kind], name)
+	}
+	rows.Close()
+
+	rows, err = db.Query(`
+		SELECT panel_no_pp, COUNT(*),
+			COUNT(*) FILTER (WHERE closed_at IS NULL AND actual_delivery_wiring IS NULL),
+			MIN(created_at), MAX(COALESCE(actual_delivery_wiring, closed_at)),
+			MIN(target_delivery_wiring), AVG(progress)
+		FROM wirings WHERE archived_at IS NULL AND panel_no_pp = ANY($1)
+		GROUP BY panel_no_pp`, pq.Array(noPps))
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var noPp string
+		var w timelinePanelRow
+		if err := rows.Scan(&noPp, &w.wiringCount, &w.wiringOpen, &w.wiringStart, &w.wiringEnd, &w.wiringTarget, &w.wiringProgress); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		row := index[noPp]
+		row.wiringCount, row.wiringOpen, row.wiringStart, row.wiringEnd = w.wiringCount, w.wiringOpen, w.wiringStart, w.wiringEnd
+		row.wiringTarget, row.wiringProgress = w.wiringTarget, w.wiringProgress
+	}
+	rows.Close()
+
+	// Component/palet/corepart tidak punya kolom tanggal selesai; diambil dari
+	// audit saat statusnya terakhir berubah menjadi Done/Close.
+	rows, err = db.Query(`
+		SELECT e.panel_no_pp, c.key, MAX(e.occurred_at)
+		FROM audit_events e, jsonb_each(e.changes) c
+		WHERE e.entity = 'panel' AND e.panel_no_pp = ANY($1)
+			AND c.key IN ('status_component', 'status_palet', 'status_corepart')
+			AND c.value->>'to' IN ('Done', 'Close')
+		GROUP BY e.panel_no_pp, c.key`, pq.Array(noPps))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var noPp, key string
+		var at time.Time
+		if err := rows.Scan(&noPp, &key, &at); err != nil {
+			return nil, err
+		}
+		index[noPp].partClosedAt[key[len("status_"):]] = &at
+	}
+	return list, rows.Err()
+}
+
+// getProjectTimelineHandler: GET /projects/{id}/timeline?wbs_id=&critical_only=true.
+// Mengembalikan task Gantt per panel beserta perkiraan selesai dan penanda
+// panel kritis yang mengancam deadline project.
+func (a *App) getProjectTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	projectID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ID project tidak valid")
+		return
+	}
+	id := requestIdentity(r)
+	scopeQuery, scopeArgs, ok := panelScopeQuery(id.Role, id.CompanyID)
+	if !ok {
+		respondWithError(w, http.StatusForbidden, "Role tidak dikenal")
+		return
+	}
+	project, err := scanProject(a.DB.QueryRow(`SELECT `+projectColumns+` FROM projects pr WHERE pr.id = $1`, projectID))
+	if err != nil {
+		respondProjectError(w, err, "Project")
+		return
+	}
+	// Customer, tanggal kontrak dan catatan project hanya untuk pemilik
+	// panel project ini, sama seperti getProjectHandler.
+	visible, err := projectVisibleTo(a.DB, id, projectID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memeriksa project: "+err.Error())
+		return
+	}
+	if !visible {
+		respondWithError(w, http.StatusNotFound, "Project tidak ditemukan")
+		return
+	}
+	var deadline *time.Time
+	if project.ContractDeliveryDate != nil {
+		deadline, _ = parseDateParam(*project.ContractDeliveryDate, false)
+	}
+
+	where := "AND p.project_id = $" + strconv.Itoa(len(scopeArgs)+1)
+	whereArgs := []interface{}{projectID}
+	if s := r.URL.Query().Get("wbs_id"); s != "" {
+		wbsID, err := strconv.Atoi(s)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "wbs_id tidak valid")
+			return
+		}
+		where += " AND p.wbs_id = $" + strconv.Itoa(len(scopeArgs)+2)
+		whereArgs = append(whereArgs, wbsID)
+	}
+	criticalOnly, _ := strconv.ParseBool(r.URL.Query().Get("critical_only"))
+
+	rows, err := loadTimelineRows(a.DB, scopeQuery, scopeArgs, where, whereArgs...)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil data timeline: "+err.Error())
+		return
+	}
+
+	panels := []PanelTimeline{}
+	critical := []string{}
+	var start, finish *time.Time
+	for _, row := range rows {
+		p := buildPanelTimeline(row, deadline)
+		for _, t := range p.Tasks {
+			for _, d := range []*time.Time{t.PlannedStart, t.ActualStart} {
+				if d != nil && (start == nil || d.Before(*start)) {
+					start = d
+				}
+			}
+		}
+		if p.ForecastFinish != nil && (finish == nil || p.ForecastFinish.After(*finish)) {
+			finish = p.ForecastFinish
+		}
+		if p.Critical {
+			critical = append(critical, p.NoPp)
+		}
+		if criticalOnly && !p.Critical {
+			continue
+		}
+		panels = append(panels, p)
+	}
+	sort.Strings(critical)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"project":         project,
+		"deadline":        deadline,
+		"start":           start,
+		"forecast_finish": finish,
+		"critical_panels": critical,
+		"panels":          panels,
+	})
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const defaultTrashRetentionDays = 30
+
+// softDeletePanelsQuery memindahkan panel ke trash. Slot produksi dilepas
+// supaya bisa dipakai panel lain; restore tidak mengambil slotnya kembali.
+const softDeletePanelsQuery = `
+	UPDATE public.panels SET deleted_at = NOW(), deleted_by = $2, production_slot = NULL
+	WHERE no_pp = ANY($1) AND deleted_at IS NULL AND ($3::bigint IS NULL OR version = $3)`
+
+type TrashItem struct {
+	Type      string     `json:"type"`
+	ID        string     `json:"id"`
+	PanelNoPp *string    `json:"panel_no_pp"`
+	Label     string     `json:"label"`
+	DeletedAt time.Time  `json:"deleted_at"`
+	DeletedBy *string    `json:"deleted_by"`
+	PurgeAt   *time.Time `json:"purge_at,omitempty"`
+}
+
+type trashType struct {
+	Table string
+	// List mengembalikan kolom type, id, panel_no_pp, label, deleted_at, deleted_by.
+	List string
+	// Parent mencari apakah induk item masih di trash (kosong untuk panel).
+	Parent string
+}
+
+var trashTypes = map[string]trashType{
+	"panel": {
+		Table: "panels",
+		List: `SELECT 'panel', no_pp, no_pp, COALESCE(no_panel, '') || ' / ' || COALESCE(project, ''), deleted_at, deleted_by
+			FROM panels WHERE deleted_at IS NOT NULL`,
+	},
+	"issue": {
+		Table: "issues",
+		List: `SELECT 'issue', i.id::text, c.panel_no_pp, i.title, i.deleted_at, i.deleted_by
+			FROM issues i JOIN chats c ON c.id = i.chat_id WHERE i.deleted_at IS NOT NULL`,
+		Parent: `SELECT CASE WHEN p.deleted_at IS NOT NULL THEN 'panel ' || p.no_pp END
+			FROM issues i JOIN chats c ON c.id = i.chat_id JOIN panels p ON p.no_pp = c.panel_no_pp
+			WHERE i.id::text = $1`,
+	},
+	"comment": {
+		Table: "issue_comments",
+		List: `SELECT 'comment', ic.id::text, c.panel_no_pp, LEFT(ic.text, 120), ic.deleted_at, ic.deleted_by
+			FROM issue_comments ic JOIN issues i ON i.id = ic.issue_id JOIN chats c ON c.id = i.chat_id
+			WHERE ic.deleted_at IS NOT NULL`,
+		Parent: `SELECT CASE WHEN p.deleted_at IS NOT NULL THEN 'panel ' || p.no_pp
+				WHEN i.deleted_at IS NOT NULL THEN 'issue ' || i.id END
+			FROM issue_comments ic JOIN issues i ON i.id = ic.issue_id
+			JOIN chats c ON c.id = i.chat_id JOIN panels p ON p.no_pp = c.panel_no_pp
+			WHERE ic.id::text = $1`,
+	},
+}
+
+// Path /trash/{type}/{id} menerima bentuk tunggal maupun jamak.
+func trashTypeFromPath(name string) (string, bool) {
+	name = strings.TrimSuffix(strings.ToLower(name), "s")
+	_, ok := trashTypes[name]
+	return name, ok
+}
+
+func (t trashType) keyColumn() string {
+	if t.Table == "panels" {
+		return "no_pp"
+	}
+	return "id"
+}
+
+// trashRetention dibaca dari TRASH_RETENTION_DAYS (default 30 hari).
+// Nilai 0 atau negatif mematikan purge otomatis.
+func trashRetention() time.Duration {
+	days := defaultTrashRetentionDays
+	if v := os.Getenv("TRASH_RETENTION_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			days = n
+		} else {
+			log.Printf("TRASH_RETENTION_DAYS tidak valid (%q), memakai %d hari", v, days)
+		}
+	}
+	if days <= 0 {
+		return 0
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func (a *App) getTrashHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	types := splitListParam(q, "type")
+	if len(types) == 0 {
+		types = []string{"panel", "issue", "comment"}
+	}
+	var parts []string
+	for _, t := range types {
+		name, ok := trashTypeFromPath(t)
+		if !ok {
+			respondWithError(w, http.StatusBadRequest, "Tipe trash tidak dikenal: "+t)
+			return
+		}
+		parts = append(parts, trashTypes[name].List)
+	}
+
+	var args []interface{}
+	where := ""
+	if v := q.Get("panel_no_pp"); v != "" {
+		args = append(args, v)
+		where = " WHERE panel_no_pp = $1"
+	}
+	limit, offset := 100, 0
+	var err error
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			respondWithError(w, http.StatusBadRequest, "limit harus berupa angka positif")
+			return
+		}
+		if limit > 1000 {
+			limit = 1000
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			respondWithError(w, http.StatusBadRequest, "offset tidak valid")
+			return
+		}
+	}
+
+	base := "SELECT * FROM (" + strings.Join(parts, " UNION ALL ") + ") AS t(type, id, panel_no_pp, label, deleted_at, deleted_by)" + where
+	var total int
+	if err := a.DB.QueryRow("SELECT COUNT(*) FROM ("+base+") c", args...).Scan(&total); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menghitung trash: "+err.Error())
+		return
+	}
+	args = append(args, limit, offset)
+	rows, err := a.DB.Query(fmt.Sprintf("%s ORDER BY deleted_at DESC LIMIT $%d OFFSET $%d", base, len(args)-1, len(args)), args...)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil trash: "+err.Error())
+		return
+	}
+	defer rows.Close()
+
+	retention := trashRetention()
+	items := []TrashItem{}
+	for rows.Next() {
+		var it TrashItem
+		if err := rows.Scan(&it.Type, &it.ID, &it.PanelNoPp, &it.Label, &it.DeletedAt, &it.DeletedBy); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal membaca trash: "+err.Error())
+			return
+		}
+		if retention > 0 {
+			purgeAt := it.DeletedAt.Add(retention)
+			it.PurgeAt = &purgeAt
+		}
+		items = append(items, it)
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	respondWithJSON(w, http.StatusOK, items)
+}
+
+func (a *App) restoreTrashHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name, ok := trashTypeFromPath(vars["type"])
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Tipe trash tidak dikenal: "+vars["type"])
+		return
+	}
+	t, id := trashTypes[name], vars["id"]
+
+	// Item tidak bisa dipulihkan selama induknya masih di trash.
+	if t.Parent != "" {
+		var parent sql.NullString
+		err := a.DB.QueryRow(t.Parent, id).Scan(&parent)
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Item tidak ditemukan di trash")
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if parent.Valid {
+			respondWithError(w, http.StatusConflict, fmt.Sprintf("Pulihkan %s terlebih dahulu.", parent.String))
+			return
+		}
+	}
+
+	tx, err := a.DB.Begin()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memulai transaksi: "+err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	var audit *auditScope
+	if name == "panel" {
+		audit = beginAudit(tx, "panel", "t.no_pp = $1", id)
+	}
+	res, err := tx.Exec(fmt.Sprintf("UPDATE %s SET deleted_at = NULL, deleted_by = NULL WHERE %s::text = $1 AND deleted_at IS NOT NULL", t.Table, t.keyColumn()), id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memulihkan: "+err.Error())
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusNotFound, "Item tidak ditemukan di trash")
+		return
+	}
+	if audit != nil {
+		audit.record(tx, requestIdentity(r).Username, AuditSourceAPI)
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal commit transaksi: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": "restored", "type": name, "id": id})
+}
+
+// purgeTrashItemHandler menghapus permanen satu item yang sudah di trash,
+// termasuk seluruh data turunannya (ON DELETE CASCADE).
+func (a *App) purgeTrashItemHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name, ok := trashTypeFromPath(vars["type"])
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Tipe trash tidak dikenal: "+vars["type"])
+		return
+	}
+	t, id := trashTypes[name], vars["id"]
+
+	tx, err := a.DB.Begin()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal memulai transaksi: "+err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	var audit *auditScope
+	if name == "panel" {
+		audit = beginAudit(tx, "panel", "t.no_pp = $1", id)
+	}
+	res, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s::text = $1 AND deleted_at IS NOT NULL", t.Table, t.keyColumn()), id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal menghapus permanen: "+err.Error())
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusNotFound, "Item tidak ditemukan di trash")
+		return
+	}
+	if audit != nil {
+		audit.record(tx, requestIdentity(r).Username, AuditSourcePurge)
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal commit transaksi: "+err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": "purged", "type": name, "id": id})
+}
+
+// purgeTrash menghapus permanen item yang masuk trash sebelum cutoff dan
+// mengembalikan jumlah baris per tipe.
+func purgeTrash(db *sql.DB, cutoff time.Time) (map[string]int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	audit := beginAudit(tx, "panel", "t.deleted_at < $1", cutoff)
+	counts := map[string]int64{}
+	// Urutan anak dulu supaya jumlah per tipe tidak tertelan cascade.
+	for _, name := range []string{"comment", "issue", "panel"} {
+		res, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE deleted_at < $1", trashTypes[name].Table), cutoff)
+		if err != nil {
+			return nil, fmt.Errorf("purge %s: %w", name, err)
+		}
+		counts[name], _ = res.RowsAffected()
+	}
+	audit.record(tx, "", AuditSourcePurge)
+	return counts, tx.Commit()
+}
+
+func (a *App) runTrashPurge() error {
+	retention := trashRetention()
+	if retention == 0 {
+		return nil
+	}
+	counts, err := purgeTrash(a.DB, time.Now().Add(-retention))
+	if err != nil {
+		return fmt.Errorf("purge trash gagal: %w", err)
+	}
+	if counts["panel"]+counts["issue"]+counts["comment"] > 0 {
+		log.Printf("Purge trash: %d panel, %d issue, %d komentar dihapus permanen.", counts["panel"], counts["issue"], counts["comment"])
+	}
+	return nil
+}
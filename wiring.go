@@ -0,0 +1,200 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Paket wiring per panel (lihat migrasi 0010_wiring_packages). Panel lama
+// dan transfer biasa hanya punya satu paket bernama defaultWiringPackage.
+const defaultWiringPackage = "Utama"
+
+// wiringPackageExpr mengembalikan ekspresi SQL nama paket: nilai param bila
+// diisi, selain itu paket aktif tertua milik panel $1.
+func wiringPackageExpr(param string) string {
+	return `COALESCE(NULLIF(` + param + `, ''), (
+		SELECT w2.package_name FROM wirings w2
+		WHERE w2.panel_no_pp = $1 AND w2.archived_at IS NULL
+		ORDER BY w2.created_at, w2.id LIMIT 1))`
+}
+
+// setWiringActor menyimpan actor dan source di transaksi berjalan untuk
+// trigger wiring_progress_events (migrasi 0022). Riwayat progres tetap
+// tercatat tanpa ini, hanya saja dengan source 'db' dan tanpa actor.
+func setWiringActor(tx *sql.Tx, actor string, source auditSource) error {
+	_, err := tx.Exec(`SELECT set_config('secpanel.actor', $1, true), set_config('secpanel.source', $2, true)`, actor, string(source))
+	if err != nil {
+		return fmt.Errorf("gagal menyimpan actor wiring: %w", err)
+	}
+	return nil
+}
+
+// fetchWiringSummaries mengembalikan satu *Wiring gabungan per panel untuk
+// export, dari paket-paket yang masih aktif.
+func fetchWiringSummaries(db DBTX, noPps []string) ([]interface{}, error) {
+	rows, err := db.Query(`
+		SELECT panel_no_pp, progress, status, COALESCE(suppliers, ''), target_delivery_wiring
+		FROM panel_wiring_summary WHERE panel_no_pp = ANY($1)`, pq.Array(noPps))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	results := []interface{}{}
+	for rows.Next() {
+		w := &Wiring{}
+		if err := rows.Scan(&w.PanelNoPP, &w.Progress, &w.Status, &w.Supplier, &w.TargetDeliveryWiring); err != nil {
+			return nil, err
+		}
+		results = append(results, w)
+	}
+	return results, rows.Err()
+}
+
+type WiringProgressEvent struct {
+	ID           int64     `json:"id"`
+	WiringID     int       `json:"wiring_id"`
+	PackageName  *string   `json:"package_name,omitempty"`
+	Supplier     *string   `json:"supplier,omitempty"`
+	ProgressFrom *int      `json:"progress_from,omitempty"`
+	Progress     int       `json:"progress"`
+	Status       *string   `json:"status,omitempty"`
+	Actor        *string   `json:"actor,omitempty"`
+	Source       string    `json:"source"`
+	RecordedAt   time.Time `json:"recorded_at"`
+}
+
+// getWiringProgressHandler mengembalikan riwayat progres wiring sebuah panel
+// per paket, ditambah seri harian progres gabungan (rata-rata paket yang
+// sudah ada pada hari itu, memakai progres terakhir yang diketahui).
+func (a *App) getWiringProgressHandler(w http.ResponseWriter, r *http.Request) {
+	noPp := mux.Vars(r)["no_pp"]
+	includeArchived, _ := strconv.ParseBool(r.URL.Query().Get("include_archived"))
+	from, err := parseDateParam(r.URL.Query().Get("from"), false)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Parameter from tidak valid")
+		return
+	}
+
+	type wiringPackage struct {
+		WiringID    int                   `json:"wiring_id"`
+		PackageName string                `json:"package_name"`
+		Supplier    *string               `json:"supplier,omitempty"`
+		Progress    *int                  `json:"progress,omitempty"`
+		Status      *string               `json:"status,omitempty"`
+		ArchivedAt  *time.Time            `json:"archived_at,omitempty"`
+		Deleted     bool                  `json:"deleted,omitempty"`
+		Events      []WiringProgressEvent `json:"events"`
+	}
+
+	// Paket yang sudah dihapus tetap muncul dari riwayat event-nya.
+	rows, err := a.DB.Query(`
+		SELECT e.id, e.wiring_id, e.package_name, e.supplier, e.progress_from, e.progress, e.status,
+			e.actor, e.source, e.recorded_at,
+			w.id IS NULL, w.package_name, w.supplier, w.progress, w.status, w.archived_at
+		FROM wiring_progress_events e
+		LEFT JOIN wirings w ON w.id = e.wiring_id
+		WHERE e.panel_no_pp = $1 AND ($2 OR w.archived_at IS NULL)
+		ORDER BY e.recorded_at, e.id`, noPp, includeArchived)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Gagal mengambil riwayat progres wiring: "+err.Error())
+		return
+	}
+	defer rows.Close()
+
+	var packages []*wiringPackage
+	index := map[int]*wiringPackage{}
+	for rows.Next() {
+		var e WiringProgressEvent
+		var deleted bool
+		var name, supplier, status sql.NullString
+		var progress sql.NullInt64
+		var archivedAt *time.Time
+		if err := rows.Scan(&e.ID, &e.WiringID, &e.PackageName, &e.Supplier, &e.ProgressFrom, &e.Progress, &e.Status,
+			&e.Actor, &e.Source, &e.RecordedAt, &deleted, &name, &supplier, &progress, &status, &archivedAt); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Gagal membaca riwayat progres wiring: "+err.Error())
+			return
+		}
+		if deleted && !includeArchived {
+			continue
+		}
+		pkg := index[e.WiringID]
+		if pkg == nil {
+			pkg = &wiringPackage{WiringID: e.WiringID, Deleted: deleted, ArchivedAt: archivedAt, Events: []WiringProgressEvent{}}
+			if name.Valid {
+				pkg.PackageName = name.String
+			} else if e.PackageName != nil {
+				pkg.PackageName = *e.PackageName
+			}
+			if supplier.Valid {
+				pkg.Supplier = &supplier.String
+			}
+			if progress.Valid {
+				p := int(progress.Int64)
+				pkg.Progress = &p
+			}
+			if status.Valid {
+				pkg.Status = &status.String
+			}
+			index[e.WiringID] = pkg
+			packages = append(packages, pkg)
+		}
+		pkg.Events = append(pkg.Events, e)
+	}
+	if err := rows.Err(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	type dailyProgress struct {
+		Date     string `json:"date"`
+		Progress int    `json:"progress"`
+		Packages int    `json:"packages"`
+	}
+	daily := []dailyProgress{}
+	var all []WiringProgressEvent
+	for _, pkg := range packages {
+		all = append(all, pkg.Events...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].RecordedAt.Before(all[j].RecordedAt) })
+	if len(all) > 0 {
+		last := map[int]int{}
+		day := dayStart(all[0].RecordedAt)
+		end := dayStart(time.Now())
+		i := 0
+		for !day.After(end) {
+			next := day.AddDate(0, 0, 1)
+			for i < len(all) && all[i].RecordedAt.Before(next) {
+				last[all[i].WiringID] = all[i].Progress
+				i++
+			}
+			if from == nil || !day.Before(dayStart(*from)) {
+				total := 0
+				for _, p := range last {
+					total += p
+				}
+				daily = append(daily, dailyProgress{Date: day.Format("2006-01-02"), Progress: total / len(last), Packages: len(last)})
+			}
+			day = next
+		}
+	}
+
+	if packages == nil {
+		packages = []*wiringPackage{}
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"panel_no_pp": noPp,
+		"packages":    packages,
+		"daily":       daily,
+	})
+}
+
+func dayStart(t time.Time) time.Time {
+	return defaultCalendar().Date(t)
+}
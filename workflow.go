@@ -0,0 +1,670 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Workflow status_penyelesaian panel. Transfer tunggal maupun mass transfer
+// sama-sama dijalankan lewat runTransition supaya aturan dan efek sampingnya
+// tidak bercabang.
+
+type workflowState struct {
+	Name    string   `json:"name"`
+	Label   string   `json:"label"`
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+var workflowStates = []workflowState{
+	{Name: "Vendor K3", Label: "Di Vendor K3"},
+	{Name: "VendorWarehouse", Label: "Warehouse", Aliases: []string{"Warehouse"}},
+	{Name: "Production", Label: "Produksi"},
+	{Name: "Subcontractor", Label: "Subkontraktor"},
+	{Name: "FAT", Label: "FAT"},
+	{Name: "Done", Label: "Selesai"},
+}
+
+// defaultWorkflowState dipakai untuk panel yang status_penyelesaian-nya kosong.
+const defaultWorkflowState = "VendorWarehouse"
+
+type workflowGuard struct {
+	Description string
+	// check mengembalikan *workflowError bila guard tidak terpenuhi. req nil
+	// berarti hanya pratinjau (GET workflow panel), sehingga guard yang
+	// bergantung pada isi request dilewati.
+	check func(db DBTX, p *workflowPanel, req *transferRequest) error
+}
+
+type workflowTransition struct {
+	Action   string   `json:"action"`
+	Label    string   `json:"label"`
+	From     []string `json:"from,omitempty"` // kosong = dari status mana pun
+	To       string   `json:"to,omitempty"`   // kosong = status tidak berubah / ditentukan history
+	Requires []string `json:"requires,omitempty"`
+	Guards   []string `json:"guards,omitempty"`
+	// DateParam adalah field payload yang menjadi timestamp snapshot history.
+	DateParam string `json:"date_param,omitempty"`
+	apply     func(tx *sql.Tx, p *workflowPanel, req transferRequest, history []byte) error
+}
+
+var workflowGuards map[string]workflowGuard
+var workflowTransitions []workflowTransition
+
+func init() {
+	workflowGuards = map[string]workflowGuard{
+		"has_history": {
+			Description: "Panel punya riwayat transfer untuk di-rollback",
+			check: func(db DBTX, p *workflowPanel, req *transferRequest) error {
+				if len(p.History) == 0 {
+					return workflowErrorf(http.StatusBadRequest, "No history to rollback to.")
+				}
+				return nil
+			},
+		},
+		"slot_available": {
+			Description: "Slot produksi (bila diisi) terdaftar, belum terisi dan tidak dipesan panel lain",
+			check:       guardSlotAvailable,
+		},
+		"vendor_required": {
+			Description: "Vendor subkontraktor wajib diisi",
+			check: func(db DBTX, p *workflowPanel, req *transferRequest) error {
+				if req != nil && strings.TrimSpace(req.Vendor) == "" {
+					return workflowErrorf(http.StatusBadRequest, "Vendor wajib diisi")
+				}
+				return nil
+			},
+		},
+		"wiring_closed": {
+			Description: "Semua paket wiring aktif harus 100% dan Closed sebelum FAT",
+			check:       guardWiringClosed,
+		},
+	}
+
+	workflowTransitions = []workflowTransition{
+		{
+			Action: "to_production", Label: "Kirim ke Produksi",
+			From: []string{"Vendor K3", "VendorWarehouse"}, To: "Production",
+			Requires: []string{"slot"}, Guards: []string{"slot_available"},
+			DateParam: "production_date", apply: applyToProduction,
+		},
+		{
+			Action: "to_subcontractor", Label: "Kirim ke Subkontraktor",
+			From: []string{"Vendor K3", "VendorWarehouse", "Production"}, To: "Subcontractor",
+			Requires: []string{"vendor"}, Guards: []string{"vendor_required"},
+			DateParam: "production_date", apply: applyToSubcontractor,
+		},
+		{
+			Action: "to_fat", Label: "Lanjut ke FAT",
+			From: []string{"Production", "Subcontractor"}, To: "FAT",
+			Guards: []string{"wiring_closed"}, DateParam: "fat_date", apply: applyToFAT,
+		},
+		{
+			Action: "to_done", Label: "Tandai Selesai",
+			From: []string{"FAT"}, To: "Done",
+			DateParam: "all_done_date", apply: applyToDone,
+		},
+		{
+			Action: "rollback", Label: "Rollback ke status sebelumnya",
+			Guards: []string{"has_history"}, apply: applyRollback,
+		},
+		{
+			Action: "update_dates", Label: "Ubah tanggal",
+			apply: applyUpdateDates,
+		},
+	}
+}
+
+type workflowError struct {
+	Status  int
+	Message string
+}
+
+func (e *workflowError) Error() string { return e.Message }
+
+func workflowErrorf(status int, format string, args ...interface{}) error {
+	return &workflowError{Status: status, Message: fmt.Sprintf(format, args...)}
+}
+
+// transferRequest adalah input transisi, dari /panels/{no_pp}/transfer atau
+// satu baris mass transfer.
+type transferRequest struct {
+	Action        string
+	Actor         string
+	Slot          string
+	Vendor        string
+	NewVendorRole string
+	TargetWiring  *time.Time
+	Dates         map[string]*time.Time // start_date, production_date, fat_date, all_done_date
+}
+
+func (r transferRequest) date(name string) *time.Time {
+	if t := r.Dates[name]; t != nil && !t.IsZero() {
+		return t
+	}
+	return nil
+}
+
+type workflowPanel struct {
+	NoPp           string
+	NoWbs          string
+	NoPanel        string
+	PanelType      string
+	State          string
+	ProductionSlot *string
+	TargetDelivery *time.Time
+	History        []map[string]interface{}
+}
+
+func (p *workflowPanel) slot() string {
+	if p.ProductionSlot == nil {
+		return ""
+	}
+	return *p.ProductionSlot
+}
+
+func normalizeWorkflowState(status string) string {
+	if status == "" {
+		return defaultWorkflowState
+	}
+	for _, s := range workflowStates {
+		if s.Name == status {
+			return s.Name
+		}
+		for _, alias := range s.Aliases {
+			if alias == status {
+				return s.Name
+			}
+		}
+	}
+	return status
+}
+
+func findWorkflowTransition(action string) (workflowTransition, bool) {
+	for _, t := range workflowTransitions {
+		if t.Action == action {
+			return t, true
+		}
+	}
+	return workflowTransition{}, false
+}
+
+func (t workflowTransition) allowedFrom(state string) bool {
+	if len(t.From) == 0 {
+		return true
+	}
+	for _, s := range t.From {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+func loadWorkflowPanel(db DBTX, noPp string, forUpdate bool) (*workflowPanel, error) {
+	query := `SELECT no_pp, COALESCE(no_wbs, ''), COALESCE(no_panel, ''), COALESCE(panel_type, ''),
+			COALESCE(status_penyelesaian, ''), production_slot, target_delivery, history_stack
+		FROM panels WHERE no_pp = $1 AND deleted_at IS NULL`
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	var p workflowPanel
+	var historyJSON []byte
+	err := db.QueryRow(query, noPp).Scan(&p.NoPp, &p.NoWbs, &p.NoPanel, &p.PanelType, &p.State, &p.ProductionSlot, &p.TargetDelivery, &historyJSON)
+	if err == sql.ErrNoRows {
+		return nil, workflowErrorf(http.StatusNotFound, "Panel tidak ditemukan")
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.State = normalizeWorkflowState(p.State)
+	if len(historyJSON) > 0 {
+		json.Unmarshal(historyJSON, &p.History)
+	}
+	return &p, nil
+}
+
+// checkTransition memeriksa status asal dan semua guard transisi.
+func checkTransition(db DBTX, p *workflowPanel, t workflowTransition, req *transferRequest) error {
+	if !t.allowedFrom(p.State) {
+		return workflowErrorf(http.StatusConflict, "Aksi %s tidak bisa dilakukan dari status %s", t.Action, p.State)
+	}
+	for _, name := range t.Guards {
+		if err := workflowGuards[name].check(db, p, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runTransition menjalankan satu aksi workflow di dalam tx. Error bertipe
+// *workflowError membawa status HTTP yang sesuai.
+func runTransition(tx *sql.Tx, noPp string, req transferRequest) error {
+	t, ok := findWorkflowTransition(req.Action)
+	if !ok {
+		return workflowErrorf(http.StatusBadRequest, "Invalid action specified.")
+	}
+	p, err := loadWorkflowPanel(tx, noPp, true)
+	if err != nil {
+		return err
+	}
+	if err := checkTransition(tx, p, t, &req); err != nil {
+		return err
+	}
+
+	var history []byte
+	if t.To != "" {
+		snapshot, err := workflowSnapshot(tx, p, req, req.date(t.DateParam))
+		if err != nil {
+			return fmt.Errorf("gagal membuat snapshot: %w", err)
+		}
+		history, _ = json.Marshal(append(p.History, snapshot))
+	}
+	return t.apply(tx, p, req, history)
+}
+
+func workflowSnapshot(tx *sql.Tx, p *workflowPanel, req transferRequest, at *time.Time) (map[string]interface{}, error) {
+	var raw []byte
+	if err := tx.QueryRow("SELECT row_to_json(p) FROM panels p WHERE no_pp = $1", p.NoPp).Scan(&raw); err != nil {
+		return nil, err
+	}
+	var state map[string]interface{}
+	json.Unmarshal(raw, &state)
+	// history_stack tidak ikut disimpan supaya snapshot tidak bersarang.
+	delete(state, "history_stack")
+
+	ts := time.Now()
+	if at != nil {
+		ts = *at
+	}
+	return map[string]interface{}{
+		"timestamp":       ts.UTC().Format(time.RFC3339),
+		"snapshot_status": p.State,
+		"actor":           req.Actor,
+		"action":          req.Action,
+		"state":           state,
+	}, nil
+}
+
+func guardSlotAvailable(db DBTX, p *workflowPanel, req *transferRequest) error {
+	if req == nil || req.Slot == "" {
+		return nil
+	}
+	// Baris slot dikunci sampai transaksi transfer selesai supaya dua transfer
+	// bersamaan tidak bisa mengambil slot yang sama (lihat saveSlotReservation).
+	var occupied bool
+	var holder sql.NullString
+	err := db.QueryRow(`
+		SELECT ps.is_occupied, (SELECT no_pp FROM panels WHERE production_slot = ps.position_code AND no_pp <> $2 LIMIT 1)
+		FROM production_slots ps WHERE ps.position_code = $1
+		FOR UPDATE OF ps`, req.Slot, p.NoPp).Scan(&occupied, &holder)
+	if err == sql.ErrNoRows {
+		return workflowErrorf(http.StatusBadRequest, "Slot %s tidak terdaftar", req.Slot)
+	}
+	if err != nil {
+		return err
+	}
+	if holder.Valid {
+		return workflowErrorf(http.StatusConflict, "Slot %s sudah dipakai panel %s", req.Slot, holder.String)
+	}
+	if occupied && p.slot() != req.Slot {
+		return workflowErrorf(http.StatusConflict, "Slot %s sudah terisi", req.Slot)
+	}
+	start, end := productionWindow(today(), p.TargetDelivery)
+	conflicts, err := slotConflicts(db, req.Slot, start, end, p.NoPp, 0)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		c := conflicts[0]
+		holder := "reservasi lain"
+		if c.PanelNoPp != nil {
+			holder = "panel " + *c.PanelNoPp
+		}
+		return workflowErrorf(http.StatusConflict, "Slot %s sudah dipesan untuk %s (%s s.d. %s)", req.Slot, holder, c.StartDate, c.EndDate)
+	}
+	return nil
+}
+
+func guardWiringClosed(db DBTX, p *workflowPanel, req *transferRequest) error {
+	// Semua paket wiring yang aktif harus selesai.
+	var progress int
+	var status string
+	err := db.QueryRow("SELECT progress, status FROM panel_wiring_summary WHERE panel_no_pp = $1", p.NoPp).Scan(&progress, &status)
+	if err == sql.ErrNoRows {
+		return workflowErrorf(http.StatusBadRequest, "Data wiring tidak ditemukan. Panel harus melalui tahap Wiring dahulu.")
+	}
+	if err != nil {
+		return err
+	}
+	if progress < 100 || status != "Closed" {
+		return workflowErrorf(http.StatusBadRequest, "Gagal Transfer: Wiring baru %d%% (%s). Harus 100%% & Closed!", progress, status)
+	}
+	return nil
+}
+
+// closePartsSQL menutup status komponen vendor saat panel keluar dari
+// warehouse. Parameter pertama adalah closed_date default.
+const closePartsSQL = `status_component = 'Done', status_palet = 'Close', status_corepart = 'Close',
+	percent_progress = 100, is_closed = true, closed_date = COALESCE(closed_date, $1)`
+
+// resetWiring mengarsipkan paket wiring yang masih aktif lalu membuat paket
+// baru, sehingga riwayat wiring sebelum transfer ulang tetap tersimpan.
+func resetWiring(tx *sql.Tx, p *workflowPanel, supplier *string, target *time.Time) error {
+	if _, err := tx.Exec(`UPDATE wirings SET archived_at = NOW() WHERE panel_no_pp = $1 AND archived_at IS NULL`, p.NoPp); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+		INSERT INTO wirings (no_wbs, panel_no_pp, no_panel, panel_type, supplier, status, progress, target_delivery_wiring, package_name, updated_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, 'Open', 0, $6, $7, NOW(), NOW())`,
+		p.NoWbs, p.NoPp, p.NoPanel, p.PanelType, supplier, target, defaultWiringPackage)
+	if err != nil {
+		return fmt.Errorf("gagal membuat wiring: %w", err)
+	}
+	return nil
+}
+
+func transitionTime(req transferRequest, param string) time.Time {
+	if t := req.date(param); t != nil {
+		return *t
+	}
+	return time.Now()
+}
+
+func applyToProduction(tx *sql.Tx, p *workflowPanel, req transferRequest, history []byte) error {
+	if err := resetWiring(tx, p, nil, req.TargetWiring); err != nil {
+		return err
+	}
+	var slot *string
+	if req.Slot != "" {
+		slot = &req.Slot
+	}
+	_, err := tx.Exec(`UPDATE panels SET `+closePartsSQL+`,
+		status_penyelesaian = 'Production', production_slot = $2, history_stack = $3
+		WHERE no_pp = $4`, transitionTime(req, "production_date"), slot, history, p.NoPp)
+	if err != nil {
+		return fmt.Errorf("gagal transfer ke produksi: %w", err)
+	}
+	if p.slot() != req.Slot {
+		if err := vacateSlot(tx, p.slot(), p.NoPp, req.Actor, req.Action); err != nil {
+			return err
+		}
+	}
+	_, end := productionWindow(today(), p.TargetDelivery)
+	return occupySlot(tx, req.Slot, p.NoPp, req.Actor, end)
+}
+
+// resolveSubcontractor mencari vendor berdasarkan id atau nama. Vendor yang
+// belum ada dibuat dengan role newRole (default g3).
+func resolveSubcontractor(tx *sql.Tx, input, newRole string) (string, error) {
+	var id string
+	err := tx.QueryRow("SELECT id FROM companies WHERE id = $1 OR name = $1 ORDER BY (id = $1) DESC LIMIT 1", input).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", fmt.Errorf("gagal memvalidasi vendor: %w", err)
+	}
+	if newRole == "" {
+		newRole = AppRoleG3
+	}
+	id = strings.ToLower(strings.ReplaceAll(input, " ", "_"))
+	_, err = tx.Exec("INSERT INTO companies (id, name, role) VALUES ($1, $2, $3) ON CONFLICT (id) DO NOTHING", id, input, newRole)
+	if err != nil {
+		return "", fmt.Errorf("gagal membuat vendor baru: %w", err)
+	}
+	return id, nil
+}
+
+func applyToSubcontractor(tx *sql.Tx, p *workflowPanel, req transferRequest, history []byte) error {
+	vendor, err := resolveSubcontractor(tx, strings.TrimSpace(req.Vendor), req.NewVendorRole)
+	if err != nil {
+		return err
+	}
+	if err := resetWiring(tx, p, &vendor, req.TargetWiring); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM g3_vendors WHERE panel_no_pp = $1`, p.NoPp); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO g3_vendors (panel_no_pp, vendor) VALUES ($1, $2) ON CONFLICT DO NOTHING`, p.NoPp, vendor); err != nil {
+		return fmt.Errorf("gagal assign G3 vendor: %w", err)
+	}
+	_, err = tx.Exec(`UPDATE panels SET `+closePartsSQL+`,
+		status_penyelesaian = 'Subcontractor', production_slot = NULL, history_stack = $2
+		WHERE no_pp = $3`, transitionTime(req, "production_date"), history, p.NoPp)
+	if err != nil {
+		return fmt.Errorf("gagal transfer ke subkontraktor: %w", err)
+	}
+	return vacateSlot(tx, p.slot(), p.NoPp, req.Actor, req.Action)
+}
+
+func applyToFAT(tx *sql.Tx, p *workflowPanel, req transferRequest, history []byte) error {
+	_, err := tx.Exec("UPDATE panels SET status_penyelesaian = 'FAT', production_slot = NULL, history_stack = $1 WHERE no_pp = $2", history, p.NoPp)
+	if err != nil {
+		return fmt.Errorf("gagal transfer ke FAT: %w", err)
+	}
+	return vacateSlot(tx, p.slot(), p.NoPp, req.Actor, req.Action)
+}
+
+func applyToDone(tx *sql.Tx, p *workflowPanel, req transferRequest, history []byte) error {
+	_, err := tx.Exec("UPDATE panels SET status_penyelesaian = 'Done', history_stack = $1 WHERE no_pp = $2", history, p.NoPp)
+	if err != nil {
+		return fmt.Errorf("gagal transfer ke Done: %w", err)
+	}
+	return nil
+}
+
+// Kolom yang tidak dikembalikan saat rollback. project_id/wbs_id diturunkan
+// ulang oleh trigger dari teks project/no_wbs.
+var rollbackSkipColumns = map[string]bool{
+	"no_pp": true, "history_stack": true, "snapshot_status": true,
+	"version": true, "deleted_at": true, "deleted_by": true,
+	"project_id": true, "wbs_id": true,
+}
+
+func applyRollback(tx *sql.Tx, p *workflowPanel, req transferRequest, _ []byte) error {
+	last := p.History[len(p.History)-1]
+	history, _ := json.Marshal(p.History[:len(p.History)-1])
+	state, _ := last["state"].(map[string]interface{})
+
+	var sets []string
+	var values []interface{}
+	arg := func(v interface{}) string {
+		values = append(values, v)
+		return fmt.Sprintf("$%d", len(values))
+	}
+	if _, full := state["no_pp"]; full {
+		for col, val := range state {
+			if rollbackSkipColumns[col] {
+				continue
+			}
+			sets = append(sets, pq.QuoteIdentifier(col)+" = "+arg(val))
+		}
+	} else {
+		// Snapshot lama dari mass transfer hanya menyimpan status.
+		status, _ := last["snapshot_status"].(string)
+		sets = append(sets, "status_penyelesaian = "+arg(status))
+	}
+	sets = append(sets, "history_stack = "+arg(history))
+
+	var restoredSlot *string
+	query := fmt.Sprintf("UPDATE panels SET %s WHERE no_pp = %s RETURNING production_slot", strings.Join(sets, ", "), arg(p.NoPp))
+	if err := tx.QueryRow(query, values...).Scan(&restoredSlot); err != nil {
+		return fmt.Errorf("gagal mengembalikan panel dari history: %w", err)
+	}
+
+	restored := ""
+	if restoredSlot != nil {
+		restored = *restoredSlot
+	}
+	if restored == p.slot() {
+		return nil
+	}
+	if err := vacateSlot(tx, p.slot(), p.NoPp, req.Actor, req.Action); err != nil {
+		return err
+	}
+	_, end := productionWindow(today(), p.TargetDelivery)
+	return occupySlot(tx, restored, p.NoPp, req.Actor, end)
+}
+
+// workflowMilestones membaca history_stack dan mengembalikan tanggal panel
+// masuk Production, FAT dan Done. Timestamp snapshot berstatus X adalah waktu
+// panel meninggalkan X; snapshot yang lebih baru menimpa yang lama.
+func workflowMilestones(raw []byte) (production, fat, done *time.Time) {
+	var history []map[string]interface{}
+	if raw == nil || json.Unmarshal(raw, &history) != nil {
+		return nil, nil, nil
+	}
+	for _, item := range history {
+		status, _ := item["snapshot_status"].(string)
+		timestamp, _ := item["timestamp"].(string)
+		ts, err := time.Parse(time.RFC3339, timestamp)
+		if status == "" || err != nil {
+			continue
+		}
+		switch normalizeWorkflowState(status) {
+		case "Vendor K3", "VendorWarehouse":
+			production = &ts
+		case "Production", "Subcontractor":
+			fat = &ts
+		case "FAT":
+			done = &ts
+		}
+	}
+	return production, fat, done
+}
+
+// applyUpdateDates mengubah start_date dan timestamp history tanpa
+// mengubah status.
+func applyUpdateDates(tx *sql.Tx, p *workflowPanel, req transferRequest, _ []byte) error {
+	var sets []string
+	var values []interface{}
+	if t := req.date("start_date"); t != nil {
+		values = append(values, *t)
+		sets = append(sets, fmt.Sprintf("start_date = $%d", len(values)))
+	}
+
+	// Timestamp snapshot berstatus X adalah waktu panel meninggalkan X.
+	leaving := map[string]string{
+		"Vendor K3":       "production_date",
+		"VendorWarehouse": "production_date",
+		"Production":      "fat_date",
+		"Subcontractor":   "fat_date",
+		"FAT":             "all_done_date",
+	}
+	changed := false
+	for i, item := range p.History {
+		status, _ := item["snapshot_status"].(string)
+		if t := req.date(leaving[normalizeWorkflowState(status)]); t != nil {
+			p.History[i]["timestamp"] = t.UTC().Format(time.RFC3339)
+			changed = true
+		}
+	}
+	if changed {
+		history, _ := json.Marshal(p.History)
+		values = append(values, history)
+		sets = append(sets, fmt.Sprintf("history_stack = $%d", len(values)))
+	}
+	if len(sets) == 0 {
+		return nil
+	}
+	values = append(values, p.NoPp)
+	_, err := tx.Exec(fmt.Sprintf("UPDATE panels SET %s WHERE no_pp = $%d", strings.Join(sets, ", "), len(values)), values...)
+	if err != nil {
+		return fmt.Errorf("gagal update tanggal: %w", err)
+	}
+	return nil
+}
+
+// parseTransferDate menerima RFC3339, 2006-01-02 atau 02/01/2006.
+func parseTransferDate(value *string) *time.Time {
+	if value == nil || strings.TrimSpace(*value) == "" {
+		return nil
+	}
+	v := strings.TrimSpace(*value)
+	for _, layout := range []string{time.RFC3339, "2006-01-02", "02/01/2006"} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return &t
+		}
+	}
+	log.Printf("[WARN] Gagal parse tanggal transfer: %s", v)
+	return nil
+}
+
+func respondWorkflowError(w http.ResponseWriter, err error) {
+	if we, ok := err.(*workflowError); ok {
+		respondWithError(w, we.Status, we.Message)
+		return
+	}
+	respondWithError(w, http.StatusInternalServerError, err.Error())
+}
+
+type workflowGuardInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+func (a *App) getWorkflowHandler(w http.ResponseWriter, r *http.Request) {
+	type transitionInfo struct {
+		workflowTransition
+		Guards []workflowGuardInfo `json:"guards,omitempty"`
+	}
+	transitions := make([]transitionInfo, 0, len(workflowTransitions))
+	for _, t := range workflowTransitions {
+		info := transitionInfo{workflowTransition: t}
+		for _, name := range t.Guards {
+			info.Guards = append(info.Guards, workflowGuardInfo{name, workflowGuards[name].Description})
+		}
+		transitions = append(transitions, info)
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"initial_state": defaultWorkflowState,
+		"states":        workflowStates,
+		"transitions":   transitions,
+	})
+}
+
+// getPanelWorkflowHandler mengembalikan status panel saat ini beserta aksi
+// yang tersedia. Guard yang bergantung pada isi request (slot, vendor)
+// baru diperiksa saat transfer dijalankan.
+func (a *App) getPanelWorkflowHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := loadWorkflowPanel(a.DB, mux.Vars(r)["no_pp"], false)
+	if err != nil {
+		respondWorkflowError(w, err)
+		return
+	}
+
+	type actionInfo struct {
+		Action   string   `json:"action"`
+		Label    string   `json:"label"`
+		To       string   `json:"to,omitempty"`
+		Requires []string `json:"requires,omitempty"`
+		Allowed  bool     `json:"allowed"`
+		Reason   string   `json:"reason,omitempty"`
+	}
+	actions := []actionInfo{}
+	for _, t := range workflowTransitions {
+		info := actionInfo{Action: t.Action, Label: t.Label, To: t.To, Requires: t.Requires, Allowed: true}
+		if err := checkTransition(a.DB, p, t, nil); err != nil {
+			if _, ok := err.(*workflowError); !ok {
+				respondWithError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			info.Allowed, info.Reason = false, err.Error()
+		}
+		actions = append(actions, info)
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"no_pp":   p.NoPp,
+		"state":   p.State,
+		"actions": actions,
+	})
+}